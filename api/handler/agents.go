@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/compliance-framework/framework/api"
+	"github.com/compliance-framework/framework/domain"
+	"github.com/compliance-framework/framework/service"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type AgentsHandler struct {
+	service *service.AgentService
+	sugar   *zap.SugaredLogger
+}
+
+func (h *AgentsHandler) Register(api *echo.Group) {
+	api.GET("", h.GetAgents)
+	api.GET("/:id", h.GetAgent)
+}
+
+func NewAgentsHandler(l *zap.SugaredLogger, s *service.AgentService) *AgentsHandler {
+	return &AgentsHandler{
+		sugar:   l,
+		service: s,
+	}
+}
+
+// GetAgents godoc
+//
+//	@Summary		List agents
+//	@Description	Returns every agent which has registered, including when it was last heard from, and whether its heartbeats have stopped
+//	@Tags			Agent
+//	@Produce		json
+//	@Success		200	{object}	handler.GenericDataListResponse[domain.Agent]
+//	@Failure		500	{object}	api.Error
+//	@Router			/agents [get]
+func (h *AgentsHandler) GetAgents(c echo.Context) error {
+	agents, err := h.service.List(c.Request().Context())
+	if err != nil {
+		h.sugar.Error(err)
+		return c.JSON(http.StatusInternalServerError, api.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, GenericDataListResponse[*domain.Agent]{
+		Data: agents,
+	})
+}
+
+// GetAgent godoc
+//
+//	@Summary		Get an agent
+//	@Description	Returns an agent's version, host, plugins and policies, and the status of its last run
+//	@Tags			Agent
+//	@Produce		json
+//	@Param			id	path		string	true	"Agent ID"
+//	@Success		200	{object}	handler.GenericDataResponse[domain.Agent]
+//	@Failure		404	{object}	api.Error
+//	@Failure		500	{object}	api.Error
+//	@Router			/agents/{id} [get]
+func (h *AgentsHandler) GetAgent(c echo.Context) error {
+	agent, err := h.service.Get(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrAgentNotFound) {
+			return c.JSON(http.StatusNotFound, api.NewError(err))
+		}
+		h.sugar.Error(err)
+		return c.JSON(http.StatusInternalServerError, api.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, GenericDataResponse[*domain.Agent]{
+		Data: agent,
+	})
+}
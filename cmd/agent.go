@@ -1,56 +1,181 @@
 package cmd
 
 import (
+	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	runner2 "github.com/compliance-framework/framework/runner"
 	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"io"
 	"log"
+	"maps"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path"
+	"reflect"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/compliance-framework/framework/domain"
 	"github.com/compliance-framework/framework/internal"
+	"github.com/compliance-framework/framework/internal/artifact"
 	"github.com/compliance-framework/framework/internal/event"
-	"github.com/compliance-framework/gooci/pkg/oci"
+	"github.com/compliance-framework/framework/internal/host"
+	"github.com/compliance-framework/framework/internal/retry"
+	"github.com/compliance-framework/framework/internal/sandbox"
+	"github.com/compliance-framework/framework/internal/scheduler"
+	"github.com/compliance-framework/framework/internal/secret"
+	"github.com/compliance-framework/framework/internal/signature"
+	"github.com/compliance-framework/framework/internal/telemetry"
 	"github.com/coreos/go-systemd/v22/daemon"
 	"github.com/fsnotify/fsnotify"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin"
+	"github.com/mitchellh/mapstructure"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type natsConfig struct {
 	Url string `json:"url"`
 }
 
-type agentPolicy string
+// outboxConfig configures where results are stored until they are acknowledged by NATS.
+// Changes to the outbox configuration take effect when the agent is restarted.
+type outboxConfig struct {
+	Path string `mapstructure:"path"`
+	// MaxSize is the maximum total size in bytes of results held in the outbox. Once it is exceeded,
+	// the oldest results are dropped.
+	MaxSize int64 `mapstructure:"max_size"`
+	// MaxAge is how long results are held in the outbox before they are dropped.
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+// agentPolicy is a policy bundle evaluated by a plugin. In configuration, it can either be given as just its
+// source, or as a map including the checksum required for HTTP(S) sources.
+type agentPolicy struct {
+	Source string `mapstructure:"source"`
+	Sha256 string `mapstructure:"sha256"`
+}
+
+// policyDecodeHook allows policies to be configured as just their source.
+func policyDecodeHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(agentPolicy{}) || from.Kind() != reflect.String {
+		return data, nil
+	}
+	return agentPolicy{Source: data.(string)}, nil
+}
 
 type agentPluginConfig map[string]string
 
 type agentPlugin struct {
-	Source   string            `mapstructure:"source"`
+	Source string `mapstructure:"source"`
+	// Sha256 is the checksum of the plugin, which is required for HTTP(S) sources.
+	Sha256   string            `mapstructure:"sha256"`
 	Policies []agentPolicy     `mapstructure:"policies"`
 	Config   agentPluginConfig `mapstructure:"config"`
 	Labels   map[string]string `mapstructure:"labels"`
+
+	// Schedule is a cron expression (or descriptor such as `@daily` or `@every 5m`) describing
+	// how often the plugin should be run against each of its policies when running as a daemon.
+	Schedule string `mapstructure:"schedule"`
+	// Jitter is the maximum random delay added before each scheduled run.
+	Jitter time.Duration `mapstructure:"jitter"`
+	// Timeout is the maximum time a single run of the plugin may take, across configuring,
+	// preparing and evaluating all of its policies.
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// VersionedStreams starts a new result stream whenever the plugin or policy version changes. By default,
+	// results continue the same stream across versions, so compliance history is kept through upgrades.
+	VersionedStreams bool `mapstructure:"versioned_streams"`
+
+	// Sandbox runs the plugin with restricted privileges and resources, on Linux.
+	Sandbox *sandboxConfig `mapstructure:"sandbox"`
+
+	// MaxRuns is how many runs a plugin process is reused for before it is restarted. By default, processes
+	// are reused until the plugin changes or crashes, and 1 starts a new process for every run.
+	MaxRuns int `mapstructure:"max_runs"`
+
+	// Retry retries the plugin when it fails. By default, failures aren't retried until the next scheduled run.
+	Retry *retryConfig `mapstructure:"retry"`
+	// CircuitBreaker pauses the plugin after it fails repeatedly.
+	CircuitBreaker *circuitBreakerConfig `mapstructure:"circuit_breaker"`
+
+	// fromPlan is set for plugins configured by assessment plans, rather than the config file.
+	fromPlan bool
+}
+
+// schedule returns the configured schedule for the plugin, or the default schedule if none was set.
+func (ap *agentPlugin) schedule() string {
+	if ap.Schedule == "" {
+		return DefaultPluginSchedule
+	}
+	return ap.Schedule
+}
+
+// timeout returns the configured timeout for the plugin, or the default timeout if none was set.
+func (ap *agentPlugin) timeout() time.Duration {
+	if ap.Timeout == 0 {
+		return DefaultPluginTimeout
+	}
+	return ap.Timeout
 }
 
 type agentConfig struct {
-	Daemon    bool                    `mapstructure:"daemon"`
-	Verbosity int32                   `mapstructure:"verbosity"`
-	Nats      *natsConfig             `mapstructure:"nats"`
-	Plugins   map[string]*agentPlugin `mapstructure:"plugins"`
+	Daemon      bool                    `mapstructure:"daemon"`
+	Verbosity   int32                   `mapstructure:"verbosity"`
+	Concurrency int                     `mapstructure:"concurrency"`
+	Nats        *natsConfig             `mapstructure:"nats"`
+	Outbox      *outboxConfig           `mapstructure:"outbox"`
+	Plugins     map[string]*agentPlugin `mapstructure:"plugins"`
+
+	// PluginCache configures where the persistent caches plugins use through host services are kept.
+	PluginCache *pluginCacheConfig `mapstructure:"plugin_cache"`
+
+	// GracePeriod is how long running plugins are given to finish when the agent is asked to stop,
+	// before they are cancelled.
+	GracePeriod time.Duration `mapstructure:"grace_period"`
+
+	// ResultChunkSize is the most observations, findings, risks and log entries published in a single result.
+	// Larger results are split into several results on the same stream. If it is zero, results aren't split.
+	ResultChunkSize int `mapstructure:"result_chunk_size"`
+
+	// TrustedKeys are paths to public keys which plugins and policies must be signed by.
+	// If none are configured, signatures are not checked.
+	TrustedKeys []string `mapstructure:"trusted_keys"`
+
+	// Health configures an HTTP listener for health checks and metrics.
+	Health *healthConfig `mapstructure:"health"`
+
+	// Labels describe the agent. Activities in assessment plans run on the agent if their subject
+	// selection matches these labels.
+	Labels map[string]string `mapstructure:"labels"`
+
+	// DisableCloudMetadata stops the agent querying cloud instance metadata endpoints for host facts.
+	DisableCloudMetadata bool `mapstructure:"disable_cloud_metadata"`
+
+	// Id identifies the agent to the API. By default, it is derived from the hostname and config file path.
+	Id string `mapstructure:"id"`
+	// HeartbeatInterval is how often the agent publishes a heartbeat.
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+
+	// Telemetry configures tracing of plugin runs.
+	Telemetry *telemetryConfig `mapstructure:"telemetry"`
 }
 
 // logVerbosity reverses our verbosity "increase" to hclog's reversed "decrease."
@@ -61,6 +186,83 @@ func (ac *agentConfig) logVerbosity() int32 {
 	return int32(hclog.Info) - ac.Verbosity
 }
 
+// concurrency returns the maximum number of plugins which may run at the same time.
+func (ac *agentConfig) concurrency() int {
+	if ac.Concurrency == 0 {
+		return DefaultConcurrency
+	}
+	return ac.Concurrency
+}
+
+// gracePeriod returns how long running plugins are given to finish when the agent shuts down.
+func (ac *agentConfig) gracePeriod() time.Duration {
+	if ac.GracePeriod == 0 {
+		return DefaultGracePeriod
+	}
+	return ac.GracePeriod
+}
+
+// heartbeatInterval returns how often the agent publishes a heartbeat.
+func (ac *agentConfig) heartbeatInterval() time.Duration {
+	if ac.HeartbeatInterval == 0 {
+		return DefaultHeartbeatInterval
+	}
+	return ac.HeartbeatInterval
+}
+
+// outboxOptions returns the options for the results outbox, stored in the user's home directory by default.
+func (ac *agentConfig) outboxOptions() (event.OutboxOptions, error) {
+	opts := event.OutboxOptions{}
+	if ac.Outbox != nil {
+		opts.Dir = ac.Outbox.Path
+		opts.MaxSize = ac.Outbox.MaxSize
+		opts.MaxAge = ac.Outbox.MaxAge
+	}
+
+	if opts.Dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return opts, fmt.Errorf("could not determine outbox path: %w", err)
+		}
+		opts.Dir = path.Join(home, AgentOutboxDir)
+	}
+
+	return opts, nil
+}
+
+// verifier returns a verifier for the configured trusted keys, or nil if signatures should not be checked.
+func (ac *agentConfig) verifier() (*signature.Verifier, error) {
+	if len(ac.TrustedKeys) == 0 {
+		return nil, nil
+	}
+
+	keys := []ed25519.PublicKey{}
+	for _, keyPath := range ac.TrustedKeys {
+		key, err := signature.LoadPublicKey(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading trusted key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return signature.NewVerifier(keys...), nil
+}
+
+// ociSources returns every OCI plugin and policy source in the configuration.
+func (ac *agentConfig) ociSources() []string {
+	sources := []string{}
+	for _, pluginConfig := range ac.Plugins {
+		if internal.IsOCI(pluginConfig.Source) {
+			sources = append(sources, pluginConfig.Source)
+		}
+		for _, policy := range pluginConfig.Policies {
+			if internal.IsOCI(policy.Source) {
+				sources = append(sources, policy.Source)
+			}
+		}
+	}
+	return sources
+}
+
 func (ac *agentConfig) validate() error {
 	if ac.Nats == nil {
 		return fmt.Errorf("no nats configuration available in config file")
@@ -70,16 +272,146 @@ func (ac *agentConfig) validate() error {
 		return fmt.Errorf("invalid nats url: %s", ac.Nats.Url)
 	}
 
-	if len(ac.Plugins) == 0 {
+	// A daemon may be configured entirely by the assessment plans it receives.
+	if len(ac.Plugins) == 0 && !ac.Daemon {
 		return fmt.Errorf("no plugins specified in config")
 	}
 
+	return ac.validatePlugins()
+}
+
+// validatePlugins checks everything needed to run the configured plugins, which is everything but the NATS
+// configuration, so configurations can be evaluated locally without NATS.
+func (ac *agentConfig) validatePlugins() error {
+	if ac.Concurrency < 0 {
+		return fmt.Errorf("concurrency cannot be negative: %d", ac.Concurrency)
+	}
+
+	if ac.GracePeriod < 0 {
+		return fmt.Errorf("grace period cannot be negative: %s", ac.GracePeriod)
+	}
+
+	if ac.ResultChunkSize < 0 {
+		return fmt.Errorf("result chunk size cannot be negative: %d", ac.ResultChunkSize)
+	}
+
+	if ac.HeartbeatInterval < 0 {
+		return fmt.Errorf("heartbeat interval cannot be negative: %s", ac.HeartbeatInterval)
+	}
+
+	if ac.Outbox != nil {
+		if ac.Outbox.MaxSize < 0 {
+			return fmt.Errorf("outbox max size cannot be negative: %d", ac.Outbox.MaxSize)
+		}
+		if ac.Outbox.MaxAge < 0 {
+			return fmt.Errorf("outbox max age cannot be negative: %s", ac.Outbox.MaxAge)
+		}
+	}
+
+	if ac.Health != nil {
+		if ac.Health.Address != "" {
+			if _, _, err := net.SplitHostPort(ac.Health.Address); err != nil {
+				return fmt.Errorf("invalid health address %q: %w", ac.Health.Address, err)
+			}
+		}
+		if ac.Health.MaxRunAge < 0 {
+			return fmt.Errorf("health max run age cannot be negative: %s", ac.Health.MaxRunAge)
+		}
+	}
+
+	if err := ac.Telemetry.options().Validate(); err != nil {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+
+	if _, err := ac.verifier(); err != nil {
+		return err
+	}
+
+	for pluginName, pluginConfig := range ac.Plugins {
+		if _, err := scheduler.Parse(pluginConfig.schedule()); err != nil {
+			return fmt.Errorf("plugin %s: %w", pluginName, err)
+		}
+
+		if pluginConfig.Jitter < 0 {
+			return fmt.Errorf("plugin %s: jitter cannot be negative: %s", pluginName, pluginConfig.Jitter)
+		}
+
+		if pluginConfig.Timeout < 0 {
+			return fmt.Errorf("plugin %s: timeout cannot be negative: %s", pluginName, pluginConfig.Timeout)
+		}
+
+		if artifact.IsHTTP(pluginConfig.Source) {
+			if err := artifact.ValidateChecksum(pluginConfig.Sha256); err != nil {
+				return fmt.Errorf("plugin %s: %w", pluginName, err)
+			}
+		}
+
+		if err := pluginConfig.validateSecrets(); err != nil {
+			return fmt.Errorf("plugin %s: %w", pluginName, err)
+		}
+
+		if pluginConfig.Sandbox != nil {
+			if err := pluginConfig.Sandbox.options().Validate(); err != nil {
+				return fmt.Errorf("plugin %s: sandbox: %w", pluginName, err)
+			}
+		}
+
+		if pluginConfig.MaxRuns < 0 {
+			return fmt.Errorf("plugin %s: max runs cannot be negative: %d", pluginName, pluginConfig.MaxRuns)
+		}
+
+		if err := pluginConfig.validateRetries(); err != nil {
+			return fmt.Errorf("plugin %s: %w", pluginName, err)
+		}
+
+		for _, policy := range pluginConfig.Policies {
+			if policy.Source == "" {
+				return fmt.Errorf("plugin %s: policy source cannot be empty", pluginName)
+			}
+			if artifact.IsHTTP(policy.Source) {
+				if err := artifact.ValidateChecksum(policy.Sha256); err != nil {
+					return fmt.Errorf("plugin %s: policy %s: %w", pluginName, policy.Source, err)
+				}
+			}
+		}
+	}
+
 	return nil
 }
 
 const AgentPluginDir = ".compliance-framework/plugins"
 const AgentPolicyDir = ".compliance-framework/policies"
 
+// AgentOutboxDir is where results are stored until they have been published, relative to the user's home directory.
+const AgentOutboxDir = ".compliance-framework/outbox"
+
+// AgentResultTopic is the NATS topic results are published to.
+const AgentResultTopic = "job.result"
+
+// DefaultPluginSchedule is used for plugins which do not specify a schedule.
+const DefaultPluginSchedule = "@every 60s"
+
+// DefaultPluginTimeout is used for plugins which do not specify a timeout.
+const DefaultPluginTimeout = 10 * time.Minute
+
+// DefaultConcurrency is the number of plugins which may run at the same time, if not otherwise configured.
+const DefaultConcurrency = 4
+
+// DefaultGracePeriod is how long running plugins are given to finish when the agent shuts down, if not otherwise configured.
+const DefaultGracePeriod = 30 * time.Second
+
+// DefaultHeartbeatInterval is how often the agent publishes a heartbeat, if not otherwise configured.
+const DefaultHeartbeatInterval = domain.DefaultAgentHeartbeatInterval
+
+// artifactDownloadTimeout is the maximum time allowed for downloading a single HTTP(S) artifact.
+const artifactDownloadTimeout = 10 * time.Minute
+
+// artifactCacheSubdir is the directory HTTP(S) artifacts are cached in, within the plugin and policy directories.
+const artifactCacheSubdir = "sha256"
+
+// natsFlushTimeout is how long we wait for pending results to be published when the agent shuts down.
+const natsFlushTimeout = 10 * time.Second
+
 func AgentCmd() *cobra.Command {
 	var agentCmd = &cobra.Command{
 		Use:   "agent",
@@ -98,6 +430,9 @@ with plugins to ensure continuous compliance.`,
 	agentCmd.Flags().StringP("config", "c", "", "Location of config file")
 	agentCmd.MarkFlagRequired("config")
 
+	agentCmd.AddCommand(AgentEvalCmd())
+	agentCmd.AddCommand(AgentSandboxExecCmd())
+
 	return agentCmd
 }
 
@@ -133,8 +468,18 @@ func mergeConfig(cmd *cobra.Command, fileConfig *viper.Viper) (*agentConfig, err
 		}
 	}
 
+	return decodeConfig(fileConfig)
+}
+
+// decodeConfig decodes the agent configuration from v.
+func decodeConfig(v *viper.Viper) (*agentConfig, error) {
 	config := &agentConfig{}
-	err := fileConfig.Unmarshal(config)
+	err := v.Unmarshal(config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		// The defaults used by viper
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		policyDecodeHook,
+	)))
 	if err != nil {
 		return nil, err
 	}
@@ -162,6 +507,10 @@ func agentRunner(cmd *cobra.Command, args []string) error {
 	v.SetConfigFile(configPath)
 	v.AutomaticEnv()
 
+	// Host facts are collected once, when the configuration is first loaded, as querying cloud metadata
+	// can take a while outside a cloud.
+	var facts host.Facts
+
 	loadConfig := func() (*agentConfig, error) {
 		err := v.ReadInConfig()
 		if err != nil {
@@ -173,6 +522,14 @@ func agentRunner(cmd *cobra.Command, args []string) error {
 			return nil, err
 		}
 
+		if facts == nil {
+			facts = config.hostFacts(cmd.Context())
+		}
+		err = config.render(facts)
+		if err != nil {
+			return nil, err
+		}
+
 		err = config.validate()
 		if err != nil {
 			return nil, err
@@ -185,56 +542,85 @@ func agentRunner(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Secrets are redacted from everything the agent and its plugins log.
+	secrets := secret.NewRedactor()
 	logger := hclog.New(&hclog.LoggerOptions{
 		Name:   "agent",
-		Output: os.Stdout,
+		Output: secrets.Writer(os.Stdout),
 		Level:  hclog.Level(config.logVerbosity()),
 	})
 
+	stopTelemetry, err := config.setupTelemetry(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer stopTelemetry()
+
+	natsBus := event.NewNatsBus(logger)
+	natsBus.UseRedactor(secrets.Redact)
+
+	lock, err := artifact.LoadLock(lockPath(configPath))
+	if err != nil {
+		return err
+	}
+
+	agentId, err := config.agentId(configPath)
+	if err != nil {
+		return err
+	}
+
 	agentRunner := AgentRunner{
 		logger:          logger,
 		config:          *config,
-		natsBus:         event.NewNatsBus(logger),
+		localConfig:     *config,
+		natsBus:         natsBus,
+		secrets:         secrets,
+		agentId:         agentId,
+		started:         time.Now(),
+		hostFacts:       facts,
+		status:          newAgentStatus(),
+		lock:            lock,
 		pluginLocations: map[string]string{},
 		policyLocations: map[string]string{},
+		pluginVersions:  map[string]string{},
+		policyVersions:  map[string]string{},
+		scheduler:       scheduler.New(logger.Named("scheduler")),
+		workers:         make(chan struct{}, config.concurrency()),
+		configSettings:  v.AllSettings(),
 	}
+	agentRunner.health.Store(config.Health)
 
 	v.OnConfigChange(func(in fsnotify.Event) {
-		// We want to wait for any running agent processes to finish first.
 		logger.Debug("config file changed", "path", in.Name)
-		logger.Debug("waiting for lock to update configurations")
-		agentRunner.mu.Lock()
-		logger.Debug("received lock to update configurations")
-		defer agentRunner.mu.Unlock()
-
-		// When the config changes, if this gives us an error, it's likely due to the config being invalid.
-		// This will exit the whole process of the agent. This might not be ideal.
-		// Maybe a better strategy here is to re-use the old config and log an error, so the process can continue
-		// until the config is fixed ?
+
+		// If the new configuration is invalid in any way, we keep running with the previous one
+		// until it is fixed, rather than stopping the agent.
 		config, err := loadConfig()
-		if err != nil {
-			logger.Error("Error downloading plugins", "error", err)
-			panic(err)
+		if err == nil {
+			err = agentRunner.reloadConfig(config, v.AllSettings())
 		}
-
-		agentRunner.config = *config
-
-		err = agentRunner.DownloadPlugins()
-
 		if err != nil {
-			logger.Error("Error downloading plugins", "error", err)
-			panic(err)
+			agentRunner.rejectConfig(in.Name, v.AllSettings(), err)
+			return
 		}
-		logger.Debug("Successfully reloaded configuration")
+
+		logger.Info("Successfully reloaded configuration", "path", in.Name)
 	})
 	v.WatchConfig()
 
-	err = agentRunner.Run()
+	// The first signal starts a graceful shutdown. After that, signals are handled as normal,
+	// so a second signal stops the agent immediately.
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	defer stop()
+
+	err = agentRunner.Run(ctx)
 
 	// Don't return the error as that will cause it to spit help out, which is no
 	// longer useful at this stage. Log the error and then exit
 	if err != nil {
 		logger.Error("Error running agent", "error", err)
+		stopTelemetry()
 		os.Exit(1)
 	}
 
@@ -244,26 +630,105 @@ func agentRunner(cmd *cobra.Command, args []string) error {
 type AgentRunner struct {
 	logger hclog.Logger
 
-	mu sync.Mutex
+	// mu protects the configuration and downloaded locations. It is only held briefly, to read or replace
+	// them, so runs, downloads and health checks don't wait on each other. Runs take what they need when
+	// they start, and look up downloaded locations as they go.
+	mu sync.RWMutex
+
+	// downloadMu serialises downloads of policies, which are retrieved without holding mu.
+	downloadMu sync.Mutex
+
+	// reloadMu serialises configuration changes, from both the config file and assessment plans.
+	reloadMu sync.Mutex
+
+	// config is the running configuration, including plugins from assessment plans.
+	config agentConfig
+	// localConfig is the configuration read from the config file.
+	localConfig agentConfig
+	// configSettings are the raw settings the running configuration was loaded from.
+	configSettings map[string]interface{}
+	// plans are the assessment plans received from the API, by plan id.
+	plans map[string]domain.JobSpecification
 
-	config  agentConfig
 	natsBus *event.NatsBus
+	// secrets redacts the secrets resolved from plugin config, and may be nil.
+	secrets *secret.Redactor
+
+	// agentId identifies the agent in its heartbeats and results.
+	agentId string
+	// started is when the agent started, reported in its heartbeats.
+	started time.Time
+	// hostFacts describe the host the agent runs on, and are added to every result as `_host.*` labels.
+	hostFacts host.Facts
+
+	// status tracks the agent's health, and exports metrics.
+	status *agentStatus
+	// health is the running configuration's health settings, which health checks read without ar.mu, so they
+	// answer while the configuration is locked.
+	health atomic.Pointer[healthConfig]
+
+	// lock pins the digest of every OCI plugin and policy tag.
+	lock *artifact.Lock
 
 	pluginLocations map[string]string
 	policyLocations map[string]string
 
+	// pluginVersions and policyVersions identify the content of each downloaded source, such as its digest.
+	pluginVersions map[string]string
+	policyVersions map[string]string
+
 	setupPluginTask   *internal.Task
 	setupPoliciesTask *internal.Task
 
+	scheduler *scheduler.Scheduler
+	// runCtx is the context scheduled runs are started with. It is cancelled when the daemon shuts down.
+	runCtx context.Context
+	// workers bounds the number of plugins running concurrently.
+	workers chan struct{}
+
+	// pool keeps plugin processes running between runs.
+	pool pluginPool
+
+	// breakers are the circuit breakers of plugins, by plugin name.
+	breakers   map[string]*retry.Breaker
+	breakersMu sync.Mutex
+
 	queryBundles []*rego.Rego
+
+	// collect, if set, receives results instead of them being published to NATS, such as when evaluating
+	// a configuration locally. It must be safe to call concurrently.
+	collect func(result *runner2.Result)
+	// logWriter is where plugin logs are written, defaulting to stdout.
+	logWriter io.Writer
 }
 
-func (ar *AgentRunner) Run() error {
+// Run connects to NATS, downloads plugins, and then runs them, either once or on their schedules as a daemon.
+//
+// When ctx is done, no new runs are started, and running plugins are given the configured grace period to
+// finish before they are cancelled. Pending results are flushed to NATS before Run returns.
+func (ar *AgentRunner) Run(ctx context.Context) error {
 	ar.logger.Info("Starting agent", "daemon", ar.config.Daemon, "nats_uri", ar.config.Nats.Url)
 
+	// Results are stored in the outbox until NATS has received them, so they aren't lost if NATS is
+	// unavailable, or the agent is restarted before they can be published.
+	outboxOptions, err := ar.config.outboxOptions()
+	if err != nil {
+		return err
+	}
+	outbox, err := event.NewOutbox(ar.logger.Named("outbox"), outboxOptions)
+	if err != nil {
+		return err
+	}
+	ar.natsBus.UseOutbox(outbox, AgentResultTopic)
+	ar.status.registerBus(ar.natsBus, outbox)
+
 	const maxRetries = 10
 	for i := 1; i <= maxRetries; i++ {
 		err := ar.natsBus.Connect(ar.config.Nats.Url)
+		if err == nil && !ar.natsBus.Connected() {
+			ar.logger.Warn("NATS is unavailable, results will be held in the outbox until it can be reached", "outbox", outboxOptions.Dir)
+			break
+		}
 		if err == nil {
 			log.Println("Connected to NATS successfully.")
 			break
@@ -273,7 +738,11 @@ func (ar *AgentRunner) Run() error {
 		if i < maxRetries {
 			log.Printf("Attempt %d/%d: Error connecting to NATS: %v. Retrying in 5 seconds...\n",
 				i, maxRetries, err)
-			time.Sleep(5 * time.Second)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		} else {
 			// We've reached the maximum number of retries
 			log.Printf("Attempt %d/%d: Error connecting to NATS: %v. Giving up.\n",
@@ -283,215 +752,694 @@ func (ar *AgentRunner) Run() error {
 	}
 
 	defer ar.natsBus.Close()
+	defer ar.flush()
+
+	stopHealth, err := ar.serveHealth()
+	if err != nil {
+		return err
+	}
+	defer stopHealth()
+
+	// Registers the agent, and says goodbye when it stops, before pending messages are flushed.
+	stopHeartbeats := ar.startHeartbeats()
+	defer stopHeartbeats()
+
+	err = ar.DownloadPlugins()
+	if err != nil {
+		return err
+	}
 
-	err := ar.DownloadPlugins()
+	err = ar.lock.Retain(ar.config.ociSources())
 	if err != nil {
 		return err
 	}
 
+	ar.status.setReady()
+
+	runCtx, cancelRuns := ar.runContext(ctx)
+	defer cancelRuns()
+
 	if ar.config.Daemon == true {
-		ar.runDaemon()
-		return nil
+		// Assessment plans are only applied by daemons, as a single run would finish before receiving any.
+		err = event.Subscribe(ar.natsBus, AgentPlanTopic, ar.handlePlanEvent)
+		if err != nil {
+			return err
+		}
+		return ar.runDaemon(ctx, runCtx)
+	}
+
+	defer ar.closePluginClients()
+	return ar.runInstance(runCtx)
+}
+
+// runContext returns the context used for running plugins. It is cancelled once the grace period
+// has passed after ctx is done, giving running plugins a chance to finish and publish their results.
+func (ar *AgentRunner) runContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	stop := context.AfterFunc(ctx, func() {
+		ar.mu.RLock()
+		gracePeriod := ar.config.gracePeriod()
+		ar.mu.RUnlock()
+
+		ar.logger.Info("Waiting for running plugins to finish", "grace_period", gracePeriod)
+		select {
+		case <-time.After(gracePeriod):
+			ar.logger.Warn("Grace period exceeded, cancelling running plugins", "grace_period", gracePeriod)
+			cancel()
+		case <-runCtx.Done():
+		}
+	})
+
+	return runCtx, func() {
+		stop()
+		cancel()
 	}
+}
 
-	return ar.runInstance()
+// flush waits for any pending results to be published to NATS.
+func (ar *AgentRunner) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), natsFlushTimeout)
+	defer cancel()
+
+	err := ar.natsBus.Flush(ctx)
+	if err != nil {
+		ar.logger.Error("Error flushing results to NATS", "error", err)
+	}
 }
 
-// Should never return, either handles any error or panics.
-// TODO: We should take a cancellable context here, so the caller can cancel the daemon at any time, and continue to whatever is appropriate
-func (ar *AgentRunner) runDaemon() {
-	sigs := make(chan os.Signal, 1)
+// runDaemon runs each plugin and policy pair once at startup, and then on the plugin's schedule, rather than all at once.
+// Errors from individual runs are logged, and the daemon continues.
+//
+// It returns once ctx is done and any running plugins have finished, or if the plugins cannot be scheduled.
+// Plugins are run using runCtx, which is expected to outlive ctx by the shutdown grace period.
+func (ar *AgentRunner) runDaemon(ctx context.Context, runCtx context.Context) error {
+	ar.mu.Lock()
+	ar.runCtx = runCtx
+	err := ar.schedule()
+	ar.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ar.scheduler.Start()
+	// Run every job straight away, so results don't wait a whole interval for the first scheduled run.
+	ar.scheduler.RunAll()
 
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go daemon.SdNotify(false, daemon.SdNotifyReady)
+	go ar.watchdog(ctx)
 
-	go func() {
-		sig := <-sigs
-		fmt.Println()
-		ar.logger.Info("received signal to terminate plugins and exit", "signal", sig)
-		ar.closePluginClients()
-		os.Exit(0)
-	}()
+	// Scheduled jobs run in the background, until we are asked to stop.
+	<-ctx.Done()
 
-	go daemon.SdNotify(false, "READY=1")
+	ar.logger.Info("Stopping agent, no new plugin runs will be started")
+	go daemon.SdNotify(false, daemon.SdNotifyStopping)
 
-	for {
-		err := ar.runInstance()
+	// Wait for running jobs to finish. If they exceed the grace period, runCtx is cancelled,
+	// which makes them return early.
+	<-ar.scheduler.Stop().Done()
 
-		if err != nil {
-			ar.logger.Error("error running instance", "error", err)
-			// No return for now, we keep retrying.
-			// TODO: Should we have a retry limit maybe?
+	ar.closePluginClients()
+
+	ar.logger.Info("All plugin runs finished")
+	return nil
+}
+
+// schedule creates a scheduled job for each plugin and policy pair in the current configuration,
+// replacing any previously scheduled jobs. Jobs which haven't changed keep their place in the timetable.
+//
+// The caller must hold ar.mu.
+func (ar *AgentRunner) schedule() error {
+	jobs := []scheduler.Job{}
+	for pluginName, pluginConfig := range ar.config.Plugins {
+		for _, policy := range pluginConfig.Policies {
+			jobs = append(jobs, scheduler.Job{
+				Key:      scheduleKey(pluginName, policy),
+				Schedule: pluginConfig.schedule(),
+				Jitter:   pluginConfig.Jitter,
+				Run: func() {
+					err := ar.runScheduled(pluginName, policy)
+					if err != nil {
+						ar.logger.Error("error running scheduled plugin", "plugin", pluginName, "policy", policy.Source, "error", err)
+					}
+				},
+			})
 		}
+	}
+
+	err := ar.scheduler.Replace(jobs)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		next, _ := ar.scheduler.Next(job.Key)
+		ar.logger.Info("Scheduled plugin", "job", job.Key, "schedule", job.Schedule, "next", next)
+	}
+
+	return nil
+}
+
+func scheduleKey(pluginName string, policy agentPolicy) string {
+	return fmt.Sprintf("%s:%s", pluginName, policy.Source)
+}
+
+// runScheduled runs a single plugin against a single policy. It is called by the scheduler.
+// The plugin configuration is looked up at run time, so configuration reloads are picked up by the next run.
+func (ar *AgentRunner) runScheduled(pluginName string, policy agentPolicy) error {
+	if err := ar.DownloadPolicies(); err != nil {
+		return err
+	}
+
+	ar.mu.RLock()
+	ctx := ar.runCtx
+	pluginConfig, ok := ar.config.Plugins[pluginName]
+	ar.mu.RUnlock()
+	if !ok {
+		// The plugin was removed from the configuration before the job was unscheduled.
+		return nil
+	}
 
-		time.Sleep(time.Second * 60)
+	release := ar.acquireWorker()
+	defer release()
+
+	if ctx.Err() != nil {
+		// The agent is shutting down, and the grace period has passed while we waited.
+		return ctx.Err()
 	}
+
+	return ar.runPlugin(ctx, pluginName, pluginConfig, []agentPolicy{policy})
 }
 
 // Run the agent as an instance, this is a single run of the agent that will check the
 // policies against the plugins.
 //
+// Plugins are run concurrently, bounded by the configured concurrency. A failing plugin does
+// not stop the others from running.
+//
 // Returns:
-// - error: any error that occurred during the run
-func (ar *AgentRunner) runInstance() error {
-	ar.mu.Lock()
-	defer ar.mu.Unlock()
+// - error: any errors that occurred during the run, joined together
+func (ar *AgentRunner) runInstance(ctx context.Context) error {
+	if err := ar.DownloadPolicies(); err != nil {
+		return err
+	}
 
-	defer ar.closePluginClients()
+	// Reloads replace the plugins rather than modifying them, so they can be used once the lock is released.
+	ar.mu.RLock()
+	plugins := ar.config.Plugins
+	ar.mu.RUnlock()
 
-	err := ar.DownloadPolicies()
-	if err != nil {
-		return err
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(plugins))
+	errsMu := sync.Mutex{}
+
+	for pluginName, pluginConfig := range plugins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			release := ar.acquireWorker()
+			defer release()
+
+			err := ar.runPlugin(ctx, pluginName, pluginConfig, pluginConfig.Policies)
+			if err != nil {
+				errsMu.Lock()
+				errs = append(errs, fmt.Errorf("plugin %s: %w", pluginName, err))
+				errsMu.Unlock()
+			}
+		}()
 	}
 
-	for pluginName, pluginConfig := range ar.config.Plugins {
-		logger := hclog.New(&hclog.LoggerOptions{
-			Name:   fmt.Sprintf("runner.%s", pluginName),
-			Output: os.Stdout,
-			Level:  hclog.Level(ar.config.logVerbosity()),
-		})
+	wg.Wait()
 
-		resultLabels := pluginConfig.Labels
+	return errors.Join(errs...)
+}
 
-		source := ar.pluginLocations[pluginConfig.Source]
+// acquireWorker blocks until a slot in the worker pool is available, and returns a function to release it.
+func (ar *AgentRunner) acquireWorker() func() {
+	ar.mu.RLock()
+	workers := ar.workers
+	ar.mu.RUnlock()
+	workers <- struct{}{}
+	return func() {
+		<-workers
+	}
+}
 
-		logger.Debug("Running plugin", "source", source)
+// runPlugin runs a single plugin against each of the policies passed, retrying any failures according to the
+// plugin's retry policy. Results are published to NATS. If the plugin still fails for some policies after its
+// last attempt, an error result is published for each of them, and the errors are returned.
+//
+// If the plugin's circuit breaker is open, the plugin isn't run at all. An unavailable result is published for
+// each of the policies instead.
+func (ar *AgentRunner) runPlugin(ctx context.Context, pluginName string, pluginConfig *agentPlugin, policies []agentPolicy) (err error) {
+	ctx, span := tracer.Start(ctx, "run plugin", trace.WithAttributes(
+		attrPlugin.String(pluginName),
+		attrSource.String(pluginConfig.Source),
+	))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	ar.mu.RLock()
+	verbosity := ar.config.logVerbosity()
+	ar.mu.RUnlock()
 
-		if _, err := os.ReadFile(source); err != nil {
-			return err
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   fmt.Sprintf("runner.%s", pluginName),
+		Output: ar.logOutput(),
+		Level:  hclog.Level(verbosity),
+	})
+
+	breaker := ar.breaker(pluginName, pluginConfig)
+	if allowed, until := breaker.Allow(time.Now()); !allowed {
+		logger.Debug("Plugin is paused after failing repeatedly", "until", until)
+		span.AddEvent("plugin paused")
+		err := fmt.Errorf("%w: paused until %s after %d consecutive failures", errPluginUnavailable, until.Format(time.RFC3339), breaker.Failures)
+		for _, policy := range policies {
+			ar.publishFailure(ctx, logger, pluginName, pluginConfig, pluginFailure{policy: policy, err: err}, nil)
 		}
+		return nil
+	}
 
-		runnerInstance, err := ar.getRunnerInstance(logger, source)
+	retryPolicy := pluginConfig.retryPolicy()
+	retries := &internal.Task{
+		Title:       "Retry plugin",
+		Description: fmt.Sprintf("Retrying plugin %s after it failed, up to %d attempts", pluginName, retryPolicy.Attempts),
+	}
 
-		if err != nil {
-			return err
+	remaining := policies
+	failures := []pluginFailure{}
+	for attempt := 1; ; attempt++ {
+		failures = ar.runPluginAttempt(ctx, logger, pluginName, pluginConfig, remaining, retries)
+		span.AddEvent("attempt finished", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.Int("failures", len(failures)),
+		))
+		if len(failures) == 0 || !retryPolicy.Retry(attempt) || ctx.Err() != nil {
+			break
+		}
+		// Invalid config, and plugins speaking no protocol version the agent supports, fail the same way every
+		// time, so they aren't retried.
+		if err := joinFailures(failures); errors.Is(err, errInvalidPluginConfig) || errors.Is(err, runner2.ErrUnsupportedProtocol) {
+			break
 		}
 
-		_, err = runnerInstance.Configure(&proto2.ConfigureRequest{
-			Config: pluginConfig.Config,
+		delay := retryPolicy.Delay(attempt)
+		err := joinFailures(failures)
+		logger.Warn("Plugin failed, retrying", "attempt", attempt, "delay", delay, "error", err)
+		retries.AddActivity(internal.Activity{
+			Title:       fmt.Sprintf("Attempt %d failed", attempt),
+			Description: fmt.Sprintf("%s. Retrying after %s.", err, delay),
 		})
-		if err != nil {
-			result := runner2.ErrorResult(&runner2.Result{
-				Error:  err,
-				Labels: resultLabels,
-			})
-			if pubErr := event.Publish(ar.natsBus, result, "job.result"); pubErr != nil {
-				logger.Error("Error publishing configure result", "error", pubErr)
-			}
-			return err
+		if retry.Sleep(ctx, delay) != nil {
+			break
 		}
 
-		_, err = runnerInstance.PrepareForEval(&proto2.PrepareForEvalRequest{})
-		if err != nil {
-			result := runner2.ErrorResult(&runner2.Result{
-				Error:  err,
-				Labels: resultLabels,
-			})
-			if pubErr := event.Publish(ar.natsBus, result, "job.result"); pubErr != nil {
-				logger.Error("Error publishing evaslutae result", "error", pubErr)
-			}
-			return err
+		remaining = []agentPolicy{}
+		for _, failure := range failures {
+			remaining = append(remaining, failure.policy)
+		}
+	}
+
+	// The plugin is only considered to have failed if it couldn't evaluate any of the policies, as a single
+	// broken policy doesn't mean the plugin is unavailable.
+	if len(failures) > 0 && len(failures) == len(policies) {
+		if breaker.Failure(time.Now()) {
+			logger.Warn("Pausing plugin after repeated failures", "failures", breaker.Failures, "pause", breaker.Pause)
 		}
+	} else {
+		breaker.Success()
+	}
 
-		for _, inputBundle := range pluginConfig.Policies {
-			policyPath := ar.policyLocations[string(inputBundle)]
-			// TODO we need a way to get the plugin, policy and agent version at runtime.
-			resultLabels["_plugin"] = pluginName
-			resultLabels["_policy"] = policyPath
-			resultLabels["_hostname"] = os.Getenv("HOSTNAME")
+	errs := []error{}
+	for _, failure := range failures {
+		ar.publishFailure(ctx, logger, pluginName, pluginConfig, failure, retries)
+		errs = append(errs, failure.err)
+	}
+	return errors.Join(errs...)
+}
 
-			streamId, err := internal.SeededUUID([]string{
-				fmt.Sprintf("plugin:%s:v1.0.0", pluginName),
-				fmt.Sprintf("policy:%s:v1.0.0", policyPath),
-				// Uniquely identify this agent.
-				// If a set of machines is running the same agent config, each should have a unique UUID.
-				fmt.Sprintf("hostname:%s", os.Getenv("HOSTNAME")),
-			})
-			if err != nil {
-				fmt.Printf("Failed to create UUID from dataset: %v. Generating random uuid", err)
-				streamId = uuid.New()
-			}
-			resultLabels["_stream"] = streamId.String()
+// pluginFailure is a policy which a plugin failed to evaluate.
+type pluginFailure struct {
+	policy agentPolicy
+	err    error
+}
 
-			res, err := runnerInstance.Eval(&proto2.EvalRequest{
-				BundlePath: policyPath,
-			})
-			if err != nil {
-				result := runner2.ErrorResult(&runner2.Result{
-					Error:    err,
-					StreamID: streamId.String(),
-					Labels:   resultLabels,
-				})
-				if pubErr := event.Publish(ar.natsBus, result, "job.result"); pubErr != nil {
-					logger.Error("Error publishing evaluate result", "error", pubErr)
-				}
-				return err
-			}
+// publishFailure publishes a failed result, so the failure is visible in the stream which would have received
+// a result. Any failed attempts before it are included as logs.
+func (ar *AgentRunner) publishFailure(ctx context.Context, logger hclog.Logger, pluginName string, pluginConfig *agentPlugin, failure pluginFailure, retries *internal.Task) {
+	streamId, resultLabels := ar.resultStream(pluginName, pluginConfig, failure.policy)
+	result := runner2.ErrorResult(&runner2.Result{
+		Error:    failure.err,
+		StreamID: streamId.String(),
+		Labels:   resultLabels,
+	})
+	if errors.Is(failure.err, errPluginUnavailable) {
+		result.Status = proto2.ExecutionStatus_UNAVAILABLE
+	}
+	if retries != nil && len(retries.Activities) > 0 {
+		logs := []*proto2.LogEntry{}
+		for _, activity := range retries.Activities {
+			logs = append(logs, &proto2.LogEntry{Title: activity.Title, Description: activity.Description})
+		}
+		result.Logs = &logs
+	}
 
-			logger.Debug("Obtained results from running plugin", "res", res)
+	if pubErr := ar.publishResult(ctx, result); pubErr != nil {
+		logger.Error("Error publishing error result", "error", pubErr)
+		ar.status.observePublishError(AgentResultTopic)
+	}
+}
 
-			findings := []*proto2.Finding{}
+// runPluginAttempt configures and prepares a single plugin, and evaluates it against each of the policies
+// passed. Results are published to NATS as they are received, and the policies which failed are returned.
+// Results include the retries task, if there have been previous attempts.
+//
+// All calls to the plugin in an attempt share the plugin's timeout, which is propagated to the plugin as a
+// deadline. They are also cancelled if ctx is cancelled, such as when the agent is shutting down.
+func (ar *AgentRunner) runPluginAttempt(ctx context.Context, logger hclog.Logger, pluginName string, pluginConfig *agentPlugin, policies []agentPolicy, retries *internal.Task) []pluginFailure {
+	ctx, cancel := context.WithTimeout(ctx, pluginConfig.timeout())
+	defer cancel()
+
+	failures := []pluginFailure{}
+	// fail records a failure for each of the policies passed. Secrets are redacted from the error, as plugins
+	// may include their config in errors.
+	fail := func(err error, duration time.Duration, policies ...agentPolicy) []pluginFailure {
+		err = ar.secrets.RedactError(err)
+		for _, policy := range policies {
+			ar.status.observeRun(pluginName, policy.Source, duration, nil, err)
+			failures = append(failures, pluginFailure{policy: policy, err: err})
+		}
+		return failures
+	}
 
-			setupTasks := []*proto2.Task{
-				ar.setupPluginTask.ToProtoStep(),
-				ar.setupPoliciesTask.ToProtoStep(),
-			}
+	source, version := ar.pluginSource(pluginConfig.Source)
+
+	logger.Debug("Running plugin", "source", source, "timeout", pluginConfig.timeout())
+
+	if _, err := os.ReadFile(source); err != nil {
+		return fail(err, 0, policies...)
+	}
+
+	config, err := ar.resolveConfig(ctx, pluginConfig)
+	if err != nil {
+		logger.Error("Error resolving plugin secrets", "error", err)
+		return fail(err, 0, policies...)
+	}
+
+	process, err := ar.pluginProcess(ctx, logger, pluginName, pluginConfig, source, version, config)
+	if err != nil {
+		return fail(err, 0, policies...)
+	}
+	defer func() {
+		// The process is reused by later runs, unless it was left mid-call by the timeout, or has crashed.
+		if ctx.Err() == nil && process.healthy() {
+			ar.pool.put(pluginName, process, pluginConfig.MaxRuns)
+		} else {
+			process.close()
+		}
+	}()
 
+	prepareCtx, prepareSpan := tracer.Start(ctx, "prepare plugin")
+	_, err = process.runner.PrepareForEval(prepareCtx, &proto2.PrepareForEvalRequest{})
+	if err != nil {
+		err = process.limitError(err)
+		logger.Error("Error preparing plugin for evaluation", "error", err)
+		telemetry.EndSpan(prepareSpan, ar.secrets.RedactError(err))
+		return fail(err, 0, policies...)
+	}
+	prepareSpan.End()
+
+	for i, inputBundle := range policies {
+		policyPath, _ := ar.policySource(inputBundle.Source)
+		streamId, resultLabels := ar.resultStream(pluginName, pluginConfig, inputBundle)
+
+		ar.mu.RLock()
+		chunkSize := ar.config.ResultChunkSize
+		setupTasks := []*proto2.Task{
+			ar.setupPluginTask.ToProtoStep(),
+			ar.setupPoliciesTask.ToProtoStep(),
+		}
+		ar.mu.RUnlock()
+		if len(retries.Activities) > 0 {
+			setupTasks = append(setupTasks, retries.ToProtoStep())
+		}
+
+		// result returns the result of a response, or of a chunk of it, on the policy's stream. Chunks are labelled
+		// so the API can assemble them, with the number of chunks on the last.
+		chunks := 0
+		chunkRun := uuid.New().String()
+		result := func(res *proto2.EvalResponse, last bool) *runner2.Result {
+			findings := []*proto2.Finding{}
 			for _, finding := range res.Findings {
-				tasks := setupTasks
-				tasks = append(tasks, finding.Tasks...)
-				finding.Tasks = tasks
+				// Each finding gets its own copy, as appending to setupTasks would share its spare capacity.
+				finding.Tasks = slices.Concat(setupTasks, finding.Tasks)
 				findings = append(findings, finding)
 			}
 
-			result := runner2.Result{
+			labels := resultLabels
+			if chunkSize > 0 {
+				chunks++
+				labels = maps.Clone(resultLabels)
+				labels[runner2.LabelChunk] = strconv.Itoa(chunks)
+				labels[runner2.LabelChunkRun] = chunkRun
+				if last {
+					labels[runner2.LabelChunks] = strconv.Itoa(chunks)
+				}
+			}
+			return &runner2.Result{
 				Title:        res.Title,
 				Status:       res.Status,
 				StreamID:     streamId.String(),
-				Error:        err,
 				Observations: &res.Observations,
 				Findings:     &findings,
 				Risks:        &res.Risks,
 				Logs:         &res.Logs,
-				Labels:       resultLabels,
+				Labels:       labels,
 			}
+		}
 
-			// Publish findings to nats
-			if pubErr := event.Publish(ar.natsBus, result, "job.result"); pubErr != nil {
-				logger.Error("Error publishing result", "error", pubErr)
+		evalCtx, evalSpan := tracer.Start(ctx, "eval policy", trace.WithAttributes(attrPolicy.String(inputBundle.Source)))
+		evalStart := time.Now()
+		process.host.beginEval(evalCtx, policyPath)
+		// The response is streamed from plugins which support it. It is assembled into a single result, unless
+		// results are chunked, when each chunk is published as soon as it is full, on the same stream.
+		res, err := runner2.EvalChunked(evalCtx, process.runner, &proto2.EvalRequest{
+			BundlePath: policyPath,
+		}, chunkSize, func(chunk *proto2.EvalResponse) error {
+			ar.status.observeResult(pluginName, inputBundle.Source, chunk)
+			if err := ar.publishResult(evalCtx, result(chunk, false)); err != nil {
+				ar.status.observePublishError(AgentResultTopic)
+				return fmt.Errorf("publishing result: %w", err)
+			}
+			return nil
+		})
+		hostLogs := process.host.endEval()
+		evalDuration := time.Since(evalStart)
+		if err != nil {
+			err = process.limitError(err)
+			logger.Error("Error evaluating policy", "policy", policyPath, "error", err)
+			telemetry.EndSpan(evalSpan, ar.secrets.RedactError(err))
+			fail(err, evalDuration, inputBundle)
+			if ctx.Err() != nil {
+				// Once the timeout is exceeded the remaining policies can't be evaluated either, so we stop here.
+				fail(err, 0, policies[i+1:]...)
+				break
 			}
+			continue
+		}
+
+		logger.Debug("Obtained results from running plugin", "res", res)
+		// Logs the plugin added through host services are part of the result, after any it returned.
+		res.Logs = append(res.Logs, hostLogs...)
+		ar.status.observeRun(pluginName, inputBundle.Source, evalDuration, res, nil)
+
+		// Publish findings to nats
+		if pubErr := ar.publishResult(evalCtx, result(res, true)); pubErr != nil {
+			logger.Error("Error publishing result", "error", pubErr)
+			ar.status.observePublishError(AgentResultTopic)
 		}
+		evalSpan.End()
 	}
 
-	return nil
+	return failures
+}
+
+// pin records the digests tags were resolved to in the lock file, so the tags aren't resolved again.
+func (ar *AgentRunner) pin(pins map[string]string) {
+	for source, digest := range pins {
+		if err := ar.lock.Set(source, digest); err != nil {
+			ar.logger.Error("Error updating lock file", "source", source, "error", err)
+		}
+	}
+}
+
+// pluginSource returns the local path a plugin source was downloaded to, and its version.
+func (ar *AgentRunner) pluginSource(source string) (location string, version string) {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+	return ar.pluginLocations[source], ar.pluginVersions[source]
 }
 
-func (ar *AgentRunner) getRunnerInstance(logger hclog.Logger, path string) (runner2.Runner, error) {
-	// We're a host! Start by launching the plugin process.
-	client := plugin.NewClient(&plugin.ClientConfig{
+// policySource returns the local path a policy source was downloaded to, and its version.
+func (ar *AgentRunner) policySource(source string) (location string, version string) {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+	return ar.policyLocations[source], ar.policyVersions[source]
+}
+
+// publishResult publishes a result to NATS, or passes it to the collector if results are being collected
+// locally instead. The trace context of ctx is published with the result, so its processing by the API is part
+// of the same trace.
+func (ar *AgentRunner) publishResult(ctx context.Context, result *runner2.Result) error {
+	if ar.collect != nil {
+		ar.collect(result)
+		return nil
+	}
+	return event.PublishContext(ctx, ar.natsBus, result, AgentResultTopic)
+}
+
+// logOutput is where plugin logs are written, with secrets redacted.
+func (ar *AgentRunner) logOutput() io.Writer {
+	if ar.logWriter != nil {
+		return ar.secrets.Writer(ar.logWriter)
+	}
+	return ar.secrets.Writer(os.Stdout)
+}
+
+// hostname returns the hostname results are labelled with. The HOSTNAME environment variable takes precedence,
+// as it always has, but it is often unset, such as under systemd. Streams are still seeded with HOSTNAME alone.
+func (ar *AgentRunner) hostname() string {
+	if hostname := os.Getenv("HOSTNAME"); hostname != "" {
+		return hostname
+	}
+	return ar.hostFacts[host.FactHostname]
+}
+
+// unversionedStream is the version streams are seeded with when they continue across plugin and policy
+// versions. It is the version every stream was seeded with before versions were known, so existing streams
+// carry on.
+const unversionedStream = "v1.0.0"
+
+// unversionedPolicy returns the location streams which continue across versions are seeded with for a policy.
+// It is where the policy was downloaded to before downloads were stored by digest, so existing streams carry on:
+// the source itself for local policies, and a directory for the tag for OCI policies.
+func unversionedPolicy(source string, location string) string {
+	if location == source || !internal.IsOCI(source) {
+		return source
+	}
+	tag, err := name.NewTag(source)
+	if err != nil {
+		return source
+	}
+	return path.Join(AgentPolicyDir, tag.RepositoryStr(), tag.Identifier(), "policies")
+}
+
+// resultStream returns the stream ID and labels for results of a plugin evaluated against a policy.
+// The labels are a copy of the plugin's labels, so they can be safely modified by concurrent runs.
+//
+// The stream only changes with the plugin and policy versions if the plugin has versioned streams,
+// but the versions are always included in the labels.
+func (ar *AgentRunner) resultStream(pluginName string, pluginConfig *agentPlugin, policy agentPolicy) (uuid.UUID, map[string]string) {
+	_, pluginVersion := ar.pluginSource(pluginConfig.Source)
+	policyPath, policyVersion := ar.policySource(policy.Source)
+
+	resultLabels := map[string]string{}
+	maps.Copy(resultLabels, pluginConfig.Labels)
+
+	resultLabels["_plugin"] = pluginName
+	resultLabels["_plugin_version"] = pluginVersion
+	resultLabels["_policy"] = policy.Source
+	resultLabels["_policy_path"] = policyPath
+	resultLabels["_policy_version"] = policyVersion
+	for fact, value := range ar.hostFacts {
+		resultLabels[hostLabelPrefix+fact] = value
+	}
+	resultLabels["_hostname"] = ar.hostname()
+	if ar.agentId != "" {
+		resultLabels["_agent"] = ar.agentId
+	}
+
+	// Versioned streams identify policies by their source, as downloaded policies are stored at a different
+	// path for each version.
+	policyId := policy.Source
+	if !pluginConfig.VersionedStreams {
+		pluginVersion = unversionedStream
+		policyVersion = unversionedStream
+		policyId = unversionedPolicy(policy.Source, policyPath)
+	}
+
+	streamId, err := internal.SeededUUID([]string{
+		fmt.Sprintf("plugin:%s:%s", pluginName, pluginVersion),
+		fmt.Sprintf("policy:%s:%s", policyId, policyVersion),
+		// Uniquely identify this agent.
+		// If a set of machines is running the same agent config, each should have a unique UUID.
+		// Only HOSTNAME is used, without the hostname fact, so streams of agents without it carry on.
+		fmt.Sprintf("hostname:%s", os.Getenv("HOSTNAME")),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create UUID from dataset: %v. Generating random uuid", err)
+		streamId = uuid.New()
+	}
+	resultLabels["_stream"] = streamId.String()
+
+	return streamId, resultLabels
+}
+
+func (ar *AgentRunner) getRunnerInstance(logger hclog.Logger, path string, sb *sandbox.Sandbox, host runner2.Host) (*plugin.Client, runner2.ContextRunner, error) {
+	// We're a host! Start by launching the plugin process. The highest protocol version both the agent and the
+	// plugin support is negotiated, and host services are served to plugins speaking a version with them.
+	config := &plugin.ClientConfig{
 		HandshakeConfig:  runner2.HandshakeConfig,
-		Plugins:          runner2.PluginMap,
+		VersionedPlugins: runner2.VersionedPlugins(host),
 		Managed:          true,
 		Cmd:              exec.Command(path),
 		Logger:           logger,
 		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
-	})
+	}
+	if sb != nil {
+		sb.Configure(config, path)
+	}
+	client := plugin.NewClient(config)
 
 	// Connect via RPC
 	rpcClient, err := client.Client()
 	if err != nil {
-		return nil, err
+		client.Kill()
+		return nil, nil, protocolError(err)
 	}
 
 	// Request the plugin
 	raw, err := rpcClient.Dispense("runner")
 	if err != nil {
-		return nil, err
+		client.Kill()
+		return nil, nil, err
 	}
 
 	// We should have a Greeter now! This feels like a normal interface
 	// implementation but is in fact over an RPC connection.
-	runnerInstance := raw.(runner2.Runner)
-	return runnerInstance, nil
+	runnerInstance, ok := raw.(runner2.ContextRunner)
+	if !ok {
+		client.Kill()
+		return nil, nil, fmt.Errorf("%w: dispensed %T", runner2.ErrUnsupportedProtocol, raw)
+	}
+	logger.Debug("Started plugin", "protocol_version", client.NegotiatedVersion())
+	return client, runnerInstance, nil
+}
+
+// incompatibleVersionPattern matches the error go-plugin returns when a plugin speaks none of the agent's protocol
+// versions, capturing the version the plugin advertised in its handshake. go-plugin doesn't export the error or the
+// advertised version, so TestProtocolError pins the message against the go-plugin the agent is built with.
+var incompatibleVersionPattern = regexp.MustCompile(`Incompatible API version with plugin\. Plugin version: (\d+)`)
+
+// protocolError reports a plugin which speaks none of the agent's protocol versions as ErrUnsupportedProtocol,
+// naming the version the plugin speaks.
+func protocolError(err error) error {
+	match := incompatibleVersionPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	versions := slices.Sorted(maps.Keys(runner2.VersionedPlugins(nil)))
+	return fmt.Errorf("%w: plugin speaks version %s, agent supports versions %v", runner2.ErrUnsupportedProtocol, match[1], versions)
 }
 
 // DownloadPlugins checks each item in the config and retrieves the source of the plugin
@@ -504,6 +1452,35 @@ func (ar *AgentRunner) getRunnerInstance(logger hclog.Logger, path string) (runn
 // We return any errors that occurred during the download process. TODO: What is the right
 // error handling here?
 func (ar *AgentRunner) DownloadPlugins() error {
+	ar.mu.RLock()
+	config := ar.config
+	ar.mu.RUnlock()
+
+	pins := map[string]string{}
+	locations, versions, task, err := ar.downloadPlugins(&config, pins)
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	ar.setupPluginTask = task
+	if err != nil {
+		return err
+	}
+
+	maps.Copy(ar.pluginLocations, locations)
+	maps.Copy(ar.pluginVersions, versions)
+	ar.pin(pins)
+	return nil
+}
+
+// downloadPlugins retrieves the plugins required by config, returning maps of each plugin source to its
+// local file path and its version, and a task describing the downloads.
+// Downloads are cached by checksum or digest, so they never replace a plugin the running configuration uses.
+// It does not modify the agent's state, so it can be used to validate a configuration before it is applied. The
+// digests tags were resolved to are added to pins, to be recorded in the lock file with pin once it is applied.
+func (ar *AgentRunner) downloadPlugins(config *agentConfig, pins map[string]string) (_ map[string]string, _ map[string]string, _ *internal.Task, err error) {
+	ctx, span := tracer.Start(context.Background(), "download plugins")
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	// Add a task to indicate we've downloaded the items
 	task := &internal.Task{
 		Title:       "Download plugins",
@@ -511,33 +1488,52 @@ func (ar *AgentRunner) DownloadPlugins() error {
 		SubjectId:   "",
 		Activities:  []internal.Activity{},
 	}
-	defer func() {
-		ar.setupPluginTask = task
-	}()
 
-	// Build a set of unique plugin sources
-	pluginSources := map[string]struct{}{}
+	verifier, err := config.verifier()
+	if err != nil {
+		return nil, nil, task, err
+	}
+
+	// Build a set of unique plugin sources, with their checksums
+	pluginSources := map[string]string{}
 
-	for _, pluginConfig := range ar.config.Plugins {
-		pluginSources[pluginConfig.Source] = struct{}{}
+	for _, pluginConfig := range config.Plugins {
+		pluginSources[pluginConfig.Source] = pluginConfig.Sha256
 	}
 
-	for source := range pluginSources {
-		location, activity, err := ar.downloadItem("plugins", source, AgentPluginDir, true)
+	locations := map[string]string{}
+	versions := map[string]string{}
+	for source, checksum := range pluginSources {
+		_, itemSpan := tracer.Start(ctx, "download plugin", trace.WithAttributes(attrSource.String(source)))
+		location, version, activity, err := ar.downloadItem("plugins", source, checksum, true, verifier, pins)
+		telemetry.EndSpan(itemSpan, err)
+
+		task.AddActivity(activity)
 
 		if err != nil {
-			return err
+			return locations, versions, task, err
 		}
 
-		task.AddActivity(activity)
-
-		ar.pluginLocations[source] = location
+		locations[source] = location
+		versions[source] = version
 	}
 
-	return nil
+	return locations, versions, task, nil
 }
 
-func (ar *AgentRunner) DownloadPolicies() error {
+// DownloadPolicies retrieves the policies of every configured plugin. Policies are downloaded without holding
+// ar.mu, so runs can continue while they download, and the downloaded locations are then updated together.
+func (ar *AgentRunner) DownloadPolicies() (err error) {
+	ar.downloadMu.Lock()
+	defer ar.downloadMu.Unlock()
+
+	ctx, span := tracer.Start(context.Background(), "download policies")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	ar.mu.RLock()
+	config := ar.config
+	ar.mu.RUnlock()
+
 	// Add a task to indicate we've downloaded the items
 	task := &internal.Task{
 		Title:       "Download policies",
@@ -545,29 +1541,45 @@ func (ar *AgentRunner) DownloadPolicies() error {
 		SubjectId:   "",
 		Activities:  []internal.Activity{},
 	}
+	locations := map[string]string{}
+	versions := map[string]string{}
+	pins := map[string]string{}
 	defer func() {
+		ar.mu.Lock()
+		defer ar.mu.Unlock()
 		ar.setupPoliciesTask = task
+		maps.Copy(ar.policyLocations, locations)
+		maps.Copy(ar.policyVersions, versions)
+		ar.pin(pins)
 	}()
 
-	// Build a set of unique policy sources
-	policySources := map[string]struct{}{}
+	verifier, err := config.verifier()
+	if err != nil {
+		return err
+	}
+
+	// Build a set of unique policy sources, with their checksums
+	policySources := map[string]string{}
 
-	for _, pluginConfig := range ar.config.Plugins {
+	for _, pluginConfig := range config.Plugins {
 		for _, policy := range pluginConfig.Policies {
-			policySources[string(policy)] = struct{}{}
+			policySources[policy.Source] = policy.Sha256
 		}
 	}
 
-	for source := range policySources {
-		location, activity, err := ar.downloadItem("policies", source, AgentPolicyDir, false)
+	for source, checksum := range policySources {
+		_, itemSpan := tracer.Start(ctx, "download policy", trace.WithAttributes(attrSource.String(source)))
+		location, version, activity, err := ar.downloadItem("policies", source, checksum, false, verifier, pins)
+		telemetry.EndSpan(itemSpan, err)
+
+		task.AddActivity(activity)
 
 		if err != nil {
 			return err
 		}
 
-		task.AddActivity(activity)
-
-		ar.policyLocations[source] = location
+		locations[source] = location
+		versions[source] = version
 	}
 
 	return nil
@@ -580,15 +1592,25 @@ func (ar *AgentRunner) DownloadPolicies() error {
 // We also update the map of plugin sources, this could be an identity map if it's a local
 // file or maps from the URL to the local file if we downloaded a remote file.
 //
+// HTTP(S) sources must have a checksum, and are cached by it, so they are only downloaded once.
+// OCI tags are resolved to a digest, and cached by that digest. Tags which aren't in the lock file are added to
+// pins with the digest they were resolved to, so the caller can record them once the item is in use.
+//
+// If verifier is set, items must be signed by one of its trusted keys, otherwise they are refused.
+//
 // We return the following:
-// * A map of the source to the local file path
+// * The local file path of the item
+// * The version of the item, which is its digest, or its revision for policy bundles with one
+// * An activity describing the steps taken, including any failure
 // * Errors that occurred during the download process. TODO: What is the right error handling here?
 func (ar *AgentRunner) downloadItem(
 	type_ string,
 	source string,
-	outDirPrefix string,
+	checksum string,
 	isArchDependent bool,
-) (string, internal.Activity, error) {
+	verifier *signature.Verifier,
+	pins map[string]string,
+) (string, string, internal.Activity, error) {
 	location := ""
 	activity := internal.Activity{
 		Title:       "Downloading " + type_,
@@ -599,6 +1621,65 @@ func (ar *AgentRunner) downloadItem(
 		Tools:       []string{"agent"},
 	}
 
+	// failed records the error on the activity, so it's visible alongside the results.
+	failed := func(err error) (string, string, internal.Activity, error) {
+		activity.AddStep(internal.Step{
+			Title:       fmt.Sprintf("Error downloading %s", type_),
+			SubjectId:   "",
+			Description: fmt.Sprintf("Error downloading %s from %s: '%v'", type_, source, err),
+		})
+		return location, "", activity, err
+	}
+
+	// versioned returns the item at location, identified by digest. Local items have no known digest,
+	// so the digest of their content is used instead.
+	versioned := func(location string, digest string) (string, string, internal.Activity, error) {
+		version := digest
+		if version == "" {
+			var err error
+			version, err = signature.Digest(location)
+			if err != nil {
+				return failed(err)
+			}
+		}
+
+		if type_ == "policies" {
+			revision, err := internal.BundleRevision(location)
+			if err != nil {
+				return failed(err)
+			}
+			if revision != "" {
+				version = revision
+			}
+		}
+
+		return location, version, activity, nil
+	}
+
+	// verified checks the signature of the item at location, if signatures are required.
+	verified := func(location string, digest string) (string, string, internal.Activity, error) {
+		if verifier == nil {
+			return versioned(location, digest)
+		}
+
+		keyID, err := verifier.VerifyPath(location)
+		if err != nil {
+			return failed(fmt.Errorf("signature verification failed: %w", err))
+		}
+
+		activity.AddStep(internal.Step{
+			Title:       "Verified signature",
+			SubjectId:   "",
+			Description: fmt.Sprintf("Verified signature of %s, signed by trusted key %s", location, keyID),
+		})
+		return versioned(location, digest)
+	}
+
+	downloadStart := time.Now()
+	defer func() {
+		ar.status.observeDownload(type_, source, time.Since(downloadStart))
+	}()
+
 	ar.logger.Trace("Checking for source", "type", type_, "source", source)
 
 	// First we check if the source is a path that exists on the fs, if so we just use that.
@@ -615,7 +1696,7 @@ func (ar *AgentRunner) downloadItem(
 		})
 
 		// The file exists locally, so we use the local path.
-		return source, activity, nil
+		return verified(source, "")
 	}
 
 	// The error we've received is something other than not exists.
@@ -627,17 +1708,11 @@ func (ar *AgentRunner) downloadItem(
 			Description: fmt.Sprintf("Error finding plugin on filesystem: '%v'", err),
 		})
 
-		return location, activity, err
+		return location, "", activity, err
 	}
 
 	if internal.IsOCI(source) {
 		ar.logger.Debug("Source looks like an OCI endpoint, attempting to download", "type", type_, "Source", source)
-		tag, err := name.NewTag(source)
-		if err != nil {
-			return location, activity, err
-		}
-
-		outDir := path.Join(outDirPrefix, tag.RepositoryStr(), tag.Identifier())
 
 		activity.AddStep(internal.Step{
 			Title:       "Plugin OCI endpoint found",
@@ -645,54 +1720,146 @@ func (ar *AgentRunner) downloadItem(
 			Description: fmt.Sprintf("Plugin found OCI endpoint %s", source),
 		})
 
-		downloaderImpl, err := oci.NewDownloader(
-			tag,
-			outDir,
-		)
-		if err != nil {
-			return location, activity, err
+		ctx, cancel := context.WithTimeout(context.Background(), artifactDownloadTimeout)
+		defer cancel()
+
+		// Tags are resolved once and pinned in the lock file, so a tag which is pushed again doesn't
+		// change what runs.
+		digest, locked := ar.lock.Digest(source)
+		if locked {
+			activity.AddStep(internal.Step{
+				Title:       "Using locked digest",
+				SubjectId:   "",
+				Description: fmt.Sprintf("%s is locked to %s", source, digest),
+			})
+		} else {
+			digest, err = artifact.ResolveOCI(ctx, source)
+			if err != nil {
+				return failed(err)
+			}
+			pins[source] = digest
+
+			activity.AddStep(internal.Step{
+				Title:       "Resolved tag",
+				SubjectId:   "",
+				Description: fmt.Sprintf("Resolved %s to %s", source, digest),
+			})
 		}
+
+		var platform *v1.Platform
 		if isArchDependent {
-			err = downloaderImpl.Download(remote.WithPlatform(v1.Platform{
-				Architecture: runtime.GOARCH,
-				OS:           runtime.GOOS,
-			}))
-		} else {
-			err = downloaderImpl.Download()
+			platform = hostPlatform()
 		}
+
+		downloaded, err := artifact.NewOCIDownloader(artifactCacheDir(type_)).Download(ctx, source, digest, platform)
 		if err != nil {
-			return location, activity, err
+			return failed(err)
 		}
 
-		location := outDir
+		location := downloaded.Path
 		if type_ == "plugins" {
-			location = path.Join(outDir, "plugin")
+			location = path.Join(downloaded.Path, "plugin")
 		} else if type_ == "policies" {
-			location = path.Join(outDir, "policies")
+			location = path.Join(downloaded.Path, "policies")
+		}
+
+		if downloaded.Cached {
+			activity.AddStep(internal.Step{
+				Title:       "Using cached artifact",
+				SubjectId:   "",
+				Description: fmt.Sprintf("Artifact with digest %s already downloaded to %s", digest, location),
+			})
+		} else {
+			activity.AddStep(internal.Step{
+				Title:       "Downloaded Plugin",
+				SubjectId:   "",
+				Description: fmt.Sprintf("Downloaded plugin to destination %s", location),
+			})
 		}
 
+		ar.logger.Debug("Source downloaded successfully", "type", type_, "Destination", location, "digest", digest, "cached", downloaded.Cached)
+		return verified(location, digest)
+	} else if artifact.IsHTTP(source) {
+		ar.logger.Debug("Source looks like an HTTP(S) URL, attempting to download", "type", type_, "Source", source)
+
 		activity.AddStep(internal.Step{
-			Title:       "Downloaded Plugin",
+			Title:       "HTTP artifact found",
 			SubjectId:   "",
-			Description: fmt.Sprintf("Downloaded plugin to destination %s", location),
+			Description: fmt.Sprintf("Found HTTP artifact %s with sha256 %s", source, checksum),
 		})
 
-		ar.logger.Debug("Source downloaded successfully", "type", type_, "Destination", outDir)
-		// Update the source in the agent configuration to the new path
-		return location, activity, nil
+		ctx, cancel := context.WithTimeout(context.Background(), artifactDownloadTimeout)
+		defer cancel()
+
+		downloader := artifact.NewHTTPDownloader(artifactCacheDir(type_))
+		if verifier != nil {
+			downloader.WithVerifier(verifier)
+		}
+
+		downloaded, err := downloader.Download(ctx, source, checksum)
+		if err != nil {
+			return failed(err)
+		}
+
+		location := downloaded.Path
+		if downloaded.Extracted && type_ == "plugins" {
+			// Archives contain the plugin binary, the same as OCI artifacts.
+			location = path.Join(downloaded.Path, "plugin")
+		}
+
+		if downloaded.Cached {
+			activity.AddStep(internal.Step{
+				Title:       "Using cached artifact",
+				SubjectId:   "",
+				Description: fmt.Sprintf("Artifact with sha256 %s already downloaded to %s", checksum, location),
+			})
+		} else {
+			activity.AddStep(internal.Step{
+				Title:       "Downloaded artifact",
+				SubjectId:   "",
+				Description: fmt.Sprintf("Downloaded artifact and verified sha256 %s, stored at %s", checksum, location),
+			})
+		}
+
+		if downloaded.SignedBy != "" {
+			activity.AddStep(internal.Step{
+				Title:       "Verified signature",
+				SubjectId:   "",
+				Description: fmt.Sprintf("Verified signature of %s, signed by trusted key %s", source, downloaded.SignedBy),
+			})
+		}
+
+		ar.logger.Debug("Source downloaded successfully", "type", type_, "Destination", location, "cached", downloaded.Cached)
+		return versioned(location, "sha256:"+checksum)
 	} else {
-		ar.logger.Debug("Attempting to download artifact (TODO)", "Source", source)
+		return failed(fmt.Errorf("unsupported source %s, expected a local path, OCI tag or HTTP(S) URL", source))
+	}
+}
 
-		activity.AddStep(internal.Step{
-			Title:       "Plugin error",
-			SubjectId:   "",
-			Description: "Downloading artifacts is not yet implemented",
-		})
+// artifactCacheDir is where downloaded artifacts are cached. As they are keyed by their checksum or digest,
+// the cache is shared by every configuration, and doesn't need to be staged when configuration is reloaded.
+func artifactCacheDir(type_ string) string {
+	if type_ == "plugins" {
+		return path.Join(AgentPluginDir, artifactCacheSubdir)
+	}
+	return path.Join(AgentPolicyDir, artifactCacheSubdir)
+}
 
-		return location, activity, errors.New("Downloading artifacts is not yet implemented")
+// hostPlatform is the platform plugins are downloaded for.
+func hostPlatform() *v1.Platform {
+	return &v1.Platform{
+		Architecture: runtime.GOARCH,
+		OS:           runtime.GOOS,
 	}
 }
 
+// lockPath returns the location of the lock file for the configuration at configPath.
+func lockPath(configPath string) string {
+	return path.Join(path.Dir(configPath), artifact.LockFileName)
+}
+
+// closePluginClients stops every plugin process, including those kept for later runs.
 func (ar *AgentRunner) closePluginClients() {
+	ar.pool.close()
 	plugin.CleanupClients()
 }
@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/compliance-framework/framework/internal/artifact"
+	"github.com/compliance-framework/framework/internal/host"
+	"github.com/compliance-framework/framework/internal/scheduler"
+	"github.com/compliance-framework/framework/internal/secret"
+	runner2 "github.com/compliance-framework/framework/runner"
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats supported by `cf agent eval`.
+const (
+	EvalOutputTable = "table"
+	EvalOutputJSON  = "json"
+	EvalOutputYAML  = "yaml"
+)
+
+// Exit codes of `cf agent eval`, so it can gate CI pipelines.
+const (
+	// EvalExitFindings is returned when every evaluation succeeded, but at least one finding was produced.
+	EvalExitFindings = 1
+	// EvalExitError is returned when any plugin or policy could not be evaluated.
+	EvalExitError = 2
+)
+
+func AgentEvalCmd() *cobra.Command {
+	var evalCmd = &cobra.Command{
+		Use:   "eval",
+		Short: "evaluates every plugin and policy once, printing the results instead of publishing them",
+		Long: `Runs every plugin against each of its policies once, and prints the results rather than publishing them
+to NATS, so policies can be developed and checked without the rest of the stack. NATS configuration is not required.
+
+The exit code is 0 if there were no findings, 1 if any findings were produced, and 2 if anything could not be
+evaluated, so the same configuration can be used to gate CI pipelines.`,
+		Args: cobra.NoArgs,
+		RunE: agentEval,
+	}
+
+	evalCmd.Flags().StringP("config", "c", "", "Location of config file")
+	evalCmd.MarkFlagRequired("config")
+
+	evalCmd.Flags().StringP("output", "o", EvalOutputTable, "Output format, one of table, json or yaml")
+	evalCmd.Flags().String("output-file", "", "Write results to this file rather than stdout")
+	evalCmd.Flags().CountP("verbose", "v", "Enable verbose output")
+
+	return evalCmd
+}
+
+func agentEval(cmd *cobra.Command, args []string) error {
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return err
+	}
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains([]string{EvalOutputTable, EvalOutputJSON, EvalOutputYAML}, format) {
+		return fmt.Errorf("unsupported output format %q, expected table, json or yaml", format)
+	}
+	outputFile, err := cmd.Flags().GetString("output-file")
+	if err != nil {
+		return err
+	}
+
+	config, err := readAgentConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("verbose") {
+		verbosity, err := cmd.Flags().GetCount("verbose")
+		if err != nil {
+			return err
+		}
+		config.Verbosity = int32(verbosity)
+	}
+	facts := config.hostFacts(cmd.Context())
+	if err := config.render(facts); err != nil {
+		return err
+	}
+	if len(config.Plugins) == 0 {
+		return fmt.Errorf("no plugins specified in config")
+	}
+	if err := config.validatePlugins(); err != nil {
+		return err
+	}
+
+	lock, err := artifact.LoadLock(lockPath(configPath))
+	if err != nil {
+		return err
+	}
+
+	// Logs go to stderr, so the results on stdout can be piped elsewhere. As with the agent, secrets are redacted.
+	secrets := secret.NewRedactor()
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   "agent",
+		Output: secrets.Writer(os.Stderr),
+		Level:  hclog.Level(config.logVerbosity()),
+	})
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	stopTelemetry, err := config.setupTelemetry(ctx)
+	if err != nil {
+		return err
+	}
+	results, evalErr := evaluate(ctx, logger, config, lock, facts, secrets)
+	stopTelemetry()
+
+	out := cmd.OutOrStdout()
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := writeEvalResults(out, format, results); err != nil {
+		return err
+	}
+
+	// As with the agent, we exit rather than returning an error, so the usage isn't printed,
+	// and the exit code reflects the results.
+	if evalErr != nil {
+		logger.Error("Error evaluating configuration", "error", evalErr)
+	}
+	if code := evalExitCode(results, evalErr); code != 0 {
+		os.Exit(code)
+	}
+	return nil
+}
+
+// evaluate runs every plugin against each of its policies once, returning the results sorted by plugin
+// and policy. Results are returned for any plugins which ran, even if others failed.
+func evaluate(ctx context.Context, logger hclog.Logger, config *agentConfig, lock *artifact.Lock, facts host.Facts, secrets *secret.Redactor) ([]*runner2.Result, error) {
+	results := []*runner2.Result{}
+	resultsMu := sync.Mutex{}
+
+	ar := &AgentRunner{
+		logger:          logger,
+		config:          *config,
+		lock:            lock,
+		hostFacts:       facts,
+		secrets:         secrets,
+		pluginLocations: map[string]string{},
+		policyLocations: map[string]string{},
+		pluginVersions:  map[string]string{},
+		policyVersions:  map[string]string{},
+		scheduler:       scheduler.New(logger.Named("scheduler")),
+		workers:         make(chan struct{}, config.concurrency()),
+		logWriter:       os.Stderr,
+		collect: func(result *runner2.Result) {
+			resultsMu.Lock()
+			defer resultsMu.Unlock()
+			results = append(results, result)
+		},
+	}
+	defer ar.closePluginClients()
+
+	if err := ar.DownloadPlugins(); err != nil {
+		return results, err
+	}
+
+	err := ar.runInstance(ctx)
+
+	slices.SortFunc(results, func(a, b *runner2.Result) int {
+		if c := strings.Compare(a.Labels["_plugin"], b.Labels["_plugin"]); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Labels["_policy"], b.Labels["_policy"])
+	})
+	return results, err
+}
+
+// evalExitCode returns the exit code for a set of results, and any error evaluating them.
+func evalExitCode(results []*runner2.Result, err error) int {
+	if err != nil {
+		return EvalExitError
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			return EvalExitError
+		}
+	}
+	for _, result := range results {
+		if result.Findings != nil && len(*result.Findings) > 0 {
+			return EvalExitFindings
+		}
+	}
+	return 0
+}
+
+// evalOutput is a result as it is printed. Errors are printed as their message, as they would otherwise
+// be encoded as an empty object.
+type evalOutput struct {
+	*runner2.Result
+	Error string `json:"error,omitempty"`
+}
+
+func writeEvalResults(w io.Writer, format string, results []*runner2.Result) error {
+	outputs := make([]evalOutput, 0, len(results))
+	for _, result := range results {
+		output := evalOutput{Result: result}
+		if result.Error != nil {
+			output.Error = result.Error.Error()
+		}
+		outputs = append(outputs, output)
+	}
+
+	switch format {
+	case EvalOutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(outputs)
+	case EvalOutputYAML:
+		// Results are mostly protobuf messages, which are only tagged for JSON, so we convert them via JSON
+		// to get the same field names.
+		content, err := json.Marshal(outputs)
+		if err != nil {
+			return err
+		}
+		generic := []interface{}{}
+		if err := yaml.Unmarshal(content, &generic); err != nil {
+			return err
+		}
+		content, err = yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	case EvalOutputTable:
+		return writeEvalTable(w, outputs)
+	}
+	return errors.New("unsupported output format " + format)
+}
+
+func writeEvalTable(w io.Writer, outputs []evalOutput) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLUGIN\tPOLICY\tSTATUS\tFINDINGS\tOBSERVATIONS\tTITLE")
+	for _, output := range outputs {
+		findings, observations := 0, 0
+		if output.Findings != nil {
+			findings = len(*output.Findings)
+		}
+		if output.Observations != nil {
+			observations = len(*output.Observations)
+		}
+		title := output.Title
+		if output.Error != "" {
+			title = output.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n",
+			output.Labels["_plugin"],
+			path.Base(output.Labels["_policy"]),
+			output.Status,
+			findings,
+			observations,
+			title,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, output := range outputs {
+		if output.Findings == nil {
+			continue
+		}
+		for _, finding := range *output.Findings {
+			fmt.Fprintf(w, "\n%s: %s\n", output.Labels["_plugin"], finding.Title)
+			if finding.Description != "" {
+				fmt.Fprintf(w, "  %s\n", finding.Description)
+			}
+		}
+	}
+	return nil
+}
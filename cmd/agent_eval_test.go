@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	runner2 "github.com/compliance-framework/framework/runner"
+	"github.com/compliance-framework/framework/runner/proto"
+	"gopkg.in/yaml.v2"
+)
+
+func evalTestResults() []*runner2.Result {
+	return []*runner2.Result{
+		{
+			Title:  "Local SSH",
+			Status: proto.ExecutionStatus_SUCCESS,
+			Findings: &[]*proto.Finding{
+				{Title: "Password authentication is enabled", Description: "PasswordAuthentication should be no"},
+			},
+			Labels: map[string]string{"_plugin": "local-ssh", "_policy": "policies/ssh"},
+		},
+		{
+			Title:  "Remote SSH",
+			Status: proto.ExecutionStatus_FAILURE,
+			Error:  errors.New("connection refused"),
+			Labels: map[string]string{"_plugin": "remote-ssh", "_policy": "policies/ssh"},
+		},
+	}
+}
+
+func TestAgentCmd_EvalValidation(t *testing.T) {
+	config := &agentConfig{
+		Plugins: map[string]*agentPlugin{
+			"local-ssh": {
+				Source:   "plugins/local-ssh",
+				Policies: []agentPolicy{{Source: "policies/ssh"}},
+			},
+		},
+	}
+
+	if err := config.validate(); err == nil {
+		t.Errorf("Expected the agent to require NATS configuration")
+	}
+	if err := config.validatePlugins(); err != nil {
+		t.Errorf("Expected plugins to be valid without NATS configuration, got %v", err)
+	}
+}
+
+func TestEvalExitCode(t *testing.T) {
+	results := evalTestResults()
+
+	tests := []struct {
+		name     string
+		results  []*runner2.Result
+		err      error
+		expected int
+	}{
+		{name: "No results", results: nil, expected: 0},
+		{name: "No findings", results: []*runner2.Result{{Findings: &[]*proto.Finding{}}}, expected: 0},
+		{name: "Findings", results: results[:1], expected: EvalExitFindings},
+		{name: "Failed result", results: results, expected: EvalExitError},
+		{name: "Evaluation error", results: nil, err: errors.New("download failed"), expected: EvalExitError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := evalExitCode(test.results, test.err); code != test.expected {
+				t.Errorf("Expected exit code %d, got %d", test.expected, code)
+			}
+		})
+	}
+}
+
+func TestWriteEvalResults(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		if err := writeEvalResults(out, EvalOutputJSON, evalTestResults()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		decoded := []map[string]interface{}{}
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+			t.Fatalf("Output is not valid JSON: %v\n%s", err, out.String())
+		}
+		if len(decoded) != 2 {
+			t.Fatalf("Expected 2 results, got %d", len(decoded))
+		}
+		if decoded[0]["title"] != "Local SSH" {
+			t.Errorf("Expected title Local SSH, got %v", decoded[0]["title"])
+		}
+		if _, ok := decoded[0]["error"]; ok {
+			t.Errorf("Expected no error for a successful result, got %v", decoded[0]["error"])
+		}
+		if decoded[1]["error"] != "connection refused" {
+			t.Errorf("Expected the error message to be printed, got %v", decoded[1]["error"])
+		}
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		if err := writeEvalResults(out, EvalOutputYAML, evalTestResults()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		decoded := []map[string]interface{}{}
+		if err := yaml.Unmarshal(out.Bytes(), &decoded); err != nil {
+			t.Fatalf("Output is not valid YAML: %v\n%s", err, out.String())
+		}
+		if len(decoded) != 2 {
+			t.Fatalf("Expected 2 results, got %d", len(decoded))
+		}
+		if decoded[1]["error"] != "connection refused" {
+			t.Errorf("Expected the error message to be printed, got %v", decoded[1]["error"])
+		}
+	})
+
+	t.Run("Table", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		if err := writeEvalResults(out, EvalOutputTable, evalTestResults()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, expected := range []string{
+			"PLUGIN",
+			"local-ssh",
+			"remote-ssh",
+			"connection refused",
+			"local-ssh: Password authentication is enabled",
+			"PasswordAuthentication should be no",
+		} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("Expected table to contain %q, got:\n%s", expected, out.String())
+			}
+		}
+	})
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		if err := writeEvalResults(&bytes.Buffer{}, "xml", evalTestResults()); err == nil {
+			t.Errorf("Expected an error for an unsupported format")
+		}
+	})
+}
@@ -0,0 +1,378 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/compliance-framework/framework/domain"
+	"github.com/compliance-framework/framework/internal/event"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// healthConfig configures the agent's HTTP listener, which serves health checks and metrics.
+// Changes to the listen address take effect when the agent is restarted.
+type healthConfig struct {
+	// Address is the address the listener binds to, such as `:9090`. If it is empty, there is no listener.
+	Address string `mapstructure:"address"`
+	// MaxRunAge is how long the agent may go without a successful run before it is reported as unhealthy.
+	// If it is zero, the agent is healthy regardless of its runs.
+	MaxRunAge time.Duration `mapstructure:"max_run_age"`
+}
+
+// healthShutdownTimeout is how long in-flight health and metrics requests are given when the agent stops.
+const healthShutdownTimeout = 5 * time.Second
+
+// agentStatus tracks whether the agent is healthy and ready, and exports metrics about its runs,
+// downloads and publishing.
+//
+// A nil *agentStatus is valid, and records nothing.
+type agentStatus struct {
+	registry *prometheus.Registry
+
+	runs          *prometheus.CounterVec
+	runErrors     *prometheus.CounterVec
+	runDuration   *prometheus.HistogramVec
+	findings      *prometheus.CounterVec
+	observations  *prometheus.CounterVec
+	downloadTime  *prometheus.HistogramVec
+	publishErrors *prometheus.CounterVec
+	lastSuccess   prometheus.Gauge
+	progress      *prometheus.GaugeVec
+
+	started time.Time
+	// ready is set once plugins have been downloaded, and the agent has started running them.
+	ready atomic.Bool
+	// lastSuccessfulRun is the time of the last successful run, in Unix nanoseconds.
+	lastSuccessfulRun atomic.Int64
+	// lastRun is the most recent run, whether or not it succeeded, reported in heartbeats.
+	lastRun atomic.Pointer[domain.AgentRun]
+}
+
+func newAgentStatus() *agentStatus {
+	s := &agentStatus{
+		registry: prometheus.NewRegistry(),
+		started:  time.Now(),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cf_agent_runs_total",
+			Help: "Number of times a plugin has been evaluated against a policy.",
+		}, []string{"plugin", "policy"}),
+		runErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cf_agent_run_errors_total",
+			Help: "Number of plugin evaluations against a policy which failed.",
+		}, []string{"plugin", "policy"}),
+		runDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "cf_agent_run_duration_seconds",
+			Help:    "Time taken to evaluate a plugin against a policy.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+		}, []string{"plugin", "policy"}),
+		findings: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cf_agent_findings_total",
+			Help: "Number of findings produced by evaluating a plugin against a policy.",
+		}, []string{"plugin", "policy"}),
+		observations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cf_agent_observations_total",
+			Help: "Number of observations produced by evaluating a plugin against a policy.",
+		}, []string{"plugin", "policy"}),
+		downloadTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "cf_agent_download_duration_seconds",
+			Help:    "Time taken to retrieve a plugin or policy, including cached and local sources.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"type", "source"}),
+		publishErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cf_agent_publish_errors_total",
+			Help: "Number of messages which could not be published.",
+		}, []string{"topic"}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cf_agent_last_successful_run_timestamp_seconds",
+			Help: "Unix time of the last successful plugin evaluation.",
+		}),
+		progress: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cf_agent_plugin_progress_ratio",
+			Help: "Fraction of its current call a plugin last reported having completed.",
+		}, []string{"plugin"}),
+	}
+
+	s.registry.MustRegister(
+		s.runs,
+		s.runErrors,
+		s.runDuration,
+		s.findings,
+		s.observations,
+		s.downloadTime,
+		s.publishErrors,
+		s.lastSuccess,
+		s.progress,
+	)
+	return s
+}
+
+// registerBus exports the state of the NATS connection, and the number of results waiting in and dropped from the
+// outbox.
+func (s *agentStatus) registerBus(bus *event.NatsBus, outbox *event.Outbox) {
+	if s == nil {
+		return
+	}
+	s.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "cf_agent_nats_connected",
+			Help: "Whether the agent is connected to NATS.",
+		}, func() float64 {
+			if bus.Connected() {
+				return 1
+			}
+			return 0
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "cf_agent_outbox_messages",
+			Help: "Number of results in the outbox waiting to be published.",
+		}, func() float64 {
+			return float64(outbox.Len())
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "cf_agent_outbox_dropped_total",
+			Help: "Number of results dropped from the outbox without being published.",
+		}, func() float64 {
+			return float64(outbox.Dropped())
+		}),
+	)
+}
+
+// observeProgress records the progress a plugin has reported through host services.
+func (s *agentStatus) observeProgress(pluginName string, completed int64, total int64) {
+	if s == nil || total <= 0 {
+		return
+	}
+	s.progress.WithLabelValues(pluginName).Set(float64(completed) / float64(total))
+}
+
+// observeRun records the evaluation of a plugin against a policy. res is nil if the evaluation failed.
+func (s *agentStatus) observeRun(pluginName string, policy string, duration time.Duration, res *proto2.EvalResponse, err error) {
+	if s == nil {
+		return
+	}
+
+	now := time.Now()
+	run := &domain.AgentRun{
+		Plugin:  pluginName,
+		Policy:  policy,
+		Success: err == nil,
+		Time:    now.UTC(),
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	s.lastRun.Store(run)
+
+	s.runs.WithLabelValues(pluginName, policy).Inc()
+	if duration > 0 {
+		s.runDuration.WithLabelValues(pluginName, policy).Observe(duration.Seconds())
+	}
+	if err != nil {
+		s.runErrors.WithLabelValues(pluginName, policy).Inc()
+		return
+	}
+
+	s.observeResult(pluginName, policy, res)
+
+	s.lastSuccessfulRun.Store(now.UnixNano())
+	s.lastSuccess.Set(float64(now.Unix()))
+}
+
+// observeResult records the findings and observations of a result, or of a chunk of one.
+func (s *agentStatus) observeResult(pluginName string, policy string, res *proto2.EvalResponse) {
+	if s == nil || res == nil {
+		return
+	}
+	s.findings.WithLabelValues(pluginName, policy).Add(float64(len(res.Findings)))
+	s.observations.WithLabelValues(pluginName, policy).Add(float64(len(res.Observations)))
+}
+
+// observeDownload records the time taken to retrieve a plugin or policy.
+func (s *agentStatus) observeDownload(type_ string, source string, duration time.Duration) {
+	if s == nil {
+		return
+	}
+	s.downloadTime.WithLabelValues(type_, source).Observe(duration.Seconds())
+}
+
+// observePublishError records a message which could not be published on topic.
+func (s *agentStatus) observePublishError(topic string) {
+	if s == nil {
+		return
+	}
+	s.publishErrors.WithLabelValues(topic).Inc()
+}
+
+// latestRun returns the most recent run, or nil if nothing has run yet.
+func (s *agentStatus) latestRun() *domain.AgentRun {
+	if s == nil {
+		return nil
+	}
+	return s.lastRun.Load()
+}
+
+// setReady marks the agent as ready, once it has started running plugins.
+func (s *agentStatus) setReady() {
+	if s == nil {
+		return
+	}
+	s.ready.Store(true)
+}
+
+// healthReport describes the agent's health and readiness.
+type healthReport struct {
+	Status            string     `json:"status"`
+	Ready             bool       `json:"ready"`
+	NatsConnected     bool       `json:"nats_connected"`
+	LastSuccessfulRun *time.Time `json:"last_successful_run,omitempty"`
+	Problems          []string   `json:"problems,omitempty"`
+}
+
+// live returns whether the agent is making progress. It is unhealthy if it has gone more than maxRunAge
+// without a successful run. Until the first run, this is measured from when the agent started.
+func (s *agentStatus) live(now time.Time, maxRunAge time.Duration) (bool, string) {
+	if maxRunAge <= 0 {
+		return true, ""
+	}
+
+	since := s.started
+	if last := s.lastSuccessfulRun.Load(); last != 0 {
+		since = time.Unix(0, last)
+	}
+	if age := now.Sub(since); age > maxRunAge {
+		return false, fmt.Sprintf("no successful run for %s, exceeding max_run_age of %s", age.Round(time.Second), maxRunAge)
+	}
+	return true, ""
+}
+
+// report checks the agent's liveness and readiness. The agent is ready once it has started running plugins,
+// and while it is connected to NATS.
+func (s *agentStatus) report(now time.Time, maxRunAge time.Duration, natsConnected bool) (live bool, ready bool, report healthReport) {
+	report = healthReport{
+		Status:        "ok",
+		Ready:         true,
+		NatsConnected: natsConnected,
+		Problems:      []string{},
+	}
+	if last := s.lastSuccessfulRun.Load(); last != 0 {
+		lastRun := time.Unix(0, last).UTC()
+		report.LastSuccessfulRun = &lastRun
+	}
+
+	live, problem := s.live(now, maxRunAge)
+	if !live {
+		report.Status = "unhealthy"
+		report.Problems = append(report.Problems, problem)
+	}
+
+	ready = live
+	if !s.ready.Load() {
+		ready = false
+		report.Problems = append(report.Problems, "plugins have not been started")
+	}
+	if !natsConnected {
+		ready = false
+		report.Problems = append(report.Problems, "not connected to NATS")
+	}
+	report.Ready = ready
+
+	return live, ready, report
+}
+
+// healthReport returns the agent's current liveness and readiness.
+func (ar *AgentRunner) healthReport() (bool, bool, healthReport) {
+	maxRunAge := time.Duration(0)
+	if health := ar.health.Load(); health != nil {
+		maxRunAge = health.MaxRunAge
+	}
+
+	return ar.status.report(time.Now(), maxRunAge, ar.natsBus.Connected())
+}
+
+// healthHandler serves /healthz, /readyz and /metrics.
+func (ar *AgentRunner) healthHandler() http.Handler {
+	writeReport := func(w http.ResponseWriter, ok bool, report healthReport) {
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		live, _, report := ar.healthReport()
+		writeReport(w, live, report)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		_, ready, report := ar.healthReport()
+		writeReport(w, ready, report)
+	})
+	mux.Handle("GET /metrics", promhttp.HandlerFor(ar.status.registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+// serveHealth starts the health and metrics listener, if one is configured. The returned function stops it.
+func (ar *AgentRunner) serveHealth() (func(), error) {
+	if ar.config.Health == nil || ar.config.Health.Address == "" {
+		return func() {}, nil
+	}
+
+	listener, err := net.Listen("tcp", ar.config.Health.Address)
+	if err != nil {
+		return nil, fmt.Errorf("starting health listener: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           ar.healthHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ar.logger.Error("Health listener stopped", "error", err)
+		}
+	}()
+	ar.logger.Info("Serving health checks and metrics", "address", listener.Addr().String())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
+
+// watchdog pings the systemd watchdog while the agent is live, if the service has a watchdog configured.
+// If the agent stops making progress, the pings stop, and systemd restarts it.
+func (ar *AgentRunner) watchdog(ctx context.Context) {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil || interval == 0 {
+		return
+	}
+
+	// systemd recommends pinging at half the watchdog interval.
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		if live, _, report := ar.healthReport(); live {
+			_, _ = daemon.SdNotify(false, daemon.SdNotifyWatchdog)
+		} else {
+			ar.logger.Warn("Agent is unhealthy, not notifying the systemd watchdog", "problems", report.Problems)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
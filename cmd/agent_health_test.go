@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compliance-framework/framework/internal/event"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestAgentStatus_Report(t *testing.T) {
+	tests := []struct {
+		name          string
+		ready         bool
+		natsConnected bool
+		lastRun       time.Duration
+		maxRunAge     time.Duration
+		expectLive    bool
+		expectReady   bool
+	}{
+		{name: "Ready", ready: true, natsConnected: true, expectLive: true, expectReady: true},
+		{name: "Not Started", ready: false, natsConnected: true, expectLive: true, expectReady: false},
+		{name: "NATS Disconnected", ready: true, natsConnected: false, expectLive: true, expectReady: false},
+		{name: "Recent Run", ready: true, natsConnected: true, lastRun: time.Minute, maxRunAge: time.Hour, expectLive: true, expectReady: true},
+		{name: "Stale Run", ready: true, natsConnected: true, lastRun: 2 * time.Hour, maxRunAge: time.Hour, expectLive: false, expectReady: false},
+		{name: "Stale Run Without Max Age", ready: true, natsConnected: true, lastRun: 2 * time.Hour, expectLive: true, expectReady: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := newAgentStatus()
+			if test.ready {
+				status.setReady()
+			}
+			status.observeRun("ssh", "policy", time.Second, &proto2.EvalResponse{}, nil)
+
+			live, ready, report := status.report(time.Now().Add(test.lastRun), test.maxRunAge, test.natsConnected)
+			if live != test.expectLive {
+				t.Errorf("Expected live to be %v, got %v (%v)", test.expectLive, live, report.Problems)
+			}
+			if ready != test.expectReady {
+				t.Errorf("Expected ready to be %v, got %v (%v)", test.expectReady, ready, report.Problems)
+			}
+			if report.LastSuccessfulRun == nil {
+				t.Errorf("Expected the last successful run to be reported")
+			}
+		})
+	}
+
+	t.Run("Measures from start until the first run", func(t *testing.T) {
+		status := newAgentStatus()
+		status.setReady()
+		status.observeRun("ssh", "policy", time.Second, nil, errors.New("failed"))
+
+		live, _, _ := status.report(time.Now().Add(2*time.Hour), time.Hour, true)
+		if live {
+			t.Errorf("Expected the agent to be unhealthy without a successful run")
+		}
+	})
+}
+
+func TestAgentRunner_HealthHandler(t *testing.T) {
+	ar := newTestAgentRunner(agentConfig{})
+	ar.natsBus = event.NewNatsBus(hclog.NewNullLogger())
+	ar.status = newAgentStatus()
+	ar.status.setReady()
+	ar.status.observeRun("ssh", "policy", time.Second, &proto2.EvalResponse{
+		Findings:     []*proto2.Finding{{}, {}},
+		Observations: []*proto2.Observation{{}},
+	}, nil)
+	ar.status.observeRun("ssh", "policy", time.Second, nil, errors.New("failed"))
+	ar.status.observeDownload("plugins", "ghcr.io/some-plugin:v1", time.Second)
+	ar.status.observePublishError(AgentResultTopic)
+
+	server := httptest.NewServer(ar.healthHandler())
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Error requesting %s: %v", path, err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("Error reading %s: %v", path, err)
+		}
+		return res.StatusCode, string(body)
+	}
+
+	t.Run("Healthy while making progress", func(t *testing.T) {
+		code, body := get("/healthz")
+		if code != http.StatusOK {
+			t.Errorf("Expected /healthz to return 200, got %d: %s", code, body)
+		}
+	})
+
+	t.Run("Not ready without NATS", func(t *testing.T) {
+		code, body := get("/readyz")
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("Expected /readyz to return 503, got %d: %s", code, body)
+		}
+
+		report := healthReport{}
+		if err := json.Unmarshal([]byte(body), &report); err != nil {
+			t.Fatalf("Error decoding report: %v", err)
+		}
+		if report.NatsConnected || report.Ready {
+			t.Errorf("Expected the report to show NATS is disconnected, got %+v", report)
+		}
+	})
+
+	t.Run("Exports metrics", func(t *testing.T) {
+		code, body := get("/metrics")
+		if code != http.StatusOK {
+			t.Fatalf("Expected /metrics to return 200, got %d", code)
+		}
+
+		for _, metric := range []string{
+			`cf_agent_runs_total{plugin="ssh",policy="policy"} 2`,
+			`cf_agent_run_errors_total{plugin="ssh",policy="policy"} 1`,
+			`cf_agent_findings_total{plugin="ssh",policy="policy"} 2`,
+			`cf_agent_observations_total{plugin="ssh",policy="policy"} 1`,
+			`cf_agent_run_duration_seconds_count{plugin="ssh",policy="policy"} 2`,
+			`cf_agent_download_duration_seconds_count{source="ghcr.io/some-plugin:v1",type="plugins"} 1`,
+			`cf_agent_publish_errors_total{topic="job.result"} 1`,
+		} {
+			if !strings.Contains(body, metric) {
+				t.Errorf("Expected metrics to contain %s", metric)
+			}
+		}
+	})
+}
+
+func TestAgentRunner_HealthReport_ConfigLocked(t *testing.T) {
+	ar := newTestAgentRunner(agentConfig{})
+	ar.natsBus = event.NewNatsBus(hclog.NewNullLogger())
+	ar.status = newAgentStatus()
+	ar.health.Store(&healthConfig{MaxRunAge: time.Nanosecond})
+
+	// Health checks don't wait for the configuration, however long it is locked, such as by a reload.
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	done := make(chan bool, 1)
+	go func() {
+		live, _, _ := ar.healthReport()
+		done <- live
+	}()
+	select {
+	case live := <-done:
+		if live {
+			t.Errorf("Expected the configured max run age to be checked")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected health to be reported while the configuration is locked")
+	}
+}
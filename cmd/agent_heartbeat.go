@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/compliance-framework/framework/domain"
+	apievent "github.com/compliance-framework/framework/event"
+	"github.com/compliance-framework/framework/internal"
+	"github.com/compliance-framework/framework/internal/event"
+)
+
+// Version is the version of cf. Releases set it with
+// -ldflags "-X github.com/compliance-framework/framework/cmd.Version=<version>".
+var Version string
+
+// AgentHeartbeatTopic is the NATS topic agents register on, and publish their heartbeats to.
+const AgentHeartbeatTopic = string(apievent.TopicTypeAgent)
+
+// agentVersion returns the version of cf, falling back to the module version and VCS revision it was built from.
+func agentVersion() string {
+	if Version != "" {
+		return Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && setting.Value != "" {
+			version = fmt.Sprintf("%s+%.12s", version, setting.Value)
+		}
+	}
+	return version
+}
+
+// agentId returns the configured agent id. By default, the id is derived from the hostname and config file
+// path, so it is stable across restarts, but differs between agents sharing a host.
+func (ac *agentConfig) agentId(configPath string) (string, error) {
+	if ac.Id != "" {
+		return ac.Id, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("could not determine agent id: %w", err)
+	}
+	id, err := internal.SeededUUID([]string{
+		fmt.Sprintf("hostname:%s", hostname),
+		fmt.Sprintf("config:%s", configPath),
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not determine agent id: %w", err)
+	}
+	return id.String(), nil
+}
+
+// agentEvent describes the agent, its configured plugins and policies, and its last run, for the API.
+func (ar *AgentRunner) agentEvent(eventType string) apievent.AgentEvent {
+	hostname, _ := os.Hostname()
+
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
+	plugins := []domain.AgentPlugin{}
+	for name, pluginConfig := range ar.config.Plugins {
+		plugin := domain.AgentPlugin{
+			Name:     name,
+			Source:   pluginConfig.Source,
+			Version:  ar.pluginVersions[pluginConfig.Source],
+			Schedule: pluginConfig.schedule(),
+			Policies: []domain.AgentPolicy{},
+		}
+		for _, policy := range pluginConfig.Policies {
+			plugin.Policies = append(plugin.Policies, domain.AgentPolicy{
+				Source:  policy.Source,
+				Version: ar.policyVersions[policy.Source],
+			})
+		}
+		plugins = append(plugins, plugin)
+	}
+	slices.SortFunc(plugins, func(a, b domain.AgentPlugin) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return apievent.AgentEvent{
+		Type: eventType,
+		Agent: domain.Agent{
+			Id:      ar.agentId,
+			Version: agentVersion(),
+			Status:  domain.AgentStatusRunning,
+			Host: domain.AgentHost{
+				Hostname: hostname,
+				OS:       runtime.GOOS,
+				Arch:     runtime.GOARCH,
+				CPUs:     runtime.NumCPU(),
+			},
+			Labels:            ar.config.Labels,
+			Plugins:           plugins,
+			LastRun:           ar.status.latestRun(),
+			StartedAt:         ar.started.UTC(),
+			HeartbeatInterval: ar.config.heartbeatInterval(),
+		},
+	}
+}
+
+// publishAgentEvent publishes the agent's current state. Heartbeats are not held in the outbox, as only the
+// latest matters, so they are dropped while NATS is unavailable.
+func (ar *AgentRunner) publishAgentEvent(eventType string) {
+	if err := event.Publish(ar.natsBus, ar.agentEvent(eventType), AgentHeartbeatTopic); err != nil {
+		ar.status.observePublishError(AgentHeartbeatTopic)
+		ar.logger.Debug("Error publishing agent heartbeat", "type", eventType, "error", err)
+	}
+}
+
+// startHeartbeats registers the agent, and publishes heartbeats until the returned function is called,
+// which publishes that the agent has stopped.
+func (ar *AgentRunner) startHeartbeats() func() {
+	ar.publishAgentEvent(apievent.AgentEventRegistered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ar.mu.RLock()
+		interval := ar.config.heartbeatInterval()
+		ar.mu.RUnlock()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			ar.publishAgentEvent(apievent.AgentEventHeartbeat)
+
+			// The interval may have been changed by a configuration reload.
+			ar.mu.RLock()
+			next := ar.config.heartbeatInterval()
+			ar.mu.RUnlock()
+			if next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		ar.publishAgentEvent(apievent.AgentEventStopped)
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/compliance-framework/framework/domain"
+	apievent "github.com/compliance-framework/framework/event"
+	"github.com/compliance-framework/framework/internal/event"
+	"github.com/hashicorp/go-hclog"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+func TestAgentConfig_AgentId(t *testing.T) {
+	configured := &agentConfig{Id: "web-01"}
+	if id, err := configured.agentId("/etc/cf/agent.yaml"); err != nil || id != "web-01" {
+		t.Errorf("Expected the configured id, got %q (%v)", id, err)
+	}
+
+	config := &agentConfig{}
+	first, err := config.agentId("/etc/cf/agent.yaml")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	again, _ := config.agentId("/etc/cf/agent.yaml")
+	other, _ := config.agentId("/etc/cf/other.yaml")
+
+	if first == "" || first != again {
+		t.Errorf("Expected the derived id to be stable, got %q and %q", first, again)
+	}
+	if first == other {
+		t.Errorf("Expected agents with different configurations to have different ids, both got %q", first)
+	}
+}
+
+func TestAgentRunner_AgentEvent(t *testing.T) {
+	ar := newTestAgentRunner(agentConfig{
+		Labels: map[string]string{"env": "prod"},
+		Plugins: map[string]*agentPlugin{
+			"remote-ssh": {Source: "ghcr.io/compliance-framework/plugin-remote-ssh:v1"},
+			"local-ssh": {
+				Source:   "ghcr.io/compliance-framework/plugin-local-ssh:v1",
+				Schedule: "@every 5m",
+				Policies: []agentPolicy{{Source: "ghcr.io/compliance-framework/policies-ssh:v1"}},
+			},
+		},
+	})
+	ar.agentId = "web-01"
+	ar.status = newAgentStatus()
+	ar.pluginVersions["ghcr.io/compliance-framework/plugin-local-ssh:v1"] = "sha256:plugin"
+	ar.policyVersions["ghcr.io/compliance-framework/policies-ssh:v1"] = "2024.11.1"
+	ar.status.observeRun("local-ssh", "ghcr.io/compliance-framework/policies-ssh:v1", time.Second, nil, errors.New("connection refused"))
+
+	agentEvent := ar.agentEvent(apievent.AgentEventHeartbeat)
+	agent := agentEvent.Agent
+
+	if agentEvent.Type != apievent.AgentEventHeartbeat || agent.Id != "web-01" || agent.Status != domain.AgentStatusRunning {
+		t.Errorf("Expected a heartbeat from running agent web-01, got %s from %s (%s)", agentEvent.Type, agent.Id, agent.Status)
+	}
+	if agent.Version == "" || agent.Host.OS == "" || agent.Host.CPUs == 0 {
+		t.Errorf("Expected the version and host facts, got %q and %+v", agent.Version, agent.Host)
+	}
+	if agent.Labels["env"] != "prod" {
+		t.Errorf("Expected the agent's labels, got %v", agent.Labels)
+	}
+	if agent.HeartbeatInterval != DefaultHeartbeatInterval {
+		t.Errorf("Expected the default heartbeat interval, got %s", agent.HeartbeatInterval)
+	}
+
+	if len(agent.Plugins) != 2 || agent.Plugins[0].Name != "local-ssh" {
+		t.Fatalf("Expected both plugins sorted by name, got %+v", agent.Plugins)
+	}
+	plugin := agent.Plugins[0]
+	if plugin.Version != "sha256:plugin" || plugin.Schedule != "@every 5m" {
+		t.Errorf("Expected the plugin's version and schedule, got %+v", plugin)
+	}
+	if len(plugin.Policies) != 1 || plugin.Policies[0].Version != "2024.11.1" {
+		t.Errorf("Expected the policy and its version, got %+v", plugin.Policies)
+	}
+	if agent.Plugins[1].Schedule != DefaultPluginSchedule {
+		t.Errorf("Expected the default schedule, got %s", agent.Plugins[1].Schedule)
+	}
+
+	if agent.LastRun == nil || agent.LastRun.Success || agent.LastRun.Error != "connection refused" {
+		t.Errorf("Expected the failed last run, got %+v", agent.LastRun)
+	}
+}
+
+func TestAgentRunner_Heartbeats(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	options := natsserver.DefaultTestOptions
+	options.Port = -1
+	s := natsserver.RunServer(&options)
+	defer s.Shutdown()
+
+	sub, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Error connecting to NATS: %v", err)
+	}
+	defer sub.Close()
+
+	received := make(chan apievent.AgentEvent, 10)
+	_, err = sub.Subscribe(AgentHeartbeatTopic, func(m *nats.Msg) {
+		var agentEvent apievent.AgentEvent
+		if err := json.Unmarshal(m.Data, &agentEvent); err == nil {
+			received <- agentEvent
+		}
+	})
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+	if err := sub.Flush(); err != nil {
+		t.Fatalf("Error flushing subscription: %v", err)
+	}
+
+	ar := newTestAgentRunner(agentConfig{HeartbeatInterval: 20 * time.Millisecond})
+	ar.agentId = "web-01"
+	ar.natsBus = event.NewNatsBus(hclog.NewNullLogger())
+	if err := ar.natsBus.Connect(s.ClientURL()); err != nil {
+		t.Fatalf("Error connecting to NATS: %v", err)
+	}
+	defer ar.natsBus.Close()
+
+	next := func() apievent.AgentEvent {
+		select {
+		case agentEvent := <-received:
+			if agentEvent.Id != "web-01" {
+				t.Errorf("Expected events from agent web-01, got %q", agentEvent.Id)
+			}
+			return agentEvent
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected an agent event")
+		}
+		return apievent.AgentEvent{}
+	}
+
+	stop := ar.startHeartbeats()
+	if agentEvent := next(); agentEvent.Type != apievent.AgentEventRegistered {
+		t.Errorf("Expected the agent to register first, got %s", agentEvent.Type)
+	}
+	if agentEvent := next(); agentEvent.Type != apievent.AgentEventHeartbeat {
+		t.Errorf("Expected a heartbeat, got %s", agentEvent.Type)
+	}
+
+	stop()
+	for {
+		agentEvent := next()
+		if agentEvent.Type == apievent.AgentEventStopped {
+			break
+		}
+		if agentEvent.Type != apievent.AgentEventHeartbeat {
+			t.Fatalf("Expected heartbeats until the agent stopped, got %s", agentEvent.Type)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/compliance-framework/framework/internal/kv"
+	"github.com/compliance-framework/framework/internal/telemetry"
+	policy_manager "github.com/compliance-framework/framework/policy-manager"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-hclog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AgentPluginCacheDir is where plugins' persistent caches are kept, relative to the user's home directory.
+const AgentPluginCacheDir = ".compliance-framework/plugin-cache"
+
+// pluginCacheConfig configures the persistent caches plugins use through host services.
+type pluginCacheConfig struct {
+	// Path is the directory caches are kept in, with a subdirectory for each plugin.
+	Path string `mapstructure:"path"`
+}
+
+// pluginCacheDir returns the directory plugins' caches are kept in, in the user's home directory by default.
+func (ac *agentConfig) pluginCacheDir() (string, error) {
+	if ac.PluginCache != nil && ac.PluginCache.Path != "" {
+		return ac.PluginCache.Path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine plugin cache path: %w", err)
+	}
+	return path.Join(home, AgentPluginCacheDir), nil
+}
+
+// pluginCacheNamePattern matches plugin names which are safe to use as the name of their cache directory.
+var pluginCacheNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// pluginCacheName returns the name of the plugin's cache directory. Plugin names can come from assessment
+// plans, so any name which isn't plainly safe, such as `..`, is replaced by its sha256 to keep the cache inside
+// the cache directory.
+func pluginCacheName(pluginName string) string {
+	if pluginCacheNamePattern.MatchString(pluginName) {
+		return pluginName
+	}
+	sum := sha256.Sum256([]byte(pluginName))
+	return "sha256-" + hex.EncodeToString(sum[:])
+}
+
+// errNotEvaluating is returned when a plugin asks to evaluate a policy bundle outside an evaluation of it.
+var errNotEvaluating = errors.New("only the policy bundle being evaluated can be evaluated by the agent")
+
+// pluginHost provides the agent's host services to a plugin process. As each process is used by one run at a
+// time, and a run evaluates its policies one at a time, calls from the plugin belong to the evaluation in
+// progress, which the agent sets with beginEval.
+type pluginHost struct {
+	logger     hclog.Logger
+	pluginName string
+	status     *agentStatus
+	// cacheDir is the plugin's cache directory, which is only created once the plugin uses it.
+	cacheDir string
+	cacheErr error
+
+	cacheOnce sync.Once
+	cache     *kv.Store
+
+	mu   sync.Mutex
+	eval *hostEval
+}
+
+// hostEval is an evaluation of a policy bundle by a plugin, which the plugin's logs and progress are part of.
+type hostEval struct {
+	bundlePath string
+	span       trace.Span
+	logs       []*proto2.LogEntry
+}
+
+// newPluginHost returns the host services for a process of the plugin.
+func (ar *AgentRunner) newPluginHost(logger hclog.Logger, pluginName string) *pluginHost {
+	host := &pluginHost{
+		logger:     logger.Named("host"),
+		pluginName: pluginName,
+		status:     ar.status,
+	}
+	ar.mu.RLock()
+	dir, err := ar.config.pluginCacheDir()
+	ar.mu.RUnlock()
+	if err != nil {
+		host.cacheErr = err
+	} else {
+		host.cacheDir = path.Join(dir, pluginCacheName(pluginName))
+	}
+	return host
+}
+
+// beginEval starts the evaluation of a policy bundle, which the plugin's logs and progress are part of until
+// endEval is called.
+func (h *pluginHost) beginEval(ctx context.Context, bundlePath string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.eval = &hostEval{bundlePath: bundlePath, span: trace.SpanFromContext(ctx)}
+}
+
+// endEval ends the evaluation in progress, returning the log entries the plugin added to its result.
+func (h *pluginHost) endEval() []*proto2.LogEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	eval := h.eval
+	h.eval = nil
+	if eval == nil {
+		return nil
+	}
+	return eval.logs
+}
+
+func (h *pluginHost) EvalPolicy(ctx context.Context, bundlePath string, namespace string, input map[string]interface{}) (_ []policy_manager.Result, err error) {
+	h.mu.Lock()
+	evaluating := h.eval != nil && h.eval.bundlePath == bundlePath
+	h.mu.Unlock()
+	if !evaluating {
+		return nil, errNotEvaluating
+	}
+
+	ctx, span := tracer.Start(ctx, "host eval policy", trace.WithAttributes(attrPlugin.String(h.pluginName)))
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	return policy_manager.New(ctx, h.logger.Named("policy"), bundlePath).Execute(ctx, namespace, input)
+}
+
+func (h *pluginHost) Log(ctx context.Context, entry *proto2.LogEntry) error {
+	if entry == nil {
+		return errors.New("no log entry")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.eval == nil {
+		h.logger.Info(entry.Title, "description", entry.Description, "remarks", entry.Remarks)
+		return nil
+	}
+	h.logger.Debug("Plugin added log entry", "title", entry.Title)
+	h.eval.logs = append(h.eval.logs, entry)
+	return nil
+}
+
+// store returns the plugin's cache, opening it when it is first used.
+func (h *pluginHost) store() (*kv.Store, error) {
+	h.cacheOnce.Do(func() {
+		if h.cacheErr == nil {
+			h.cache, h.cacheErr = kv.Open(h.cacheDir)
+		}
+	})
+	return h.cache, h.cacheErr
+}
+
+func (h *pluginHost) CacheGet(ctx context.Context, key string) ([]byte, bool, error) {
+	store, err := h.store()
+	if err != nil {
+		return nil, false, err
+	}
+	return store.Get(key)
+}
+
+func (h *pluginHost) CacheSet(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	store, err := h.store()
+	if err != nil {
+		return err
+	}
+	return store.Set(key, value, ttl)
+}
+
+func (h *pluginHost) CacheDelete(ctx context.Context, key string) error {
+	store, err := h.store()
+	if err != nil {
+		return err
+	}
+	return store.Delete(key)
+}
+
+func (h *pluginHost) Progress(ctx context.Context, completed int64, total int64, message string) error {
+	if completed < 0 || total < 0 {
+		return fmt.Errorf("progress cannot be negative: %d of %d", completed, total)
+	}
+
+	h.logger.Debug("Plugin progress", "completed", completed, "total", total, "message", message)
+	h.status.observeProgress(h.pluginName, completed, total)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.eval != nil {
+		h.eval.span.AddEvent("progress", trace.WithAttributes(
+			attribute.Int64("completed", completed),
+			attribute.Int64("total", total),
+			attribute.String("message", message),
+		))
+	}
+	return nil
+}
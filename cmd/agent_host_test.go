@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compliance-framework/framework/internal"
+	runner2 "github.com/compliance-framework/framework/runner"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+)
+
+func TestPluginHost(t *testing.T) {
+	ar := newTestAgentRunner(agentConfig{PluginCache: &pluginCacheConfig{Path: t.TempDir()}})
+	host := ar.newPluginHost(ar.logger, "test/plugin")
+	ctx := context.Background()
+
+	if _, err := host.EvalPolicy(ctx, "../policy-manager/testdata", "local_ssh", nil); !errors.Is(err, errNotEvaluating) {
+		t.Errorf("Expected policies not to be evaluated outside an evaluation, got %v", err)
+	}
+	if err := host.Log(ctx, &proto2.LogEntry{Title: "Outside"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	host.beginEval(ctx, "../policy-manager/testdata")
+	results, err := host.EvalPolicy(ctx, "../policy-manager/testdata", "local_ssh", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Unexpected error evaluating policies: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Expected one result, got %d", len(results))
+	}
+	if _, err := host.EvalPolicy(ctx, "/etc", "local_ssh", nil); !errors.Is(err, errNotEvaluating) {
+		t.Errorf("Expected other bundles not to be evaluated, got %v", err)
+	}
+	if err := host.Log(ctx, &proto2.LogEntry{Title: "Inside"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := host.Progress(ctx, -1, 10, ""); err == nil {
+		t.Errorf("Expected negative progress to be rejected")
+	}
+	logs := host.endEval()
+	if len(logs) != 1 || logs[0].Title != "Inside" {
+		t.Errorf("Expected only the log entry added during the evaluation, got %v", logs)
+	}
+
+	if err := host.CacheSet(ctx, "key", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	other := ar.newPluginHost(ar.logger, "other")
+	if _, found, _ := other.CacheGet(ctx, "key"); found {
+		t.Errorf("Expected caches to be scoped to the plugin")
+	}
+	value, found, err := ar.newPluginHost(ar.logger, "test/plugin").CacheGet(ctx, "key")
+	if err != nil || !found || string(value) != "value" {
+		t.Errorf("Expected the plugin's cache to persist, got %q, %v, %v", value, found, err)
+	}
+}
+
+func TestPluginCacheName(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{".", "..", "../../etc", "test/plugin", "AWS EC2", ".hidden", ""} {
+		cacheName := pluginCacheName(name)
+		if !strings.HasPrefix(cacheName, "sha256-") {
+			t.Errorf("Expected the cache of %q to be named by its hash, got %q", name, cacheName)
+		}
+		if cacheDir := path.Join(dir, cacheName); path.Dir(cacheDir) != dir {
+			t.Errorf("Expected the cache of %q to be inside %s, got %s", name, dir, cacheDir)
+		}
+	}
+	if pluginCacheName("..") == pluginCacheName(".") {
+		t.Errorf("Expected different names to have different caches")
+	}
+
+	for _, name := range []string{"local-ssh", "aws_ec2", "plugin.v2"} {
+		if cacheName := pluginCacheName(name); cacheName != name {
+			t.Errorf("Expected the cache of %q to be named after it, got %q", name, cacheName)
+		}
+	}
+}
+
+func TestAgentRunner_HostServices(t *testing.T) {
+	pluginConfig := &agentPlugin{
+		Source:   "test-plugin",
+		Policies: []agentPolicy{{Source: "policy"}},
+		Config:   agentPluginConfig{"region": "eu-west-1", "host": "true"},
+	}
+	ar := newTestAgentRunner(agentConfig{
+		Plugins:     map[string]*agentPlugin{"test-plugin": pluginConfig},
+		PluginCache: &pluginCacheConfig{Path: t.TempDir()},
+	})
+	ar.pluginLocations["test-plugin"] = os.Args[0]
+	ar.policyLocations["policy"] = "../policy-manager/testdata"
+	ar.logWriter = io.Discard
+	ar.setupPluginTask = &internal.Task{}
+	ar.setupPoliciesTask = &internal.Task{}
+	t.Cleanup(ar.closePluginClients)
+
+	results := []*runner2.Result{}
+	ar.collect = func(result *runner2.Result) {
+		results = append(results, result)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ar.runPlugin(context.Background(), "test-plugin", pluginConfig, pluginConfig.Policies); err != nil {
+			t.Fatalf("Unexpected error running plugin: %v", err)
+		}
+		// A new process each time, so the cache is shown to persist between processes.
+		ar.pool.close()
+		ar.pool = pluginPool{}
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected two results, got %d", len(results))
+	}
+	if results[1].Title != "1 results, 1 previous runs" {
+		t.Errorf("Unexpected title %q", results[1].Title)
+	}
+	if results[1].Logs == nil || len(*results[1].Logs) != 1 || (*results[1].Logs)[0].Title != "Evaluated policies" {
+		t.Errorf("Expected the plugin's log entry in the result, got %v", results[1].Logs)
+	}
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/compliance-framework/framework/domain"
+	apievent "github.com/compliance-framework/framework/event"
+	"github.com/hashicorp/go-hclog"
+)
+
+// AgentPlanTopic is the NATS topic on which the API publishes assessment plans when they are activated.
+const AgentPlanTopic = string(apievent.TopicTypePlan)
+
+// planPoliciesKey is the key in an activity's provider configuration listing the policies the plugin is run
+// against, separated by commas. It is not passed on to the plugin.
+const planPoliciesKey = "policies"
+
+// defaultPlanTag is used for providers which don't specify an image tag.
+const defaultPlanTag = "latest"
+
+// Labels added to the results of plugins configured by assessment plans.
+const (
+	planLabel     = "_plan"
+	taskLabel     = "_task"
+	activityLabel = "_activity"
+)
+
+// Plan events which remove a plan. Any other event type adds or replaces it.
+var planRemovedEvents = []string{"deactivated", "deleted"}
+
+// errSubjectQuery is returned for subject selections which use a query, as agents can only match labels.
+var errSubjectQuery = errors.New("subject queries are not supported by agents, use labels or expressions")
+
+// selectorMatches returns whether an activity's subject selection matches an agent with the given labels.
+// Every label and expression in the selection must match. Selections which only list subject ids never
+// match, as they refer to subjects known to the API rather than agents.
+func selectorMatches(selector domain.SubjectSelection, labels map[string]string) (bool, error) {
+	if selector.Query != "" {
+		return false, errSubjectQuery
+	}
+	if len(selector.Labels) == 0 && len(selector.Expressions) == 0 {
+		return false, nil
+	}
+
+	for key, value := range selector.Labels {
+		if actual, ok := labels[key]; !ok || actual != value {
+			return false, nil
+		}
+	}
+
+	for _, expression := range selector.Expressions {
+		matches, err := expressionMatches(expression, labels)
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// expressionMatches evaluates a single match expression against labels. The operators are those used for
+// Kubernetes label selectors, compared case-insensitively.
+func expressionMatches(expression domain.SubjectMatchExpression, labels map[string]string) (bool, error) {
+	value, ok := labels[expression.Key]
+
+	switch strings.ToLower(expression.Operator) {
+	case "in":
+		return ok && slices.Contains(expression.Values, value), nil
+	case "notin":
+		return !ok || !slices.Contains(expression.Values, value), nil
+	case "exists":
+		return ok, nil
+	case "doesnotexist":
+		return !ok, nil
+	}
+	return false, fmt.Errorf("unsupported operator %q for label %s", expression.Operator, expression.Key)
+}
+
+// planActivity is an activity in an assessment plan which selects this agent.
+type planActivity struct {
+	plan     domain.JobSpecification
+	task     domain.TaskInformation
+	activity domain.ActivityInformation
+}
+
+// plugin returns the plugin configuration which runs the activity.
+func (pa planActivity) plugin() *agentPlugin {
+	provider := pa.activity.Provider
+
+	tag := provider.Tag
+	if tag == "" {
+		tag = defaultPlanTag
+	}
+
+	pluginConfig := agentPluginConfig{}
+	policies := []agentPolicy{}
+	for key, value := range provider.Configuration {
+		if key != planPoliciesKey {
+			pluginConfig[key] = value
+			continue
+		}
+		for _, source := range strings.Split(value, ",") {
+			if source = strings.TrimSpace(source); source != "" {
+				policies = append(policies, agentPolicy{Source: source})
+			}
+		}
+	}
+
+	return &agentPlugin{
+		Source:   provider.Image + ":" + tag,
+		Policies: policies,
+		Config:   pluginConfig,
+		Schedule: pa.task.Schedule,
+		Labels: map[string]string{
+			planLabel:     pa.plan.PlanId,
+			taskLabel:     pa.task.Id,
+			activityLabel: pa.activity.Id,
+		},
+		fromPlan: true,
+	}
+}
+
+// planPlugins returns a plugin for every activity in plans whose subject selection matches labels.
+//
+// Plugins are named after the activity's provider. If several activities use the same provider, each is
+// named after both the provider and the activity, so they don't replace one another.
+func planPlugins(logger hclog.Logger, plans map[string]domain.JobSpecification, labels map[string]string) map[string]*agentPlugin {
+	activities := []planActivity{}
+	for _, plan := range plans {
+		for _, task := range plan.Tasks {
+			for _, activity := range task.Activities {
+				matches, err := selectorMatches(activity.Selector, labels)
+				if err != nil {
+					logger.Warn("Skipping activity with an unsupported subject selection", "plan", plan.PlanId, "activity", activity.Id, "error", err)
+					continue
+				}
+				if matches {
+					activities = append(activities, planActivity{plan: plan, task: task, activity: activity})
+				}
+			}
+		}
+	}
+
+	names := map[string]int{}
+	for _, activity := range activities {
+		names[activity.activity.Provider.Name]++
+	}
+
+	plugins := map[string]*agentPlugin{}
+	for _, activity := range activities {
+		name := activity.activity.Provider.Name
+		if name == "" || names[name] > 1 {
+			name = strings.TrimPrefix(name+"-"+activity.activity.Id, "-")
+		}
+		plugins[name] = activity.plugin()
+	}
+	return plugins
+}
+
+// withPlans returns the configuration with a plugin added for every activity in plans which selects the agent.
+// Plugins configured locally take precedence over plugins of the same name from plans.
+func (ac *agentConfig) withPlans(logger hclog.Logger, plans map[string]domain.JobSpecification) *agentConfig {
+	if len(plans) == 0 {
+		return ac
+	}
+
+	config := *ac
+	config.Plugins = planPlugins(logger, plans, ac.Labels)
+	for name := range config.Plugins {
+		if _, ok := ac.Plugins[name]; ok {
+			logger.Debug("Plugin is configured locally, ignoring the plugin from the assessment plan", "plugin", name)
+		}
+	}
+	maps.Copy(config.Plugins, ac.Plugins)
+	return &config
+}
+
+// handlePlanEvent applies an assessment plan published by the API. Its activities which select the agent
+// are run alongside the plugins configured locally. If the resulting configuration can't be applied, the
+// agent continues with its previous plans.
+func (ar *AgentRunner) handlePlanEvent(planEvent apievent.PlanEvent) {
+	planId := planEvent.PlanId
+	if planId == "" {
+		planId = planEvent.Id
+	}
+	if planId == "" {
+		ar.logger.Warn("Ignoring assessment plan event without a plan id", "type", planEvent.Type)
+		return
+	}
+
+	ar.reloadMu.Lock()
+	defer ar.reloadMu.Unlock()
+
+	ar.mu.RLock()
+	local := ar.localConfig
+	settings := ar.configSettings
+	plans := maps.Clone(ar.plans)
+	ar.mu.RUnlock()
+
+	if plans == nil {
+		plans = map[string]domain.JobSpecification{}
+	}
+	if slices.Contains(planRemovedEvents, planEvent.Type) {
+		delete(plans, planId)
+	} else {
+		plans[planId] = planEvent.JobSpecification
+	}
+
+	if err := ar.applyConfig(&local, settings, plans); err != nil {
+		ar.logger.Error("Rejected assessment plan, continuing with the previous configuration", "plan", planId, "type", planEvent.Type, "error", err)
+		return
+	}
+
+	ar.logger.Info("Applied assessment plan", "plan", planId, "type", planEvent.Type, "title", planEvent.Title)
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/compliance-framework/framework/domain"
+	apievent "github.com/compliance-framework/framework/event"
+	"github.com/compliance-framework/framework/internal/artifact"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"env": "prod", "team": "finance"}
+
+	tests := []struct {
+		name     string
+		selector domain.SubjectSelection
+		matches  bool
+		err      bool
+	}{
+		{
+			name:     "Matching labels",
+			selector: domain.SubjectSelection{Labels: map[string]string{"env": "prod"}},
+			matches:  true,
+		},
+		{
+			name:     "Different label value",
+			selector: domain.SubjectSelection{Labels: map[string]string{"env": "dev"}},
+			matches:  false,
+		},
+		{
+			name:     "Missing label",
+			selector: domain.SubjectSelection{Labels: map[string]string{"region": "eu"}},
+			matches:  false,
+		},
+		{
+			name: "Matching expressions",
+			selector: domain.SubjectSelection{Expressions: []domain.SubjectMatchExpression{
+				{Key: "env", Operator: "In", Values: []string{"prod", "staging"}},
+				{Key: "team", Operator: "NotIn", Values: []string{"engineering"}},
+				{Key: "team", Operator: "Exists"},
+				{Key: "region", Operator: "DoesNotExist"},
+			}},
+			matches: true,
+		},
+		{
+			name: "Labels and expressions must all match",
+			selector: domain.SubjectSelection{
+				Labels: map[string]string{"env": "prod"},
+				Expressions: []domain.SubjectMatchExpression{
+					{Key: "team", Operator: "in", Values: []string{"engineering"}},
+				},
+			},
+			matches: false,
+		},
+		{
+			name: "Unsupported operator",
+			selector: domain.SubjectSelection{Expressions: []domain.SubjectMatchExpression{
+				{Key: "env", Operator: "Like", Values: []string{"pr%"}},
+			}},
+			err: true,
+		},
+		{
+			name:     "Query",
+			selector: domain.SubjectSelection{Query: "env=prod"},
+			err:      true,
+		},
+		{
+			name:     "Only subject ids",
+			selector: domain.SubjectSelection{Ids: []string{"6720f7bbd0e1a2f0a1b2c3d4"}},
+			matches:  false,
+		},
+		{
+			name:     "Empty selection",
+			selector: domain.SubjectSelection{},
+			matches:  false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches, err := selectorMatches(test.selector, labels)
+			if test.err && err == nil {
+				t.Errorf("Expected an error")
+			}
+			if !test.err && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if matches != test.matches {
+				t.Errorf("Expected match to be %v, got %v", test.matches, matches)
+			}
+		})
+	}
+}
+
+func testPlan(planId string, activities ...domain.ActivityInformation) domain.JobSpecification {
+	return domain.JobSpecification{
+		Id:     planId,
+		PlanId: planId,
+		Title:  "Check SSH configuration",
+		Tasks: []domain.TaskInformation{
+			{Id: "task-1", Title: "SSH", Schedule: "@every 5m", Activities: activities},
+		},
+	}
+}
+
+func testActivity(id string, provider string, labels map[string]string) domain.ActivityInformation {
+	return domain.ActivityInformation{
+		Id:       id,
+		Title:    "Check sshd_config",
+		Selector: domain.SubjectSelection{Labels: labels},
+		Provider: domain.Provider{
+			Name:  provider,
+			Image: "ghcr.io/compliance-framework/plugin-" + provider,
+			Tag:   "v1",
+			Configuration: map[string]string{
+				"host":     "localhost",
+				"policies": "ghcr.io/compliance-framework/policies-ssh:v1, ghcr.io/compliance-framework/policies-cis:v2",
+			},
+		},
+	}
+}
+
+func TestAgentConfig_WithPlans(t *testing.T) {
+	logger := hclog.NewNullLogger()
+	prod := map[string]string{"env": "prod"}
+
+	t.Run("Adds a plugin for each matching activity", func(t *testing.T) {
+		config := &agentConfig{Labels: prod}
+		plans := map[string]domain.JobSpecification{
+			"plan-1": testPlan("plan-1",
+				testActivity("activity-1", "local-ssh", prod),
+				testActivity("activity-2", "aws", map[string]string{"env": "dev"}),
+			),
+		}
+
+		merged := config.withPlans(logger, plans)
+		if len(merged.Plugins) != 1 {
+			t.Fatalf("Expected 1 plugin, got %d", len(merged.Plugins))
+		}
+		plugin, ok := merged.Plugins["local-ssh"]
+		if !ok {
+			t.Fatalf("Expected the plugin to be named after its provider, got %v", merged.Plugins)
+		}
+		if plugin.Source != "ghcr.io/compliance-framework/plugin-local-ssh:v1" {
+			t.Errorf("Expected the provider image as the source, got %s", plugin.Source)
+		}
+		if plugin.Schedule != "@every 5m" {
+			t.Errorf("Expected the task schedule, got %s", plugin.Schedule)
+		}
+		if len(plugin.Policies) != 2 || plugin.Policies[1].Source != "ghcr.io/compliance-framework/policies-cis:v2" {
+			t.Errorf("Expected policies from the provider configuration, got %v", plugin.Policies)
+		}
+		if _, ok := plugin.Config[planPoliciesKey]; ok || plugin.Config["host"] != "localhost" {
+			t.Errorf("Expected the provider configuration without policies as plugin config, got %v", plugin.Config)
+		}
+		if plugin.Labels[planLabel] != "plan-1" || plugin.Labels[activityLabel] != "activity-1" {
+			t.Errorf("Expected plan and activity labels, got %v", plugin.Labels)
+		}
+		if len(config.Plugins) != 0 {
+			t.Errorf("Expected the local configuration to be unchanged, got %v", config.Plugins)
+		}
+	})
+
+	t.Run("Local plugins take precedence", func(t *testing.T) {
+		local := &agentPlugin{Source: "plugins/local-ssh"}
+		config := &agentConfig{
+			Labels:  prod,
+			Plugins: map[string]*agentPlugin{"local-ssh": local},
+		}
+		plans := map[string]domain.JobSpecification{
+			"plan-1": testPlan("plan-1", testActivity("activity-1", "local-ssh", prod)),
+		}
+
+		merged := config.withPlans(logger, plans)
+		if merged.Plugins["local-ssh"] != local {
+			t.Errorf("Expected the local plugin, got %v", merged.Plugins["local-ssh"])
+		}
+	})
+
+	t.Run("Activities sharing a provider are named after the activity", func(t *testing.T) {
+		config := &agentConfig{Labels: prod}
+		plans := map[string]domain.JobSpecification{
+			"plan-1": testPlan("plan-1", testActivity("activity-1", "local-ssh", prod)),
+			"plan-2": testPlan("plan-2", testActivity("activity-2", "local-ssh", prod)),
+		}
+
+		merged := config.withPlans(logger, plans)
+		for _, name := range []string{"local-ssh-activity-1", "local-ssh-activity-2"} {
+			if _, ok := merged.Plugins[name]; !ok {
+				t.Errorf("Expected plugin %s, got %v", name, merged.Plugins)
+			}
+		}
+	})
+}
+
+func TestAgentRunner_HandlePlanEvent(t *testing.T) {
+	dir := chdirTemp(t)
+
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := crane.Image(map[string][]byte{"plugin": []byte("#!/bin/sh\n")})
+	if err != nil {
+		t.Fatalf("Error building image: %v", err)
+	}
+	if err := crane.Push(img, host+"/plugin-local-ssh:v1"); err != nil {
+		t.Fatalf("Error pushing image: %v", err)
+	}
+
+	lock, err := artifact.LoadLock(path.Join(dir, artifact.LockFileName))
+	if err != nil {
+		t.Fatalf("Error loading lock file: %v", err)
+	}
+
+	prod := map[string]string{"env": "prod"}
+	ar := newTestAgentRunner(agentConfig{Labels: prod, Daemon: true})
+	ar.lock = lock
+
+	activity := testActivity("activity-1", "local-ssh", prod)
+	activity.Provider.Image = host + "/plugin-local-ssh"
+	activity.Provider.Configuration = map[string]string{}
+
+	ar.handlePlanEvent(apievent.PlanEvent{Type: "activated", JobSpecification: testPlan("plan-1", activity)})
+	if _, ok := ar.config.Plugins["local-ssh"]; !ok {
+		t.Fatalf("Expected the activity to be added as a plugin, got %v", ar.config.Plugins)
+	}
+	if _, ok := ar.pluginLocations[host+"/plugin-local-ssh:v1"]; !ok {
+		t.Errorf("Expected the plugin to be downloaded, got %v", ar.pluginLocations)
+	}
+
+	invalid := testPlan("plan-2", testActivity("activity-2", "aws", prod))
+	invalid.Tasks[0].Schedule = "every five minutes"
+	ar.handlePlanEvent(apievent.PlanEvent{Type: "activated", JobSpecification: invalid})
+	if _, ok := ar.plans["plan-2"]; ok {
+		t.Errorf("Expected a plan with an invalid schedule to be rejected")
+	}
+	if len(ar.config.Plugins) != 1 {
+		t.Errorf("Expected the previous plugins to keep running, got %v", ar.config.Plugins)
+	}
+
+	ar.handlePlanEvent(apievent.PlanEvent{Type: "deleted", JobSpecification: domain.JobSpecification{PlanId: "plan-1"}})
+	if len(ar.config.Plugins) != 0 || len(ar.plans) != 0 {
+		t.Errorf("Expected the plan's plugins to be removed, got %v", ar.config.Plugins)
+	}
+}
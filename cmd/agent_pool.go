@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/compliance-framework/framework/internal/sandbox"
+	"github.com/compliance-framework/framework/internal/telemetry"
+	runner2 "github.com/compliance-framework/framework/runner"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// pluginProcess is a running plugin, which has been configured and can be evaluated by one run at a time.
+type pluginProcess struct {
+	client  *plugin.Client
+	runner  runner2.ContextRunner
+	sandbox *sandbox.Sandbox
+	host    *pluginHost
+
+	// key identifies what the process was started with. Processes are only reused by runs with the same key.
+	key string
+	// runs is how many runs have used the process.
+	runs int
+}
+
+// pluginProcessKey identifies a plugin process by the plugin binary, its resolved config and its sandbox,
+// so a process is restarted when any of them change. It is a hash, as the config may contain secrets.
+func pluginProcessKey(location, version string, config agentPluginConfig, sc *sandboxConfig) string {
+	content, _ := json.Marshal(struct {
+		Location string
+		Version  string
+		Config   agentPluginConfig
+		Sandbox  *sandboxConfig
+	}{location, version, config, sc})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// healthy returns whether the process is still running and responding.
+func (p *pluginProcess) healthy() bool {
+	if p.client.Exited() {
+		return false
+	}
+	rpcClient, err := p.client.Client()
+	if err != nil {
+		return false
+	}
+	return rpcClient.Ping() == nil
+}
+
+// limitError reports a plugin failure as exceeding a sandbox limit, if that's why it failed.
+func (p *pluginProcess) limitError(err error) error {
+	return sandboxLimitError(p.sandbox, err)
+}
+
+func (p *pluginProcess) close() {
+	p.client.Kill()
+	p.sandbox.Close()
+}
+
+// pluginPool keeps idle plugin processes between runs, so plugins with expensive startup don't pay for it on
+// every run. Processes are taken out of the pool while a run uses them, so each is only used by one run at a
+// time, and runs of the same plugin which overlap start processes of their own.
+//
+// The zero value is an empty pool. It is safe for concurrent use.
+type pluginPool struct {
+	mu sync.Mutex
+	// idle are the processes waiting to be reused, by plugin name.
+	idle   map[string][]*pluginProcess
+	closed bool
+}
+
+// get takes an idle process of the plugin which was started with key, or returns nil if there isn't one.
+// Idle processes started with another key are stopped, as the plugin has changed. Processes which have crashed
+// or stopped responding since their last run are stopped too.
+func (pp *pluginPool) get(pluginName, key string) *pluginProcess {
+	for {
+		pp.mu.Lock()
+		var process *pluginProcess
+		stale := []*pluginProcess{}
+		idle := []*pluginProcess{}
+		for _, p := range pp.idle[pluginName] {
+			switch {
+			case p.key != key:
+				stale = append(stale, p)
+			case process == nil:
+				process = p
+			default:
+				idle = append(idle, p)
+			}
+		}
+		if pp.idle != nil {
+			pp.idle[pluginName] = idle
+		}
+		pp.mu.Unlock()
+
+		for _, p := range stale {
+			p.close()
+		}
+		if process == nil || process.healthy() {
+			return process
+		}
+		process.close()
+	}
+}
+
+// put returns a process to the pool once a run has finished with it. The process is stopped instead if it has
+// been used for maxRuns runs, or the pool has been closed. A maxRuns of zero reuses processes indefinitely.
+func (pp *pluginPool) put(pluginName string, process *pluginProcess, maxRuns int) {
+	process.runs++
+
+	pp.mu.Lock()
+	if pp.closed || (maxRuns > 0 && process.runs >= maxRuns) {
+		pp.mu.Unlock()
+		process.close()
+		return
+	}
+	if pp.idle == nil {
+		pp.idle = map[string][]*pluginProcess{}
+	}
+	pp.idle[pluginName] = append(pp.idle[pluginName], process)
+	pp.mu.Unlock()
+}
+
+// retain stops the idle processes of any plugins not in pluginNames, such as once they've been removed from
+// the configuration.
+func (pp *pluginPool) retain(pluginNames map[string]*agentPlugin) {
+	pp.mu.Lock()
+	stale := []*pluginProcess{}
+	for pluginName, processes := range pp.idle {
+		if _, ok := pluginNames[pluginName]; !ok {
+			stale = append(stale, processes...)
+			delete(pp.idle, pluginName)
+		}
+	}
+	pp.mu.Unlock()
+
+	for _, p := range stale {
+		p.close()
+	}
+}
+
+// close stops every idle process. Processes returned to the pool afterwards are stopped straight away.
+func (pp *pluginPool) close() {
+	pp.mu.Lock()
+	stale := []*pluginProcess{}
+	for _, processes := range pp.idle {
+		stale = append(stale, processes...)
+	}
+	pp.idle = nil
+	pp.closed = true
+	pp.mu.Unlock()
+
+	for _, p := range stale {
+		p.close()
+	}
+}
+
+// pluginProcess returns a configured process of the plugin for a run. An idle process is reused if the
+// plugin, its config and its sandbox haven't changed since it started, and otherwise a new one is started.
+// source and version are where the plugin was downloaded to, and its version.
+func (ar *AgentRunner) pluginProcess(ctx context.Context, logger hclog.Logger, pluginName string, pluginConfig *agentPlugin, source string, version string, config agentPluginConfig) (_ *pluginProcess, err error) {
+	key := pluginProcessKey(source, version, config, pluginConfig.Sandbox)
+	if process := ar.pool.get(pluginName, key); process != nil {
+		logger.Debug("Reusing plugin process", "runs", process.runs)
+		trace.SpanFromContext(ctx).AddEvent("reusing plugin process", trace.WithAttributes(attribute.Int("runs", process.runs)))
+		return process, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "start plugin")
+	defer func() { telemetry.EndSpan(span, ar.secrets.RedactError(err)) }()
+
+	sb, err := ar.pluginSandbox(pluginConfig)
+	if err != nil {
+		logger.Error("Error preparing plugin sandbox", "error", err)
+		return nil, err
+	}
+
+	host := ar.newPluginHost(logger, pluginName)
+	client, runnerInstance, err := ar.getRunnerInstance(logger, source, sb, host)
+	if err != nil {
+		sb.Close()
+		return nil, err
+	}
+	process := &pluginProcess{
+		client:  client,
+		runner:  runnerInstance,
+		sandbox: sb,
+		host:    host,
+		key:     key,
+	}
+
+	// The config is part of the process key, so it only needs checking when a process is started.
+	if _, err := validatePluginConfig(ctx, runnerInstance, config); err != nil {
+		process.close()
+		logger.Error("Error validating plugin config", "error", err)
+		return nil, err
+	}
+
+	configureCtx, configureSpan := tracer.Start(ctx, "configure plugin")
+	_, err = runnerInstance.Configure(configureCtx, &proto2.ConfigureRequest{
+		Config: config,
+	})
+	telemetry.EndSpan(configureSpan, ar.secrets.RedactError(err))
+	if err != nil {
+		err = process.limitError(err)
+		process.close()
+		logger.Error("Error configuring plugin", "error", err)
+		return nil, err
+	}
+
+	return process, nil
+}
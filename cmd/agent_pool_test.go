@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compliance-framework/framework/internal"
+	runner2 "github.com/compliance-framework/framework/runner"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+)
+
+// testPluginProtocolEnv makes the fake plugin speak only the protocol version it is set to, rather than every
+// version the runner package supports.
+const testPluginProtocolEnv = "CF_TEST_PLUGIN_PROTOCOL"
+
+// TestMain serves a fake plugin when the test binary is started by the agent as a plugin, so tests can run
+// real plugin processes.
+func TestMain(m *testing.M) {
+	if os.Getenv(runner2.HandshakeConfig.MagicCookieKey) == runner2.HandshakeConfig.MagicCookieValue {
+		config := runner2.ServeConfig(&processRunner{})
+		if version, err := strconv.Atoi(os.Getenv(testPluginProtocolEnv)); err == nil {
+			config.VersionedPlugins = map[int]plugin.PluginSet{
+				version: {"runner": &runner2.RunnerGRPCPlugin{ContextImpl: &processRunner{}}},
+			}
+		}
+		plugin.Serve(config)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// processRunner reports its process, and how many times it has been configured, as the title of its results.
+// If it is configured with host set to true, it uses the agent's host services, and reports how as the title.
+// If it is configured with wait_for, its evaluations create wait_for.started, then wait for wait_for to exist.
+// If it is configured with observations, its results have that many observations, and with findings, that many
+// findings, each with a task of its own.
+// If it is configured with fail_once, its first evaluation fails, creating fail_once, and later ones succeed.
+type processRunner struct {
+	configured int
+	config     map[string]string
+}
+
+func (r *processRunner) Configure(ctx context.Context, req *proto2.ConfigureRequest) (*proto2.ConfigureResponse, error) {
+	r.configured++
+	r.config = req.Config
+	return &proto2.ConfigureResponse{}, nil
+}
+
+func (r *processRunner) PrepareForEval(ctx context.Context, req *proto2.PrepareForEvalRequest) (*proto2.PrepareForEvalResponse, error) {
+	return &proto2.PrepareForEvalResponse{}, nil
+}
+
+// processRunnerSchema requires a region, and is declared by processRunner.
+const processRunnerSchema = `{
+	"type": "object",
+	"properties": {"region": {"type": "string", "pattern": "^[a-z]+-[a-z]+-[0-9]$"}},
+	"required": ["region"]
+}`
+
+func (r *processRunner) Info(ctx context.Context, req *proto2.InfoRequest) (*proto2.InfoResponse, error) {
+	return &proto2.InfoResponse{
+		Name:            "process",
+		Version:         "1.0.0",
+		PolicyNamespace: "compliance_framework",
+		ConfigSchema:    processRunnerSchema,
+		Capabilities:    []string{runner2.CapabilityCancellation},
+	}, nil
+}
+
+func (r *processRunner) Eval(ctx context.Context, req *proto2.EvalRequest) (*proto2.EvalResponse, error) {
+	if path := r.config["fail_once"]; path != "" {
+		if _, err := os.Stat(path); err != nil {
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("failing once")
+		}
+	}
+	if path := r.config["wait_for"]; path != "" {
+		if err := waitForFile(ctx, path); err != nil {
+			return nil, err
+		}
+	}
+	if r.config["host"] == "true" {
+		title, err := useHost(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return &proto2.EvalResponse{Title: title, Status: proto2.ExecutionStatus_SUCCESS}, nil
+	}
+	res := &proto2.EvalResponse{
+		Title:  fmt.Sprintf("pid %d configured %d", os.Getpid(), r.configured),
+		Status: proto2.ExecutionStatus_SUCCESS,
+	}
+	observations, _ := strconv.Atoi(r.config["observations"])
+	for i := 0; i < observations; i++ {
+		res.Observations = append(res.Observations, &proto2.Observation{Id: strconv.Itoa(i)})
+	}
+	findings, _ := strconv.Atoi(r.config["findings"])
+	for i := 0; i < findings; i++ {
+		res.Findings = append(res.Findings, &proto2.Finding{
+			Id:    strconv.Itoa(i),
+			Tasks: []*proto2.Task{{Title: fmt.Sprintf("finding %d", i)}},
+		})
+	}
+	return res, nil
+}
+
+// waitForFile signals that it has started by creating path.started, then waits until path exists.
+func waitForFile(ctx context.Context, path string) error {
+	if err := os.WriteFile(path+".started", nil, 0644); err != nil {
+		return err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestAgentRunner_PluginPool(t *testing.T) {
+	pluginConfig := &agentPlugin{
+		Source:   "test-plugin",
+		Policies: []agentPolicy{{Source: "policy"}},
+		Config:   agentPluginConfig{"region": "eu-west-1"},
+	}
+	ar := newTestAgentRunner(agentConfig{Plugins: map[string]*agentPlugin{"test-plugin": pluginConfig}})
+	ar.pluginLocations["test-plugin"] = os.Args[0]
+	ar.logWriter = io.Discard
+	ar.setupPluginTask = &internal.Task{}
+	ar.setupPoliciesTask = &internal.Task{}
+	t.Cleanup(ar.closePluginClients)
+
+	titles := []string{}
+	titlesMu := sync.Mutex{}
+	ar.collect = func(result *runner2.Result) {
+		titlesMu.Lock()
+		defer titlesMu.Unlock()
+		titles = append(titles, result.Title)
+	}
+	run := func() string {
+		t.Helper()
+		if err := ar.runPlugin(context.Background(), "test-plugin", pluginConfig, pluginConfig.Policies); err != nil {
+			t.Fatalf("Unexpected error running plugin: %v", err)
+		}
+		return titles[len(titles)-1]
+	}
+
+	first := run()
+	if second := run(); second != first {
+		t.Errorf("Expected the process to be reused without configuring it again, got %q then %q", first, second)
+	}
+
+	pluginConfig.Config = agentPluginConfig{"region": "us-east-1"}
+	changed := run()
+	if changed == first {
+		t.Errorf("Expected a new process once the config changed, got %q", changed)
+	}
+
+	ar.pool.mu.Lock()
+	idle := ar.pool.idle["test-plugin"]
+	ar.pool.mu.Unlock()
+	if len(idle) != 1 {
+		t.Fatalf("Expected one idle process, got %d", len(idle))
+	}
+	idle[0].client.Kill()
+	if restarted := run(); restarted == changed {
+		t.Errorf("Expected a new process once the previous one exited, got %q", restarted)
+	}
+
+	pluginConfig.MaxRuns = 1
+	recycled := run()
+	if next := run(); next == recycled {
+		t.Errorf("Expected a new process for every run with max runs of 1, got %q twice", next)
+	}
+
+	ar.pool.retain(map[string]*agentPlugin{})
+	ar.pool.mu.Lock()
+	defer ar.pool.mu.Unlock()
+	if len(ar.pool.idle) != 0 {
+		t.Errorf("Expected processes of removed plugins to be stopped, got %v", ar.pool.idle)
+	}
+}
+
+// useHost evaluates the policy bundle, logs, reports progress and counts its runs in the cache through the
+// agent's host services.
+func useHost(ctx context.Context, req *proto2.EvalRequest) (string, error) {
+	host := runner2.HostFromContext(ctx)
+	if host == nil {
+		return "", errors.New("no host services")
+	}
+	results, err := host.EvalPolicy(ctx, req.BundlePath, "local_ssh", map[string]interface{}{})
+	if err != nil {
+		return "", err
+	}
+	if err := host.Log(ctx, &proto2.LogEntry{Title: "Evaluated policies"}); err != nil {
+		return "", err
+	}
+	if err := host.Progress(ctx, 1, 1, "evaluated policies"); err != nil {
+		return "", err
+	}
+	previous, _, err := host.CacheGet(ctx, "runs")
+	if err != nil {
+		return "", err
+	}
+	if err := host.CacheSet(ctx, "runs", append(previous, 'x'), time.Hour); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d results, %d previous runs", len(results), len(previous)), nil
+}
+
+func TestAgentRunner_ProtocolVersions(t *testing.T) {
+	run := func(t *testing.T, config agentPluginConfig) []*runner2.Result {
+		t.Helper()
+		pluginConfig := &agentPlugin{
+			Source:   "test-plugin",
+			Policies: []agentPolicy{{Source: "policy"}},
+			Config:   config,
+		}
+		ar := newTestAgentRunner(agentConfig{
+			Plugins:     map[string]*agentPlugin{"test-plugin": pluginConfig},
+			PluginCache: &pluginCacheConfig{Path: t.TempDir()},
+		})
+		ar.pluginLocations["test-plugin"] = os.Args[0]
+		ar.policyLocations["policy"] = "../policy-manager/testdata"
+		ar.logWriter = io.Discard
+		ar.setupPluginTask = &internal.Task{}
+		ar.setupPoliciesTask = &internal.Task{}
+		t.Cleanup(ar.closePluginClients)
+
+		results := []*runner2.Result{}
+		ar.collect = func(result *runner2.Result) {
+			results = append(results, result)
+		}
+		_ = ar.runPlugin(context.Background(), "test-plugin", pluginConfig, pluginConfig.Policies)
+		return results
+	}
+
+	t.Run("Version 1 plugins run without version 2 capabilities", func(t *testing.T) {
+		t.Setenv(testPluginProtocolEnv, "1")
+
+		// The plugin's config schema requires a region, but version 1 plugins can't declare it.
+		results := run(t, agentPluginConfig{})
+		if len(results) != 1 || results[0].Status != proto2.ExecutionStatus_SUCCESS {
+			t.Fatalf("Expected a successful result, got %v", results)
+		}
+
+		// Host services aren't served to version 1 plugins.
+		results = run(t, agentPluginConfig{"region": "eu-west-1", "host": "true"})
+		if len(results) != 1 || results[0].Status != proto2.ExecutionStatus_FAILURE {
+			t.Fatalf("Expected a failed result without host services, got %v", results)
+		}
+	})
+
+	t.Run("Unsupported versions are reported as failed results", func(t *testing.T) {
+		t.Setenv(testPluginProtocolEnv, "3")
+
+		results := run(t, agentPluginConfig{"region": "eu-west-1"})
+		if len(results) != 1 {
+			t.Fatalf("Expected one result, got %d", len(results))
+		}
+		if results[0].Status != proto2.ExecutionStatus_FAILURE || !errors.Is(results[0].Error, runner2.ErrUnsupportedProtocol) {
+			t.Errorf("Expected a failed result for the unsupported version, got %v: %v", results[0].Status, results[0].Error)
+		}
+	})
+}
+
+func TestProtocolError(t *testing.T) {
+	// go-plugin only reports a version mismatch in its error's message, so this pins the message protocolError
+	// matches against a real handshake with a plugin speaking an unsupported version.
+	t.Setenv(testPluginProtocolEnv, "3")
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  runner2.HandshakeConfig,
+		VersionedPlugins: runner2.VersionedPlugins(nil),
+		Cmd:              exec.Command(os.Args[0]),
+		Logger:           hclog.NewNullLogger(),
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+	})
+	t.Cleanup(client.Kill)
+
+	_, err := client.Client()
+	if err == nil {
+		t.Fatalf("Expected the handshake to fail")
+	}
+	err = protocolError(err)
+	if !errors.Is(err, runner2.ErrUnsupportedProtocol) {
+		t.Fatalf("Expected go-plugin's error to be reported as an unsupported protocol, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "plugin speaks version 3") {
+		t.Errorf("Expected the error to name the plugin's version, got %v", err)
+	}
+
+	other := errors.New("plugin exited before we could connect")
+	if err := protocolError(other); err != other {
+		t.Errorf("Expected other errors to be returned as they are, got %v", err)
+	}
+}
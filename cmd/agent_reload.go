@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/compliance-framework/framework/domain"
+	"github.com/compliance-framework/framework/internal/event"
+)
+
+// AgentConfigErrorTopic is the NATS topic on which the agent reports configuration it has rejected.
+const AgentConfigErrorTopic = "agent.config.error"
+
+// configChange describes a single setting which differs between two configurations.
+type configChange struct {
+	Key      string `json:"key"`
+	Change   string `json:"change"`
+	Previous string `json:"previous,omitempty"`
+	Rejected string `json:"rejected,omitempty"`
+}
+
+// configErrorEvent is published when a configuration reload is rejected. The agent continues to run
+// with its previous configuration.
+type configErrorEvent struct {
+	AgentId  string         `json:"agentId"`
+	Hostname string         `json:"hostname"`
+	Path     string         `json:"path"`
+	Error    string         `json:"error"`
+	Rejected []configChange `json:"rejected"`
+	Time     time.Time      `json:"time"`
+}
+
+// reloadConfig validates and applies a new configuration read from the config file. Plugins from the
+// assessment plans the agent has received continue to run alongside it.
+func (ar *AgentRunner) reloadConfig(config *agentConfig, settings map[string]interface{}) error {
+	ar.reloadMu.Lock()
+	defer ar.reloadMu.Unlock()
+
+	ar.mu.RLock()
+	plans := ar.plans
+	ar.mu.RUnlock()
+
+	return ar.applyConfig(config, settings, plans)
+}
+
+// applyConfig applies the local configuration, with plugins added from plans. The caller must hold ar.reloadMu.
+//
+// New plugins are downloaded first, without holding the lock, so runs can continue while they download.
+// Downloads are cached by checksum or digest, so they never replace a plugin the running configuration uses.
+// Only once every plugin has been retrieved successfully is the new configuration swapped in, and the tags it
+// resolved pinned in the lock file. If anything fails, the running configuration and lock file are left untouched.
+func (ar *AgentRunner) applyConfig(local *agentConfig, settings map[string]interface{}, plans map[string]domain.JobSpecification) error {
+	config := local.withPlans(ar.logger, plans)
+	if config != local {
+		// The local configuration has already been validated, but plugins from plans haven't.
+		if err := config.validatePlugins(); err != nil {
+			return err
+		}
+	}
+
+	pins := map[string]string{}
+	locations, versions, task, err := ar.downloadPlugins(config, pins)
+	if err != nil {
+		return err
+	}
+
+	for source, location := range locations {
+		if _, err := os.Stat(location); err != nil {
+			return fmt.Errorf("plugin %s was not found after download: %w", source, err)
+		}
+	}
+
+	ar.logger.Debug("waiting for lock to update configurations")
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	ar.logger.Debug("received lock to update configurations")
+
+	ar.config = *config
+	ar.health.Store(config.Health)
+	ar.localConfig = *local
+	ar.configSettings = settings
+	ar.plans = plans
+	ar.pluginLocations = locations
+	ar.pluginVersions = versions
+	ar.setupPluginTask = task
+
+	// Processes of plugins which are no longer configured are stopped. Those of changed plugins are restarted
+	// by their next run.
+	ar.pool.retain(config.Plugins)
+
+	if cap(ar.workers) != config.concurrency() {
+		// Running plugins hold a slot in the old pool, which they release when they finish.
+		ar.workers = make(chan struct{}, config.concurrency())
+	}
+
+	// Tags are only pinned once the configuration using them is applied. Tags which are no longer configured are
+	// unpinned, so they are resolved again if they're added back.
+	ar.pin(pins)
+	if err := ar.lock.Retain(config.ociSources()); err != nil {
+		ar.logger.Error("Error updating lock file", "error", err)
+	}
+
+	if ar.config.Daemon && ar.runCtx != nil {
+		// Schedules have already been validated, so this only fails if something is very wrong.
+		err = ar.schedule()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rejectConfig reports a configuration which could not be applied. It logs what differs from the running
+// configuration, and publishes an event so the rejection is visible outside the agent.
+func (ar *AgentRunner) rejectConfig(configPath string, settings map[string]interface{}, reason error) {
+	ar.mu.RLock()
+	changes := diffSettings(ar.configSettings, settings)
+	ar.mu.RUnlock()
+
+	ar.logger.Error("Rejected configuration, continuing with the previous configuration", "path", configPath, "error", reason)
+	for _, change := range changes {
+		ar.logger.Error("Rejected configuration change", "key", change.Key, "change", change.Change, "previous", change.Previous, "rejected", change.Rejected)
+	}
+
+	configError := configErrorEvent{
+		AgentId:  ar.agentId,
+		Hostname: ar.hostname(),
+		Path:     configPath,
+		Error:    reason.Error(),
+		Rejected: changes,
+		Time:     time.Now(),
+	}
+	if err := event.Publish(ar.natsBus, configError, AgentConfigErrorTopic); err != nil {
+		ar.logger.Error("Error publishing configuration error", "error", err)
+	}
+}
+
+// diffSettings compares two sets of raw configuration settings, returning the changes between them sorted by key.
+// Plugin configuration values are redacted, as they often contain credentials.
+func diffSettings(previous map[string]interface{}, rejected map[string]interface{}) []configChange {
+	previousFlat := map[string]interface{}{}
+	flattenSettings("", previous, previousFlat)
+	rejectedFlat := map[string]interface{}{}
+	flattenSettings("", rejected, rejectedFlat)
+
+	changes := []configChange{}
+	for key, previousValue := range previousFlat {
+		rejectedValue, ok := rejectedFlat[key]
+		if !ok {
+			changes = append(changes, configChange{
+				Key:      key,
+				Change:   "removed",
+				Previous: settingString(key, previousValue),
+			})
+			continue
+		}
+		if !reflect.DeepEqual(previousValue, rejectedValue) {
+			changes = append(changes, configChange{
+				Key:      key,
+				Change:   "changed",
+				Previous: settingString(key, previousValue),
+				Rejected: settingString(key, rejectedValue),
+			})
+		}
+	}
+	for key, rejectedValue := range rejectedFlat {
+		if _, ok := previousFlat[key]; !ok {
+			changes = append(changes, configChange{
+				Key:      key,
+				Change:   "added",
+				Rejected: settingString(key, rejectedValue),
+			})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b configChange) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return changes
+}
+
+func flattenSettings(prefix string, settings map[string]interface{}, out map[string]interface{}) {
+	for key, value := range settings {
+		fullKey := key
+		if prefix != "" {
+			fullKey = prefix + "." + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenSettings(fullKey, nested, out)
+			continue
+		}
+		out[fullKey] = value
+	}
+}
+
+func settingString(key string, value interface{}) string {
+	parts := strings.Split(key, ".")
+	if len(parts) > 3 && parts[0] == "plugins" && parts[2] == "config" {
+		return "(redacted)"
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compliance-framework/framework/internal/artifact"
+	"github.com/compliance-framework/framework/internal/event"
+	"github.com/compliance-framework/framework/internal/host"
+	"github.com/compliance-framework/framework/internal/scheduler"
+	"github.com/compliance-framework/framework/internal/signature"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/hashicorp/go-hclog"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+// chdirTemp changes into a temporary directory for the duration of the test, so downloads
+// don't end up in the source tree.
+func chdirTemp(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Error getting working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Error changing directory: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+	return dir
+}
+
+func newTestAgentRunner(config agentConfig) *AgentRunner {
+	logger := hclog.NewNullLogger()
+	return &AgentRunner{
+		logger:          logger,
+		config:          config,
+		localConfig:     config,
+		pluginLocations: map[string]string{},
+		policyLocations: map[string]string{},
+		pluginVersions:  map[string]string{},
+		policyVersions:  map[string]string{},
+		scheduler:       scheduler.New(logger),
+		workers:         make(chan struct{}, config.concurrency()),
+	}
+}
+
+func TestAgentRunner_ReloadConfig(t *testing.T) {
+	dir := chdirTemp(t)
+
+	pluginPath := path.Join(dir, "plugin")
+	if err := os.WriteFile(pluginPath, []byte{}, 0755); err != nil {
+		t.Fatalf("Error writing plugin: %v", err)
+	}
+
+	previous := agentConfig{
+		Nats: &natsConfig{Url: "nats://localhost:4222"},
+		Plugins: map[string]*agentPlugin{
+			"test-plugin": {Source: pluginPath},
+		},
+	}
+
+	t.Run("Applies a valid configuration", func(t *testing.T) {
+		ar := newTestAgentRunner(previous)
+
+		next := agentConfig{
+			Nats:        previous.Nats,
+			Concurrency: 2,
+			Health:      &healthConfig{MaxRunAge: time.Hour},
+			Plugins: map[string]*agentPlugin{
+				"other-plugin": {Source: pluginPath},
+			},
+		}
+
+		err := ar.reloadConfig(&next, map[string]interface{}{"concurrency": 2})
+		if err != nil {
+			t.Fatalf("Unexpected error reloading config: %v", err)
+		}
+
+		if _, ok := ar.config.Plugins["other-plugin"]; !ok {
+			t.Errorf("Expected new configuration to be applied")
+		}
+		if ar.pluginLocations[pluginPath] != pluginPath {
+			t.Errorf("Expected local plugin to be used in place, got %s", ar.pluginLocations[pluginPath])
+		}
+		if cap(ar.workers) != 2 {
+			t.Errorf("Expected worker pool to be resized to 2, got %d", cap(ar.workers))
+		}
+		if health := ar.health.Load(); health == nil || health.MaxRunAge != time.Hour {
+			t.Errorf("Expected health checks to use the new configuration, got %v", health)
+		}
+	})
+
+	t.Run("Keeps the previous configuration if plugins cannot be downloaded", func(t *testing.T) {
+		ar := newTestAgentRunner(previous)
+		ar.pluginLocations[pluginPath] = pluginPath
+
+		next := agentConfig{
+			Nats: previous.Nats,
+			Plugins: map[string]*agentPlugin{
+				"test-plugin": {Source: path.Join(dir, "missing-plugin")},
+			},
+		}
+
+		err := ar.reloadConfig(&next, map[string]interface{}{})
+		if err == nil {
+			t.Fatalf("Expected an error reloading config")
+		}
+
+		if ar.config.Plugins["test-plugin"].Source != pluginPath {
+			t.Errorf("Expected previous configuration to be kept, got source %s", ar.config.Plugins["test-plugin"].Source)
+		}
+		if ar.pluginLocations[pluginPath] != pluginPath {
+			t.Errorf("Expected previous plugin locations to be kept")
+		}
+
+		entries, err := os.ReadDir(AgentPluginDir)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatalf("Error reading plugin directory: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected nothing to be left in the plugin directory, found %v", entries)
+		}
+	})
+
+	t.Run("Only pins tags once the configuration is applied", func(t *testing.T) {
+		server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		defer server.Close()
+		source := strings.TrimPrefix(server.URL, "http://") + "/plugins/test:v1"
+		img, err := crane.Image(map[string][]byte{"plugin": []byte("plugin")})
+		if err != nil {
+			t.Fatalf("Error building image: %v", err)
+		}
+		if err := crane.Push(img, source); err != nil {
+			t.Fatalf("Error pushing image: %v", err)
+		}
+
+		// The plugin isn't signed, so the configuration is rejected once the tag is resolved and downloaded.
+		publicKey, _, err := signature.GenerateKey()
+		if err != nil {
+			t.Fatalf("Error generating key: %v", err)
+		}
+		publicKeyPath := path.Join(dir, "trusted.pub")
+		if err := os.WriteFile(publicKeyPath, publicKey, 0644); err != nil {
+			t.Fatalf("Error writing public key: %v", err)
+		}
+
+		lockPath := path.Join(dir, artifact.LockFileName)
+		lock, err := artifact.LoadLock(lockPath)
+		if err != nil {
+			t.Fatalf("Error loading lock file: %v", err)
+		}
+		ar := newTestAgentRunner(previous)
+		ar.lock = lock
+
+		rejected := agentConfig{
+			Nats:        previous.Nats,
+			TrustedKeys: []string{publicKeyPath},
+			Plugins:     map[string]*agentPlugin{"test-plugin": {Source: source}},
+		}
+		if err := ar.reloadConfig(&rejected, map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), "signature") {
+			t.Fatalf("Expected the unsigned plugin to be refused, got %v", err)
+		}
+		if digest, locked := lock.Digest(source); locked {
+			t.Errorf("Expected a rejected configuration not to pin %s, got %s", source, digest)
+		}
+		if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+			t.Errorf("Expected the lock file not to be written, got %v", err)
+		}
+
+		applied := agentConfig{
+			Nats:    previous.Nats,
+			Plugins: map[string]*agentPlugin{"test-plugin": {Source: source}},
+		}
+		if err := ar.reloadConfig(&applied, map[string]interface{}{}); err != nil {
+			t.Fatalf("Unexpected error reloading config: %v", err)
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Error getting image digest: %v", err)
+		}
+		if locked, _ := lock.Digest(source); locked != digest.String() {
+			t.Errorf("Expected %s to be pinned to %s once applied, got %q", source, digest, locked)
+		}
+	})
+}
+
+func TestDiffSettings(t *testing.T) {
+	previous := map[string]interface{}{
+		"daemon": true,
+		"plugins": map[string]interface{}{
+			"ssh": map[string]interface{}{
+				"source":   "ghcr.io/some-plugin:v1",
+				"schedule": "@every 5m",
+				"config": map[string]interface{}{
+					"token": "secret",
+				},
+			},
+		},
+	}
+	rejected := map[string]interface{}{
+		"daemon": true,
+		"plugins": map[string]interface{}{
+			"ssh": map[string]interface{}{
+				"source": "ghcr.io/some-plugin:v2",
+				"config": map[string]interface{}{
+					"token": "other-secret",
+				},
+				"labels": map[string]interface{}{
+					"team": "platform",
+				},
+			},
+		},
+	}
+
+	changes := diffSettings(previous, rejected)
+
+	expected := []configChange{
+		{Key: "plugins.ssh.config.token", Change: "changed", Previous: "(redacted)", Rejected: "(redacted)"},
+		{Key: "plugins.ssh.labels.team", Change: "added", Rejected: "platform"},
+		{Key: "plugins.ssh.schedule", Change: "removed", Previous: "@every 5m"},
+		{Key: "plugins.ssh.source", Change: "changed", Previous: "ghcr.io/some-plugin:v1", Rejected: "ghcr.io/some-plugin:v2"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("diffSettings() = %v, expected %v", changes, expected)
+	}
+}
+
+func TestAgentRunner_RejectConfig(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	options := natsserver.DefaultTestOptions
+	options.Port = -1
+	s := natsserver.RunServer(&options)
+	defer s.Shutdown()
+
+	sub, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Error connecting to NATS: %v", err)
+	}
+	defer sub.Close()
+
+	received := make(chan configErrorEvent, 1)
+	_, err = sub.Subscribe(AgentConfigErrorTopic, func(m *nats.Msg) {
+		var configError configErrorEvent
+		if err := json.Unmarshal(m.Data, &configError); err == nil {
+			received <- configError
+		}
+	})
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+	if err := sub.Flush(); err != nil {
+		t.Fatalf("Error flushing subscription: %v", err)
+	}
+
+	// The event identifies the agent as its results do, even when HOSTNAME isn't set, such as under systemd.
+	t.Setenv("HOSTNAME", "")
+	ar := newTestAgentRunner(agentConfig{})
+	ar.agentId = "web-01"
+	ar.hostFacts = host.Facts{host.FactHostname: "web-01.example.com"}
+	ar.natsBus = event.NewNatsBus(hclog.NewNullLogger())
+	if err := ar.natsBus.Connect(s.ClientURL()); err != nil {
+		t.Fatalf("Error connecting to NATS: %v", err)
+	}
+	defer ar.natsBus.Close()
+
+	ar.rejectConfig("config.yml", map[string]interface{}{"daemon": true}, errors.New("invalid"))
+
+	select {
+	case configError := <-received:
+		if configError.AgentId != "web-01" {
+			t.Errorf("Expected the event from agent web-01, got %q", configError.AgentId)
+		}
+		if configError.Hostname != "web-01.example.com" {
+			t.Errorf("Expected the event from host web-01.example.com, got %q", configError.Hostname)
+		}
+		if configError.Error != "invalid" {
+			t.Errorf("Expected the rejection reason, got %q", configError.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a configuration error event")
+	}
+}
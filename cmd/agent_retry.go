@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/compliance-framework/framework/internal/retry"
+)
+
+// Defaults for plugins which have a retry policy, but don't set every option.
+const (
+	DefaultRetryAttempts   = 3
+	DefaultRetryBackoff    = time.Second
+	DefaultRetryMaxBackoff = time.Minute
+)
+
+// Defaults for plugins which have a circuit breaker, but don't set every option.
+const (
+	DefaultCircuitBreakerFailures = 5
+	DefaultCircuitBreakerPause    = 10 * time.Minute
+)
+
+// errPluginUnavailable is reported for each policy of a plugin while its circuit breaker has paused it.
+var errPluginUnavailable = errors.New("plugin is unavailable")
+
+// retryConfig is how a plugin is retried when configuring, preparing or evaluating it fails. Only the
+// policies which failed are retried. See retry.Policy for each option.
+type retryConfig struct {
+	Attempts   int           `mapstructure:"attempts"`
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	Jitter     time.Duration `mapstructure:"jitter"`
+}
+
+// circuitBreakerConfig pauses a plugin once it has failed for every one of its policies in a number of
+// consecutive runs, after any retries.
+type circuitBreakerConfig struct {
+	Failures int           `mapstructure:"failures"`
+	Pause    time.Duration `mapstructure:"pause"`
+}
+
+// retryPolicy returns the plugin's retry policy. Plugins without one are attempted once.
+func (ap *agentPlugin) retryPolicy() retry.Policy {
+	if ap.Retry == nil {
+		return retry.Policy{Attempts: 1}
+	}
+	policy := retry.Policy{
+		Attempts:   ap.Retry.Attempts,
+		Backoff:    ap.Retry.Backoff,
+		MaxBackoff: ap.Retry.MaxBackoff,
+		Jitter:     ap.Retry.Jitter,
+	}
+	if policy.Attempts == 0 {
+		policy.Attempts = DefaultRetryAttempts
+	}
+	if policy.Backoff == 0 {
+		policy.Backoff = DefaultRetryBackoff
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	return policy
+}
+
+// settings returns the number of consecutive failures which pause the plugin, and for how long.
+func (cb *circuitBreakerConfig) settings() (int, time.Duration) {
+	failures, pause := cb.Failures, cb.Pause
+	if failures == 0 {
+		failures = DefaultCircuitBreakerFailures
+	}
+	if pause == 0 {
+		pause = DefaultCircuitBreakerPause
+	}
+	return failures, pause
+}
+
+func (ap *agentPlugin) validateRetries() error {
+	if ap.Retry != nil {
+		if ap.Retry.Attempts < 0 {
+			return fmt.Errorf("retry attempts cannot be negative: %d", ap.Retry.Attempts)
+		}
+		if ap.Retry.Backoff < 0 {
+			return fmt.Errorf("retry backoff cannot be negative: %s", ap.Retry.Backoff)
+		}
+		if ap.Retry.MaxBackoff < 0 {
+			return fmt.Errorf("retry max backoff cannot be negative: %s", ap.Retry.MaxBackoff)
+		}
+		if ap.Retry.Jitter < 0 {
+			return fmt.Errorf("retry jitter cannot be negative: %s", ap.Retry.Jitter)
+		}
+	}
+	if ap.CircuitBreaker != nil {
+		if ap.CircuitBreaker.Failures < 0 {
+			return fmt.Errorf("circuit breaker failures cannot be negative: %d", ap.CircuitBreaker.Failures)
+		}
+		if ap.CircuitBreaker.Pause < 0 {
+			return fmt.Errorf("circuit breaker pause cannot be negative: %s", ap.CircuitBreaker.Pause)
+		}
+	}
+	return nil
+}
+
+// breaker returns the circuit breaker for a plugin, or nil if it doesn't have one. Breakers are kept across
+// runs and configuration reloads, unless the plugin's circuit breaker settings change.
+func (ar *AgentRunner) breaker(pluginName string, pluginConfig *agentPlugin) *retry.Breaker {
+	ar.breakersMu.Lock()
+	defer ar.breakersMu.Unlock()
+
+	if pluginConfig.CircuitBreaker == nil {
+		delete(ar.breakers, pluginName)
+		return nil
+	}
+
+	failures, pause := pluginConfig.CircuitBreaker.settings()
+	if b, ok := ar.breakers[pluginName]; ok && b.Failures == failures && b.Pause == pause {
+		return b
+	}
+	if ar.breakers == nil {
+		ar.breakers = map[string]*retry.Breaker{}
+	}
+	b := &retry.Breaker{Failures: failures, Pause: pause}
+	ar.breakers[pluginName] = b
+	return b
+}
+
+// joinFailures returns the distinct errors of a plugin's failures, as a single error.
+func joinFailures(failures []pluginFailure) error {
+	errs := []error{}
+	seen := map[string]bool{}
+	for _, failure := range failures {
+		if message := failure.err.Error(); !seen[message] {
+			seen[message] = true
+			errs = append(errs, failure.err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compliance-framework/framework/internal"
+	runner2 "github.com/compliance-framework/framework/runner"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+)
+
+func TestAgentPlugin_RetryPolicy(t *testing.T) {
+	none := (&agentPlugin{}).retryPolicy()
+	if none.Retry(1) {
+		t.Errorf("Expected plugins without a retry policy not to be retried")
+	}
+
+	defaults := (&agentPlugin{Retry: &retryConfig{}}).retryPolicy()
+	if defaults.Attempts != DefaultRetryAttempts || defaults.Backoff != DefaultRetryBackoff || defaults.MaxBackoff != DefaultRetryMaxBackoff {
+		t.Errorf("Expected default retry policy, got %+v", defaults)
+	}
+
+	configured := (&agentPlugin{Retry: &retryConfig{Attempts: 5, Backoff: time.Millisecond}}).retryPolicy()
+	if configured.Attempts != 5 || configured.Backoff != time.Millisecond {
+		t.Errorf("Expected configured retry policy, got %+v", configured)
+	}
+}
+
+func TestAgentPlugin_ValidateRetries(t *testing.T) {
+	tests := []struct {
+		name   string
+		plugin agentPlugin
+		err    string
+	}{
+		{name: "No retries", plugin: agentPlugin{}},
+		{name: "Valid", plugin: agentPlugin{
+			Retry:          &retryConfig{Attempts: 3, Backoff: time.Second, Jitter: time.Second},
+			CircuitBreaker: &circuitBreakerConfig{Failures: 5, Pause: time.Minute},
+		}},
+		{name: "Negative attempts", plugin: agentPlugin{Retry: &retryConfig{Attempts: -1}}, err: "retry attempts cannot be negative"},
+		{name: "Negative backoff", plugin: agentPlugin{Retry: &retryConfig{Backoff: -time.Second}}, err: "retry backoff cannot be negative"},
+		{name: "Negative jitter", plugin: agentPlugin{Retry: &retryConfig{Jitter: -time.Second}}, err: "retry jitter cannot be negative"},
+		{name: "Negative pause", plugin: agentPlugin{CircuitBreaker: &circuitBreakerConfig{Pause: -time.Second}}, err: "circuit breaker pause cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.plugin.validateRetries()
+			if tt.err == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestAgentRunner_RunPluginRetries(t *testing.T) {
+	dir := t.TempDir()
+	// The plugin doesn't exist, so every attempt fails.
+	pluginConfig := &agentPlugin{
+		Source:         "missing-plugin",
+		Policies:       []agentPolicy{{Source: "policy"}},
+		Retry:          &retryConfig{Attempts: 3, Backoff: time.Millisecond},
+		CircuitBreaker: &circuitBreakerConfig{Failures: 2, Pause: time.Hour},
+	}
+	ar := newTestAgentRunner(agentConfig{Plugins: map[string]*agentPlugin{"test-plugin": pluginConfig}})
+	ar.pluginLocations["missing-plugin"] = path.Join(dir, "missing-plugin")
+
+	results := []*runner2.Result{}
+	resultsMu := sync.Mutex{}
+	ar.collect = func(result *runner2.Result) {
+		resultsMu.Lock()
+		defer resultsMu.Unlock()
+		results = append(results, result)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ar.runPlugin(context.Background(), "test-plugin", pluginConfig, pluginConfig.Policies); err == nil {
+			t.Fatalf("Expected the plugin to fail")
+		}
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected one error result per run, got %d", len(results))
+	}
+	if results[0].Status != proto2.ExecutionStatus_FAILURE {
+		t.Errorf("Expected a failure, got %s", results[0].Status)
+	}
+	if results[0].Logs == nil || len(*results[0].Logs) != 2 {
+		t.Fatalf("Expected the two retried attempts to be logged, got %v", results[0].Logs)
+	}
+	if title := (*results[0].Logs)[0].Title; title != "Attempt 1 failed" {
+		t.Errorf("Expected the first attempt to be logged, got %q", title)
+	}
+
+	// The circuit breaker opened after the second run, so the plugin isn't run again.
+	if err := ar.runPlugin(context.Background(), "test-plugin", pluginConfig, pluginConfig.Policies); err != nil {
+		t.Fatalf("Unexpected error while the plugin is paused: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected an unavailable result, got %d results", len(results))
+	}
+	if results[2].Status != proto2.ExecutionStatus_UNAVAILABLE {
+		t.Errorf("Expected the plugin to be unavailable, got %s", results[2].Status)
+	}
+	if !errors.Is(results[2].Error, errPluginUnavailable) {
+		t.Errorf("Expected an unavailable error, got %v", results[2].Error)
+	}
+	if results[2].Logs != nil {
+		t.Errorf("Expected no attempts to be logged while paused, got %v", *results[2].Logs)
+	}
+}
+
+func TestAgentRunner_RunPluginRetries_FindingTasks(t *testing.T) {
+	// The plugin fails its first attempt, so its findings follow the retries task.
+	pluginConfig := &agentPlugin{
+		Source:   "test-plugin",
+		Policies: []agentPolicy{{Source: "policy"}},
+		Config: agentPluginConfig{
+			"region":    "eu-west-1",
+			"findings":  "3",
+			"fail_once": path.Join(t.TempDir(), "failed"),
+		},
+		Retry: &retryConfig{Attempts: 2, Backoff: time.Millisecond},
+	}
+	ar := newTestAgentRunner(agentConfig{Plugins: map[string]*agentPlugin{"test-plugin": pluginConfig}})
+	ar.pluginLocations["test-plugin"] = os.Args[0]
+	ar.logWriter = io.Discard
+	ar.setupPluginTask = &internal.Task{Title: "Setup plugin"}
+	ar.setupPoliciesTask = &internal.Task{Title: "Setup policies"}
+	t.Cleanup(ar.closePluginClients)
+
+	results := []*runner2.Result{}
+	ar.collect = func(result *runner2.Result) {
+		results = append(results, result)
+	}
+	if err := ar.runPlugin(context.Background(), "test-plugin", pluginConfig, pluginConfig.Policies); err != nil {
+		t.Fatalf("Unexpected error running plugin: %v", err)
+	}
+	if len(results) != 1 || results[0].Findings == nil || len(*results[0].Findings) != 3 {
+		t.Fatalf("Expected a result with 3 findings, got %v", results)
+	}
+
+	for i, finding := range *results[0].Findings {
+		titles := []string{}
+		for _, task := range finding.Tasks {
+			titles = append(titles, task.Title)
+		}
+		want := []string{"Setup plugin", "Setup policies", "Retry plugin", fmt.Sprintf("finding %d", i)}
+		if !slices.Equal(titles, want) {
+			t.Errorf("Expected finding %d to have tasks %q, got %q", i, want, titles)
+		}
+	}
+}
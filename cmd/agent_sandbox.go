@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/compliance-framework/framework/internal/sandbox"
+	"github.com/spf13/cobra"
+)
+
+// sandboxExitTimeout is how long a failed plugin is given to exit, so we can tell whether it exceeded a limit.
+const sandboxExitTimeout = time.Second
+
+// sandboxConfig restricts what a plugin process can do. See sandbox.Options for each option.
+type sandboxConfig struct {
+	User  string   `mapstructure:"user"`
+	Group string   `mapstructure:"group"`
+	Env   []string `mapstructure:"env"`
+
+	Memory  int64         `mapstructure:"memory"`
+	CPUs    float64       `mapstructure:"cpus"`
+	CPUTime time.Duration `mapstructure:"cpu_time"`
+	Pids    int64         `mapstructure:"pids"`
+	Cgroup  string        `mapstructure:"cgroup"`
+
+	PrivateTmp bool `mapstructure:"private_tmp"`
+	ReadOnly   bool `mapstructure:"read_only"`
+}
+
+func (sc *sandboxConfig) options() sandbox.Options {
+	return sandbox.Options{
+		User:       sc.User,
+		Group:      sc.Group,
+		Env:        sc.Env,
+		Memory:     sc.Memory,
+		CPUs:       sc.CPUs,
+		CPUTime:    sc.CPUTime,
+		Pids:       sc.Pids,
+		Cgroup:     sc.Cgroup,
+		PrivateTmp: sc.PrivateTmp,
+		ReadOnly:   sc.ReadOnly,
+	}
+}
+
+// pluginSandbox returns a sandbox for a single process of the plugin, or nil if it isn't sandboxed.
+// The sandbox helper is the agent's own executable, running the hidden `agent sandbox-exec` command.
+func (ar *AgentRunner) pluginSandbox(pluginConfig *agentPlugin) (*sandbox.Sandbox, error) {
+	if pluginConfig.Sandbox == nil {
+		return nil, nil
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return sandbox.New(pluginConfig.Sandbox.options(), []string{executable, "agent", "sandbox-exec"})
+}
+
+// sandboxLimitError reports a plugin failure as exceeding a sandbox limit, if that's why it failed.
+func sandboxLimitError(sb *sandbox.Sandbox, err error) error {
+	if violation := sb.Violation(sandboxExitTimeout); violation != nil {
+		return fmt.Errorf("%w: %w", violation, err)
+	}
+	return err
+}
+
+// AgentSandboxExecCmd is the sandbox helper, which sets up a plugin's sandbox and then executes the plugin.
+// It is only run by the agent itself.
+func AgentSandboxExecCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:                "sandbox-exec",
+		Short:              "executes a plugin in its sandbox",
+		Hidden:             true,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return sandbox.Exec(args)
+		},
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	runner2 "github.com/compliance-framework/framework/runner"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// errInvalidPluginConfig is returned when a plugin's config doesn't match the schema the plugin declares.
+var errInvalidPluginConfig = errors.New("plugin config does not match the plugin's schema")
+
+// validatePluginConfig checks config against the JSON Schema the plugin declares for it, if it declares one,
+// so mistakes are reported by the agent rather than however the plugin handles them.
+// It returns the plugin's info, which is nil for plugins which don't describe themselves.
+func validatePluginConfig(ctx context.Context, r runner2.ContextRunner, config agentPluginConfig) (*proto2.InfoResponse, error) {
+	info, err := runner2.Info(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("getting plugin info: %w", err)
+	}
+	if info == nil || info.ConfigSchema == "" {
+		return info, nil
+	}
+
+	schema, err := compileConfigSchema(info.ConfigSchema)
+	if err != nil {
+		return info, err
+	}
+
+	// Config values are always strings, so the schema is checked against them as they are.
+	instance := map[string]any{}
+	for key, value := range config {
+		instance[key] = value
+	}
+	if err := schema.Validate(instance); err != nil {
+		var validationErr *jsonschema.ValidationError
+		if errors.As(err, &validationErr) {
+			return info, fmt.Errorf("%w: %s", errInvalidPluginConfig, strings.Join(schemaErrors(validationErr), "; "))
+		}
+		return info, fmt.Errorf("%w: %w", errInvalidPluginConfig, err)
+	}
+	return info, nil
+}
+
+// compileConfigSchema compiles a schema declared by a plugin. Schemas must be self-contained, so declaring one
+// can't make the agent read files or make requests.
+func compileConfigSchema(source string) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external schema references are not supported: %s", url)
+	}
+	if err := compiler.AddResource("config.json", strings.NewReader(source)); err != nil {
+		return nil, fmt.Errorf("invalid plugin config schema: %w", err)
+	}
+	schema, err := compiler.Compile("config.json")
+	if err != nil {
+		return nil, fmt.Errorf("invalid plugin config schema: %w", err)
+	}
+	return schema, nil
+}
+
+// schemaErrors describes each way the config failed to match the schema, by the config key it concerns.
+func schemaErrors(err *jsonschema.ValidationError) []string {
+	if len(err.Causes) > 0 {
+		messages := []string{}
+		for _, cause := range err.Causes {
+			messages = append(messages, schemaErrors(cause)...)
+		}
+		return messages
+	}
+
+	key := strings.TrimPrefix(err.InstanceLocation, "/")
+	if key == "" {
+		return []string{err.Message}
+	}
+	return []string{fmt.Sprintf("%s: %s", key, err.Message)}
+}
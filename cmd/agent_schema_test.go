@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compliance-framework/framework/internal"
+	runner2 "github.com/compliance-framework/framework/runner"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+)
+
+// schemaRunner declares schema as the schema of its config, or doesn't describe itself if it's nil.
+type schemaRunner struct {
+	processRunner
+	schema *string
+}
+
+func (r *schemaRunner) Info(ctx context.Context, req *proto2.InfoRequest) (*proto2.InfoResponse, error) {
+	if r.schema == nil {
+		return nil, nil
+	}
+	return &proto2.InfoResponse{ConfigSchema: *r.schema}, nil
+}
+
+func TestValidatePluginConfig(t *testing.T) {
+	schema := func(s string) *string { return &s }
+
+	tests := []struct {
+		name   string
+		schema *string
+		config agentPluginConfig
+		err    string
+	}{
+		{
+			name:   "Valid config",
+			schema: schema(processRunnerSchema),
+			config: agentPluginConfig{"region": "eu-west-1"},
+		},
+		{
+			name:   "Invalid value",
+			schema: schema(processRunnerSchema),
+			config: agentPluginConfig{"region": "mars"},
+			err:    "region: does not match pattern",
+		},
+		{
+			name:   "Missing key",
+			schema: schema(processRunnerSchema),
+			config: agentPluginConfig{},
+			err:    "missing properties: 'region'",
+		},
+		{
+			name:   "No schema",
+			schema: schema(""),
+			config: agentPluginConfig{"anything": "goes"},
+		},
+		{
+			name:   "Invalid schema",
+			schema: schema(`{"type": "object", "$ref": "file:///etc/passwd"}`),
+			config: agentPluginConfig{},
+			err:    "invalid plugin config schema",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := validatePluginConfig(context.Background(), &schemaRunner{schema: test.schema}, test.config)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestAgentRunner_InvalidPluginConfig(t *testing.T) {
+	pluginConfig := &agentPlugin{
+		Source:   "test-plugin",
+		Policies: []agentPolicy{{Source: "policy"}},
+		Config:   agentPluginConfig{"region": "mars"},
+		Retry:    &retryConfig{Attempts: 3, Backoff: time.Millisecond},
+	}
+	ar := newTestAgentRunner(agentConfig{Plugins: map[string]*agentPlugin{"test-plugin": pluginConfig}})
+	ar.pluginLocations["test-plugin"] = os.Args[0]
+	ar.logWriter = io.Discard
+	ar.setupPluginTask = &internal.Task{}
+	ar.setupPoliciesTask = &internal.Task{}
+	t.Cleanup(ar.closePluginClients)
+
+	results := []*runner2.Result{}
+	ar.collect = func(result *runner2.Result) {
+		results = append(results, result)
+	}
+
+	if err := ar.runPlugin(context.Background(), "test-plugin", pluginConfig, pluginConfig.Policies); err == nil {
+		t.Fatalf("Expected the plugin to fail")
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected one error result, got %d", len(results))
+	}
+	if !errors.Is(results[0].Error, errInvalidPluginConfig) {
+		t.Errorf("Expected an invalid config error, got %v", results[0].Error)
+	}
+	if results[0].Logs != nil {
+		t.Errorf("Expected invalid config not to be retried, got %v", *results[0].Logs)
+	}
+}
+
+func TestPluginInfoCmd(t *testing.T) {
+	cmd := PluginInfoCmd()
+	out := bytes.Buffer{}
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--output", "json", os.Args[0]})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info := pluginInfoOutput{}
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatalf("Error decoding output %q: %v", out.String(), err)
+	}
+	if info.Name != "process" || info.Version != "1.0.0" || info.PolicyNamespace != "compliance_framework" {
+		t.Errorf("Unexpected plugin info: %+v", info)
+	}
+	if len(info.Capabilities) != 1 || info.Capabilities[0] != runner2.CapabilityCancellation {
+		t.Errorf("info.Capabilities: got %v, want %v", info.Capabilities, []string{runner2.CapabilityCancellation})
+	}
+	if !json.Valid(info.ConfigSchema) || !strings.Contains(string(info.ConfigSchema), "region") {
+		t.Errorf("Expected the config schema as JSON, got %s", info.ConfigSchema)
+	}
+}
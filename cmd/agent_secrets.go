@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/compliance-framework/framework/internal/secret"
+)
+
+// resolveConfig returns the plugin's config with secret references, such as ${env:GITHUB_TOKEN}, replaced by
+// the secrets they refer to. Secrets are resolved on every run, so rotated secrets are picked up without a
+// reload, and are added to the agent's redactor so they are never logged or published.
+//
+// Plugins from assessment plans are configured by the API, so their references are passed on as they are,
+// rather than giving the API access to the agent's environment, files and commands.
+func (ar *AgentRunner) resolveConfig(ctx context.Context, pluginConfig *agentPlugin) (agentPluginConfig, error) {
+	if pluginConfig.fromPlan {
+		return pluginConfig.Config, nil
+	}
+
+	resolved := agentPluginConfig{}
+	for key, value := range pluginConfig.Config {
+		value, secrets, err := secret.Resolve(ctx, value)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %w", key, err)
+		}
+		ar.secrets.Add(secrets...)
+		resolved[key] = value
+	}
+	return resolved, nil
+}
+
+// validateSecrets checks the secret references in the plugin's config are complete. They are only resolved
+// when the plugin runs.
+func (ap *agentPlugin) validateSecrets() error {
+	if ap.fromPlan {
+		return nil
+	}
+	for key, value := range ap.Config {
+		if _, err := secret.References(value); err != nil {
+			return fmt.Errorf("config %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/compliance-framework/framework/internal/secret"
+)
+
+func TestAgentRunner_ResolveConfig(t *testing.T) {
+	t.Setenv("CF_TEST_TOKEN", "s3cr3t")
+
+	logs := bytes.Buffer{}
+	ar := newTestAgentRunner(agentConfig{})
+	ar.secrets = secret.NewRedactor()
+	ar.logWriter = &logs
+
+	pluginConfig := &agentPlugin{
+		Config: agentPluginConfig{
+			"host":  "localhost",
+			"token": "Bearer ${env:CF_TEST_TOKEN}",
+		},
+	}
+
+	config, err := ar.resolveConfig(context.Background(), pluginConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config["token"] != "Bearer s3cr3t" || config["host"] != "localhost" {
+		t.Errorf("Expected the secret to be resolved, got %v", config)
+	}
+	if pluginConfig.Config["token"] != "Bearer ${env:CF_TEST_TOKEN}" {
+		t.Errorf("Expected the plugin's config to keep the reference, got %q", pluginConfig.Config["token"])
+	}
+
+	if err := ar.secrets.RedactError(errors.New("invalid token s3cr3t")); err.Error() != "invalid token (redacted)" {
+		t.Errorf("Expected the resolved secret to be redacted from errors, got %q", err)
+	}
+	ar.logOutput().Write([]byte("configured with s3cr3t\n"))
+	if strings.Contains(logs.String(), "s3cr3t") {
+		t.Errorf("Expected the resolved secret to be redacted from plugin logs, got %q", logs.String())
+	}
+
+	t.Run("Plugins from plans are not resolved", func(t *testing.T) {
+		planPlugin := &agentPlugin{Config: agentPluginConfig{"token": "${env:CF_TEST_TOKEN}"}, fromPlan: true}
+		config, err := ar.resolveConfig(context.Background(), planPlugin)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config["token"] != "${env:CF_TEST_TOKEN}" {
+			t.Errorf("Expected the reference to be passed on as it is, got %q", config["token"])
+		}
+	})
+
+	t.Run("Unresolvable secrets are errors", func(t *testing.T) {
+		_, err := ar.resolveConfig(context.Background(), &agentPlugin{
+			Config: agentPluginConfig{"token": "${env:CF_TEST_MISSING}"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "config token") {
+			t.Errorf("Expected an error naming the config key, got %v", err)
+		}
+	})
+}
+
+func TestAgentPlugin_ValidateSecrets(t *testing.T) {
+	valid := &agentPlugin{Config: agentPluginConfig{"token": "${file:/run/secrets/token}"}}
+	if err := valid.validateSecrets(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	invalid := &agentPlugin{Config: agentPluginConfig{"token": "${exec:}"}}
+	if err := invalid.validateSecrets(); err == nil {
+		t.Errorf("Expected an error for an incomplete reference")
+	}
+}
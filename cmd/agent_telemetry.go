@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/compliance-framework/framework/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// agentServiceName identifies the agent's spans.
+const agentServiceName = "cf-agent"
+
+// telemetryShutdownTimeout is how long pending spans are given to be exported when the agent stops.
+const telemetryShutdownTimeout = 5 * time.Second
+
+// tracer creates the agent's spans. Until tracing is set up, its spans are not recorded.
+var tracer = telemetry.Tracer("github.com/compliance-framework/framework/cmd")
+
+// telemetryConfig configures tracing of the agent and its plugins. See telemetry.Config for each option.
+type telemetryConfig struct {
+	Exporter    string   `mapstructure:"exporter"`
+	Endpoint    string   `mapstructure:"endpoint"`
+	Insecure    bool     `mapstructure:"insecure"`
+	File        string   `mapstructure:"file"`
+	SampleRatio *float64 `mapstructure:"sample_ratio"`
+}
+
+func (tc *telemetryConfig) options() telemetry.Config {
+	if tc == nil {
+		return telemetry.Config{}
+	}
+	return telemetry.Config{
+		Exporter:    tc.Exporter,
+		Endpoint:    tc.Endpoint,
+		Insecure:    tc.Insecure,
+		File:        tc.File,
+		SampleRatio: tc.SampleRatio,
+	}
+}
+
+// setupTelemetry sets up tracing as configured, and returns a function which exports any pending spans.
+// Tracing is set up once, so changes to its configuration take effect when the agent restarts.
+func (ac *agentConfig) setupTelemetry(ctx context.Context) (func(), error) {
+	shutdown, err := telemetry.Setup(ctx, agentServiceName, ac.Telemetry.options())
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), telemetryShutdownTimeout)
+		defer cancel()
+		_ = shutdown(ctx)
+	}, nil
+}
+
+// Attributes of the agent's spans.
+var (
+	attrPlugin = attribute.Key("cf.plugin")
+	attrPolicy = attribute.Key("cf.policy")
+	attrSource = attribute.Key("cf.source")
+)
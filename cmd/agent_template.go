@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/compliance-framework/framework/internal/host"
+)
+
+// hostLabelPrefix prefixes the host fact labels added to every result, such as `_host.hostname`.
+const hostLabelPrefix = "_host."
+
+// configTemplateData is available to templates in labels and plugin config values, as `.Host` and `.Env`.
+type configTemplateData struct {
+	Host host.Facts
+	Env  map[string]string
+}
+
+var configTemplateFuncs = template.FuncMap{
+	"env": os.Getenv,
+	// default returns fallback if value is empty, so it can be piped into: {{ .Host.cloud_region | default "local" }}
+	"default": func(fallback string, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// hostFacts collects facts about the host the agent runs on.
+func (ac *agentConfig) hostFacts(ctx context.Context) host.Facts {
+	return host.Collect(ctx, host.Options{CloudMetadata: !ac.DisableCloudMetadata})
+}
+
+// render interpolates host facts and environment variables into the agent's labels, and each plugin's labels
+// and config values, so the same configuration can be used across a fleet.
+func (ac *agentConfig) render(facts host.Facts) error {
+	env := map[string]string{}
+	for _, entry := range os.Environ() {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			env[key] = value
+		}
+	}
+	data := configTemplateData{Host: facts, Env: env}
+
+	if err := renderValues(ac.Labels, data); err != nil {
+		return fmt.Errorf("labels: %w", err)
+	}
+	for pluginName, pluginConfig := range ac.Plugins {
+		if err := renderValues(pluginConfig.Labels, data); err != nil {
+			return fmt.Errorf("plugin %s: labels: %w", pluginName, err)
+		}
+		if err := renderValues(pluginConfig.Config, data); err != nil {
+			return fmt.Errorf("plugin %s: config: %w", pluginName, err)
+		}
+	}
+	return nil
+}
+
+// renderValues renders every value in values as a template, in place.
+func renderValues(values map[string]string, data configTemplateData) error {
+	for key, value := range values {
+		if !strings.Contains(value, "{{") {
+			continue
+		}
+
+		// Missing facts and variables are rendered as empty, so configurations work on hosts where they aren't
+		// available, such as outside a cloud.
+		tmpl, err := template.New(key).Option("missingkey=zero").Funcs(configTemplateFuncs).Parse(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		rendered := strings.Builder{}
+		if err := tmpl.Execute(&rendered, data); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		values[key] = rendered.String()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/compliance-framework/framework/internal/host"
+)
+
+func TestAgentConfig_Render(t *testing.T) {
+	t.Setenv("CF_ENVIRONMENT", "prod")
+	facts := host.Facts{
+		host.FactHostname:    "web-01",
+		host.FactCloudRegion: "eu-west-2",
+	}
+
+	t.Run("Interpolates facts and environment variables", func(t *testing.T) {
+		config := &agentConfig{
+			Labels: map[string]string{
+				"env": "{{ .Env.CF_ENVIRONMENT }}",
+			},
+			Plugins: map[string]*agentPlugin{
+				"local-ssh": {
+					Labels: map[string]string{
+						"host":   "{{ .Host.hostname }}",
+						"region": `{{ .Host.cloud_region | default "local" }}`,
+						"zone":   `{{ .Host.cloud_zone | default "local" }}`,
+						"static": "ssh",
+					},
+					Config: agentPluginConfig{
+						"host":  `{{ .Host.hostname }}.{{ env "CF_ENVIRONMENT" }}.internal`,
+						"token": `${env:CF_ENVIRONMENT}`,
+					},
+				},
+			},
+		}
+
+		if err := config.render(facts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if config.Labels["env"] != "prod" {
+			t.Errorf("Expected the agent label from the environment, got %q", config.Labels["env"])
+		}
+		expected := map[string]string{"host": "web-01", "region": "eu-west-2", "zone": "local", "static": "ssh"}
+		for key, value := range expected {
+			if actual := config.Plugins["local-ssh"].Labels[key]; actual != value {
+				t.Errorf("Expected label %s to be %q, got %q", key, value, actual)
+			}
+		}
+		if host := config.Plugins["local-ssh"].Config["host"]; host != "web-01.prod.internal" {
+			t.Errorf("Expected the config value to be rendered, got %q", host)
+		}
+		// Secret references are left to be resolved, and redacted, when the plugin runs.
+		if token := config.Plugins["local-ssh"].Config["token"]; token != "${env:CF_ENVIRONMENT}" {
+			t.Errorf("Expected the secret reference to be left as it is, got %q", token)
+		}
+	})
+
+	t.Run("Missing facts are empty", func(t *testing.T) {
+		config := &agentConfig{Labels: map[string]string{"account": "{{ .Host.cloud_account }}"}}
+		if err := config.render(facts); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Labels["account"] != "" {
+			t.Errorf("Expected a missing fact to be empty, got %q", config.Labels["account"])
+		}
+	})
+
+	t.Run("Invalid templates are rejected", func(t *testing.T) {
+		config := &agentConfig{
+			Plugins: map[string]*agentPlugin{
+				"local-ssh": {Config: agentPluginConfig{"host": "{{ .Host.hostname"}},
+			},
+		}
+		if err := config.render(facts); err == nil {
+			t.Errorf("Expected an error for an invalid template")
+		}
+	})
+}
+
+func TestAgentRunner_ResultStream_HostFacts(t *testing.T) {
+	t.Setenv("HOSTNAME", "")
+
+	ar := newTestAgentRunner(agentConfig{})
+	ar.hostFacts = host.Facts{host.FactHostname: "web-01", host.FactOS: "linux"}
+
+	streamId, labels := ar.resultStream("local-ssh", &agentPlugin{}, agentPolicy{Source: "policies/ssh"})
+	if labels["_host.hostname"] != "web-01" || labels["_host.os"] != "linux" {
+		t.Errorf("Expected host fact labels, got %v", labels)
+	}
+	if labels["_hostname"] != "web-01" {
+		t.Errorf("Expected the hostname fact when HOSTNAME is unset, got %q", labels["_hostname"])
+	}
+
+	// The hostname fact only labels results, so streams of agents without HOSTNAME carry on.
+	ar.hostFacts = host.Facts{}
+	if withoutFacts, _ := ar.resultStream("local-ssh", &agentPlugin{}, agentPolicy{Source: "policies/ssh"}); withoutFacts != streamId {
+		t.Errorf("Expected the hostname fact not to change the stream, got %s and %s", streamId, withoutFacts)
+	}
+
+	t.Setenv("HOSTNAME", "container-1")
+	_, labels = ar.resultStream("local-ssh", &agentPlugin{}, agentPolicy{Source: "policies/ssh"})
+	if labels["_hostname"] != "container-1" {
+		t.Errorf("Expected HOSTNAME to take precedence, got %q", labels["_hostname"])
+	}
+}
@@ -2,9 +2,33 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/compliance-framework/framework/internal"
+	"github.com/compliance-framework/framework/internal/artifact"
+	"github.com/compliance-framework/framework/internal/event"
+	"github.com/compliance-framework/framework/internal/scheduler"
+	"github.com/compliance-framework/framework/internal/signature"
+	runner2 "github.com/compliance-framework/framework/runner"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/hashicorp/go-hclog"
+	natsserver "github.com/nats-io/nats-server/v2/test"
 	"github.com/spf13/viper"
 )
 
@@ -40,6 +64,274 @@ plugins:
 			configYamlContent: `
 nats:
   url: nats://localhost:4222
+`,
+			valid: false,
+		},
+		{
+			name: "No Plugin Configuration As A Daemon",
+			configYamlContent: `
+daemon: true
+nats:
+  url: nats://localhost:4222
+labels:
+  env: prod
+`,
+			valid: true,
+		},
+		{
+			name: "Valid Plugin Schedule",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+    schedule: "*/5 * * * *"
+    jitter: 30s
+  other-plugin:
+    source: ghcr.io/other-plugin:v1
+    schedule: "@every 24h"
+`,
+			valid: true,
+		},
+		{
+			name: "Invalid Plugin Schedule",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+    schedule: "every five minutes"
+`,
+			valid: false,
+		},
+		{
+			name: "Valid Concurrency And Timeout",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+concurrency: 2
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+    timeout: 90s
+`,
+			valid: true,
+		},
+		{
+			name: "Negative Concurrency",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+concurrency: -1
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+`,
+			valid: false,
+		},
+		{
+			name: "Negative Result Chunk Size",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+result_chunk_size: -1
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+`,
+			valid: false,
+		},
+		{
+			name: "Negative Plugin Timeout",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+    timeout: -5s
+`,
+			valid: false,
+		},
+		{
+			name: "Valid HTTP Sources",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+plugins:
+  test-plugin:
+    source: https://artifacts.example.com/cf-plugin-ssh
+    sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+    policies:
+      - ghcr.io/some-policies:v1
+      - source: https://artifacts.example.com/policies.tar.gz
+        sha256: 60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752
+`,
+			valid: true,
+		},
+		{
+			name: "HTTP Plugin Without Checksum",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+plugins:
+  test-plugin:
+    source: https://artifacts.example.com/cf-plugin-ssh
+`,
+			valid: false,
+		},
+		{
+			name: "HTTP Policy Without Checksum",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+    policies:
+      - https://artifacts.example.com/policies.tar.gz
+`,
+			valid: false,
+		},
+		{
+			name: "Valid Outbox Limits",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+outbox:
+  path: /var/lib/compliance-framework/outbox
+  max_size: 52428800
+  max_age: 72h
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+`,
+			valid: true,
+		},
+		{
+			name: "Negative Outbox Max Age",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+outbox:
+  max_age: -1h
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+`,
+			valid: false,
+		},
+		{
+			name: "Valid Health Listener",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+health:
+  address: 127.0.0.1:9090
+  max_run_age: 1h
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+`,
+			valid: true,
+		},
+		{
+			name: "Invalid Health Address",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+health:
+  address: localhost
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+`,
+			valid: false,
+		},
+		{
+			name: "Valid Plugin Sandbox",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+    sandbox:
+      env: [PATH, HTTPS_PROXY]
+      memory: 268435456
+      cpu_time: 5m
+      private_tmp: true
+`,
+			// Sandboxing is only supported on Linux.
+			valid: runtime.GOOS == "linux",
+		},
+		{
+			name: "Invalid Plugin Sandbox",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+    sandbox:
+      cpus: 0.5
+`,
+			valid: false,
+		},
+		{
+			name: "Valid Telemetry",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+telemetry:
+  exporter: otlp
+  endpoint: collector:4317
+  insecure: true
+  sample_ratio: 0.25
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
+`,
+			valid: true,
+		},
+		{
+			name: "Invalid Telemetry Exporter",
+			configYamlContent: `
+nats:
+  url: nats://localhost:4222
+
+telemetry:
+  exporter: file
+
+plugins:
+  test-plugin:
+    source: ghcr.io/some-plugin:v1
 `,
 			valid: false,
 		},
@@ -54,8 +346,7 @@ nats:
 				t.Fatalf("Error reading config: %v", err)
 			}
 
-			config := &agentConfig{}
-			err = v.Unmarshal(config)
+			config, err := decodeConfig(v)
 			if err != nil {
 				t.Fatalf("Error unmarshalling config: %v", err)
 			}
@@ -118,3 +409,499 @@ func TestAgentCmd_ConfigurationMerging(t *testing.T) {
 		}
 	})
 }
+
+func TestAgentRunner_Run(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	options := natsserver.DefaultTestOptions
+	options.Port = -1
+	s := natsserver.RunServer(&options)
+	defer s.Shutdown()
+
+	// The fake plugin is scheduled straight away, and waits for release before finishing its run.
+	dir := t.TempDir()
+	release := path.Join(dir, "release")
+	policyPath := path.Join(dir, "policy.tar.gz")
+	if err := os.WriteFile(policyPath, []byte{}, 0644); err != nil {
+		t.Fatalf("Error writing policy: %v", err)
+	}
+
+	logger := hclog.NewNullLogger()
+	ar := &AgentRunner{
+		logger: logger,
+		config: agentConfig{
+			Daemon: true,
+			Nats:   &natsConfig{Url: s.ClientURL()},
+			Outbox: &outboxConfig{Path: t.TempDir()},
+			Plugins: map[string]*agentPlugin{
+				"test-plugin": {
+					Source:   os.Args[0],
+					Schedule: "@every 1s",
+					Policies: []agentPolicy{{Source: policyPath}},
+					Config:   agentPluginConfig{"region": "eu-west-1", "wait_for": release},
+				},
+			},
+		},
+		natsBus:         event.NewNatsBus(logger),
+		pluginLocations: map[string]string{},
+		policyLocations: map[string]string{},
+		pluginVersions:  map[string]string{},
+		policyVersions:  map[string]string{},
+		scheduler:       scheduler.New(logger),
+		workers:         make(chan struct{}, 1),
+		logWriter:       io.Discard,
+	}
+	results := make(chan *runner2.Result, 10)
+	ar.collect = func(result *runner2.Result) {
+		results <- result
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ar.Run(ctx)
+	}()
+
+	// Ask the daemon to stop once the plugin is running.
+	waitForStarted(t, release+".started")
+	cancel()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expected daemon to wait for the running plugin before stopping, got %v", err)
+	default:
+	}
+
+	if err := os.WriteFile(release, nil, 0644); err != nil {
+		t.Fatalf("Error releasing plugin: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected daemon to stop cleanly, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected daemon to stop when its context was cancelled")
+	}
+
+	// The running plugin's result is published before the daemon stops.
+	select {
+	case result := <-results:
+		if result.Status != proto2.ExecutionStatus_SUCCESS {
+			t.Errorf("Expected the running plugin to finish, got %s: %s", result.Status, result.Title)
+		}
+	default:
+		t.Errorf("Expected the running plugin's result before the daemon stopped")
+	}
+}
+
+func TestAgentRunner_ConcurrentScheduledRuns(t *testing.T) {
+	dir := t.TempDir()
+	release := path.Join(dir, "release")
+	// The plugins don't use their policy, but it is downloaded before each scheduled run.
+	policyPath := path.Join(dir, "policy.tar.gz")
+	if err := os.WriteFile(policyPath, []byte{}, 0644); err != nil {
+		t.Fatalf("Error writing policy: %v", err)
+	}
+	policies := []agentPolicy{{Source: policyPath}}
+	slow := &agentPlugin{
+		Source:   "test-plugin",
+		Policies: policies,
+		Config:   agentPluginConfig{"region": "eu-west-1", "wait_for": release},
+	}
+	fast := &agentPlugin{
+		Source:   "test-plugin",
+		Policies: policies,
+		Config:   agentPluginConfig{"region": "eu-west-1"},
+	}
+	ar := newTestAgentRunner(agentConfig{Plugins: map[string]*agentPlugin{"slow": slow, "fast": fast}})
+	ar.pluginLocations["test-plugin"] = os.Args[0]
+	ar.runCtx = context.Background()
+	ar.logWriter = io.Discard
+	ar.setupPluginTask = &internal.Task{}
+	ar.collect = func(result *runner2.Result) {}
+	t.Cleanup(ar.closePluginClients)
+
+	slowDone := make(chan error, 1)
+	go func() {
+		slowDone <- ar.runScheduled("slow", policies[0])
+	}()
+	waitForStarted(t, release+".started")
+
+	// The fast plugin's run downloads policies and reads the configuration while the slow plugin is running.
+	fastDone := make(chan error, 1)
+	go func() {
+		fastDone <- ar.runScheduled("fast", policies[0])
+	}()
+	select {
+	case err := <-fastDone:
+		if err != nil {
+			t.Errorf("Unexpected error running fast plugin: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("Expected a scheduled run not to wait for another plugin to finish")
+	}
+
+	if err := os.WriteFile(release, nil, 0644); err != nil {
+		t.Fatalf("Error releasing slow plugin: %v", err)
+	}
+	if err := <-slowDone; err != nil {
+		t.Errorf("Unexpected error running slow plugin: %v", err)
+	}
+}
+
+// waitForStarted waits for a file created by a plugin once it has started.
+func waitForStarted(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s to be created", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgentRunner_DownloadItem(t *testing.T) {
+	chdirTemp(t)
+
+	content := []byte("package compliance_framework.ssh")
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	ar := newTestAgentRunner(agentConfig{})
+
+	t.Run("Downloads HTTP sources", func(t *testing.T) {
+		location, _, activity, err := ar.downloadItem("policies", server.URL+"/ssh.rego", checksum, false, nil, map[string]string{})
+		if err != nil {
+			t.Fatalf("Unexpected error downloading policy: %v", err)
+		}
+
+		downloaded, err := os.ReadFile(location)
+		if err != nil {
+			t.Fatalf("Error reading downloaded policy: %v", err)
+		}
+		if string(downloaded) != string(content) {
+			t.Errorf("Expected downloaded policy to be %q, got %q", content, downloaded)
+		}
+		if len(activity.Steps) == 0 {
+			t.Errorf("Expected download steps to be recorded on the activity")
+		}
+	})
+
+	t.Run("Records failures on the activity", func(t *testing.T) {
+		wrongSum := sha256.Sum256([]byte("something else"))
+
+		_, _, activity, err := ar.downloadItem("policies", server.URL+"/ssh.rego", hex.EncodeToString(wrongSum[:]), false, nil, map[string]string{})
+		if err == nil {
+			t.Fatalf("Expected an error for a checksum mismatch")
+		}
+
+		last := activity.Steps[len(activity.Steps)-1]
+		if last.Title != "Error downloading policies" {
+			t.Errorf("Expected the last step to record the error, got %q", last.Title)
+		}
+	})
+}
+
+func TestAgentRunner_DownloadItem_OCI(t *testing.T) {
+	dir := chdirTemp(t)
+
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	source := strings.TrimPrefix(server.URL, "http://") + "/policies/ssh:v1"
+
+	push := func(policy string) string {
+		img, err := crane.Image(map[string][]byte{"policies/ssh.rego": []byte(policy)})
+		if err != nil {
+			t.Fatalf("Error building image: %v", err)
+		}
+		if err := crane.Push(img, source); err != nil {
+			t.Fatalf("Error pushing image: %v", err)
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Error getting image digest: %v", err)
+		}
+		return digest.String()
+	}
+
+	lock, err := artifact.LoadLock(path.Join(dir, artifact.LockFileName))
+	if err != nil {
+		t.Fatalf("Error loading lock file: %v", err)
+	}
+	ar := newTestAgentRunner(agentConfig{})
+	ar.lock = lock
+
+	first := push("package first")
+
+	pins := map[string]string{}
+	location, version, _, err := ar.downloadItem("policies", source, "", false, nil, pins)
+	if err != nil {
+		t.Fatalf("Unexpected error downloading policy: %v", err)
+	}
+	if pins[source] != first {
+		t.Errorf("Expected %s to be resolved to %s, got %s", source, first, pins[source])
+	}
+	ar.pin(pins)
+	if version != first {
+		t.Errorf("Expected the policy version to be its digest %s, got %s", first, version)
+	}
+	if digest, _ := lock.Digest(source); digest != first {
+		t.Errorf("Expected %s to be locked to %s, got %s", source, first, digest)
+	}
+
+	// Pushing the tag again doesn't change what runs, as it is locked to the first digest.
+	push("package second")
+
+	pins = map[string]string{}
+	locked, _, activity, err := ar.downloadItem("policies", source, "", false, nil, pins)
+	if err != nil {
+		t.Fatalf("Unexpected error downloading policy: %v", err)
+	}
+	if locked != location {
+		t.Errorf("Expected locked policy to be at %s, got %s", location, locked)
+	}
+	policy, err := os.ReadFile(path.Join(locked, "ssh.rego"))
+	if err != nil {
+		t.Fatalf("Error reading downloaded policy: %v", err)
+	}
+	if string(policy) != "package first" {
+		t.Errorf("Expected the locked policy, got %q", policy)
+	}
+
+	titles := []string{}
+	for _, step := range activity.Steps {
+		titles = append(titles, step.Title)
+	}
+	if !slices.Contains(titles, "Using locked digest") || !slices.Contains(titles, "Using cached artifact") {
+		t.Errorf("Expected the locked digest to be used from the cache, got steps %v", titles)
+	}
+}
+
+func TestAgentRunner_ResultStream(t *testing.T) {
+	policy := agentPolicy{Source: "ghcr.io/compliance-framework/policies-ssh:v1"}
+
+	streamAt := func(versioned bool, pluginVersion string, policyVersion string) (string, map[string]string) {
+		ar := newTestAgentRunner(agentConfig{})
+		ar.pluginVersions["plugin"] = pluginVersion
+		ar.policyVersions[policy.Source] = policyVersion
+
+		pluginConfig := &agentPlugin{Source: "plugin", VersionedStreams: versioned}
+		streamId, labels := ar.resultStream("ssh", pluginConfig, policy)
+		return streamId.String(), labels
+	}
+
+	t.Run("Labels results with versions", func(t *testing.T) {
+		_, labels := streamAt(false, "sha256:1111", "rev-1")
+		if labels["_plugin_version"] != "sha256:1111" {
+			t.Errorf("Expected _plugin_version label to be sha256:1111, got %q", labels["_plugin_version"])
+		}
+		if labels["_policy_version"] != "rev-1" {
+			t.Errorf("Expected _policy_version label to be rev-1, got %q", labels["_policy_version"])
+		}
+	})
+
+	t.Run("Continues streams across versions by default", func(t *testing.T) {
+		before, _ := streamAt(false, "sha256:1111", "rev-1")
+		after, _ := streamAt(false, "sha256:2222", "rev-2")
+		if before != after {
+			t.Errorf("Expected the stream to continue across versions, got %s and %s", before, after)
+		}
+	})
+
+	t.Run("Starts a new stream for each version if versioned", func(t *testing.T) {
+		before, _ := streamAt(true, "sha256:1111", "rev-1")
+		samePlugin, _ := streamAt(true, "sha256:1111", "rev-1")
+		newPlugin, _ := streamAt(true, "sha256:2222", "rev-1")
+		newPolicy, _ := streamAt(true, "sha256:1111", "rev-2")
+		if before != samePlugin {
+			t.Errorf("Expected the same versions to have the same stream, got %s and %s", before, samePlugin)
+		}
+		if before == newPlugin || before == newPolicy {
+			t.Errorf("Expected a new stream when a version changes")
+		}
+	})
+
+	t.Run("Continues streams from before versions were known", func(t *testing.T) {
+		// Streams were seeded with the plugin name, the policy's download location and HOSTNAME, which these
+		// stream ids were produced from.
+		t.Setenv("HOSTNAME", "web-01")
+		local := agentPolicy{Source: "policies/ssh.tar.gz"}
+		tests := []struct {
+			policy   agentPolicy
+			location string
+			streamId string
+		}{
+			{policy: policy, location: ".compliance-framework/policies/cache/sha256-1111/policies", streamId: "da6c692e-d88d-40a5-b6fc-a6bb589f9a83"},
+			{policy: local, location: local.Source, streamId: "916cb2e5-1a12-452f-aafb-784e97b87862"},
+		}
+		for _, test := range tests {
+			ar := newTestAgentRunner(agentConfig{})
+			ar.policyLocations[test.policy.Source] = test.location
+			ar.policyVersions[test.policy.Source] = "rev-1"
+
+			streamId, labels := ar.resultStream("ssh", &agentPlugin{Source: "plugin"}, test.policy)
+			if streamId.String() != test.streamId {
+				t.Errorf("Expected %s to continue stream %s, got %s", test.policy.Source, test.streamId, streamId)
+			}
+			if labels["_policy"] != test.policy.Source || labels["_policy_path"] != test.location {
+				t.Errorf("Expected results to be labelled with the policy source and location, got %v", labels)
+			}
+		}
+	})
+}
+
+func TestAgentRunner_ResultChunks(t *testing.T) {
+	pluginConfig := &agentPlugin{
+		Source:   "test-plugin",
+		Policies: []agentPolicy{{Source: "policy"}},
+		Config:   agentPluginConfig{"region": "eu-west-1", "observations": "5"},
+	}
+	ar := newTestAgentRunner(agentConfig{
+		ResultChunkSize: 2,
+		Plugins:         map[string]*agentPlugin{"test-plugin": pluginConfig},
+	})
+	ar.pluginLocations["test-plugin"] = os.Args[0]
+	ar.logWriter = io.Discard
+	ar.setupPluginTask = &internal.Task{}
+	ar.setupPoliciesTask = &internal.Task{}
+	t.Cleanup(ar.closePluginClients)
+
+	results := []*runner2.Result{}
+	ar.collect = func(result *runner2.Result) {
+		results = append(results, result)
+	}
+	if err := ar.runPlugin(context.Background(), "test-plugin", pluginConfig, pluginConfig.Policies); err != nil {
+		t.Fatalf("Unexpected error running plugin: %v", err)
+	}
+
+	// Each chunk is a result on the same stream, and the last has the plugin's title and status.
+	if len(results) != 3 {
+		t.Fatalf("Expected the 5 observations to be published in 3 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.StreamID != results[0].StreamID {
+			t.Errorf("Expected every chunk on the same stream, got %s and %s", results[0].StreamID, result.StreamID)
+		}
+		if chunk := result.Labels["_chunk"]; chunk != fmt.Sprint(i+1) {
+			t.Errorf("Expected result %d to be labelled as chunk %d, got %q", i, i+1, chunk)
+		}
+		if run := result.Labels["_chunk_run"]; run == "" || run != results[0].Labels["_chunk_run"] {
+			t.Errorf("Expected every chunk labelled with the same run, got %q and %q", results[0].Labels["_chunk_run"], run)
+		}
+		if i < 2 && result.Status != proto2.ExecutionStatus_PARTIAL {
+			t.Errorf("Expected chunk %d to be partial, got %s", i+1, result.Status)
+		}
+	}
+	if results[1].Labels["_chunks"] != "" || results[2].Labels["_chunks"] != "3" {
+		t.Errorf("Expected only the last chunk to be labelled with the number of chunks, got %q", results[2].Labels["_chunks"])
+	}
+	if len(*results[0].Observations) != 2 || len(*results[2].Observations) != 1 {
+		t.Errorf("Expected at most 2 observations in each result")
+	}
+	if last := results[2]; last.Status != proto2.ExecutionStatus_SUCCESS || !strings.HasPrefix(last.Title, "pid ") {
+		t.Errorf("Expected the last chunk to have the plugin's title and status, got %q and %s", last.Title, last.Status)
+	}
+}
+
+func TestMatchChecksums(t *testing.T) {
+	sum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	tests := []struct {
+		name      string
+		sources   []string
+		checksums []string
+		valid     bool
+	}{
+		{name: "No HTTP Sources", sources: []string{"ghcr.io/some-plugin:v1"}, valid: true},
+		{name: "Checksum For Each HTTP Source", sources: []string{"ghcr.io/some-plugin:v1", "https://example.com/plugin"}, checksums: []string{sum}, valid: true},
+		{name: "Missing Checksum", sources: []string{"https://example.com/plugin"}, valid: false},
+		{name: "Too Many Checksums", sources: []string{"https://example.com/plugin"}, checksums: []string{sum, sum}, valid: false},
+		{name: "Invalid Checksum", sources: []string{"https://example.com/plugin"}, checksums: []string{"abc"}, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := matchChecksums(tt.sources, tt.checksums)
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected validity %v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestAgentRunner_DownloadPlugins_Signatures(t *testing.T) {
+	dir := chdirTemp(t)
+
+	publicKey, privateKey, err := signature.GenerateKey()
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	publicKeyPath := path.Join(dir, "trusted.pub")
+	privateKeyPath := path.Join(dir, "trusted.key")
+	if err := os.WriteFile(publicKeyPath, publicKey, 0644); err != nil {
+		t.Fatalf("Error writing public key: %v", err)
+	}
+	if err := os.WriteFile(privateKeyPath, privateKey, 0600); err != nil {
+		t.Fatalf("Error writing private key: %v", err)
+	}
+
+	pluginPath := path.Join(dir, "plugin")
+	if err := os.WriteFile(pluginPath, []byte("plugin"), 0755); err != nil {
+		t.Fatalf("Error writing plugin: %v", err)
+	}
+
+	config := &agentConfig{
+		TrustedKeys: []string{publicKeyPath},
+		Plugins: map[string]*agentPlugin{
+			"test-plugin": {Source: pluginPath},
+		},
+	}
+	ar := newTestAgentRunner(*config)
+
+	t.Run("Refuses unsigned plugins", func(t *testing.T) {
+		_, _, task, err := ar.downloadPlugins(config, map[string]string{})
+		if err == nil {
+			t.Fatalf("Expected unsigned plugin to be refused")
+		}
+
+		steps := task.Activities[0].Steps
+		if last := steps[len(steps)-1]; last.Title != "Error downloading plugins" {
+			t.Errorf("Expected the failure to be recorded in the setup task, got %q", last.Title)
+		}
+	})
+
+	t.Run("Accepts signed plugins", func(t *testing.T) {
+		key, err := signature.LoadPrivateKey(privateKeyPath)
+		if err != nil {
+			t.Fatalf("Error loading private key: %v", err)
+		}
+		if _, err := signature.SignPath(key, pluginPath); err != nil {
+			t.Fatalf("Error signing plugin: %v", err)
+		}
+
+		locations, _, task, err := ar.downloadPlugins(config, map[string]string{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if locations[pluginPath] != pluginPath {
+			t.Errorf("Expected local plugin to be used, got %s", locations[pluginPath])
+		}
+
+		steps := task.Activities[0].Steps
+		if last := steps[len(steps)-1]; last.Title != "Verified signature" {
+			t.Errorf("Expected the verification to be recorded in the setup task, got %q", last.Title)
+		}
+	})
+}
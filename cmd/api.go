@@ -4,7 +4,9 @@ import (
 	"context"
 	"github.com/compliance-framework/framework/api"
 	"github.com/compliance-framework/framework/api/handler"
+	"github.com/compliance-framework/framework/event"
 	"github.com/compliance-framework/framework/event/bus"
+	"github.com/compliance-framework/framework/internal/telemetry"
 	apiRuntime "github.com/compliance-framework/framework/runtime"
 	"github.com/compliance-framework/framework/service"
 	mongoStore "github.com/compliance-framework/framework/store/mongo"
@@ -35,9 +37,13 @@ const (
 	DefaultPort     = ":8080"
 )
 
+// apiServiceName identifies the API's spans.
+const apiServiceName = "cf-api"
+
 type Config struct {
-	MongoURI string
-	NatsURI  string
+	MongoURI  string
+	NatsURI   string
+	Telemetry telemetry.Config
 }
 
 //	@title			Compliance Framework Configuration Service API
@@ -60,6 +66,12 @@ func apiRunner(cmd *cobra.Command, args []string) error {
 
 	config := loadConfig()
 
+	shutdownTelemetry, err := telemetry.Setup(ctx, apiServiceName, config.Telemetry)
+	if err != nil {
+		sugar.Fatal(err)
+	}
+	defer shutdownTelemetry(context.WithoutCancel(ctx))
+
 	mongoDatabase, err := connectMongo(ctx, options.Client().ApplyURI(config.MongoURI), "cf")
 	if err != nil {
 		sugar.Fatal(err)
@@ -85,9 +97,16 @@ func apiRunner(cmd *cobra.Command, args []string) error {
 	resultHandler := handler.NewResultsHandler(sugar, resultService, planService)
 	resultHandler.Register(server.API().Group("/results"))
 
-	resultProcessor := apiRuntime.NewProcessor(bus.Subscribe[apiRuntime.ExecutionResult], planService, resultService)
+	resultProcessor := apiRuntime.NewProcessor(bus.SubscribeContext[apiRuntime.ExecutionResult], planService, resultService)
 	resultProcessor.Listen()
 
+	agentService := service.NewAgentService(mongoDatabase)
+	agentHandler := handler.NewAgentsHandler(sugar, agentService)
+	agentHandler.Register(server.API().Group("/agents"))
+
+	agentProcessor := apiRuntime.NewAgentProcessor(bus.Subscribe[event.AgentEvent], agentService)
+	agentProcessor.Listen()
+
 	plansService := service.NewPlansService(mongoDatabase, bus.Publish)
 	plansHandler := handler.NewPlansHandler(sugar, plansService)
 	plansHandler.Register(server.API().Group("/plans"))
@@ -135,9 +154,18 @@ func loadConfig() (config Config) {
 		natsURI = DefaultNATSURI
 	}
 
+	// Traces are exported as configured by TELEMETRY_EXPORTER, which is one of none, otlp, stdout or file.
+	telemetryConfig := telemetry.Config{
+		Exporter: os.Getenv("TELEMETRY_EXPORTER"),
+		Endpoint: os.Getenv("TELEMETRY_ENDPOINT"),
+		Insecure: os.Getenv("TELEMETRY_INSECURE") == "true",
+		File:     os.Getenv("TELEMETRY_FILE"),
+	}
+
 	config = Config{
-		MongoURI: mongoURI,
-		NatsURI:  natsURI,
+		MongoURI:  mongoURI,
+		NatsURI:   natsURI,
+		Telemetry: telemetryConfig,
 	}
 	return config
 }
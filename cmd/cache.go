@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/compliance-framework/framework/internal"
+	"github.com/compliance-framework/framework/internal/artifact"
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func CacheCmd() *cobra.Command {
+	var cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "manages downloaded plugins and policies",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Usage()
+		},
+	}
+
+	cacheCmd.AddCommand(CacheGCCmd())
+
+	return cacheCmd
+}
+
+func CacheGCCmd() *cobra.Command {
+	var gcCmd = &cobra.Command{
+		Use:   "gc",
+		Short: "removes downloaded plugins and policies which are no longer used",
+		Long: `Removes every downloaded plugin and policy which isn't referenced by any of the given agent configurations.
+OCI tags are kept at the digest recorded in the lock file alongside each configuration.
+
+Every configuration used by agents sharing the download directories should be given, otherwise their
+plugins and policies will be removed, and downloaded again when the agent next starts or reloads.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger := hclog.New(&hclog.LoggerOptions{
+				Output: os.Stdout,
+				Level:  hclog.Info,
+			})
+			gcRunner := CacheGCRunner{
+				logger: logger,
+			}
+			return gcRunner.Run(cmd, args)
+		},
+	}
+
+	var configs []string
+	gcCmd.Flags().StringArrayVarP(&configs, "config", "c", configs, "Location of an agent config file whose plugins and policies should be kept")
+	gcCmd.MarkFlagRequired("config")
+
+	gcCmd.Flags().Bool("dry-run", false, "List what would be removed without removing anything")
+
+	return gcCmd
+}
+
+type CacheGCRunner struct {
+	logger hclog.Logger
+}
+
+func (c *CacheGCRunner) Run(cmd *cobra.Command, args []string) error {
+	configPaths, err := cmd.Flags().GetStringArray("config")
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	// If any configuration can't be read, we don't know what it references, so nothing is removed.
+	references := newCacheReferences()
+	for _, configPath := range configPaths {
+		config, err := readAgentConfig(configPath)
+		if err != nil {
+			return err
+		}
+		lock, err := artifact.LoadLock(lockPath(configPath))
+		if err != nil {
+			return err
+		}
+		references.add(config, lock)
+	}
+
+	for _, dir := range []string{AgentPluginDir, AgentPolicyDir} {
+		removed, err := references.collect(c.logger, dir, dryRun)
+		if err != nil {
+			return err
+		}
+		c.logger.Info("Finished collecting garbage", "dir", dir, "removed", removed, "dry_run", dryRun)
+	}
+
+	return nil
+}
+
+// readAgentConfig reads the agent configuration at configPath, without merging any flags.
+func readAgentConfig(configPath string) (*agentConfig, error) {
+	v := viper.New()
+	v.SetConfigFile(configPath)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return decodeConfig(v)
+}
+
+// cacheReferences are the downloaded artifacts referenced by agent configurations, which are kept when
+// collecting garbage.
+type cacheReferences struct {
+	// keys are the cache keys of HTTP(S) checksums and locked OCI digests.
+	keys map[string]struct{}
+	// sources are OCI tags which haven't been locked yet, so their digest isn't known.
+	sources map[string]struct{}
+	// localPaths are local plugin and policy sources, which are never removed.
+	localPaths []string
+}
+
+func newCacheReferences() *cacheReferences {
+	return &cacheReferences{
+		keys:    map[string]struct{}{},
+		sources: map[string]struct{}{},
+	}
+}
+
+func (r *cacheReferences) add(config *agentConfig, lock *artifact.Lock) {
+	addSource := func(source string, checksum string) {
+		switch {
+		case artifact.IsHTTP(source):
+			r.keys[checksum] = struct{}{}
+		case internal.IsOCI(source):
+			if digest, ok := lock.Digest(source); ok {
+				r.keys[artifact.CacheKey(digest, nil)] = struct{}{}
+			} else {
+				r.sources[source] = struct{}{}
+			}
+		default:
+			if abs, err := filepath.Abs(source); err == nil {
+				r.localPaths = append(r.localPaths, abs)
+			}
+		}
+	}
+
+	// A running agent only keeps the sources it uses in its lock file, which includes plugins from assessment
+	// plans that aren't in the configuration.
+	for _, locked := range lock.Artifacts() {
+		r.keys[artifact.CacheKey(locked.Digest, nil)] = struct{}{}
+	}
+
+	for _, pluginConfig := range config.Plugins {
+		addSource(pluginConfig.Source, pluginConfig.Sha256)
+		for _, policy := range pluginConfig.Policies {
+			addSource(policy.Source, policy.Sha256)
+		}
+	}
+}
+
+// keeps returns whether entry is referenced.
+func (r *cacheReferences) keeps(entry artifact.CacheEntry) bool {
+	// Plugins are cached per platform, as <digest>-<os>-<arch>.
+	key, _, _ := strings.Cut(entry.Key, "-")
+	if _, ok := r.keys[key]; ok {
+		return true
+	}
+	if entry.Artifact == nil {
+		return false
+	}
+	_, ok := r.sources[entry.Artifact.Source]
+	return ok
+}
+
+// collect removes everything in dir which isn't referenced, returning how many artifacts were removed.
+// This includes artifacts downloaded to <repo>/<tag> by earlier versions of the agent.
+func (r *cacheReferences) collect(logger hclog.Logger, dir string, dryRun bool) (int, error) {
+	remove := func(target string, args ...interface{}) error {
+		if dryRun {
+			logger.Info("Would remove artifact", append([]interface{}{"path", target}, args...)...)
+			return nil
+		}
+		logger.Info("Removing artifact", append([]interface{}{"path", target}, args...)...)
+		return os.RemoveAll(target)
+	}
+
+	entries, err := artifact.ListCache(path.Join(dir, artifactCacheSubdir))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if r.keeps(entry) {
+			continue
+		}
+		source := ""
+		if entry.Artifact != nil {
+			source = entry.Artifact.Source
+		}
+		if err := remove(entry.Dir, "source", source); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	legacy, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return removed, nil
+	}
+	if err != nil {
+		return removed, err
+	}
+	for _, file := range legacy {
+		// Hidden entries may be downloads in progress.
+		if file.Name() == artifactCacheSubdir || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		target := path.Join(dir, file.Name())
+		if r.containsLocal(target) {
+			continue
+		}
+		if err := remove(target); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// containsLocal returns whether a local source is within target.
+func (r *cacheReferences) containsLocal(target string) bool {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return true
+	}
+	for _, localPath := range r.localPaths {
+		rel, err := filepath.Rel(abs, localPath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
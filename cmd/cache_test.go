@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/compliance-framework/framework/internal/artifact"
+	"github.com/hashicorp/go-hclog"
+)
+
+// cacheEntry writes a cached artifact with key into the cache of dir.
+func cacheEntry(t *testing.T, dir string, key string, cached artifact.Artifact) string {
+	entryDir := path.Join(dir, artifactCacheSubdir, key)
+	if err := os.MkdirAll(path.Join(entryDir, "content"), 0755); err != nil {
+		t.Fatalf("Error creating cache entry: %v", err)
+	}
+	metadata, err := json.Marshal(cached)
+	if err != nil {
+		t.Fatalf("Error encoding cache entry: %v", err)
+	}
+	if err := os.WriteFile(path.Join(entryDir, "artifact.json"), metadata, 0644); err != nil {
+		t.Fatalf("Error writing cache entry: %v", err)
+	}
+	return entryDir
+}
+
+func TestCacheReferences_Collect(t *testing.T) {
+	dir := chdirTemp(t)
+
+	httpSum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	unusedSum := "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"
+	lockedDigest := "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	staleDigest := "sha256:fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"
+
+	localPlugin := path.Join(AgentPluginDir, "local", "plugin")
+	if err := os.MkdirAll(path.Dir(localPlugin), 0755); err != nil {
+		t.Fatalf("Error creating local plugin: %v", err)
+	}
+	if err := os.WriteFile(localPlugin, []byte{}, 0755); err != nil {
+		t.Fatalf("Error creating local plugin: %v", err)
+	}
+
+	lock, err := artifact.LoadLock(path.Join(dir, artifact.LockFileName))
+	if err != nil {
+		t.Fatalf("Error loading lock file: %v", err)
+	}
+	if err := lock.Set("ghcr.io/compliance-framework/plugin-local-ssh:v1", lockedDigest); err != nil {
+		t.Fatalf("Error locking plugin: %v", err)
+	}
+
+	config := &agentConfig{
+		Plugins: map[string]*agentPlugin{
+			"http": {
+				Source: "https://artifacts.example.com/plugin",
+				Sha256: httpSum,
+			},
+			"oci": {
+				Source: "ghcr.io/compliance-framework/plugin-local-ssh:v1",
+				Policies: []agentPolicy{
+					{Source: "ghcr.io/compliance-framework/policies-ssh:v1"},
+				},
+			},
+			"local": {
+				Source: localPlugin,
+			},
+		},
+	}
+
+	keptHTTP := cacheEntry(t, AgentPluginDir, httpSum, artifact.Artifact{Source: "https://artifacts.example.com/plugin", Checksum: httpSum})
+	keptLocked := cacheEntry(t, AgentPluginDir, artifact.CacheKey(lockedDigest, hostPlatform()), artifact.Artifact{Source: "ghcr.io/compliance-framework/plugin-local-ssh:v1", Digest: lockedDigest, Extracted: true})
+	keptUnlocked := cacheEntry(t, AgentPolicyDir, artifact.CacheKey(staleDigest, nil), artifact.Artifact{Source: "ghcr.io/compliance-framework/policies-ssh:v1", Digest: staleDigest, Extracted: true})
+	removedHTTP := cacheEntry(t, AgentPluginDir, unusedSum, artifact.Artifact{Source: "https://artifacts.example.com/old-plugin", Checksum: unusedSum})
+	removedStale := cacheEntry(t, AgentPluginDir, artifact.CacheKey(staleDigest, hostPlatform()), artifact.Artifact{Source: "ghcr.io/compliance-framework/plugin-local-ssh:v1", Digest: staleDigest, Extracted: true})
+
+	legacy := path.Join(AgentPluginDir, "compliance-framework", "plugin-local-ssh", "v1")
+	if err := os.MkdirAll(legacy, 0755); err != nil {
+		t.Fatalf("Error creating legacy download: %v", err)
+	}
+
+	references := newCacheReferences()
+	references.add(config, lock)
+
+	t.Run("Dry run doesn't remove anything", func(t *testing.T) {
+		removed, err := references.collect(hclog.NewNullLogger(), AgentPluginDir, true)
+		if err != nil {
+			t.Fatalf("Unexpected error collecting garbage: %v", err)
+		}
+		if removed != 3 {
+			t.Errorf("Expected 3 artifacts to be removed, got %d", removed)
+		}
+		for _, p := range []string{removedHTTP, removedStale, legacy} {
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("Expected %s to be kept in a dry run", p)
+			}
+		}
+	})
+
+	t.Run("Removes unreferenced artifacts", func(t *testing.T) {
+		for _, dir := range []string{AgentPluginDir, AgentPolicyDir} {
+			if _, err := references.collect(hclog.NewNullLogger(), dir, false); err != nil {
+				t.Fatalf("Unexpected error collecting garbage: %v", err)
+			}
+		}
+
+		for _, p := range []string{keptHTTP, keptLocked, keptUnlocked, localPlugin} {
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("Expected %s to be kept", p)
+			}
+		}
+		for _, p := range []string{removedHTTP, removedStale, path.Join(AgentPluginDir, "compliance-framework")} {
+			if _, err := os.Stat(p); !os.IsNotExist(err) {
+				t.Errorf("Expected %s to be removed", p)
+			}
+		}
+	})
+}
@@ -17,6 +17,9 @@ func New() *cobra.Command {
 		AgentCmd(),
 		DownloadPluginCmd(),
 		DownloadPolicyCmd(),
+		PluginCmd(),
+		SignCmd(),
+		CacheCmd(),
 	)
 	return cmd
 }
@@ -1,12 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path"
 
 	"github.com/compliance-framework/framework/internal"
-	"github.com/compliance-framework/gooci/pkg/oci"
-	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/compliance-framework/framework/internal/artifact"
 	"github.com/hashicorp/go-hclog"
 	"github.com/spf13/cobra"
 )
@@ -16,8 +17,9 @@ func DownloadPluginCmd() *cobra.Command {
 		Use:   "download-plugin",
 		Short: "downloads plugins from OCI or URLs",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// Logs go to stderr, so the download locations printed on stdout can be used by scripts.
 			logger := hclog.New(&hclog.LoggerOptions{
-				Output: os.Stdout,
+				Output: os.Stderr,
 				Level:  hclog.Debug,
 			})
 			downloadCmd := DownloadRunner{
@@ -31,6 +33,9 @@ func DownloadPluginCmd() *cobra.Command {
 	agentCmd.Flags().StringArrayVarP(&source, "source", "s", source, "OCI or URL sources of the plugins")
 	agentCmd.MarkFlagsOneRequired("source")
 
+	var checksums []string
+	agentCmd.Flags().StringArrayVar(&checksums, "sha256", checksums, "SHA256 checksums of HTTP(S) sources, in the same order as the HTTP(S) sources")
+
 	return agentCmd
 }
 
@@ -44,6 +49,15 @@ func (d *DownloadRunner) Run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	checksums, err := cmd.Flags().GetStringArray("sha256")
+	if err != nil {
+		return err
+	}
+	httpChecksums, err := matchChecksums(sources, checksums)
+	if err != nil {
+		return err
+	}
+
 	basePath, loopErr := os.Getwd()
 	if loopErr != nil {
 		return loopErr
@@ -58,26 +72,65 @@ func (d *DownloadRunner) Run(cmd *cobra.Command, args []string) error {
 		d.logger.Debug("Received source", "source", source)
 
 		if internal.IsOCI(source) {
-			tag, err := name.NewTag(source)
+			ctx, cancel := context.WithTimeout(context.Background(), artifactDownloadTimeout)
+			digest, err := artifact.ResolveOCI(ctx, source)
 			if err != nil {
+				cancel()
 				return err
 			}
-			destination := path.Join(pluginPath, tag.RepositoryStr(), tag.Identifier())
-			downloaderImpl, err := oci.NewDownloader(
-				tag,
-				destination,
-			)
+			downloaded, err := artifact.NewOCIDownloader(path.Join(pluginPath, artifactCacheSubdir)).Download(ctx, source, digest, hostPlatform())
+			cancel()
 			if err != nil {
 				return err
 			}
-			err = downloaderImpl.Download()
+
+			location := path.Join(downloaded.Path, "plugin")
+			d.logger.Info("Downloaded plugin", "source", source, "path", location, "digest", digest, "cached", downloaded.Cached)
+			fmt.Fprintln(cmd.OutOrStdout(), location)
+		} else if artifact.IsHTTP(source) {
+			ctx, cancel := context.WithTimeout(context.Background(), artifactDownloadTimeout)
+			downloaded, err := artifact.NewHTTPDownloader(path.Join(pluginPath, artifactCacheSubdir)).Download(ctx, source, httpChecksums[source])
+			cancel()
 			if err != nil {
 				return err
 			}
 
-			d.logger.Debug("Downloaded plugin", "path", destination)
+			location := downloaded.Path
+			if downloaded.Extracted {
+				// Archives contain the plugin binary, the same as OCI artifacts.
+				location = path.Join(downloaded.Path, "plugin")
+			}
+			d.logger.Info("Downloaded plugin", "source", source, "path", location, "cached", downloaded.Cached)
+			fmt.Fprintln(cmd.OutOrStdout(), location)
 		}
 	}
 
 	return nil
 }
+
+// matchChecksums pairs each HTTP(S) source with its checksum. Checksums are given in the same order as the
+// HTTP(S) sources, skipping any other sources, and one is required for each.
+func matchChecksums(sources []string, checksums []string) (map[string]string, error) {
+	matched := map[string]string{}
+	httpSources := 0
+	for _, source := range sources {
+		if !artifact.IsHTTP(source) {
+			continue
+		}
+		if httpSources == len(checksums) {
+			return nil, fmt.Errorf("no sha256 checksum given for %s", source)
+		}
+		checksum := checksums[httpSources]
+		httpSources++
+		if err := artifact.ValidateChecksum(checksum); err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		matched[source] = checksum
+	}
+
+	if len(checksums) > httpSources {
+		return nil, fmt.Errorf("received %d sha256 checksums for %d HTTP(S) sources", len(checksums), httpSources)
+	}
+
+	return matched, nil
+}
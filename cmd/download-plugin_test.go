@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDownloadPluginCmd(t *testing.T) {
+	chdirTemp(t)
+
+	content := []byte("plugin")
+	sum := sha256.Sum256(content)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	stdout := bytes.Buffer{}
+	cmd := DownloadPluginCmd()
+	cmd.SetOut(&stdout)
+	cmd.SetArgs([]string{"--source", server.URL + "/plugin", "--sha256", hex.EncodeToString(sum[:])})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Only the location is printed, so scripts can use it.
+	location := strings.TrimSpace(stdout.String())
+	downloaded, err := os.ReadFile(location)
+	if err != nil {
+		t.Fatalf("Expected the plugin's location on stdout, got %q: %v", stdout.String(), err)
+	}
+	if string(downloaded) != string(content) {
+		t.Errorf("Expected the downloaded plugin at %s, got %q", location, downloaded)
+	}
+}
@@ -1,12 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path"
 
 	"github.com/compliance-framework/framework/internal"
-	"github.com/compliance-framework/gooci/pkg/oci"
-	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/compliance-framework/framework/internal/artifact"
 	"github.com/hashicorp/go-hclog"
 	"github.com/spf13/cobra"
 )
@@ -16,8 +17,9 @@ func DownloadPolicyCmd() *cobra.Command {
 		Use:   "download-policy",
 		Short: "downloads policies from OCI or URLs",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// Logs go to stderr, so the download locations printed on stdout can be used by scripts.
 			logger := hclog.New(&hclog.LoggerOptions{
-				Output: os.Stdout,
+				Output: os.Stderr,
 				Level:  hclog.Debug,
 			})
 			downloadCmd := PolicyDownloadRunner{
@@ -31,6 +33,9 @@ func DownloadPolicyCmd() *cobra.Command {
 	policyCmd.Flags().StringArrayVarP(&source, "source", "s", source, "OCI or URL sources of the policies")
 	policyCmd.MarkFlagsOneRequired("source")
 
+	var checksums []string
+	policyCmd.Flags().StringArrayVar(&checksums, "sha256", checksums, "SHA256 checksums of HTTP(S) sources, in the same order as the HTTP(S) sources")
+
 	return policyCmd
 }
 
@@ -44,6 +49,15 @@ func (d *PolicyDownloadRunner) Run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	checksums, err := cmd.Flags().GetStringArray("sha256")
+	if err != nil {
+		return err
+	}
+	httpChecksums, err := matchChecksums(sources, checksums)
+	if err != nil {
+		return err
+	}
+
 	basePath, loopErr := os.Getwd()
 	if loopErr != nil {
 		return loopErr
@@ -55,24 +69,31 @@ func (d *PolicyDownloadRunner) Run(cmd *cobra.Command, args []string) error {
 		d.logger.Debug("Received source", "source", source)
 
 		if internal.IsOCI(source) {
-			tag, err := name.NewTag(source)
+			ctx, cancel := context.WithTimeout(context.Background(), artifactDownloadTimeout)
+			digest, err := artifact.ResolveOCI(ctx, source)
 			if err != nil {
+				cancel()
 				return err
 			}
-			destination := path.Join(policyPath, tag.RepositoryStr(), tag.Identifier())
-			downloaderImpl, err := oci.NewDownloader(
-				tag,
-				destination,
-			)
+			downloaded, err := artifact.NewOCIDownloader(path.Join(policyPath, artifactCacheSubdir)).Download(ctx, source, digest, nil)
+			cancel()
 			if err != nil {
 				return err
 			}
-			err = downloaderImpl.Download()
+
+			location := path.Join(downloaded.Path, "policies")
+			d.logger.Info("Downloaded policy", "source", source, "path", location, "digest", digest, "cached", downloaded.Cached)
+			fmt.Fprintln(cmd.OutOrStdout(), location)
+		} else if artifact.IsHTTP(source) {
+			ctx, cancel := context.WithTimeout(context.Background(), artifactDownloadTimeout)
+			downloaded, err := artifact.NewHTTPDownloader(path.Join(policyPath, artifactCacheSubdir)).Download(ctx, source, httpChecksums[source])
+			cancel()
 			if err != nil {
 				return err
 			}
 
-			d.logger.Debug("Downloaded policy", "path", destination)
+			d.logger.Info("Downloaded policy", "source", source, "path", downloaded.Path, "cached", downloaded.Cached)
+			fmt.Fprintln(cmd.OutOrStdout(), downloaded.Path)
 		}
 	}
 
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/compliance-framework/framework/internal/artifact"
+	runner2 "github.com/compliance-framework/framework/runner"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+)
+
+// Output formats supported by `cf plugin info`.
+const (
+	PluginInfoOutputText = "text"
+	PluginInfoOutputJSON = "json"
+)
+
+// pluginInfoTimeout limits how long `cf plugin info` waits for a plugin to start and describe itself.
+const pluginInfoTimeout = time.Minute
+
+func PluginCmd() *cobra.Command {
+	var pluginCmd = &cobra.Command{
+		Use:   "plugin",
+		Short: "inspects plugins",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Usage()
+		},
+	}
+
+	pluginCmd.AddCommand(PluginInfoCmd())
+
+	return pluginCmd
+}
+
+func PluginInfoCmd() *cobra.Command {
+	var infoCmd = &cobra.Command{
+		Use:   "info [flags] <source>",
+		Short: "prints the name, version, config schema and capabilities of a plugin",
+		Long: `Starts a plugin from a local path, OCI or HTTP(S) source, and prints how it describes itself: its name and
+version, the namespace its policies must be in, the JSON Schema its config is validated against by the agent,
+and the optional capabilities it supports. The plugin is not configured or run.`,
+		Args: cobra.ExactArgs(1),
+		RunE: pluginInfo,
+	}
+
+	infoCmd.Flags().String("sha256", "", "SHA256 checksum of an HTTP(S) source")
+	infoCmd.Flags().StringArray("trusted-key", nil, "Public keys the plugin must be signed by")
+	infoCmd.Flags().StringP("output", "o", PluginInfoOutputText, "Output format, one of text or json")
+
+	return infoCmd
+}
+
+func pluginInfo(cmd *cobra.Command, args []string) error {
+	source := args[0]
+	checksum, err := cmd.Flags().GetString("sha256")
+	if err != nil {
+		return err
+	}
+	trustedKeys, err := cmd.Flags().GetStringArray("trusted-key")
+	if err != nil {
+		return err
+	}
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if format != PluginInfoOutputText && format != PluginInfoOutputJSON {
+		return fmt.Errorf("unsupported output format %q, expected text or json", format)
+	}
+	if artifact.IsHTTP(source) {
+		if err := artifact.ValidateChecksum(checksum); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+	}
+
+	config := agentConfig{TrustedKeys: trustedKeys}
+	verifier, err := config.verifier()
+	if err != nil {
+		return err
+	}
+
+	// Logs go to stderr, so the info on stdout can be piped elsewhere.
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   "plugin",
+		Output: os.Stderr,
+		Level:  hclog.Info,
+	})
+	ar := &AgentRunner{logger: logger}
+
+	// The plugin is only described, so tags aren't pinned.
+	location, _, _, err := ar.downloadItem("plugins", source, checksum, true, verifier, map[string]string{})
+	if err != nil {
+		return err
+	}
+
+	client, runnerInstance, err := ar.getRunnerInstance(logger, location, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer client.Kill()
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), pluginInfoTimeout)
+	defer cancel()
+	info, err := runner2.Info(ctx, runnerInstance)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return fmt.Errorf("plugin %s does not describe itself, as it was built before plugins had an Info call, or speaks protocol version %d", source, runner2.ProtocolVersion1)
+	}
+	if info.ConfigSchema != "" {
+		if _, err := compileConfigSchema(info.ConfigSchema); err != nil {
+			return err
+		}
+	}
+
+	return writePluginInfo(cmd.OutOrStdout(), format, info)
+}
+
+// pluginInfoOutput is the JSON output of `cf plugin info`. The schema is included as JSON, rather than as the
+// string the plugin sends it as.
+type pluginInfoOutput struct {
+	Name            string          `json:"name"`
+	Version         string          `json:"version"`
+	PolicyNamespace string          `json:"policy_namespace"`
+	Capabilities    []string        `json:"capabilities"`
+	ConfigSchema    json.RawMessage `json:"config_schema,omitempty"`
+}
+
+func writePluginInfo(out io.Writer, format string, info *proto2.InfoResponse) error {
+	capabilities := info.Capabilities
+	if capabilities == nil {
+		capabilities = []string{}
+	}
+
+	if format == PluginInfoOutputJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(pluginInfoOutput{
+			Name:            info.Name,
+			Version:         info.Version,
+			PolicyNamespace: info.PolicyNamespace,
+			Capabilities:    capabilities,
+			ConfigSchema:    json.RawMessage(info.ConfigSchema),
+		})
+	}
+
+	fmt.Fprintf(out, "Name:             %s\n", info.Name)
+	fmt.Fprintf(out, "Version:          %s\n", info.Version)
+	fmt.Fprintf(out, "Policy namespace: %s\n", info.PolicyNamespace)
+	fmt.Fprintf(out, "Capabilities:     %s\n", strings.Join(capabilities, ", "))
+	if info.ConfigSchema == "" {
+		fmt.Fprintln(out, "Config schema:    none")
+		return nil
+	}
+	schema := bytes.Buffer{}
+	if err := json.Indent(&schema, []byte(info.ConfigSchema), "", "  "); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Config schema:\n%s\n", schema.String())
+	return nil
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/compliance-framework/framework/internal/signature"
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+)
+
+func SignCmd() *cobra.Command {
+	var signCmd = &cobra.Command{
+		Use:   "sign [flags] <artifact>...",
+		Short: "produces detached signatures for plugins and policies",
+		Long: `Signs plugin binaries, policy bundles or directories with a private key, writing a detached signature
+alongside each artifact with a .sig extension. Agents configured with the matching public key in trusted_keys
+will refuse any artifact without a valid signature.
+
+For HTTP(S) sources, the signature should be published at the artifact's URL with .sig appended.
+For OCI sources, the signature should be included in the artifact alongside the plugin or policies.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger := hclog.New(&hclog.LoggerOptions{
+				Output: os.Stdout,
+				Level:  hclog.Info,
+			})
+			signRunner := SignRunner{
+				logger: logger,
+			}
+			return signRunner.Run(cmd, args)
+		},
+	}
+
+	signCmd.Flags().StringP("key", "k", "", "Location of the PEM encoded ed25519 private key to sign with")
+	signCmd.MarkFlagRequired("key")
+
+	signCmd.AddCommand(GenerateKeyCmd())
+
+	return signCmd
+}
+
+type SignRunner struct {
+	logger hclog.Logger
+}
+
+func (s *SignRunner) Run(cmd *cobra.Command, args []string) error {
+	keyPath, err := cmd.Flags().GetString("key")
+	if err != nil {
+		return err
+	}
+
+	key, err := signature.LoadPrivateKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	for _, artifactPath := range args {
+		sig, err := signature.SignPath(key, artifactPath)
+		if err != nil {
+			return fmt.Errorf("signing %s: %w", artifactPath, err)
+		}
+
+		s.logger.Info("Signed artifact", "artifact", artifactPath, "signature", artifactPath+signature.Ext, "digest", sig.Digest, "key_id", sig.KeyID)
+	}
+
+	return nil
+}
+
+func GenerateKeyCmd() *cobra.Command {
+	var generateKeyCmd = &cobra.Command{
+		Use:   "generate-key",
+		Short: "generates a key pair for signing plugins and policies",
+		Long: `Generates an ed25519 key pair, writing the private key to <out>.key and the public key to <out>.pub.
+The private key is used with 'cf sign', and the public key added to the agent's trusted_keys.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, err := cmd.Flags().GetString("out")
+			if err != nil {
+				return err
+			}
+
+			publicKey, privateKey, err := signature.GenerateKey()
+			if err != nil {
+				return err
+			}
+
+			// O_EXCL so an existing key is never overwritten.
+			privateFile, err := os.OpenFile(out+".key", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return err
+			}
+			defer privateFile.Close()
+			if _, err := privateFile.Write(privateKey); err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(out+".pub", publicKey, 0644); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Private key written to %s.key\nPublic key written to %s.pub\n", out, out)
+			return nil
+		},
+	}
+
+	generateKeyCmd.Flags().StringP("out", "o", "cf-signing", "Path prefix for the generated key files")
+
+	return generateKeyCmd
+}
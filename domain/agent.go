@@ -0,0 +1,85 @@
+package domain
+
+import "time"
+
+// AgentStatus is the lifecycle state an agent last reported.
+type AgentStatus string
+
+const (
+	AgentStatusRunning AgentStatus = "running"
+	AgentStatusStopped AgentStatus = "stopped"
+)
+
+// DefaultAgentHeartbeatInterval is assumed for agents which don't report how often they send heartbeats.
+const DefaultAgentHeartbeatInterval = 30 * time.Second
+
+// AgentStaleHeartbeats is how many heartbeats a running agent may miss before it is considered stale.
+const AgentStaleHeartbeats = 3
+
+// Agent is an agent running plugins against policies, as described by the heartbeats it publishes.
+type Agent struct {
+	// Id identifies the agent across restarts.
+	Id      string      `json:"id" yaml:"id" bson:"_id"`
+	Version string      `json:"version" yaml:"version" bson:"version"`
+	Status  AgentStatus `json:"status" yaml:"status" bson:"status"`
+	Host    AgentHost   `json:"host" yaml:"host" bson:"host"`
+	// Labels are the agent's configured labels, which assessment plans select agents by.
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" bson:"labels,omitempty"`
+	Plugins []AgentPlugin     `json:"plugins" yaml:"plugins" bson:"plugins"`
+	LastRun *AgentRun         `json:"lastRun,omitempty" yaml:"lastRun,omitempty" bson:"lastRun,omitempty"`
+
+	StartedAt         time.Time     `json:"startedAt" yaml:"startedAt" bson:"startedAt"`
+	HeartbeatInterval time.Duration `json:"heartbeatInterval" yaml:"heartbeatInterval" bson:"heartbeatInterval"`
+	// RegisteredAt is when the API first heard from the agent, and LastHeartbeat when it last did.
+	RegisteredAt  time.Time `json:"registeredAt" yaml:"registeredAt" bson:"registeredAt"`
+	LastHeartbeat time.Time `json:"lastHeartbeat" yaml:"lastHeartbeat" bson:"lastHeartbeat"`
+
+	// Stale is set when a running agent's heartbeats have stopped. It is calculated when the agent is read,
+	// rather than stored.
+	Stale bool `json:"stale" yaml:"stale" bson:"-"`
+}
+
+// AgentHost describes the machine an agent runs on.
+type AgentHost struct {
+	Hostname string `json:"hostname" yaml:"hostname" bson:"hostname"`
+	OS       string `json:"os" yaml:"os" bson:"os"`
+	Arch     string `json:"arch" yaml:"arch" bson:"arch"`
+	CPUs     int    `json:"cpus" yaml:"cpus" bson:"cpus"`
+}
+
+// AgentPlugin is a plugin configured on an agent, and the policies it is run against.
+type AgentPlugin struct {
+	Name     string        `json:"name" yaml:"name" bson:"name"`
+	Source   string        `json:"source" yaml:"source" bson:"source"`
+	Version  string        `json:"version,omitempty" yaml:"version,omitempty" bson:"version,omitempty"`
+	Schedule string        `json:"schedule,omitempty" yaml:"schedule,omitempty" bson:"schedule,omitempty"`
+	Policies []AgentPolicy `json:"policies" yaml:"policies" bson:"policies"`
+}
+
+// AgentPolicy is a policy a plugin is run against.
+type AgentPolicy struct {
+	Source  string `json:"source" yaml:"source" bson:"source"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty" bson:"version,omitempty"`
+}
+
+// AgentRun describes the most recent run of a plugin against a policy on an agent.
+type AgentRun struct {
+	Plugin  string    `json:"plugin" yaml:"plugin" bson:"plugin"`
+	Policy  string    `json:"policy" yaml:"policy" bson:"policy"`
+	Success bool      `json:"success" yaml:"success" bson:"success"`
+	Error   string    `json:"error,omitempty" yaml:"error,omitempty" bson:"error,omitempty"`
+	Time    time.Time `json:"time" yaml:"time" bson:"time"`
+}
+
+// IsStale returns whether a running agent has missed too many heartbeats. Stopped agents are never stale,
+// as they said goodbye.
+func (a *Agent) IsStale(now time.Time) bool {
+	if a.Status == AgentStatusStopped {
+		return false
+	}
+	interval := a.HeartbeatInterval
+	if interval <= 0 {
+		interval = DefaultAgentHeartbeatInterval
+	}
+	return now.Sub(a.LastHeartbeat) > AgentStaleHeartbeats*interval
+}
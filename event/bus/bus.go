@@ -1,8 +1,10 @@
 package bus
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/compliance-framework/framework/event"
+	"github.com/compliance-framework/framework/internal/telemetry"
 	"github.com/nats-io/nats.go"
 	"go.uber.org/zap"
 	"sync"
@@ -58,6 +60,30 @@ func Subscribe[T any](topic event.TopicType) (chan T, error) {
 	return ch, nil
 }
 
+// SubscribeContext is Subscribe, with each message received along with the trace context it was published with.
+func SubscribeContext[T any](topic event.TopicType) (chan event.Message[T], error) {
+	ch := make(chan event.Message[T])
+	_, err := conn.Subscribe(string(topic), func(m *nats.Msg) {
+		var msg T
+		err := json.Unmarshal(m.Data, &msg)
+		if err != nil {
+			sugar.Errorf("Error unmarshalling data: %v", err)
+			return
+		}
+		ch <- event.Message[T]{
+			Context: telemetry.Extract(context.Background(), telemetry.HeaderCarrier(m.Header)),
+			Data:    msg,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	subCh = append(subCh, chanHolder{Ch: ch})
+	mu.Unlock()
+	return ch, nil
+}
+
 func Publish(msg interface{}, topic event.TopicType) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
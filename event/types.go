@@ -1,15 +1,30 @@
 package event
 
-import "github.com/compliance-framework/framework/domain"
+import (
+	"context"
+
+	"github.com/compliance-framework/framework/domain"
+)
 
 type TopicType string
 
 const (
 	TopicTypePlan   TopicType = "runtime.configuration"
 	TopicTypeResult TopicType = "job.result"
+	TopicTypeAgent  TopicType = "agent.heartbeat"
 )
 
 type Subscriber[T any] func(topic TopicType) (chan T, error)
+
+// ContextSubscriber is a Subscriber which receives each message with the context it was published with, such as
+// the trace context of the agent which published it.
+type ContextSubscriber[T any] func(topic TopicType) (chan Message[T], error)
+
+// Message is a message received by a ContextSubscriber.
+type Message[T any] struct {
+	Context context.Context
+	Data    T
+}
 type Publisher func(msg interface{}, topic TopicType) error
 
 type PlanEvent struct {
@@ -19,3 +34,17 @@ type PlanEvent struct {
 }
 
 type ResultEvent struct{}
+
+// Types of AgentEvent.
+const (
+	AgentEventRegistered = "registered"
+	AgentEventHeartbeat  = "heartbeat"
+	AgentEventStopped    = "stopped"
+)
+
+// AgentEvent is published by agents when they start, periodically while they run, and when they stop.
+type AgentEvent struct {
+	// Type holds the type of the event: registered / heartbeat / stopped
+	Type         string `yaml:"type" json:"type"`
+	domain.Agent `yaml:"data" json:"data"`
+}
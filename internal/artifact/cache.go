@@ -0,0 +1,123 @@
+package artifact
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Each cache entry is a directory containing the artifact's metadata, and its content.
+const (
+	metadataFileName = "artifact.json"
+	contentDirName   = "content"
+)
+
+// CacheEntry is an artifact stored in a cache directory.
+type CacheEntry struct {
+	// Key is the name of the entry within the cache, derived from the artifact's checksum or digest.
+	Key string
+	// Dir is the entry's directory.
+	Dir string
+	// Artifact is the cached artifact, or nil if its metadata could not be read.
+	Artifact *Artifact
+}
+
+// ListCache returns the entries in cacheDir. Incomplete downloads are not included.
+func ListCache(cacheDir string) ([]CacheEntry, error) {
+	files, err := os.ReadDir(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []CacheEntry{}
+	for _, file := range files {
+		if !file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		dir := filepath.Join(cacheDir, file.Name())
+		artifact, _ := loadCacheEntry(dir)
+		entries = append(entries, CacheEntry{
+			Key:      file.Name(),
+			Dir:      dir,
+			Artifact: artifact,
+		})
+	}
+	return entries, nil
+}
+
+// newCacheEntry creates a temporary directory in cacheDir for an artifact to be written to.
+//
+// Everything is written to the temporary directory first, and moved into place once complete, so an
+// interrupted download is never mistaken for a cached artifact.
+func newCacheEntry(cacheDir string) (tmpDir string, contentDir string, err error) {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", "", err
+	}
+
+	tmpDir, err = os.MkdirTemp(cacheDir, ".download-")
+	if err != nil {
+		return "", "", err
+	}
+
+	contentDir = filepath.Join(tmpDir, contentDirName)
+	if err := os.Mkdir(contentDir, 0755); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", "", err
+	}
+
+	return tmpDir, contentDir, nil
+}
+
+// commitCacheEntry writes the artifact's metadata, and moves the temporary directory into place at dir.
+func commitCacheEntry(tmpDir string, dir string, artifact *Artifact) (*Artifact, error) {
+	metadata, err := json.Marshal(artifact)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, metadataFileName), metadata, 0644); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmpDir, dir); err != nil {
+		// Another download of the same artifact may have finished first, in which case we use that one.
+		if cached, cachedErr := loadCacheEntry(dir); cachedErr == nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	artifact.Path = contentPath(dir, artifact)
+	return artifact, nil
+}
+
+// loadCacheEntry returns the artifact stored in dir, if it exists.
+func loadCacheEntry(dir string) (*Artifact, error) {
+	metadata, err := os.ReadFile(filepath.Join(dir, metadataFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	artifact := &Artifact{}
+	if err := json.Unmarshal(metadata, artifact); err != nil {
+		return nil, fmt.Errorf("reading cached artifact %s: %w", dir, err)
+	}
+	artifact.Path = contentPath(dir, artifact)
+	artifact.Cached = true
+	return artifact, nil
+}
+
+// contentPath returns the path of an artifact's contents within its cache directory.
+func contentPath(dir string, artifact *Artifact) string {
+	contentDir := filepath.Join(dir, contentDirName)
+	if artifact.Extracted {
+		return contentDir
+	}
+	return filepath.Join(contentDir, fileName(artifact.Source))
+}
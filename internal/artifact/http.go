@@ -0,0 +1,293 @@
+package artifact
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/compliance-framework/framework/internal"
+	"github.com/compliance-framework/framework/internal/signature"
+)
+
+// maxSignatureSize is the largest signature file which will be downloaded.
+const maxSignatureSize = 64 * 1024
+
+var checksumPattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// IsHTTP returns whether source is an HTTP or HTTPS URL.
+func IsHTTP(source string) bool {
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// ValidateChecksum checks checksum is a hex encoded SHA256 digest.
+func ValidateChecksum(checksum string) error {
+	if checksum == "" {
+		return errors.New("a sha256 checksum is required")
+	}
+	if !checksumPattern.MatchString(checksum) {
+		return fmt.Errorf("invalid sha256 checksum %q, expected 64 lowercase hex characters", checksum)
+	}
+	return nil
+}
+
+// Artifact is an artifact retrieved into the cache.
+type Artifact struct {
+	// Source is the URL or OCI tag the artifact was downloaded from.
+	Source string `json:"source"`
+	// Checksum is the SHA256 digest of an artifact downloaded over HTTP(S).
+	Checksum string `json:"sha256,omitempty"`
+	// Digest is the digest of an OCI artifact's manifest, such as `sha256:<hex>`.
+	Digest string `json:"digest,omitempty"`
+	// Extracted is whether the artifact was a gzipped tarball, which has been extracted into Path.
+	Extracted bool `json:"extracted"`
+	// Path is the downloaded file, or the directory the artifact was extracted into.
+	Path string `json:"-"`
+	// Cached is whether the artifact was already in the cache, so nothing was downloaded.
+	Cached bool `json:"-"`
+	// SignedBy is the ID of the key which signed the artifact, if signatures are verified.
+	SignedBy string `json:"-"`
+}
+
+// HTTPDownloader downloads artifacts over HTTP(S) into a cache keyed by their checksum.
+//
+// Each artifact is stored in <cache dir>/<sha256>. As artifacts are verified against their checksum,
+// once an artifact is in the cache it is never downloaded again.
+type HTTPDownloader struct {
+	client   *http.Client
+	cacheDir string
+	verifier *signature.Verifier
+}
+
+func NewHTTPDownloader(cacheDir string) *HTTPDownloader {
+	return &HTTPDownloader{
+		client:   http.DefaultClient,
+		cacheDir: cacheDir,
+	}
+}
+
+// WithVerifier requires artifacts to be signed by one of the verifier's trusted keys. The detached signature
+// is downloaded from the artifact's URL with a `.sig` extension, and kept in the cache alongside the artifact.
+func (d *HTTPDownloader) WithVerifier(verifier *signature.Verifier) *HTTPDownloader {
+	d.verifier = verifier
+	return d
+}
+
+// Download retrieves the artifact at source, and verifies it matches checksum. If the artifact is a gzipped
+// tarball it is extracted.
+func (d *HTTPDownloader) Download(ctx context.Context, source string, checksum string) (*Artifact, error) {
+	artifact, err := d.download(ctx, source, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.verifier != nil {
+		// Signatures are verified for cached artifacts too, as the trusted keys may have changed.
+		artifact.SignedBy, err = d.verify(ctx, filepath.Join(d.cacheDir, checksum), source, checksum)
+		if err != nil {
+			return nil, fmt.Errorf("verifying signature of %s: %w", source, err)
+		}
+	}
+
+	return artifact, nil
+}
+
+func (d *HTTPDownloader) download(ctx context.Context, source string, checksum string) (*Artifact, error) {
+	if err := ValidateChecksum(checksum); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(d.cacheDir, checksum)
+	if cached, err := loadCacheEntry(dir); err == nil {
+		return cached, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	tmpDir, contentDir, err := newCacheEntry(d.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	downloaded := filepath.Join(tmpDir, "download")
+	if err := d.fetch(ctx, source, checksum, downloaded); err != nil {
+		return nil, err
+	}
+
+	artifact := &Artifact{
+		Source:   source,
+		Checksum: checksum,
+	}
+
+	artifact.Extracted, err = isGzip(downloaded)
+	if err != nil {
+		return nil, err
+	}
+	if artifact.Extracted {
+		if err := extract(downloaded, contentDir); err != nil {
+			return nil, fmt.Errorf("extracting %s: %w", source, err)
+		}
+	} else {
+		// Plugins are downloaded as a single binary, so they need to be executable.
+		if err := os.Chmod(downloaded, 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(downloaded, filepath.Join(contentDir, fileName(source))); err != nil {
+			return nil, err
+		}
+	}
+
+	return commitCacheEntry(tmpDir, dir, artifact)
+}
+
+// verify checks the signature of the artifact cached in dir, downloading it if it hasn't been already.
+func (d *HTTPDownloader) verify(ctx context.Context, dir string, source string, checksum string) (string, error) {
+	sigPath := filepath.Join(dir, "artifact"+signature.Ext)
+
+	content, err := os.ReadFile(sigPath)
+	if errors.Is(err, os.ErrNotExist) {
+		content, err = d.fetchSignature(ctx, source)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := signature.Parse(content)
+	if err != nil {
+		return "", err
+	}
+	keyID, err := d.verifier.Verify("sha256:"+checksum, sig)
+	if err != nil {
+		return "", err
+	}
+
+	// Only keep signatures which have been verified, so a bad signature can be fixed on the server.
+	if err := os.WriteFile(sigPath, content, 0644); err != nil {
+		return "", err
+	}
+	return keyID, nil
+}
+
+// fetchSignature downloads the detached signature of the artifact at source.
+func (d *HTTPDownloader) fetchSignature(ctx context.Context, source string) ([]byte, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	u.Path += signature.Ext
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s is not signed, no signature found at %s", source, u)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("downloading signature %s: unexpected status %s", u, res.Status)
+	}
+
+	// Signatures are small, so anything larger isn't one.
+	return io.ReadAll(io.LimitReader(res.Body, maxSignatureSize))
+}
+
+// fetch downloads source to destination, returning an error if it doesn't match checksum.
+func (d *HTTPDownloader) fetch(ctx context.Context, source string, checksum string, destination string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("downloading %s: unexpected status %s", source, res.Status)
+	}
+
+	f, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), res.Body); err != nil {
+		return fmt.Errorf("downloading %s: %w", source, err)
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != checksum {
+		return fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", source, checksum, actual)
+	}
+
+	return f.Close()
+}
+
+func isGzip(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	magic, err := bufio.NewReader(f).Peek(2)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+func extract(file string, destination string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	return internal.Untar(destination, gz)
+}
+
+// fileName returns the name a non-archive artifact is stored under, based on its URL.
+func fileName(source string) string {
+	u, err := url.Parse(source)
+	if err == nil {
+		if name := path.Base(u.Path); name != "." && name != "/" {
+			return name
+		}
+	}
+	return "artifact"
+}
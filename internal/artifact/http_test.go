@@ -0,0 +1,185 @@
+package artifact
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/compliance-framework/framework/internal/signature"
+	"github.com/stretchr/testify/assert"
+)
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func gzippedTarball(t *testing.T, name string, content string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0755,
+		Size:     int64(len(content)),
+		Typeflag: tar.TypeReg,
+	}))
+	_, err := tw.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// serve returns a server which responds with content on every path, and a count of requests made.
+func serve(t *testing.T, content []byte) (*httptest.Server, *atomic.Int32) {
+	requests := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestIsHTTP(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{source: "https://artifacts.example.com/policies.tar.gz", expected: true},
+		{source: "http://localhost:8080/plugin", expected: true},
+		{source: "ghcr.io/compliance-framework/plugin-local-ssh:v1", expected: false},
+		{source: "../plugin-local-ssh/cf-plugin-local-ssh", expected: false},
+		{source: "file:///tmp/plugin", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsHTTP(tt.source))
+		})
+	}
+}
+
+func TestHTTPDownloader_Download(t *testing.T) {
+	t.Run("Downloads and caches a file", func(t *testing.T) {
+		content := []byte("#!/bin/sh\necho plugin")
+		server, requests := serve(t, content)
+		d := NewHTTPDownloader(t.TempDir())
+
+		artifact, err := d.Download(context.Background(), server.URL+"/cf-plugin-ssh", checksum(content))
+		assert.NoError(t, err)
+		assert.False(t, artifact.Extracted)
+		assert.False(t, artifact.Cached)
+		assert.Equal(t, "cf-plugin-ssh", filepath.Base(artifact.Path))
+
+		downloaded, err := os.ReadFile(artifact.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, content, downloaded)
+
+		info, err := os.Stat(artifact.Path)
+		assert.NoError(t, err)
+		assert.NotZero(t, info.Mode()&0100, "expected downloaded file to be executable")
+
+		cached, err := d.Download(context.Background(), server.URL+"/cf-plugin-ssh", checksum(content))
+		assert.NoError(t, err)
+		assert.True(t, cached.Cached)
+		assert.Equal(t, artifact.Path, cached.Path)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("Extracts gzipped tarballs", func(t *testing.T) {
+		content := gzippedTarball(t, "policies/ssh.rego", "package compliance_framework.ssh")
+		server, _ := serve(t, content)
+		d := NewHTTPDownloader(t.TempDir())
+
+		artifact, err := d.Download(context.Background(), server.URL+"/policies.tar.gz", checksum(content))
+		assert.NoError(t, err)
+		assert.True(t, artifact.Extracted)
+
+		policy, err := os.ReadFile(filepath.Join(artifact.Path, "policies", "ssh.rego"))
+		assert.NoError(t, err)
+		assert.Equal(t, "package compliance_framework.ssh", string(policy))
+	})
+
+	t.Run("Rejects artifacts which don't match their checksum", func(t *testing.T) {
+		server, _ := serve(t, []byte("tampered"))
+		cacheDir := t.TempDir()
+		d := NewHTTPDownloader(cacheDir)
+
+		_, err := d.Download(context.Background(), server.URL+"/plugin", checksum([]byte("original")))
+		assert.ErrorContains(t, err, "checksum mismatch")
+
+		entries, err := os.ReadDir(cacheDir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Requires a valid checksum", func(t *testing.T) {
+		d := NewHTTPDownloader(t.TempDir())
+
+		_, err := d.Download(context.Background(), "https://artifacts.example.com/plugin", "")
+		assert.Error(t, err)
+		_, err = d.Download(context.Background(), "https://artifacts.example.com/plugin", "not-a-checksum")
+		assert.Error(t, err)
+	})
+
+	t.Run("Returns an error for unsuccessful responses", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+		d := NewHTTPDownloader(t.TempDir())
+
+		_, err := d.Download(context.Background(), server.URL+"/plugin", checksum([]byte("plugin")))
+		assert.ErrorContains(t, err, "404")
+	})
+}
+
+func TestHTTPDownloader_Verify(t *testing.T) {
+	_, trusted, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	verifier := signature.NewVerifier(trusted.Public().(ed25519.PublicKey))
+
+	content := []byte("plugin")
+	sig, err := json.Marshal(signature.Sign(trusted, "sha256:"+checksum(content)))
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/signed/plugin", func(w http.ResponseWriter, r *http.Request) { w.Write(content) })
+	mux.HandleFunc("/signed/plugin.sig", func(w http.ResponseWriter, r *http.Request) { w.Write(sig) })
+	mux.HandleFunc("/unsigned/plugin", func(w http.ResponseWriter, r *http.Request) { w.Write(content) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("Accepts signed artifacts", func(t *testing.T) {
+		d := NewHTTPDownloader(t.TempDir()).WithVerifier(verifier)
+
+		artifact, err := d.Download(context.Background(), server.URL+"/signed/plugin", checksum(content))
+		assert.NoError(t, err)
+		assert.Equal(t, signature.KeyID(trusted.Public().(ed25519.PublicKey)), artifact.SignedBy)
+
+		// The signature is kept with the cached artifact.
+		cached, err := d.Download(context.Background(), server.URL+"/signed/plugin", checksum(content))
+		assert.NoError(t, err)
+		assert.True(t, cached.Cached)
+		assert.Equal(t, artifact.SignedBy, cached.SignedBy)
+	})
+
+	t.Run("Refuses unsigned artifacts", func(t *testing.T) {
+		d := NewHTTPDownloader(t.TempDir()).WithVerifier(verifier)
+
+		_, err := d.Download(context.Background(), server.URL+"/unsigned/plugin", checksum(content))
+		assert.ErrorContains(t, err, "not signed")
+	})
+}
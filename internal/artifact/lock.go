@@ -0,0 +1,168 @@
+package artifact
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// LockFileName is the name of the lock file, which is kept alongside the agent's configuration.
+const LockFileName = "cf.lock"
+
+const lockVersion = 1
+
+// LockedArtifact pins an OCI tag to the digest it resolved to.
+type LockedArtifact struct {
+	Source string `json:"source"`
+	Digest string `json:"digest"`
+}
+
+// Lock records the digest every OCI tag resolved to when it was first downloaded, so a tag which is pushed
+// again doesn't change what runs. To move to a new digest, remove the tag from the lock file.
+//
+// A nil *Lock is valid, and doesn't pin anything.
+type Lock struct {
+	path      string
+	mu        sync.Mutex
+	artifacts map[string]string
+}
+
+type lockFile struct {
+	Version   int              `json:"version"`
+	Artifacts []LockedArtifact `json:"artifacts"`
+}
+
+// LoadLock reads the lock file at path. A missing file is treated as an empty lock, which is written
+// once the first tag is resolved.
+func LoadLock(path string) (*Lock, error) {
+	lock := &Lock{
+		path:      path,
+		artifacts: map[string]string{},
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := lockFile{}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("reading lock file %s: %w", path, err)
+	}
+	if file.Version != lockVersion {
+		return nil, fmt.Errorf("unsupported lock file version %d in %s", file.Version, path)
+	}
+	for _, locked := range file.Artifacts {
+		lock.artifacts[locked.Source] = locked.Digest
+	}
+	return lock, nil
+}
+
+// Digest returns the digest source is locked to, if it is locked.
+func (l *Lock) Digest(source string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	digest, ok := l.artifacts[source]
+	return digest, ok
+}
+
+// Artifacts returns every locked artifact, sorted by source.
+func (l *Lock) Artifacts() []LockedArtifact {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.sorted()
+}
+
+// Set locks source to digest, and writes the lock file.
+func (l *Lock) Set(source string, digest string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.artifacts[source] == digest {
+		return nil
+	}
+	l.artifacts[source] = digest
+	return l.save()
+}
+
+// Retain removes every locked artifact whose source isn't in sources, and writes the lock file, so tags
+// which are no longer configured don't stay pinned if they're added back later.
+func (l *Lock) Retain(sources []string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	changed := false
+	for source := range l.artifacts {
+		if !slices.Contains(sources, source) {
+			delete(l.artifacts, source)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return l.save()
+}
+
+func (l *Lock) sorted() []LockedArtifact {
+	artifacts := make([]LockedArtifact, 0, len(l.artifacts))
+	for source, digest := range l.artifacts {
+		artifacts = append(artifacts, LockedArtifact{Source: source, Digest: digest})
+	}
+	slices.SortFunc(artifacts, func(a, b LockedArtifact) int {
+		return strings.Compare(a.Source, b.Source)
+	})
+	return artifacts
+}
+
+// save writes the lock file atomically, so an interrupted write never leaves it half written.
+func (l *Lock) save() error {
+	content, err := json.MarshalIndent(lockFile{
+		Version:   lockVersion,
+		Artifacts: l.sorted(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".tmp-"+filepath.Base(l.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
@@ -0,0 +1,72 @@
+package artifact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	t.Run("Treats a missing lock file as empty", func(t *testing.T) {
+		lock, err := LoadLock(filepath.Join(t.TempDir(), LockFileName))
+		assert.NoError(t, err)
+		assert.Empty(t, lock.Artifacts())
+
+		_, ok := lock.Digest("ghcr.io/compliance-framework/plugin-local-ssh:v1")
+		assert.False(t, ok)
+	})
+
+	t.Run("Persists locked digests", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), LockFileName)
+		lock, err := LoadLock(path)
+		assert.NoError(t, err)
+
+		assert.NoError(t, lock.Set("ghcr.io/compliance-framework/policies-ssh:v1", "sha256:2222"))
+		assert.NoError(t, lock.Set("ghcr.io/compliance-framework/plugin-local-ssh:v1", "sha256:1111"))
+
+		loaded, err := LoadLock(path)
+		assert.NoError(t, err)
+		assert.Equal(t, []LockedArtifact{
+			{Source: "ghcr.io/compliance-framework/plugin-local-ssh:v1", Digest: "sha256:1111"},
+			{Source: "ghcr.io/compliance-framework/policies-ssh:v1", Digest: "sha256:2222"},
+		}, loaded.Artifacts())
+
+		digest, ok := loaded.Digest("ghcr.io/compliance-framework/plugin-local-ssh:v1")
+		assert.True(t, ok)
+		assert.Equal(t, "sha256:1111", digest)
+	})
+
+	t.Run("Retains only the given sources", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), LockFileName)
+		lock, err := LoadLock(path)
+		assert.NoError(t, err)
+		assert.NoError(t, lock.Set("ghcr.io/compliance-framework/plugin-local-ssh:v1", "sha256:1111"))
+		assert.NoError(t, lock.Set("ghcr.io/compliance-framework/policies-ssh:v1", "sha256:2222"))
+
+		assert.NoError(t, lock.Retain([]string{"ghcr.io/compliance-framework/policies-ssh:v1"}))
+
+		loaded, err := LoadLock(path)
+		assert.NoError(t, err)
+		assert.Equal(t, []LockedArtifact{
+			{Source: "ghcr.io/compliance-framework/policies-ssh:v1", Digest: "sha256:2222"},
+		}, loaded.Artifacts())
+	})
+
+	t.Run("Rejects unsupported versions", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), LockFileName)
+		assert.NoError(t, os.WriteFile(path, []byte(`{"version": 2, "artifacts": []}`), 0644))
+
+		_, err := LoadLock(path)
+		assert.ErrorContains(t, err, "unsupported lock file version")
+	})
+
+	t.Run("A nil lock pins nothing", func(t *testing.T) {
+		var lock *Lock
+		assert.NoError(t, lock.Set("ghcr.io/compliance-framework/plugin-local-ssh:v1", "sha256:1111"))
+		_, ok := lock.Digest("ghcr.io/compliance-framework/plugin-local-ssh:v1")
+		assert.False(t, ok)
+		assert.NoError(t, lock.Retain(nil))
+	})
+}
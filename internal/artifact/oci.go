@@ -0,0 +1,134 @@
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/compliance-framework/framework/internal"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ResolveOCI returns the digest the OCI tag source currently points to, such as `sha256:<hex>`.
+func ResolveOCI(ctx context.Context, source string) (string, error) {
+	tag, err := name.NewTag(source)
+	if err != nil {
+		return "", err
+	}
+
+	opts := []remote.Option{
+		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+		remote.WithContext(ctx),
+	}
+
+	descriptor, err := remote.Head(tag, opts...)
+	if err != nil {
+		// Not every registry supports HEAD requests for manifests, so fall back to fetching it.
+		fetched, getErr := remote.Get(tag, opts...)
+		if getErr != nil {
+			return "", fmt.Errorf("resolving %s: %w", source, getErr)
+		}
+		descriptor = &fetched.Descriptor
+	}
+
+	return descriptor.Digest.String(), nil
+}
+
+// OCIDownloader downloads OCI artifacts into a cache keyed by their digest.
+//
+// Each artifact is stored in <cache dir>/<digest hex>, with its layers extracted into the entry's content
+// directory. Platform specific artifacts are keyed by platform too, as a digest may refer to an index of
+// images for several platforms.
+type OCIDownloader struct {
+	cacheDir string
+}
+
+func NewOCIDownloader(cacheDir string) *OCIDownloader {
+	return &OCIDownloader{
+		cacheDir: cacheDir,
+	}
+}
+
+// Download retrieves the artifact with digest from the repository of the OCI tag source. If platform is set,
+// the image for that platform is used when the digest refers to an index.
+func (d *OCIDownloader) Download(ctx context.Context, source string, digest string, platform *v1.Platform) (*Artifact, error) {
+	tag, err := name.NewTag(source)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := v1.NewHash(digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest %q for %s: %w", digest, source, err)
+	}
+
+	dir := filepath.Join(d.cacheDir, CacheKey(digest, platform))
+	if cached, err := loadCacheEntry(dir); err == nil {
+		return cached, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	opts := []remote.Option{
+		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+		remote.WithContext(ctx),
+	}
+	if platform != nil {
+		opts = append(opts, remote.WithPlatform(*platform))
+	}
+
+	// Pulling by digest means the registry can't give us anything other than what was resolved.
+	img, err := remote.Image(tag.Context().Digest(hash.String()), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s@%s: %w", source, digest, err)
+	}
+
+	tmpDir, contentDir, err := newCacheEntry(d.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range layers {
+		if err := untarLayer(layer, contentDir); err != nil {
+			return nil, fmt.Errorf("extracting %s@%s: %w", source, digest, err)
+		}
+	}
+
+	return commitCacheEntry(tmpDir, dir, &Artifact{
+		Source:    source,
+		Digest:    hash.String(),
+		Extracted: true,
+	})
+}
+
+// CacheKey returns the name of the cache entry for an OCI artifact with digest, downloaded for platform.
+func CacheKey(digest string, platform *v1.Platform) string {
+	hash, err := v1.NewHash(digest)
+	key := digest
+	if err == nil {
+		key = hash.Hex
+	}
+	if platform != nil {
+		key = fmt.Sprintf("%s-%s-%s", key, platform.OS, platform.Architecture)
+	}
+	return key
+}
+
+func untarLayer(layer v1.Layer, destination string) error {
+	reader, err := layer.Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return internal.Untar(destination, reader)
+}
@@ -0,0 +1,106 @@
+package artifact
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveRegistry returns the host of an in-memory OCI registry.
+func serveRegistry(t *testing.T) string {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// push pushes an image containing files to source, returning its digest.
+func push(t *testing.T, source string, files map[string][]byte) string {
+	img, err := crane.Image(files)
+	assert.NoError(t, err)
+	tag, err := name.NewTag(source)
+	assert.NoError(t, err)
+	assert.NoError(t, remote.Write(tag, img))
+
+	digest, err := img.Digest()
+	assert.NoError(t, err)
+	return digest.String()
+}
+
+func TestResolveOCI(t *testing.T) {
+	source := serveRegistry(t) + "/policies/ssh:v1"
+
+	first := push(t, source, map[string][]byte{"policies/ssh.rego": []byte("package first")})
+	resolved, err := ResolveOCI(context.Background(), source)
+	assert.NoError(t, err)
+	assert.Equal(t, first, resolved)
+
+	second := push(t, source, map[string][]byte{"policies/ssh.rego": []byte("package second")})
+	resolved, err = ResolveOCI(context.Background(), source)
+	assert.NoError(t, err)
+	assert.Equal(t, second, resolved)
+	assert.NotEqual(t, first, second)
+
+	_, err = ResolveOCI(context.Background(), serveRegistry(t)+"/policies/missing:v1")
+	var transportErr *transport.Error
+	assert.ErrorAs(t, err, &transportErr)
+}
+
+func TestOCIDownloader_Download(t *testing.T) {
+	source := serveRegistry(t) + "/policies/ssh:v1"
+
+	t.Run("Downloads and caches by digest", func(t *testing.T) {
+		digest := push(t, source, map[string][]byte{"policies/ssh.rego": []byte("package first")})
+		d := NewOCIDownloader(t.TempDir())
+
+		artifact, err := d.Download(context.Background(), source, digest, nil)
+		assert.NoError(t, err)
+		assert.True(t, artifact.Extracted)
+		assert.False(t, artifact.Cached)
+		assert.Equal(t, digest, artifact.Digest)
+
+		policy, err := os.ReadFile(filepath.Join(artifact.Path, "policies", "ssh.rego"))
+		assert.NoError(t, err)
+		assert.Equal(t, "package first", string(policy))
+
+		// Pushing the tag again doesn't change what the digest refers to.
+		push(t, source, map[string][]byte{"policies/ssh.rego": []byte("package second")})
+
+		cached, err := d.Download(context.Background(), source, digest, nil)
+		assert.NoError(t, err)
+		assert.True(t, cached.Cached)
+		assert.Equal(t, artifact.Path, cached.Path)
+
+		policy, err = os.ReadFile(filepath.Join(cached.Path, "policies", "ssh.rego"))
+		assert.NoError(t, err)
+		assert.Equal(t, "package first", string(policy))
+	})
+
+	t.Run("Keys platform specific downloads by platform", func(t *testing.T) {
+		digest := push(t, source, map[string][]byte{"plugin": []byte("#!/bin/sh")})
+		cacheDir := t.TempDir()
+		platform := &v1.Platform{OS: "linux", Architecture: "amd64"}
+
+		artifact, err := NewOCIDownloader(cacheDir).Download(context.Background(), source, digest, platform)
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(cacheDir, CacheKey(digest, platform), contentDirName), artifact.Path)
+		assert.True(t, strings.HasSuffix(CacheKey(digest, platform), "-linux-amd64"))
+	})
+
+	t.Run("Requires a valid digest", func(t *testing.T) {
+		_, err := NewOCIDownloader(t.TempDir()).Download(context.Background(), source, "v1", nil)
+		assert.ErrorContains(t, err, "invalid digest")
+	})
+}
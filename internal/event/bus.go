@@ -1,21 +1,41 @@
 package event
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
+
+	"github.com/compliance-framework/framework/internal/telemetry"
 	"github.com/hashicorp/go-hclog"
 	"github.com/nats-io/nats.go"
-	"sync"
 )
 
 const NATS_RECONNECT_BUF_SIZE = 5 * 1024 * 1024
 
+// outboxRelayInterval is how often the outbox is retried when nothing else has prompted a relay,
+// such as a new message or reconnecting to the server.
+const outboxRelayInterval = 30 * time.Second
+
+// outboxAckTimeout is how long a relay waits for the server to acknowledge a batch of messages.
+const outboxAckTimeout = 10 * time.Second
+
+var ErrNotConnected = errors.New("not connected to nats")
+
 type NatsBus struct {
 	logger hclog.Logger
+	redact func(data string) string
 
 	conn *nats.Conn
 	mu   sync.Mutex
+
+	outbox        *Outbox
+	durableTopics map[string]struct{}
+	relayNotify   chan struct{}
+	relayCancel   context.CancelFunc
+	relayDone     chan struct{}
 }
 
 func NewNatsBus(logger hclog.Logger) *NatsBus {
@@ -24,6 +44,36 @@ func NewNatsBus(logger hclog.Logger) *NatsBus {
 	}
 }
 
+// UseOutbox makes messages published on any of topics durable. Rather than being published directly, they are
+// stored in outbox and relayed to the server in the background, surviving both connection loss and restarts.
+//
+// While an outbox is in use, Connect succeeds even if the server is unavailable, and keeps trying to reconnect
+// indefinitely. UseOutbox must be called before Connect.
+func (nb *NatsBus) UseOutbox(outbox *Outbox, topics ...string) {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	nb.outbox = outbox
+	nb.durableTopics = map[string]struct{}{}
+	for _, topic := range topics {
+		nb.durableTopics[topic] = struct{}{}
+	}
+}
+
+// UseRedactor redacts message data with redact before it is logged, so secrets aren't written to trace logs.
+// Messages are published as they are. UseRedactor must be called before publishing or subscribing.
+func (nb *NatsBus) UseRedactor(redact func(data string) string) {
+	nb.redact = redact
+}
+
+// logData returns data as it should be logged.
+func (nb *NatsBus) logData(data []byte) string {
+	if nb.redact == nil {
+		return string(data)
+	}
+	return nb.redact(string(data))
+}
+
 func (nb *NatsBus) Connect(server string) error {
 	nb.mu.Lock()
 	defer nb.mu.Unlock()
@@ -32,26 +82,173 @@ func (nb *NatsBus) Connect(server string) error {
 		return errors.New("already connected")
 	}
 
-	c, err := nats.Connect(server, nats.ReconnectBufSize(NATS_RECONNECT_BUF_SIZE))
+	options := []nats.Option{
+		nats.ReconnectBufSize(NATS_RECONNECT_BUF_SIZE),
+	}
+	if nb.outbox != nil {
+		nb.relayNotify = make(chan struct{}, 1)
+		options = append(options,
+			nats.RetryOnFailedConnect(true),
+			nats.MaxReconnects(-1),
+			nats.ConnectHandler(nb.outboxConnected),
+			nats.ReconnectHandler(nb.outboxConnected),
+		)
+	}
+
+	c, err := nats.Connect(server, options...)
 	if err != nil {
 		return err
 	}
 	nb.conn = c
 
+	if nb.outbox != nil {
+		if c.IsConnected() {
+			nb.outbox.SetMaxPayload(c.MaxPayload())
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		nb.relayCancel = cancel
+		nb.relayDone = make(chan struct{})
+		go nb.relayLoop(ctx)
+		nb.notifyRelay()
+	}
+
 	return nil
 }
 
+// Connected returns whether the bus currently has a connection to the server.
+func (nb *NatsBus) Connected() bool {
+	return nb.conn != nil && nb.conn.IsConnected()
+}
+
 // Not a method due to Golang limitations on generics there, so we just pass the bus as a parameter.
 func Publish[T any](nb *NatsBus, msg T, topic string) error {
+	return PublishContext(context.Background(), nb, msg, topic)
+}
+
+// PublishContext publishes msg with the trace context of ctx in its headers, so the trace continues wherever
+// the message is received. Trace context is kept with messages stored in the outbox.
+func PublishContext[T any](ctx context.Context, nb *NatsBus, msg T, topic string) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
-	fmt.Println("#####################")
-	nb.logger.Trace("Publishing message", "topic", topic, "data", string(data))
-	return nb.conn.Publish(topic, data)
+	nb.logger.Trace("Publishing message", "topic", topic, "data", nb.logData(data))
+
+	natsMsg := nats.NewMsg(topic)
+	natsMsg.Data = data
+	telemetry.Inject(ctx, telemetry.HeaderCarrier(natsMsg.Header))
+	if len(natsMsg.Header) == 0 {
+		natsMsg.Header = nil
+	}
+
+	if _, ok := nb.durableTopics[topic]; ok && nb.outbox != nil {
+		if err := nb.outbox.PutMsg(natsMsg); err != nil {
+			return fmt.Errorf("storing message in outbox: %w", err)
+		}
+		nb.notifyRelay()
+		return nil
+	}
+
+	return nb.conn.PublishMsg(natsMsg)
+}
+
+// Subscribe calls handler with every message received on topic, decoded from JSON. Messages which can't be
+// decoded are logged and dropped. Messages on the same subscription are handled one at a time, in order.
+//
+// Not a method for the same reason as Publish. Subscriptions are re-established when the bus reconnects.
+func Subscribe[T any](nb *NatsBus, topic string, handler func(msg T)) error {
+	return SubscribeContext(nb, topic, func(_ context.Context, msg T) {
+		handler(msg)
+	})
+}
+
+// SubscribeContext is Subscribe, calling handler with a context carrying the trace context the message was
+// published with.
+func SubscribeContext[T any](nb *NatsBus, topic string, handler func(ctx context.Context, msg T)) error {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	if nb.conn == nil {
+		return ErrNotConnected
+	}
+
+	_, err := nb.conn.Subscribe(topic, func(m *nats.Msg) {
+		nb.logger.Trace("Received message", "topic", topic, "data", nb.logData(m.Data))
+
+		var msg T
+		if err := json.Unmarshal(m.Data, &msg); err != nil {
+			nb.logger.Error("Error decoding message, it will be dropped", "topic", topic, "error", err)
+			return
+		}
+		handler(telemetry.Extract(context.Background(), telemetry.HeaderCarrier(m.Header)), msg)
+	})
+	return err
+}
+
+// Flush waits until all published messages have been processed by the server, or ctx is done.
+// Messages held in the outbox are relayed first.
+func (nb *NatsBus) Flush(ctx context.Context) error {
+	if nb.outbox != nil {
+		if err := nb.relay(ctx); err != nil {
+			return fmt.Errorf("%d messages remain in outbox: %w", nb.outbox.Len(), err)
+		}
+	}
+	return nb.conn.FlushWithContext(ctx)
 }
 
 func (nb *NatsBus) Close() {
+	if nb.relayCancel != nil {
+		nb.relayCancel()
+		<-nb.relayDone
+	}
 	nb.conn.Close()
 }
+
+// outboxConnected limits the outbox to messages the server accepts, and relays it, whenever the connection is
+// established.
+func (nb *NatsBus) outboxConnected(c *nats.Conn) {
+	nb.outbox.SetMaxPayload(c.MaxPayload())
+	nb.notifyRelay()
+}
+
+func (nb *NatsBus) notifyRelay() {
+	select {
+	case nb.relayNotify <- struct{}{}:
+	default:
+	}
+}
+
+// relayLoop relays messages from the outbox whenever new messages are stored, the connection is
+// re-established, or periodically otherwise, until ctx is done.
+func (nb *NatsBus) relayLoop(ctx context.Context) {
+	defer close(nb.relayDone)
+
+	ticker := time.NewTicker(outboxRelayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-nb.relayNotify:
+		case <-ticker.C:
+		}
+
+		err := nb.relay(ctx)
+		if err != nil && !errors.Is(err, ErrNotConnected) && ctx.Err() == nil {
+			nb.logger.Warn("Error relaying messages from outbox, they will be retried", "pending", nb.outbox.Len(), "error", err)
+		}
+	}
+}
+
+// relay publishes the messages held in the outbox, if the bus is connected.
+func (nb *NatsBus) relay(ctx context.Context) error {
+	if !nb.Connected() {
+		return ErrNotConnected
+	}
+	return nb.outbox.Relay(ctx, nb.conn.PublishMsg, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, outboxAckTimeout)
+		defer cancel()
+		return nb.conn.FlushWithContext(ctx)
+	})
+}
@@ -1,15 +1,19 @@
 package event
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	natsserver "github.com/nats-io/nats-server/v2/test"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Message struct {
@@ -58,3 +62,172 @@ func TestBus(t *testing.T) {
 
 	nb.Close()
 }
+
+func TestBus_Outbox(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	// Get a random free port
+	conn, err := net.Listen("tcp", ":0")
+	port := conn.Addr().(*net.TCPAddr).Port
+	if err == nil {
+		conn.Close()
+	}
+
+	outbox, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir()})
+	assert.NoError(t, err)
+
+	nb := NewNatsBus(hclog.NewNullLogger())
+	nb.UseOutbox(outbox, "durable")
+
+	// The server isn't running yet, but we should still be able to connect and publish.
+	err = nb.Connect(fmt.Sprintf("nats://localhost:%d", port))
+	assert.NoError(t, err)
+	defer nb.Close()
+	assert.False(t, nb.Connected())
+
+	for i := range 3 {
+		err = Publish(nb, Message{Text: fmt.Sprintf("message %d", i)}, "durable")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, outbox.Len())
+
+	options := natsserver.DefaultTestOptions
+	options.Port = port
+	s := natsserver.RunServer(&options)
+	defer s.Shutdown()
+
+	sub, err := nats.Connect(s.ClientURL())
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	ch := make(chan Message, 3)
+	_, err = sub.Subscribe("durable", func(m *nats.Msg) {
+		var msg Message
+		json.Unmarshal(m.Data, &msg)
+		ch <- msg
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sub.Flush())
+
+	// Once connected, the flush relays everything held in the outbox.
+	assert.Eventually(t, nb.Connected, 10*time.Second, 50*time.Millisecond)
+	// The outbox only accepts messages the server does.
+	assert.Eventually(t, func() bool { return outbox.MaxPayload() == sub.MaxPayload() }, 5*time.Second, 50*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, nb.Flush(ctx))
+	assert.Equal(t, 0, outbox.Len())
+
+	for i := range 3 {
+		select {
+		case received := <-ch:
+			assert.Equal(t, fmt.Sprintf("message %d", i), received.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected message %d to be relayed from the outbox", i)
+		}
+	}
+}
+
+func TestBus_Subscribe(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	options := natsserver.DefaultTestOptions
+	options.Port = -1
+	s := natsserver.RunServer(&options)
+	defer s.Shutdown()
+
+	nb := NewNatsBus(hclog.NewNullLogger())
+	err := Subscribe(nb, "test", func(msg Message) {})
+	assert.ErrorIs(t, err, ErrNotConnected)
+
+	assert.NoError(t, nb.Connect(s.ClientURL()))
+	defer nb.Close()
+
+	ch := make(chan Message, 2)
+	err = Subscribe(nb, "test", func(msg Message) {
+		ch <- msg
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, nb.conn.Flush())
+
+	// Messages which can't be decoded are dropped, without affecting later messages.
+	assert.NoError(t, nb.conn.Publish("test", []byte("not json")))
+	assert.NoError(t, Publish(nb, Message{Text: "Hello World"}, "test"))
+
+	select {
+	case received := <-ch:
+		assert.Equal(t, "Hello World", received.Text)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected message to be received")
+	}
+}
+
+func TestBus_UseRedactor(t *testing.T) {
+	logs := strings.Builder{}
+	nb := NewNatsBus(hclog.New(&hclog.LoggerOptions{Output: &logs, Level: hclog.Trace}))
+	nb.UseRedactor(func(data string) string {
+		return strings.ReplaceAll(data, "s3cr3t", "(redacted)")
+	})
+
+	// The bus isn't connected, but the message is logged before it is published.
+	_ = Publish(nb, Message{Text: "token s3cr3t"}, "test.redacted")
+
+	assert.Contains(t, logs.String(), "Publishing message")
+	assert.Contains(t, logs.String(), "token (redacted)")
+	assert.NotContains(t, logs.String(), "s3cr3t")
+}
+
+func TestBus_TraceContext(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	options := natsserver.DefaultTestOptions
+	options.Port = -1
+	s := natsserver.RunServer(&options)
+	defer s.Shutdown()
+
+	outbox, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir()})
+	assert.NoError(t, err)
+
+	nb := NewNatsBus(hclog.NewNullLogger())
+	nb.UseOutbox(outbox, "durable")
+	assert.NoError(t, nb.Connect(s.ClientURL()))
+	defer nb.Close()
+
+	received := make(chan trace.SpanContext, 2)
+	for _, topic := range []string{"direct", "durable"} {
+		err = SubscribeContext(nb, topic, func(ctx context.Context, msg Message) {
+			received <- trace.SpanContextFromContext(ctx)
+		})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, nb.conn.Flush())
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+	// Trace context is kept with messages stored in the outbox, as well as those published directly.
+	for _, topic := range []string{"direct", "durable"} {
+		assert.NoError(t, PublishContext(ctx, nb, Message{Text: "traced"}, topic))
+	}
+
+	for range 2 {
+		select {
+		case got := <-received:
+			assert.Equal(t, spanContext.TraceID(), got.TraceID())
+			assert.Equal(t, spanContext.SpanID(), got.SpanID())
+			assert.True(t, got.IsRemote())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected traced message to be received")
+		}
+	}
+}
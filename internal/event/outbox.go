@@ -0,0 +1,419 @@
+package event
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultOutboxMaxSize is the maximum total size of messages held in an outbox, if not otherwise configured.
+const DefaultOutboxMaxSize = 100 * 1024 * 1024
+
+// DefaultOutboxMaxAge is how long messages are held in an outbox before they are dropped, if not otherwise configured.
+const DefaultOutboxMaxAge = 7 * 24 * time.Hour
+
+// outboxRelayBatchSize is the number of messages published between each acknowledgement from the server.
+const outboxRelayBatchSize = 100
+
+const outboxFileExt = ".json"
+
+// OutboxOptions configures an Outbox.
+type OutboxOptions struct {
+	// Dir is the directory messages are stored in.
+	Dir string
+	// MaxSize is the maximum total size in bytes of stored messages. When it is exceeded, the oldest messages are dropped.
+	MaxSize int64
+	// MaxAge is how long a message is kept before it is dropped, if it could not be delivered.
+	MaxAge time.Duration
+}
+
+// outboxMessage is the on-disk format of a message held in the outbox.
+type outboxMessage struct {
+	Topic  string          `json:"topic"`
+	Time   time.Time       `json:"time"`
+	Header nats.Header     `json:"header,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type outboxEntry struct {
+	seq  uint64
+	size int64
+	time time.Time
+}
+
+// Outbox is a persistent, ordered queue of messages waiting to be delivered.
+//
+// Each message is written to its own file before Put returns, so messages survive the agent restarting.
+// Messages are only removed once they have been acknowledged, or when they exceed the configured size
+// and age limits. Delivery is at least once: a message may be delivered again if the agent stops between
+// publishing it and receiving the acknowledgement.
+type Outbox struct {
+	logger  hclog.Logger
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	mu         sync.Mutex
+	entries    []outboxEntry
+	size       int64
+	nextSeq    uint64
+	maxPayload int64
+	dropped    uint64
+
+	// relayMu ensures only one relay runs at a time, so messages are delivered in order.
+	relayMu sync.Mutex
+}
+
+// NewOutbox opens the outbox in opts.Dir, creating it if necessary. Any messages left from a previous run
+// are kept, and will be delivered before new ones.
+func NewOutbox(logger hclog.Logger, opts OutboxOptions) (*Outbox, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("outbox directory is required")
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultOutboxMaxSize
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultOutboxMaxAge
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	o := &Outbox{
+		logger:  logger,
+		dir:     opts.Dir,
+		maxSize: opts.MaxSize,
+		maxAge:  opts.MaxAge,
+		nextSeq: 1,
+	}
+
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+
+	if len(o.entries) > 0 {
+		o.logger.Info("Found undelivered messages in outbox", "dir", o.dir, "messages", len(o.entries), "bytes", o.size)
+	}
+
+	return o, nil
+}
+
+// load reads the existing messages in the outbox directory.
+func (o *Outbox) load() error {
+	files, err := os.ReadDir(o.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(name, ".") {
+			// A message which was never completely written.
+			_ = os.Remove(filepath.Join(o.dir, name))
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, outboxFileExt), 10, 64)
+		if err != nil || !strings.HasSuffix(name, outboxFileExt) {
+			o.logger.Warn("Ignoring unexpected file in outbox", "file", name)
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			return err
+		}
+
+		o.entries = append(o.entries, outboxEntry{
+			seq:  seq,
+			size: info.Size(),
+			time: info.ModTime(),
+		})
+		o.size += info.Size()
+		o.nextSeq = max(o.nextSeq, seq+1)
+	}
+
+	slices.SortFunc(o.entries, func(a, b outboxEntry) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+
+	return nil
+}
+
+// Put durably stores a message to be delivered on topic. data must be valid JSON.
+//
+// If storing the message takes the outbox over its size limit, the oldest messages are dropped to make room.
+func (o *Outbox) Put(topic string, data []byte) error {
+	return o.PutMsg(&nats.Msg{Subject: topic, Data: data})
+}
+
+// PutMsg durably stores a message to be delivered, along with its headers. As with Put, its data must be
+// valid JSON. Messages larger than the server accepts are rejected with nats.ErrMaxPayload, as they could never
+// be delivered.
+func (o *Outbox) PutMsg(msg *nats.Msg) error {
+	if maxPayload := o.MaxPayload(); maxPayload > 0 {
+		if size := msgSize(msg); size > maxPayload {
+			return fmt.Errorf("%w: message of %d bytes exceeds the server's limit of %d bytes", nats.ErrMaxPayload, size, maxPayload)
+		}
+	}
+
+	now := time.Now()
+	content, err := json.Marshal(outboxMessage{
+		Topic:  msg.Subject,
+		Time:   now,
+		Header: msg.Header,
+		Data:   msg.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	size := int64(len(content))
+	if size > o.maxSize {
+		return fmt.Errorf("message of %d bytes exceeds the outbox size limit of %d bytes", size, o.maxSize)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	seq := o.nextSeq
+
+	// Write to a temporary file first, so a partially written message is never delivered.
+	tmp, err := os.CreateTemp(o.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), o.path(seq))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	o.nextSeq++
+	o.entries = append(o.entries, outboxEntry{seq: seq, size: size, time: now})
+	o.size += size
+
+	for o.size > o.maxSize {
+		oldest := o.entries[0]
+		o.logger.Warn("Outbox size limit exceeded, dropping oldest undelivered message", "seq", oldest.seq, "age", now.Sub(oldest.time), "max_size", o.maxSize)
+		o.dropLocked(oldest.seq)
+	}
+
+	return nil
+}
+
+// SetMaxPayload sets the largest message the server accepts, in bytes, so larger messages are rejected by PutMsg
+// rather than stored. Zero, the default, accepts messages of any size.
+func (o *Outbox) SetMaxPayload(maxPayload int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.maxPayload = maxPayload
+}
+
+// MaxPayload returns the largest message PutMsg accepts, in bytes, or zero if there is no limit.
+func (o *Outbox) MaxPayload() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.maxPayload
+}
+
+// Dropped returns the number of messages which have been dropped without being delivered, as they exceeded the
+// outbox's limits or could never be delivered.
+func (o *Outbox) Dropped() uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.dropped
+}
+
+// Len returns the number of messages waiting to be delivered.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Relay delivers stored messages in order, using publish to send each message with its headers, and ack to
+// wait until the messages sent so far have been received. Messages are removed once they are acknowledged.
+//
+// Relay returns once the outbox is empty, or on the first error. Messages which could not be delivered are
+// kept for the next call, unless they could never be delivered, such as messages larger than the server accepts,
+// which are dropped so the messages behind them are still delivered.
+func (o *Outbox) Relay(ctx context.Context, publish func(msg *nats.Msg) error, ack func(ctx context.Context) error) error {
+	o.relayMu.Lock()
+	defer o.relayMu.Unlock()
+
+	for {
+		o.expire()
+
+		batch := o.batch()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		sent := make([]uint64, 0, len(batch))
+		var publishErr error
+		for _, seq := range batch {
+			msg, err := o.read(seq)
+			if errors.Is(err, os.ErrNotExist) {
+				// Dropped since we took the batch, as the outbox was full.
+				continue
+			}
+			if err != nil {
+				o.logger.Error("Dropping unreadable message from outbox", "seq", seq, "error", err)
+				o.drop(seq)
+				continue
+			}
+
+			if publishErr = publish(&nats.Msg{Subject: msg.Topic, Header: msg.Header, Data: msg.Data}); publishErr != nil {
+				if !permanentPublishError(publishErr) {
+					break
+				}
+				// The message would fail on every relay, holding up every message behind it.
+				o.logger.Error("Dropping message from outbox which can never be published", "seq", seq, "topic", msg.Topic, "error", publishErr)
+				o.drop(seq)
+				publishErr = nil
+				continue
+			}
+			sent = append(sent, seq)
+		}
+
+		if len(sent) > 0 {
+			if err := ack(ctx); err != nil {
+				return fmt.Errorf("waiting for acknowledgement of %d messages: %w", len(sent), err)
+			}
+			for _, seq := range sent {
+				o.remove(seq)
+			}
+			o.logger.Trace("Relayed messages from outbox", "messages", len(sent))
+		}
+
+		if publishErr != nil {
+			return publishErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// batch returns the sequence numbers of the next messages to be delivered.
+func (o *Outbox) batch() []uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	batch := make([]uint64, 0, min(len(o.entries), outboxRelayBatchSize))
+	for _, entry := range o.entries[:min(len(o.entries), outboxRelayBatchSize)] {
+		batch = append(batch, entry.seq)
+	}
+	return batch
+}
+
+// expire drops messages which have been waiting longer than the maximum age.
+func (o *Outbox) expire() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	cutoff := time.Now().Add(-o.maxAge)
+	for len(o.entries) > 0 && o.entries[0].time.Before(cutoff) {
+		oldest := o.entries[0]
+		o.logger.Warn("Outbox message exceeded maximum age, dropping undelivered message", "seq", oldest.seq, "age", time.Since(oldest.time), "max_age", o.maxAge)
+		o.dropLocked(oldest.seq)
+	}
+}
+
+func (o *Outbox) read(seq uint64) (*outboxMessage, error) {
+	content, err := os.ReadFile(o.path(seq))
+	if err != nil {
+		return nil, err
+	}
+	msg := &outboxMessage{}
+	if err := json.Unmarshal(content, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// drop removes a message which won't be delivered.
+func (o *Outbox) drop(seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.dropLocked(seq)
+}
+
+func (o *Outbox) dropLocked(seq uint64) {
+	o.dropped++
+	o.removeLocked(seq)
+}
+
+func (o *Outbox) remove(seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.removeLocked(seq)
+}
+
+func (o *Outbox) removeLocked(seq uint64) {
+	i := slices.IndexFunc(o.entries, func(entry outboxEntry) bool {
+		return entry.seq == seq
+	})
+	if i < 0 {
+		return
+	}
+
+	if err := os.Remove(o.path(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		o.logger.Error("Error removing message from outbox", "seq", seq, "error", err)
+	}
+	o.size -= o.entries[i].size
+	o.entries = slices.Delete(o.entries, i, i+1)
+}
+
+func (o *Outbox) path(seq uint64) string {
+	// Zero padded, so files sort in delivery order.
+	return filepath.Join(o.dir, fmt.Sprintf("%020d%s", seq, outboxFileExt))
+}
+
+// permanentPublishError returns whether err means the message itself can't be published, so publishing it again
+// would fail the same way.
+func permanentPublishError(err error) bool {
+	return errors.Is(err, nats.ErrMaxPayload) || errors.Is(err, nats.ErrBadSubject)
+}
+
+// msgSize returns the size of msg as the server limits it: its data and encoded headers.
+func msgSize(msg *nats.Msg) int64 {
+	size := int64(len(msg.Data))
+	if len(msg.Header) > 0 {
+		header := bytes.Buffer{}
+		header.WriteString("NATS/1.0\r\n")
+		_ = http.Header(msg.Header).Write(&header)
+		header.WriteString("\r\n")
+		size += int64(header.Len())
+	}
+	return size
+}
@@ -0,0 +1,201 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+type relayed struct {
+	topic string
+	data  string
+}
+
+// recorder collects the messages relayed from an outbox.
+type recorder struct {
+	published []relayed
+	acked     int
+	ackErr    error
+}
+
+func (r *recorder) publish(msg *nats.Msg) error {
+	r.published = append(r.published, relayed{topic: msg.Subject, data: string(msg.Data)})
+	return nil
+}
+
+func (r *recorder) ack(ctx context.Context) error {
+	if r.ackErr != nil {
+		return r.ackErr
+	}
+	r.acked = len(r.published)
+	return nil
+}
+
+func TestOutbox_Relay(t *testing.T) {
+	t.Run("Relays messages in order", func(t *testing.T) {
+		o, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir()})
+		assert.NoError(t, err)
+
+		for i := range 3 {
+			assert.NoError(t, o.Put("test", []byte(fmt.Sprintf(`{"i":%d}`, i))))
+		}
+		assert.Equal(t, 3, o.Len())
+
+		r := &recorder{}
+		assert.NoError(t, o.Relay(context.Background(), r.publish, r.ack))
+
+		assert.Equal(t, []relayed{
+			{topic: "test", data: `{"i":0}`},
+			{topic: "test", data: `{"i":1}`},
+			{topic: "test", data: `{"i":2}`},
+		}, r.published)
+		assert.Equal(t, 3, r.acked)
+		assert.Equal(t, 0, o.Len())
+	})
+
+	t.Run("Keeps messages which are not acknowledged", func(t *testing.T) {
+		o, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir()})
+		assert.NoError(t, err)
+
+		assert.NoError(t, o.Put("test", []byte(`{}`)))
+
+		r := &recorder{ackErr: errors.New("timeout")}
+		assert.Error(t, o.Relay(context.Background(), r.publish, r.ack))
+		assert.Equal(t, 1, o.Len())
+
+		r = &recorder{}
+		assert.NoError(t, o.Relay(context.Background(), r.publish, r.ack))
+		assert.Len(t, r.published, 1)
+		assert.Equal(t, 0, o.Len())
+	})
+
+	t.Run("Stops at the first publish error", func(t *testing.T) {
+		o, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir()})
+		assert.NoError(t, err)
+
+		for range 3 {
+			assert.NoError(t, o.Put("test", []byte(`{}`)))
+		}
+
+		published := 0
+		err = o.Relay(context.Background(), func(msg *nats.Msg) error {
+			if published == 2 {
+				return errors.New("disconnected")
+			}
+			published++
+			return nil
+		}, func(ctx context.Context) error { return nil })
+		assert.Error(t, err)
+		assert.Equal(t, 1, o.Len())
+	})
+
+	t.Run("Drops messages which can never be published", func(t *testing.T) {
+		o, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir()})
+		assert.NoError(t, err)
+
+		for i := range 3 {
+			assert.NoError(t, o.Put("test", []byte(fmt.Sprintf(`{"i":%d}`, i))))
+		}
+
+		r := &recorder{}
+		err = o.Relay(context.Background(), func(msg *nats.Msg) error {
+			if string(msg.Data) == `{"i":1}` {
+				return nats.ErrMaxPayload
+			}
+			return r.publish(msg)
+		}, r.ack)
+		assert.NoError(t, err)
+		assert.Equal(t, []relayed{
+			{topic: "test", data: `{"i":0}`},
+			{topic: "test", data: `{"i":2}`},
+		}, r.published)
+		assert.Equal(t, 0, o.Len())
+		assert.Equal(t, uint64(1), o.Dropped())
+	})
+}
+
+func TestOutbox_Persistence(t *testing.T) {
+	dir := t.TempDir()
+
+	o, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: dir})
+	assert.NoError(t, err)
+	assert.NoError(t, o.Put("test", []byte(`{"i":0}`)))
+	assert.NoError(t, o.Put("test", []byte(`{"i":1}`)))
+
+	// A message which was never completely written should be ignored.
+	assert.NoError(t, os.WriteFile(dir+"/.tmp-123", []byte(`{"topic":`), 0600))
+
+	reopened, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reopened.Len())
+
+	assert.NoError(t, reopened.Put("test", []byte(`{"i":2}`)))
+
+	r := &recorder{}
+	assert.NoError(t, reopened.Relay(context.Background(), r.publish, r.ack))
+	assert.Equal(t, []relayed{
+		{topic: "test", data: `{"i":0}`},
+		{topic: "test", data: `{"i":1}`},
+		{topic: "test", data: `{"i":2}`},
+	}, r.published)
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestOutbox_Limits(t *testing.T) {
+	t.Run("Drops the oldest messages when full", func(t *testing.T) {
+		o, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir(), MaxSize: 250})
+		assert.NoError(t, err)
+
+		for i := range 5 {
+			assert.NoError(t, o.Put("test", []byte(fmt.Sprintf(`{"i":%d}`, i))))
+		}
+		assert.Less(t, o.Len(), 5)
+
+		r := &recorder{}
+		assert.NoError(t, o.Relay(context.Background(), r.publish, r.ack))
+		assert.Equal(t, relayed{topic: "test", data: `{"i":4}`}, r.published[len(r.published)-1])
+		assert.NotEqual(t, relayed{topic: "test", data: `{"i":0}`}, r.published[0])
+	})
+
+	t.Run("Rejects messages larger than the outbox", func(t *testing.T) {
+		o, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir(), MaxSize: 10})
+		assert.NoError(t, err)
+
+		assert.Error(t, o.Put("test", []byte(`{"text":"too large"}`)))
+		assert.Equal(t, 0, o.Len())
+	})
+
+	t.Run("Rejects messages larger than the server accepts", func(t *testing.T) {
+		o, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir()})
+		assert.NoError(t, err)
+		o.SetMaxPayload(10)
+
+		assert.ErrorIs(t, o.Put("test", []byte(`{"text":"too large"}`)), nats.ErrMaxPayload)
+		assert.NoError(t, o.Put("test", []byte(`{}`)))
+		assert.Equal(t, 1, o.Len())
+	})
+
+	t.Run("Drops expired messages", func(t *testing.T) {
+		o, err := NewOutbox(hclog.NewNullLogger(), OutboxOptions{Dir: t.TempDir(), MaxAge: time.Millisecond})
+		assert.NoError(t, err)
+
+		assert.NoError(t, o.Put("test", []byte(`{}`)))
+		time.Sleep(5 * time.Millisecond)
+
+		r := &recorder{}
+		assert.NoError(t, o.Relay(context.Background(), r.publish, r.ack))
+		assert.Empty(t, r.published)
+		assert.Equal(t, 0, o.Len())
+		assert.Equal(t, uint64(1), o.Dropped())
+	})
+}
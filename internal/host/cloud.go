@@ -0,0 +1,190 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// cloudMetadataURL is the link-local address the instance metadata endpoints of AWS, GCP and Azure listen on.
+var cloudMetadataURL = "http://169.254.169.254"
+
+// cloudProvider reads instance metadata from a single cloud's endpoint.
+type cloudProvider struct {
+	name    string
+	collect func(ctx context.Context, client *http.Client) (Facts, error)
+}
+
+// cloudProviders are queried concurrently. Outside their own cloud, each fails, so at most one succeeds.
+// If several do, the first in this order is used.
+var cloudProviders = []cloudProvider{
+	{name: "aws", collect: awsFacts},
+	{name: "gcp", collect: gcpFacts},
+	{name: "azure", collect: azureFacts},
+}
+
+// cloudFacts returns the instance metadata of the cloud the host runs in, or nil if no metadata endpoint is
+// reachable before ctx is done.
+func cloudFacts(ctx context.Context) Facts {
+	client := &http.Client{
+		// Metadata endpoints are always local, so any proxy configured for the agent is bypassed.
+		Transport: &http.Transport{Proxy: nil},
+	}
+
+	results := make([]Facts, len(cloudProviders))
+	wg := sync.WaitGroup{}
+	for i, provider := range cloudProviders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			facts, err := provider.collect(ctx, client)
+			if err != nil {
+				return
+			}
+			facts[FactCloudProvider] = provider.name
+			results[i] = facts
+		}()
+	}
+	wg.Wait()
+
+	for _, facts := range results {
+		if facts != nil {
+			return facts
+		}
+	}
+	return nil
+}
+
+// metadataRequest makes a request to the metadata endpoint, returning the body of a successful response.
+func metadataRequest(ctx context.Context, client *http.Client, method string, path string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, cloudMetadataURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata request to %s returned %s", path, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// awsFacts reads the instance identity document, using an IMDSv2 session token.
+func awsFacts(ctx context.Context, client *http.Client) (Facts, error) {
+	token, err := metadataRequest(ctx, client, http.MethodPut, "/latest/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "60",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := metadataRequest(ctx, client, http.MethodGet, "/latest/dynamic/instance-identity/document", map[string]string{
+		"X-aws-ec2-metadata-token": string(token),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	document := struct {
+		AccountId        string `json:"accountId"`
+		InstanceId       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+	}{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+
+	return Facts{
+		FactCloudAccount:      document.AccountId,
+		FactCloudInstanceId:   document.InstanceId,
+		FactCloudInstanceType: document.InstanceType,
+		FactCloudRegion:       document.Region,
+		FactCloudZone:         document.AvailabilityZone,
+	}, nil
+}
+
+// gcpFacts reads the instance and project metadata.
+func gcpFacts(ctx context.Context, client *http.Client) (Facts, error) {
+	headers := map[string]string{"Metadata-Flavor": "Google"}
+
+	body, err := metadataRequest(ctx, client, http.MethodGet, "/computeMetadata/v1/instance/?recursive=true", headers)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := struct {
+		Id          json.Number `json:"id"`
+		Zone        string      `json:"zone"`
+		MachineType string      `json:"machineType"`
+	}{}
+	if err := json.Unmarshal(body, &instance); err != nil {
+		return nil, err
+	}
+
+	project, err := metadataRequest(ctx, client, http.MethodGet, "/computeMetadata/v1/project/project-id", headers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Zones and machine types are given as paths, such as projects/123/zones/europe-west2-a.
+	zone := lastSegment(instance.Zone)
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+
+	return Facts{
+		FactCloudAccount:      string(project),
+		FactCloudInstanceId:   instance.Id.String(),
+		FactCloudInstanceType: lastSegment(instance.MachineType),
+		FactCloudRegion:       region,
+		FactCloudZone:         zone,
+	}, nil
+}
+
+// azureFacts reads the compute metadata of the instance.
+func azureFacts(ctx context.Context, client *http.Client) (Facts, error) {
+	body, err := metadataRequest(ctx, client, http.MethodGet, "/metadata/instance/compute?api-version=2021-02-01&format=json", map[string]string{
+		"Metadata": "true",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	compute := struct {
+		SubscriptionId string `json:"subscriptionId"`
+		VmId           string `json:"vmId"`
+		VmSize         string `json:"vmSize"`
+		Location       string `json:"location"`
+		Zone           string `json:"zone"`
+	}{}
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return nil, err
+	}
+
+	return Facts{
+		FactCloudAccount:      compute.SubscriptionId,
+		FactCloudInstanceId:   compute.VmId,
+		FactCloudInstanceType: compute.VmSize,
+		FactCloudRegion:       compute.Location,
+		FactCloudZone:         compute.Zone,
+	}, nil
+}
+
+func lastSegment(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
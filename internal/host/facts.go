@@ -0,0 +1,122 @@
+// Package host collects facts about the machine the agent runs on, such as its hostname, operating system,
+// addresses, and cloud instance metadata.
+package host
+
+import (
+	"context"
+	"net"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Facts are keyed by name, such as `hostname` or `cloud_region`. Facts which couldn't be determined are omitted.
+type Facts map[string]string
+
+// Names of the facts which are collected.
+const (
+	FactHostname          = "hostname"
+	FactMachineId         = "machine_id"
+	FactOS                = "os"
+	FactArch              = "arch"
+	FactKernel            = "kernel"
+	FactIPs               = "ips"
+	FactCloudProvider     = "cloud_provider"
+	FactCloudAccount      = "cloud_account"
+	FactCloudInstanceId   = "cloud_instance_id"
+	FactCloudInstanceType = "cloud_instance_type"
+	FactCloudRegion       = "cloud_region"
+	FactCloudZone         = "cloud_zone"
+)
+
+// DefaultCloudTimeout is how long cloud metadata endpoints are given to respond. Outside a cloud, they
+// are usually unreachable, so this bounds how long collecting facts takes.
+const DefaultCloudTimeout = time.Second
+
+type Options struct {
+	// CloudMetadata enables querying the local instance metadata endpoints of AWS, GCP and Azure.
+	CloudMetadata bool
+	// CloudTimeout defaults to DefaultCloudTimeout.
+	CloudTimeout time.Duration
+}
+
+// machineIdPaths are where the machine id is read from, in order of preference.
+var machineIdPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// kernelReleasePath holds the kernel release on Linux.
+var kernelReleasePath = "/proc/sys/kernel/osrelease"
+
+// Collect returns the facts about the current host. Facts which can't be determined are left out, rather than
+// failing, as none of them are required.
+func Collect(ctx context.Context, opts Options) Facts {
+	facts := Facts{
+		FactOS:   runtime.GOOS,
+		FactArch: runtime.GOARCH,
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		facts[FactHostname] = hostname
+	}
+	for _, machineIdPath := range machineIdPaths {
+		if id := readTrimmed(machineIdPath); id != "" {
+			facts[FactMachineId] = id
+			break
+		}
+	}
+	if kernel := readTrimmed(kernelReleasePath); kernel != "" {
+		facts[FactKernel] = kernel
+	}
+	if ips := addresses(); len(ips) > 0 {
+		facts[FactIPs] = strings.Join(ips, ",")
+	}
+
+	if opts.CloudMetadata {
+		timeout := opts.CloudTimeout
+		if timeout == 0 {
+			timeout = DefaultCloudTimeout
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		for key, value := range cloudFacts(ctx) {
+			if value != "" {
+				facts[key] = value
+			}
+		}
+	}
+
+	return facts
+}
+
+func readTrimmed(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// addresses returns the host's IP addresses, sorted, excluding loopback and link-local addresses.
+func addresses() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	ips := []string{}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+			continue
+		}
+		ips = append(ips, ip.String())
+	}
+	slices.Sort(ips)
+	return ips
+}
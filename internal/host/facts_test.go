@@ -0,0 +1,129 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	machineId := filepath.Join(dir, "machine-id")
+	kernel := filepath.Join(dir, "osrelease")
+	assert.NoError(t, os.WriteFile(machineId, []byte("0123456789abcdef\n"), 0644))
+	assert.NoError(t, os.WriteFile(kernel, []byte("6.8.0-45-generic\n"), 0644))
+
+	previousMachineIdPaths, previousKernelReleasePath := machineIdPaths, kernelReleasePath
+	machineIdPaths = []string{filepath.Join(dir, "missing"), machineId}
+	kernelReleasePath = kernel
+	t.Cleanup(func() {
+		machineIdPaths, kernelReleasePath = previousMachineIdPaths, previousKernelReleasePath
+	})
+
+	facts := Collect(context.Background(), Options{})
+
+	hostname, _ := os.Hostname()
+	assert.Equal(t, hostname, facts[FactHostname])
+	assert.Equal(t, "0123456789abcdef", facts[FactMachineId])
+	assert.Equal(t, "6.8.0-45-generic", facts[FactKernel])
+	assert.Equal(t, runtime.GOOS, facts[FactOS])
+	assert.Equal(t, runtime.GOARCH, facts[FactArch])
+	assert.NotContains(t, facts, FactCloudProvider)
+}
+
+// serveMetadata replaces the cloud metadata endpoint with handler for the duration of the test.
+func serveMetadata(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	previous := cloudMetadataURL
+	cloudMetadataURL = server.URL
+	t.Cleanup(func() {
+		cloudMetadataURL = previous
+	})
+}
+
+func TestCollect_Cloud(t *testing.T) {
+	t.Run("AWS", func(t *testing.T) {
+		serveMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+				w.Write([]byte("token"))
+			case r.URL.Path == "/latest/dynamic/instance-identity/document" && r.Header.Get("X-aws-ec2-metadata-token") == "token":
+				w.Write([]byte(`{"accountId": "123456789012", "instanceId": "i-0abc", "instanceType": "t3.micro", "region": "eu-west-2", "availabilityZone": "eu-west-2a"}`))
+			default:
+				http.NotFound(w, r)
+			}
+		})
+
+		facts := Collect(context.Background(), Options{CloudMetadata: true})
+		assert.Equal(t, "aws", facts[FactCloudProvider])
+		assert.Equal(t, "123456789012", facts[FactCloudAccount])
+		assert.Equal(t, "i-0abc", facts[FactCloudInstanceId])
+		assert.Equal(t, "t3.micro", facts[FactCloudInstanceType])
+		assert.Equal(t, "eu-west-2", facts[FactCloudRegion])
+		assert.Equal(t, "eu-west-2a", facts[FactCloudZone])
+	})
+
+	t.Run("GCP", func(t *testing.T) {
+		serveMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				http.NotFound(w, r)
+				return
+			}
+			switch r.URL.Path {
+			case "/computeMetadata/v1/instance/":
+				w.Write([]byte(`{"id": 4520031799277581759, "zone": "projects/123/zones/europe-west2-a", "machineType": "projects/123/machineTypes/e2-medium"}`))
+			case "/computeMetadata/v1/project/project-id":
+				w.Write([]byte("compliance"))
+			default:
+				http.NotFound(w, r)
+			}
+		})
+
+		facts := Collect(context.Background(), Options{CloudMetadata: true})
+		assert.Equal(t, "gcp", facts[FactCloudProvider])
+		assert.Equal(t, "compliance", facts[FactCloudAccount])
+		assert.Equal(t, "4520031799277581759", facts[FactCloudInstanceId])
+		assert.Equal(t, "e2-medium", facts[FactCloudInstanceType])
+		assert.Equal(t, "europe-west2", facts[FactCloudRegion])
+		assert.Equal(t, "europe-west2-a", facts[FactCloudZone])
+	})
+
+	t.Run("Azure", func(t *testing.T) {
+		serveMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/metadata/instance/compute" || r.Header.Get("Metadata") != "true" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"subscriptionId": "sub", "vmId": "vm-1", "vmSize": "Standard_B1s", "location": "uksouth", "zone": "1"}`))
+		})
+
+		facts := Collect(context.Background(), Options{CloudMetadata: true})
+		assert.Equal(t, "azure", facts[FactCloudProvider])
+		assert.Equal(t, "vm-1", facts[FactCloudInstanceId])
+		assert.Equal(t, "uksouth", facts[FactCloudRegion])
+	})
+
+	t.Run("Unreachable endpoints are bounded by the timeout", func(t *testing.T) {
+		serveMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		})
+
+		start := time.Now()
+		facts := Collect(context.Background(), Options{CloudMetadata: true, CloudTimeout: 50 * time.Millisecond})
+		assert.Less(t, time.Since(start), 2*time.Second)
+		assert.NotContains(t, facts, FactCloudProvider)
+		assert.Contains(t, facts, FactOS)
+	})
+}
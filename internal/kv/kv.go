@@ -0,0 +1,111 @@
+// Package kv is a persistent key-value store, used by the agent to give each plugin a cache which survives
+// plugin processes and the agent restarting.
+package kv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MaxValueSize is the largest value which can be stored.
+const MaxValueSize = 1024 * 1024
+
+const entryFileExt = ".json"
+
+// entry is the on-disk format of a value.
+type entry struct {
+	Key     string     `json:"key"`
+	Value   []byte     `json:"value"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// Store keeps each value in its own file in a directory, named by the hash of its key, so keys can contain
+// anything. Writes replace the file atomically, so stores in the same directory can be used concurrently, such
+// as by several processes of the same plugin.
+type Store struct {
+	dir string
+	now func() time.Time
+}
+
+// Open opens the store in dir, creating it if necessary.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, now: time.Now}, nil
+}
+
+// Get returns the value of key, and whether it was found. Expired values are not found, and are removed.
+func (s *Store) Get(key string) ([]byte, bool, error) {
+	content, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	e := entry{}
+	if err := json.Unmarshal(content, &e); err != nil {
+		return nil, false, fmt.Errorf("reading %s: %w", key, err)
+	}
+	if e.Expires != nil && !s.now().Before(*e.Expires) {
+		return nil, false, s.Delete(key)
+	}
+	return e.Value, true, nil
+}
+
+// Set stores value as key, replacing any previous value. If ttl is positive the value expires after it,
+// otherwise it is kept until it is deleted.
+func (s *Store) Set(key string, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("ttl cannot be negative: %s", ttl)
+	}
+	if len(value) > MaxValueSize {
+		return fmt.Errorf("value of %d bytes exceeds the maximum of %d bytes", len(value), MaxValueSize)
+	}
+
+	e := entry{Key: key, Value: value}
+	if ttl > 0 {
+		expires := s.now().Add(ttl)
+		e.Expires = &expires
+	}
+	content, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(s.dir, "set-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+// Delete removes key. Deleting a key which isn't stored is not an error.
+func (s *Store) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *Store) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+entryFileExt)
+}
@@ -0,0 +1,61 @@
+package kv
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	s, err := Open(dir)
+	assert.NoError(t, err)
+
+	_, found, err := s.Get("missing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, s.Set("a/key with ../ anything", []byte("value"), 0))
+	value, found, err := s.Get("a/key with ../ anything")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("value"), value)
+
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	value, found, _ = reopened.Get("a/key with ../ anything")
+	assert.True(t, found, "Values persist")
+	assert.Equal(t, []byte("value"), value)
+
+	assert.NoError(t, s.Delete("a/key with ../ anything"))
+	_, found, _ = s.Get("a/key with ../ anything")
+	assert.False(t, found)
+	assert.NoError(t, s.Delete("a/key with ../ anything"), "Deleting a missing key is not an error")
+}
+
+func TestStore_Expiry(t *testing.T) {
+	s, err := Open(t.TempDir())
+	assert.NoError(t, err)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	assert.NoError(t, s.Set("key", []byte("value"), time.Minute))
+	_, found, _ := s.Get("key")
+	assert.True(t, found)
+
+	now = now.Add(time.Minute)
+	_, found, err = s.Get("key")
+	assert.NoError(t, err)
+	assert.False(t, found, "Values expire after their TTL")
+	assert.NoFileExists(t, s.path("key"), "Expired values are removed")
+}
+
+func TestStore_Limits(t *testing.T) {
+	s, err := Open(t.TempDir())
+	assert.NoError(t, err)
+
+	assert.Error(t, s.Set("key", []byte("value"), -time.Second))
+	assert.Error(t, s.Set("key", make([]byte, MaxValueSize+1), 0))
+}
@@ -2,11 +2,18 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/rego"
 	"io/fs"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 )
 
 func PolicyCompiler(ctx context.Context, policyPath string) *ast.Compiler {
@@ -28,3 +35,21 @@ func PolicyCompiler(ctx context.Context, policyPath string) *ast.Compiler {
 
 	return compiler
 }
+
+// BundleRevision returns the revision from the manifest of the policy bundle at bundlePath. It returns an empty
+// revision if bundlePath is not a directory, or the bundle has no manifest or revision.
+func BundleRevision(bundlePath string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(bundlePath, bundle.ManifestExt))
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	manifest := bundle.Manifest{}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return "", fmt.Errorf("reading bundle manifest in %s: %w", bundlePath, err)
+	}
+	return manifest.Revision, nil
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundleRevision(t *testing.T) {
+	writeFile := func(t *testing.T, path string, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v", path, err)
+		}
+	}
+
+	t.Run("Reads the revision from the manifest", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, ".manifest"), `{"revision": "2024.11.1", "roots": [""]}`)
+
+		revision, err := BundleRevision(dir)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if revision != "2024.11.1" {
+			t.Errorf("Expected revision 2024.11.1, got %q", revision)
+		}
+	})
+
+	t.Run("Returns no revision without a manifest", func(t *testing.T) {
+		revision, err := BundleRevision(t.TempDir())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if revision != "" {
+			t.Errorf("Expected no revision, got %q", revision)
+		}
+	})
+
+	t.Run("Returns no revision for a single policy file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "ssh.rego")
+		writeFile(t, file, "package ssh")
+
+		revision, err := BundleRevision(file)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if revision != "" {
+			t.Errorf("Expected no revision, got %q", revision)
+		}
+	})
+
+	t.Run("Returns an error for an invalid manifest", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, ".manifest"), "not json")
+
+		if _, err := BundleRevision(dir); err == nil {
+			t.Errorf("Expected an error for an invalid manifest")
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker is a circuit breaker. Once an operation has failed a number of times in a row, the breaker opens,
+// and the operation isn't attempted until a pause has passed. After that, a single trial attempt is allowed:
+// if it succeeds the breaker closes again, and if it fails the breaker opens for another pause.
+//
+// It is safe for concurrent use. A nil *Breaker is valid, and never opens.
+type Breaker struct {
+	// Failures is how many consecutive failures open the breaker.
+	Failures int
+	// Pause is how long the breaker stays open.
+	Pause time.Duration
+
+	mu          sync.Mutex
+	consecutive int
+	openUntil   time.Time
+	trial       bool
+}
+
+// Allow returns whether the operation may be attempted at now. If the breaker is open, it returns false and
+// when the breaker will allow a trial attempt. Once the pause has passed, only one caller is allowed to make
+// the trial attempt until it reports its outcome.
+func (b *Breaker) Allow(now time.Time) (bool, time.Time) {
+	if b == nil {
+		return true, time.Time{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true, time.Time{}
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false, b.openUntil
+	}
+	b.trial = true
+	return true, time.Time{}
+}
+
+// Success records the operation succeeding, which closes the breaker.
+func (b *Breaker) Success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutive = 0
+	b.openUntil = time.Time{}
+	b.trial = false
+}
+
+// Failure records the operation failing at now. It returns whether the breaker opened as a result.
+func (b *Breaker) Failure(now time.Time) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutive++
+	if b.trial || (b.Failures > 0 && b.consecutive >= b.Failures) {
+		b.openUntil = now.Add(b.Pause)
+		b.trial = false
+		return true
+	}
+	return false
+}
+
+// Open returns whether the breaker is open at now.
+func (b *Breaker) Open(now time.Time) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openUntil.IsZero() && now.Before(b.openUntil)
+}
@@ -0,0 +1,52 @@
+// Package retry provides retries with exponential backoff, and a circuit breaker, for plugins which fail
+// because something they depend on is unavailable.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Policy describes how an operation is retried.
+type Policy struct {
+	// Attempts is the total number of attempts, including the first. One or fewer means no retries.
+	Attempts int
+	// Backoff is the delay before the first retry. It doubles for each retry after that, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter is the maximum random delay added to each backoff, so many failing operations don't retry at once.
+	Jitter time.Duration
+}
+
+// Delay returns how long to wait after the given attempt fails, before the next one. Attempts start at 1.
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || delay < p.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+	return delay
+}
+
+// Retry returns whether another attempt should be made after the given attempt failed.
+func (p Policy) Retry(attempt int) bool {
+	return attempt < p.Attempts
+}
+
+// Sleep waits for d, returning early with the context's error if ctx is done first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,77 @@
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Delay(t *testing.T) {
+	p := Policy{Attempts: 5, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, p.Delay(1))
+	assert.Equal(t, 2*time.Second, p.Delay(2))
+	assert.Equal(t, 4*time.Second, p.Delay(3))
+	assert.Equal(t, 5*time.Second, p.Delay(4), "Backoff is capped")
+	assert.Equal(t, 5*time.Second, p.Delay(100))
+
+	p.Jitter = time.Second
+	for i := 0; i < 10; i++ {
+		delay := p.Delay(1)
+		assert.GreaterOrEqual(t, delay, time.Second)
+		assert.Less(t, delay, 2*time.Second)
+	}
+}
+
+func TestPolicy_Retry(t *testing.T) {
+	assert.False(t, Policy{}.Retry(1))
+	assert.True(t, Policy{Attempts: 3}.Retry(2))
+	assert.False(t, Policy{Attempts: 3}.Retry(3))
+}
+
+func TestSleep(t *testing.T) {
+	assert.NoError(t, Sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, Sleep(ctx, time.Hour), context.Canceled)
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := &Breaker{Failures: 2, Pause: time.Minute}
+
+	allowed, _ := b.Allow(now)
+	assert.True(t, allowed)
+	assert.False(t, b.Failure(now))
+	assert.True(t, b.Failure(now), "The breaker opens after consecutive failures")
+
+	allowed, until := b.Allow(now.Add(time.Second))
+	assert.False(t, allowed)
+	assert.Equal(t, now.Add(time.Minute), until)
+	assert.True(t, b.Open(now.Add(time.Second)))
+
+	// Once the pause has passed, a single trial is allowed.
+	later := now.Add(2 * time.Minute)
+	allowed, _ = b.Allow(later)
+	assert.True(t, allowed)
+	allowed, _ = b.Allow(later)
+	assert.False(t, allowed, "Only one trial is allowed at a time")
+
+	assert.True(t, b.Failure(later), "A failed trial opens the breaker again")
+	allowed, _ = b.Allow(later.Add(time.Second))
+	assert.False(t, allowed)
+
+	even := later.Add(2 * time.Minute)
+	allowed, _ = b.Allow(even)
+	assert.True(t, allowed)
+	b.Success()
+	assert.False(t, b.Open(even))
+	assert.False(t, b.Failure(even), "A success resets the consecutive failures")
+
+	var nilBreaker *Breaker
+	allowed, _ = nilBreaker.Allow(now)
+	assert.True(t, allowed)
+	assert.False(t, nilBreaker.Failure(now))
+}
@@ -0,0 +1,135 @@
+package sandbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cpuPeriod is the period in microseconds a plugin's CPU share is enforced over.
+const cpuPeriod = 100000
+
+// cgroup is the cgroup v2 a single plugin process runs in. A nil *cgroup is valid, and does nothing.
+type cgroup struct {
+	path string
+	dir  *os.File
+}
+
+// newCgroup creates a cgroup within opts.Cgroup enforcing the limits in opts, opened so a process can be
+// started in it.
+func newCgroup(opts Options) (*cgroup, error) {
+	limits := map[string]string{}
+	controllers := []string{}
+	if opts.Memory > 0 {
+		limits["memory.max"] = strconv.FormatInt(opts.Memory, 10)
+		limits["memory.swap.max"] = "0"
+		controllers = append(controllers, "+memory")
+	}
+	if opts.CPUs > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d %d", int64(opts.CPUs*cpuPeriod), cpuPeriod)
+		controllers = append(controllers, "+cpu")
+	}
+	if opts.Pids > 0 {
+		limits["pids.max"] = strconv.FormatInt(opts.Pids, 10)
+		controllers = append(controllers, "+pids")
+	}
+
+	// The controllers may already be enabled, or the parent may not allow enabling them, in which case
+	// setting the limits fails below with a clearer error.
+	if len(controllers) > 0 {
+		_ = os.WriteFile(filepath.Join(opts.Cgroup, "cgroup.subtree_control"), []byte(strings.Join(controllers, " ")), 0)
+	}
+
+	path, err := os.MkdirTemp(opts.Cgroup, "plugin-")
+	if err != nil {
+		return nil, fmt.Errorf("creating cgroup: %w", err)
+	}
+	cg := &cgroup{path: path}
+
+	for file, value := range limits {
+		err := os.WriteFile(filepath.Join(path, file), []byte(value), 0)
+		if file == "memory.swap.max" && errors.Is(err, fs.ErrNotExist) {
+			// Swap accounting is disabled, so there is no swap to limit.
+			continue
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			cg.remove()
+			return nil, fmt.Errorf("cgroup %s does not have the %s controller enabled", opts.Cgroup, strings.Split(file, ".")[0])
+		}
+		if err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("setting %s in cgroup: %w", file, err)
+		}
+	}
+
+	cg.dir, err = os.Open(path)
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	return cg, nil
+}
+
+func (cg *cgroup) fd() int {
+	return int(cg.dir.Fd())
+}
+
+// closeFD closes the cgroup directory, once a process has been started in it.
+func (cg *cgroup) closeFD() {
+	cg.dir.Close()
+}
+
+// kill kills every process in the cgroup, including any the plugin started.
+func (cg *cgroup) kill() {
+	if cg == nil {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(cg.path, "cgroup.kill"), []byte("1"), 0)
+}
+
+// remove removes the cgroup, once its processes have exited.
+func (cg *cgroup) remove() {
+	if cg == nil {
+		return
+	}
+	cg.kill()
+	_ = os.Remove(cg.path)
+}
+
+// exceeded returns the limit the cgroup's processes were stopped for exceeding, if any.
+func (cg *cgroup) exceeded() string {
+	if cg == nil {
+		return ""
+	}
+	if cg.event("memory.events", "oom_kill") > 0 {
+		return LimitMemory
+	}
+	if cg.event("pids.events", "max") > 0 {
+		return LimitPids
+	}
+	return ""
+}
+
+// event returns the count of an event in one of the cgroup's event files, or zero if it can't be read.
+func (cg *cgroup) event(file string, name string) int64 {
+	f, err := os.Open(filepath.Join(cg.path, file))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if ok && key == name {
+			count, _ := strconv.ParseInt(value, 10, 64)
+			return count
+		}
+	}
+	return 0
+}
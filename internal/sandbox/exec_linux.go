@@ -0,0 +1,179 @@
+package sandbox
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Exec is the sandbox helper. It is started by a Sandbox in place of the plugin, with arguments describing
+// the sandbox, and executes the plugin once it is set up. It only returns if the sandbox can't be set up.
+//
+// The helper is started in its own mount namespace when the plugin has a read-only view of the filesystem,
+// and as the agent's user, so it can make mounts before dropping privileges.
+func Exec(args []string) error {
+	flags := flag.NewFlagSet("sandbox-exec", flag.ContinueOnError)
+	readOnly := flags.Bool("read-only", false, "Make the filesystem read-only")
+	writable := flags.String("writable", "", "A directory which stays writable with a read-only filesystem")
+	memory := flags.Int64("memory", 0, "Maximum data segment size in bytes")
+	nproc := flags.Int64("nproc", 0, "Maximum processes of the user")
+	cpuTime := flags.Uint64("cpu-time", 0, "Maximum CPU time in seconds")
+	uid := flags.Int("uid", -1, "User to run as")
+	gid := flags.Int("gid", -1, "Group to run as")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("no plugin to execute")
+	}
+
+	if *readOnly {
+		if err := readOnlyFilesystem(*writable); err != nil {
+			return fmt.Errorf("making filesystem read-only: %w", err)
+		}
+	}
+
+	if *memory > 0 {
+		if err := setrlimit(syscall.RLIMIT_DATA, uint64(*memory), uint64(*memory)); err != nil {
+			return fmt.Errorf("limiting memory: %w", err)
+		}
+	}
+	if *nproc > 0 {
+		if err := setrlimit(rlimitNproc, uint64(*nproc), uint64(*nproc)); err != nil {
+			return fmt.Errorf("limiting processes: %w", err)
+		}
+	}
+	if *cpuTime > 0 {
+		// The soft limit stops the plugin with SIGXCPU, and the hard limit with SIGKILL if it handles that.
+		if err := setrlimit(syscall.RLIMIT_CPU, *cpuTime, *cpuTime+1); err != nil {
+			return fmt.Errorf("limiting cpu time: %w", err)
+		}
+	}
+
+	// The plugin is opened before dropping privileges, so only the plugin itself has to be executable by
+	// its user, not the directories it's in. The descriptor is deliberately inherited, so interpreters can
+	// open scripts through it.
+	pluginFd, err := syscall.Open(flags.Arg(0), syscall.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("opening plugin: %w", err)
+	}
+
+	if *gid >= 0 {
+		if err := syscall.Setgroups([]int{}); err != nil {
+			return fmt.Errorf("dropping supplementary groups: %w", err)
+		}
+		if err := syscall.Setgid(*gid); err != nil {
+			return fmt.Errorf("setting group: %w", err)
+		}
+	}
+	if *uid >= 0 {
+		if err := syscall.Setuid(*uid); err != nil {
+			return fmt.Errorf("setting user: %w", err)
+		}
+	}
+
+	return syscall.Exec(fmt.Sprintf("/proc/self/fd/%d", pluginFd), flags.Args(), os.Environ())
+}
+
+// rlimitNproc is RLIMIT_NPROC, which the syscall package doesn't define.
+const rlimitNproc = 0x6
+
+func setrlimit(resource int, soft uint64, hard uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: soft, Max: hard})
+}
+
+// readOnlyFilesystem remounts every mount read-only, except writable. Mounts within /proc and /sys are left
+// as they are, as they can't always be remounted and don't hold files.
+//
+// The helper must be in its own mount namespace, so the agent's mounts are unaffected.
+func readOnlyFilesystem(writable string) error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+	// Binding the writable directory to itself makes it a mount of its own, which is kept writable.
+	if writable != "" {
+		if err := syscall.Mount(writable, writable, "", syscall.MS_BIND, ""); err != nil {
+			return err
+		}
+	}
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, mount := range mounts {
+		if mount.path == writable || strings.HasPrefix(mount.path, "/proc/") || strings.HasPrefix(mount.path, "/sys/") {
+			continue
+		}
+		flags := syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY | mount.flags
+		if err := syscall.Mount("", mount.path, "", uintptr(flags), ""); err != nil {
+			return fmt.Errorf("%s: %w", mount.path, err)
+		}
+	}
+	return nil
+}
+
+type mountPoint struct {
+	path string
+	// flags are the mount's existing flags which must be kept when it is remounted.
+	flags int
+}
+
+var mountOptionFlags = map[string]int{
+	"nosuid":      syscall.MS_NOSUID,
+	"nodev":       syscall.MS_NODEV,
+	"noexec":      syscall.MS_NOEXEC,
+	"noatime":     syscall.MS_NOATIME,
+	"nodiratime":  syscall.MS_NODIRATIME,
+	"relatime":    syscall.MS_RELATIME,
+	"strictatime": syscall.MS_STRICTATIME,
+}
+
+// mountPoints returns the mounts in the helper's mount namespace, from /proc/self/mountinfo.
+func mountPoints() ([]mountPoint, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mounts := []mountPoint{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// See proc(5): the mount point is the fifth field, and its options the sixth.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		mount := mountPoint{path: unescapeMountPath(fields[4])}
+		for _, option := range strings.Split(fields[5], ",") {
+			mount.flags |= mountOptionFlags[option]
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath unescapes the octal escapes used for spaces and other characters in mountinfo paths.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	unescaped := strings.Builder{}
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		unescaped.WriteByte(path[i])
+	}
+	return unescaped.String()
+}
@@ -0,0 +1,99 @@
+// Package sandbox runs plugins with least privilege on Linux: as another user, with a clean environment,
+// limited memory, CPU and processes, a private temporary directory, and optionally a read-only view of the
+// filesystem.
+//
+// Plugins are started through a helper, which is the agent re-executing itself to call Exec. The helper sets up
+// everything which must be done from within the plugin's process, then executes the plugin in its place, so the
+// sandbox applies from the plugin's first instruction.
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var ErrUnsupported = errors.New("plugin sandboxing is only supported on Linux")
+
+// Limits which may be exceeded by a plugin.
+const (
+	LimitMemory  = "memory"
+	LimitCPUTime = "cpu time"
+	LimitPids    = "pids"
+)
+
+// LimitError is reported when a plugin was stopped for exceeding one of its limits.
+type LimitError struct {
+	Limit string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("plugin exceeded its %s limit", e.Limit)
+}
+
+// Options configures the sandbox for a plugin.
+type Options struct {
+	// User and Group the plugin runs as, as names or numeric ids. Group defaults to the user's primary group.
+	// Changing them requires the agent to run as root.
+	User  string
+	Group string
+
+	// Env lists the environment variables passed on to the plugin. No others are inherited from the agent.
+	Env []string
+
+	// Memory is the maximum memory in bytes the plugin may use.
+	Memory int64
+	// CPUs is the share of CPUs the plugin may use, such as 0.5 for half of one CPU. It requires a cgroup.
+	CPUs float64
+	// CPUTime is the total CPU time the plugin may use, after which it is stopped.
+	CPUTime time.Duration
+	// Pids is the maximum number of processes and threads the plugin may have. Without a cgroup, it limits
+	// every process of the plugin's user, so it requires a user.
+	Pids int64
+
+	// Cgroup is a cgroup v2 directory, delegated to the agent, which a cgroup is created in for each plugin
+	// process to enforce Memory, CPUs and Pids. Without it, Memory and Pids are enforced with rlimits.
+	Cgroup string
+
+	// PrivateTmp gives the plugin a temporary directory of its own, as TMPDIR.
+	PrivateTmp bool
+	// ReadOnly runs the plugin in a mount namespace where the whole filesystem is read-only, except its
+	// private temporary directory. It requires the agent to run as root.
+	ReadOnly bool
+}
+
+func (o Options) Validate() error {
+	if o.Memory < 0 {
+		return fmt.Errorf("memory cannot be negative: %d", o.Memory)
+	}
+	if o.CPUs < 0 {
+		return fmt.Errorf("cpus cannot be negative: %g", o.CPUs)
+	}
+	if o.CPUTime < 0 {
+		return fmt.Errorf("cpu time cannot be negative: %s", o.CPUTime)
+	}
+	if o.CPUTime > 0 && o.CPUTime < time.Second {
+		return fmt.Errorf("cpu time must be at least a second: %s", o.CPUTime)
+	}
+	if o.Pids < 0 {
+		return fmt.Errorf("pids cannot be negative: %d", o.Pids)
+	}
+	if o.CPUs > 0 && o.Cgroup == "" {
+		return errors.New("a cpus limit requires a cgroup")
+	}
+	if o.Pids > 0 && o.Cgroup == "" && o.User == "" {
+		return errors.New("a pids limit without a cgroup requires a user, as it limits every process of the user")
+	}
+	if o.Cgroup != "" {
+		if info, err := os.Stat(o.Cgroup); err != nil {
+			return fmt.Errorf("cgroup: %w", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("cgroup %s is not a directory", o.Cgroup)
+		}
+	}
+	if _, _, err := o.credentials(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	"github.com/hashicorp/go-plugin/runner"
+)
+
+// Sandbox runs a single plugin process. Create one for each process with New, configure the plugin client
+// with Configure, and Close it once the client has been killed.
+//
+// A nil *Sandbox is valid, and does nothing.
+type Sandbox struct {
+	opts   Options
+	helper []string
+
+	uid, gid int
+	// dir is the sandbox's private directory, which holds the plugin's sockets, and is its TMPDIR if it has a
+	// private temporary directory. It is the only directory the plugin can write to with a read-only view.
+	dir string
+
+	// process is the plugin process, once go-plugin has created it, and exited is closed once it has exited.
+	process *process
+	exited  chan struct{}
+}
+
+// New prepares a sandbox for a plugin process. helper is the command which calls Exec with its remaining
+// arguments, such as the agent's own executable and a hidden subcommand.
+func New(opts Options, helper []string) (*Sandbox, error) {
+	if len(helper) == 0 {
+		return nil, errors.New("no sandbox helper command")
+	}
+	uid, gid, err := opts.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "cf-plugin-")
+	if err != nil {
+		return nil, err
+	}
+	if uid >= 0 || gid >= 0 {
+		if err := os.Chown(dir, uid, gid); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	return &Sandbox{
+		opts:   opts,
+		helper: helper,
+		uid:    uid,
+		gid:    gid,
+		dir:    dir,
+		exited: make(chan struct{}),
+	}, nil
+}
+
+// credentials returns the uid and gid the plugin runs as, or -1 if they are unchanged.
+func (o Options) credentials() (int, int, error) {
+	uid, gid := -1, -1
+	if o.User != "" {
+		u, err := user.LookupId(o.User)
+		if err != nil {
+			u, err = user.Lookup(o.User)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("user %s: %w", o.User, err)
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+	if o.Group != "" {
+		g, err := user.LookupGroupId(o.Group)
+		if err != nil {
+			g, err = user.LookupGroup(o.Group)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("group %s: %w", o.Group, err)
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return uid, gid, nil
+}
+
+// Configure makes config run the plugin at path in the sandbox.
+func (s *Sandbox) Configure(config *plugin.ClientConfig, path string) {
+	config.Cmd = nil
+	config.SkipHostEnv = true
+	config.UnixSocketConfig = &plugin.UnixSocketConfig{TempDir: s.dir}
+	if s.gid >= 0 {
+		// The agent's sockets for host services are created in the sandbox's directory too, and must be
+		// writable by the plugin's group for the plugin to connect to them.
+		config.UnixSocketConfig.Group = strconv.Itoa(s.gid)
+	}
+	config.RunnerFunc = func(logger hclog.Logger, cmd *exec.Cmd, socketDir string) (runner.Runner, error) {
+		return s.runner(logger, cmd, socketDir, path)
+	}
+}
+
+// Violation returns a *LimitError if the plugin was stopped for exceeding one of its limits. As it is
+// usually called when the plugin has just failed, it waits up to timeout for the plugin to exit first.
+func (s *Sandbox) Violation(timeout time.Duration) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case <-s.exited:
+	case <-time.After(timeout):
+		return nil
+	}
+	if s.process == nil || s.process.cmd.ProcessState == nil {
+		return nil
+	}
+	return s.process.violation()
+}
+
+// Close removes the sandbox's private directory. The plugin must have exited.
+func (s *Sandbox) Close() error {
+	if s == nil {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// env returns the plugin's environment: the allowed variables from the agent's environment, followed by
+// the go-plugin variables in pluginEnv.
+func (s *Sandbox) env(pluginEnv []string) []string {
+	env := []string{}
+	for _, name := range s.opts.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	if s.opts.PrivateTmp {
+		env = append(env, "TMPDIR="+s.dir)
+	}
+	return append(env, pluginEnv...)
+}
+
+// helperArgs returns the arguments to the helper to execute the plugin at path.
+func (s *Sandbox) helperArgs(path string) []string {
+	args := append([]string{}, s.helper[1:]...)
+	if s.opts.ReadOnly {
+		args = append(args, "-read-only", "-writable", s.dir)
+	}
+	if s.opts.Cgroup == "" && s.opts.Memory > 0 {
+		args = append(args, "-memory", strconv.FormatInt(s.opts.Memory, 10))
+	}
+	if s.opts.Cgroup == "" && s.opts.Pids > 0 {
+		args = append(args, "-nproc", strconv.FormatInt(s.opts.Pids, 10))
+	}
+	if s.opts.CPUTime > 0 {
+		args = append(args, "-cpu-time", strconv.FormatInt(int64(s.opts.CPUTime/time.Second), 10))
+	}
+	if s.uid >= 0 {
+		args = append(args, "-uid", strconv.Itoa(s.uid))
+	}
+	if s.gid >= 0 {
+		args = append(args, "-gid", strconv.Itoa(s.gid))
+	}
+	return append(args, "--", path)
+}
+
+func (s *Sandbox) runner(logger hclog.Logger, pluginCmd *exec.Cmd, socketDir string, path string) (runner.Runner, error) {
+	if s.uid >= 0 || s.gid >= 0 {
+		if err := os.Chown(socketDir, s.uid, s.gid); err != nil {
+			return nil, err
+		}
+	}
+
+	cmd := exec.Command(s.helper[0], s.helperArgs(path)...)
+	cmd.Env = s.env(pluginCmd.Env)
+	cmd.Stdin = pluginCmd.Stdin
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if s.opts.ReadOnly {
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWNS
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	s.process = &process{
+		sandbox: s,
+		logger:  logger,
+		cmd:     cmd,
+		path:    path,
+		stdout:  stdout,
+		stderr:  &stderrWatcher{ReadCloser: stderr},
+	}
+	return s.process, nil
+}
+
+// process runs a plugin through the sandbox helper, for go-plugin.
+type process struct {
+	sandbox *Sandbox
+	logger  hclog.Logger
+	cmd     *exec.Cmd
+	path    string
+	cgroup  *cgroup
+	pid     int
+	// cgroupLimit is the limit the cgroup reported was exceeded, read before the cgroup is removed.
+	cgroupLimit string
+
+	stdout io.ReadCloser
+	stderr *stderrWatcher
+
+	waitOnce sync.Once
+	waitErr  error
+}
+
+var _ runner.Runner = (*process)(nil)
+
+func (p *process) Start(_ context.Context) error {
+	if p.sandbox.opts.Cgroup != "" {
+		cg, err := newCgroup(p.sandbox.opts)
+		if err != nil {
+			close(p.sandbox.exited)
+			return err
+		}
+		defer cg.closeFD()
+		p.cgroup = cg
+		p.cmd.SysProcAttr.UseCgroupFD = true
+		p.cmd.SysProcAttr.CgroupFD = cg.fd()
+	}
+
+	p.logger.Debug("starting sandboxed plugin", "path", p.path, "args", p.cmd.Args)
+	if err := p.cmd.Start(); err != nil {
+		p.cgroup.remove()
+		close(p.sandbox.exited)
+		return err
+	}
+	p.pid = p.cmd.Process.Pid
+	p.logger.Debug("plugin started", "path", p.path, "pid", p.pid)
+	return nil
+}
+
+func (p *process) Wait(_ context.Context) error {
+	p.waitOnce.Do(func() {
+		p.waitErr = p.cmd.Wait()
+		p.cgroupLimit = p.cgroup.exceeded()
+		p.cgroup.remove()
+		close(p.sandbox.exited)
+	})
+	return p.waitErr
+}
+
+// violation returns the limit the plugin exceeded, if it was stopped for exceeding one. The plugin must
+// have exited.
+func (p *process) violation() error {
+	if p.cgroupLimit != "" {
+		return &LimitError{Limit: p.cgroupLimit}
+	}
+
+	state := p.cmd.ProcessState
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || state.Success() {
+		return nil
+	}
+
+	// Without a cgroup, exceeding the memory limit makes allocations fail rather than stopping the plugin, so
+	// we rely on the Go runtime reporting it.
+	if p.stderr.outOfMemory.Load() {
+		return &LimitError{Limit: LimitMemory}
+	}
+
+	if !status.Signaled() {
+		return nil
+	}
+	// The soft CPU time limit sends SIGXCPU, and the hard limit a second later sends SIGKILL.
+	cpuTime := p.sandbox.opts.CPUTime
+	if status.Signal() == syscall.SIGXCPU ||
+		(status.Signal() == syscall.SIGKILL && cpuTime > 0 && state.UserTime()+state.SystemTime() >= cpuTime) {
+		return &LimitError{Limit: LimitCPUTime}
+	}
+	return nil
+}
+
+func (p *process) Kill(_ context.Context) error {
+	p.cgroup.kill()
+	if p.cmd.Process != nil {
+		err := p.cmd.Process.Kill()
+		if !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *process) Stdout() io.ReadCloser {
+	return p.stdout
+}
+
+func (p *process) Stderr() io.ReadCloser {
+	return p.stderr
+}
+
+func (p *process) Name() string {
+	return p.path
+}
+
+func (p *process) ID() string {
+	return strconv.Itoa(p.pid)
+}
+
+func (p *process) Diagnose(_ context.Context) string {
+	return "The plugin failed to start in its sandbox. Check the plugin is executable by its user, and that the " +
+		"agent has the privileges its sandbox options require."
+}
+
+func (p *process) PluginToHost(pluginNet, pluginAddr string) (string, string, error) {
+	return pluginNet, pluginAddr, nil
+}
+
+func (p *process) HostToPlugin(hostNet, hostAddr string) (string, string, error) {
+	return hostNet, hostAddr, nil
+}
+
+// outOfMemory is how the Go runtime reports an allocation failing, such as when a plugin reaches its memory
+// rlimit: `fatal error: runtime: out of memory`.
+var outOfMemory = []byte("out of memory")
+
+// stderrWatcher watches a plugin's error output, which go-plugin reads to forward its logs, for the Go runtime
+// running out of memory.
+type stderrWatcher struct {
+	io.ReadCloser
+	outOfMemory atomic.Bool
+	// tail is the end of the previous read, in case the message is split across reads.
+	tail []byte
+}
+
+func (w *stderrWatcher) Read(p []byte) (int, error) {
+	n, err := w.ReadCloser.Read(p)
+	if n > 0 && !w.outOfMemory.Load() {
+		data := append(w.tail, p[:n]...)
+		if bytes.Contains(data, outOfMemory) {
+			w.outOfMemory.Store(true)
+		}
+		w.tail = append(w.tail[:0], data[max(0, len(data)-len(outOfMemory)):]...)
+	}
+	return n, err
+}
@@ -0,0 +1,161 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHelperProcess isn't a real test. It is the sandbox helper when the test binary is re-executed by a
+// sandbox in the tests below.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("CF_SANDBOX_TEST_HELPER") != "1" {
+		return
+	}
+	if err := Exec(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// testSandbox creates a sandbox which uses the test binary as its helper.
+func testSandbox(t *testing.T, opts Options) *Sandbox {
+	t.Helper()
+	t.Setenv("CF_SANDBOX_TEST_HELPER", "1")
+	opts.Env = append(opts.Env, "CF_SANDBOX_TEST_HELPER")
+
+	s, err := New(opts, []string{os.Args[0], "-test.run=^TestHelperProcess$", "--"})
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, s.Close())
+	})
+	return s
+}
+
+// runScript runs a shell script as a plugin in the sandbox, returning its output and the error it exited with.
+func runScript(t *testing.T, s *Sandbox, script string) (string, error) {
+	t.Helper()
+	plugin := filepath.Join(t.TempDir(), "plugin")
+	assert.NoError(t, os.WriteFile(plugin, []byte("#!/bin/sh\n"+script), 0755))
+
+	socketDir, err := os.MkdirTemp(s.dir, "plugin-dir")
+	assert.NoError(t, err)
+
+	r, err := s.runner(hclog.NewNullLogger(), exec.Command(""), socketDir, plugin)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Start(context.Background()))
+
+	stderr, _ := io.ReadAll(r.Stderr())
+	stdout, _ := io.ReadAll(r.Stdout())
+	err = r.Wait(context.Background())
+	if len(stderr) > 0 {
+		t.Logf("stderr: %s", stderr)
+	}
+	return string(stdout), err
+}
+
+func requireRoot(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("sandboxing as another user or with a read-only filesystem requires root")
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	assert.NoError(t, Options{Memory: 1 << 30, CPUTime: time.Minute, PrivateTmp: true}.Validate())
+
+	assert.ErrorContains(t, Options{Memory: -1}.Validate(), "memory")
+	assert.ErrorContains(t, Options{CPUTime: time.Millisecond}.Validate(), "at least a second")
+	assert.ErrorContains(t, Options{CPUs: 0.5}.Validate(), "requires a cgroup")
+	assert.ErrorContains(t, Options{Pids: 10}.Validate(), "requires a user")
+	assert.ErrorContains(t, Options{Cgroup: filepath.Join(t.TempDir(), "missing")}.Validate(), "cgroup")
+	assert.ErrorContains(t, Options{User: "cf-no-such-user"}.Validate(), "cf-no-such-user")
+}
+
+func TestSandbox_Environment(t *testing.T) {
+	t.Setenv("CF_ALLOWED", "allowed")
+	t.Setenv("CF_SECRET", "secret")
+
+	s := testSandbox(t, Options{Env: []string{"CF_ALLOWED", "PATH"}, PrivateTmp: true})
+	out, err := runScript(t, s, `echo "allowed=$CF_ALLOWED secret=$CF_SECRET tmp=$TMPDIR"`)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("allowed=allowed secret= tmp=%s\n", s.dir), out)
+}
+
+func TestSandbox_CPUTime(t *testing.T) {
+	s := testSandbox(t, Options{CPUTime: time.Second})
+	_, err := runScript(t, s, `while :; do :; done`)
+	assert.Error(t, err)
+
+	violation := s.Violation(time.Second)
+	limitErr := &LimitError{}
+	assert.True(t, errors.As(violation, &limitErr), "Expected a limit error, got %v", violation)
+	assert.Equal(t, LimitCPUTime, limitErr.Limit)
+}
+
+func TestSandbox_NoViolation(t *testing.T) {
+	s := testSandbox(t, Options{CPUTime: time.Minute})
+	_, err := runScript(t, s, `exit 3`)
+	assert.Error(t, err)
+	assert.NoError(t, s.Violation(time.Second))
+}
+
+func TestSandbox_User(t *testing.T) {
+	requireRoot(t)
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+
+	s := testSandbox(t, Options{User: "nobody", PrivateTmp: true})
+	out, err := runScript(t, s, `id -u; touch "$TMPDIR/file" && echo writable; cat /proc/self/status | grep -q '^Groups:\s*$' && echo no-groups`)
+	assert.NoError(t, err)
+	assert.Equal(t, nobody.Uid+"\nwritable\nno-groups\n", out)
+}
+
+func TestSandbox_ReadOnly(t *testing.T) {
+	requireRoot(t)
+
+	writable := filepath.Join(t.TempDir(), "file")
+	s := testSandbox(t, Options{ReadOnly: true, PrivateTmp: true})
+	out, err := runScript(t, s, fmt.Sprintf(`touch %s 2>/dev/null || echo read-only; touch "$TMPDIR/file" && echo private-writable`, writable))
+	assert.NoError(t, err)
+	assert.Equal(t, "read-only\nprivate-writable\n", out)
+
+	_, err = os.Stat(writable)
+	assert.True(t, os.IsNotExist(err))
+
+	// The agent's own filesystem is unaffected.
+	assert.NoError(t, os.WriteFile(writable, []byte("agent"), 0644))
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	assert.Equal(t, "/mnt/with space", unescapeMountPath(`/mnt/with\040space`))
+	assert.Equal(t, "/plain", unescapeMountPath("/plain"))
+	assert.True(t, strings.HasSuffix(unescapeMountPath(`/trailing\`), `\`))
+}
+
+func TestStderrWatcher(t *testing.T) {
+	w := &stderrWatcher{ReadCloser: io.NopCloser(strings.NewReader("fatal error: runtime: out of mem"))}
+	_, _ = io.ReadAll(w)
+	assert.False(t, w.outOfMemory.Load())
+
+	// The message is still found when it is split across reads.
+	w = &stderrWatcher{ReadCloser: io.NopCloser(io.MultiReader(
+		strings.NewReader("fatal error: runtime: out of m"),
+		strings.NewReader("emory\n"),
+	))}
+	_, _ = io.ReadAll(w)
+	assert.True(t, w.outOfMemory.Load())
+}
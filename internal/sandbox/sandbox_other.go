@@ -0,0 +1,36 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"time"
+
+	"github.com/hashicorp/go-plugin"
+)
+
+// Sandbox runs a single plugin process. Sandboxing is only supported on Linux, so New always fails.
+//
+// A nil *Sandbox is valid, and does nothing.
+type Sandbox struct{}
+
+func New(opts Options, helper []string) (*Sandbox, error) {
+	return nil, ErrUnsupported
+}
+
+func (o Options) credentials() (int, int, error) {
+	return 0, 0, ErrUnsupported
+}
+
+func (s *Sandbox) Configure(config *plugin.ClientConfig, path string) {}
+
+func (s *Sandbox) Violation(timeout time.Duration) error {
+	return nil
+}
+
+func (s *Sandbox) Close() error {
+	return nil
+}
+
+func Exec(args []string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,229 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/robfig/cron/v3"
+)
+
+// parser accepts standard 5 field cron expressions, as well as descriptors such as
+// `@hourly`, `@daily` and `@every 5m`.
+var parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Parse validates a schedule string, returning an error if it cannot be used by the Scheduler.
+func Parse(schedule string) (cron.Schedule, error) {
+	sched, err := parser.Parse(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", schedule, err)
+	}
+	return sched, nil
+}
+
+// Job is a unit of work which should be run on a schedule.
+//
+// Key uniquely identifies the job, so it can be replaced or removed when configuration changes.
+// Jitter is the maximum random delay added before each run, to avoid every job (or every agent in a fleet)
+// firing at exactly the same time.
+type Job struct {
+	Key      string
+	Schedule string
+	Jitter   time.Duration
+	Run      func()
+}
+
+type entry struct {
+	id       cron.EntryID
+	schedule string
+	jitter   time.Duration
+	run      func()
+}
+
+// Scheduler runs a set of keyed jobs, each on their own schedule.
+// A job will never run concurrently with itself; if a previous run is still in progress, the next run is skipped.
+type Scheduler struct {
+	logger hclog.Logger
+	cron   *cron.Cron
+
+	mu      sync.Mutex
+	entries map[string]entry
+	// running holds a lock for each job key, held while the job runs. Locks outlive the entries of rescheduled
+	// jobs, so a run started under a job's previous schedule still causes overlapping runs to be skipped.
+	running map[string]*sync.Mutex
+	// runs tracks jobs started by RunAll, which cron doesn't wait for when stopped.
+	runs sync.WaitGroup
+
+	// stopped is closed when the scheduler is stopped, to interrupt jobs waiting on their jitter.
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func New(logger hclog.Logger) *Scheduler {
+	cronLogger := &cronLogger{logger: logger}
+	return &Scheduler{
+		logger: logger,
+		cron: cron.New(
+			cron.WithParser(parser),
+			cron.WithLogger(cronLogger),
+		),
+		entries: map[string]entry{},
+		running: map[string]*sync.Mutex{},
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start begins running scheduled jobs in the background.
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// RunAll starts a run of every job in the background, without waiting for their schedules, such as when the
+// agent starts. Jitter is still applied, and jobs which are already running are skipped.
+func (s *Scheduler) RunAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.stopped:
+		return
+	default:
+	}
+
+	for _, existing := range s.entries {
+		s.runs.Add(1)
+		go func() {
+			defer s.runs.Done()
+			existing.run()
+		}()
+	}
+}
+
+// Stop prevents any further jobs from being started. Jobs still waiting on their jitter are skipped.
+// The returned context is done once all running jobs have completed.
+func (s *Scheduler) Stop() context.Context {
+	s.mu.Lock()
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+	})
+	s.mu.Unlock()
+
+	cronDone := s.cron.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-cronDone.Done()
+		s.runs.Wait()
+		cancel()
+	}()
+	return ctx
+}
+
+// Replace swaps the set of scheduled jobs for the ones passed.
+//
+// Jobs whose key, schedule and jitter are unchanged keep their place in the timetable, new jobs are added,
+// and jobs which are no longer present are removed. Running jobs are not interrupted.
+// All schedules are validated first, and if any are invalid no changes are made.
+func (s *Scheduler) Replace(jobs []Job) error {
+	for _, job := range jobs {
+		if _, err := Parse(job.Schedule); err != nil {
+			return fmt.Errorf("job %s: %w", job.Key, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := map[string]struct{}{}
+	for _, job := range jobs {
+		wanted[job.Key] = struct{}{}
+
+		if existing, ok := s.entries[job.Key]; ok {
+			if existing.schedule == job.Schedule && existing.jitter == job.Jitter {
+				continue
+			}
+			s.cron.Remove(existing.id)
+		}
+
+		run := s.skipIfRunning(job.Key, s.withJitter(job.Jitter, job.Run))
+		id, err := s.cron.AddFunc(job.Schedule, run)
+		if err != nil {
+			return err
+		}
+		s.entries[job.Key] = entry{
+			id:       id,
+			schedule: job.Schedule,
+			jitter:   job.Jitter,
+			run:      run,
+		}
+		s.logger.Debug("Scheduled job", "job", job.Key, "schedule", job.Schedule, "jitter", job.Jitter)
+	}
+
+	for key, existing := range s.entries {
+		if _, ok := wanted[key]; !ok {
+			s.cron.Remove(existing.id)
+			delete(s.entries, key)
+			s.logger.Debug("Removed scheduled job", "job", key)
+		}
+	}
+
+	return nil
+}
+
+// Next returns the next time the job with the given key is due to run.
+func (s *Scheduler) Next(key string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.entries[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return s.cron.Entry(existing.id).Next, true
+}
+
+// skipIfRunning skips runs of the job with the given key while a previous run is in progress, including runs
+// started before the job was rescheduled. The caller must hold s.mu.
+func (s *Scheduler) skipIfRunning(key string, run func()) func() {
+	running, ok := s.running[key]
+	if !ok {
+		running = &sync.Mutex{}
+		s.running[key] = running
+	}
+	return func() {
+		if !running.TryLock() {
+			s.logger.Debug("Skipping job, as its previous run is still in progress", "job", key)
+			return
+		}
+		defer running.Unlock()
+		run()
+	}
+}
+
+func (s *Scheduler) withJitter(jitter time.Duration, run func()) func() {
+	if jitter <= 0 {
+		return run
+	}
+	return func() {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(jitter)))):
+			run()
+		case <-s.stopped:
+		}
+	}
+}
+
+// cronLogger adapts hclog to the logger interface expected by cron.
+type cronLogger struct {
+	logger hclog.Logger
+}
+
+func (l *cronLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Trace(msg, keysAndValues...)
+}
+
+func (l *cronLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, append(keysAndValues, "error", err)...)
+}
@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		valid    bool
+	}{
+		{name: "Standard cron expression", schedule: "*/5 * * * *", valid: true},
+		{name: "Every duration", schedule: "@every 5m", valid: true},
+		{name: "Descriptor", schedule: "@daily", valid: true},
+		{name: "Seconds field is not supported", schedule: "0 */5 * * * *", valid: false},
+		{name: "Invalid duration", schedule: "@every five minutes", valid: false},
+		{name: "Empty schedule", schedule: "", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.schedule)
+			if (err == nil) != tt.valid {
+				t.Errorf("Parse(%q): expected validity %v, got %v", tt.schedule, tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestScheduler_Replace(t *testing.T) {
+	t.Run("Adds and removes jobs", func(t *testing.T) {
+		s := New(hclog.NewNullLogger())
+
+		err := s.Replace([]Job{
+			{Key: "one", Schedule: "@every 1m", Run: func() {}},
+			{Key: "two", Schedule: "@every 1m", Run: func() {}},
+		})
+		assert.NoError(t, err)
+
+		_, ok := s.Next("one")
+		assert.True(t, ok)
+		_, ok = s.Next("two")
+		assert.True(t, ok)
+
+		err = s.Replace([]Job{
+			{Key: "two", Schedule: "@every 1m", Run: func() {}},
+		})
+		assert.NoError(t, err)
+
+		_, ok = s.Next("one")
+		assert.False(t, ok)
+		_, ok = s.Next("two")
+		assert.True(t, ok)
+	})
+
+	t.Run("Keeps unchanged jobs in place", func(t *testing.T) {
+		s := New(hclog.NewNullLogger())
+
+		assert.NoError(t, s.Replace([]Job{{Key: "one", Schedule: "@daily", Run: func() {}}}))
+		before := s.entries["one"].id
+
+		assert.NoError(t, s.Replace([]Job{{Key: "one", Schedule: "@daily", Run: func() {}}}))
+		assert.Equal(t, before, s.entries["one"].id)
+
+		assert.NoError(t, s.Replace([]Job{{Key: "one", Schedule: "@hourly", Run: func() {}}}))
+		assert.NotEqual(t, before, s.entries["one"].id)
+	})
+
+	t.Run("Rescheduled jobs don't overlap runs under their previous schedule", func(t *testing.T) {
+		s := New(hclog.NewNullLogger())
+
+		release := make(chan struct{})
+		runs := make(chan struct{}, 2)
+		run := func() {
+			runs <- struct{}{}
+			<-release
+		}
+
+		assert.NoError(t, s.Replace([]Job{{Key: "one", Schedule: "@daily", Run: run}}))
+		before := s.entries["one"].run
+		done := make(chan struct{})
+		go func() {
+			before()
+			close(done)
+		}()
+		<-runs
+
+		assert.NoError(t, s.Replace([]Job{{Key: "one", Schedule: "@hourly", Run: run}}))
+		s.entries["one"].run()
+
+		close(release)
+		<-done
+		assert.Len(t, runs, 0, "Expected the run under the new schedule to be skipped")
+	})
+
+	t.Run("Invalid schedules make no changes", func(t *testing.T) {
+		s := New(hclog.NewNullLogger())
+
+		assert.NoError(t, s.Replace([]Job{{Key: "one", Schedule: "@daily", Run: func() {}}}))
+
+		err := s.Replace([]Job{
+			{Key: "two", Schedule: "@daily", Run: func() {}},
+			{Key: "three", Schedule: "not a schedule", Run: func() {}},
+		})
+		assert.Error(t, err)
+
+		_, ok := s.Next("one")
+		assert.True(t, ok)
+		_, ok = s.Next("two")
+		assert.False(t, ok)
+	})
+}
+
+func TestScheduler_Run(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	s := New(hclog.NewNullLogger())
+
+	ran := make(chan struct{}, 1)
+	err := s.Replace([]Job{
+		{Key: "one", Schedule: "@every 1s", Jitter: 100 * time.Millisecond, Run: func() {
+			select {
+			case ran <- struct{}{}:
+			default:
+			}
+		}},
+	})
+	assert.NoError(t, err)
+
+	s.Start()
+	defer s.Stop()
+
+	select {
+	case <-ran:
+	case <-time.After(3 * time.Second):
+		t.Error("Expected scheduled job to run")
+	}
+}
+
+func TestScheduler_RunAll(t *testing.T) {
+	s := New(hclog.NewNullLogger())
+
+	release := make(chan struct{})
+	ran := make(chan string, 2)
+	run := func(key string) func() {
+		return func() {
+			ran <- key
+			<-release
+		}
+	}
+	assert.NoError(t, s.Replace([]Job{
+		{Key: "one", Schedule: "@daily", Run: run("one")},
+		{Key: "two", Schedule: "@daily", Run: run("two")},
+	}))
+
+	s.RunAll()
+	assert.ElementsMatch(t, []string{"one", "two"}, []string{<-ran, <-ran})
+
+	stopped := s.Stop()
+	select {
+	case <-stopped.Done():
+		t.Fatal("Expected Stop to wait for the jobs started by RunAll")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-stopped.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected Stop to return once the jobs started by RunAll finished")
+	}
+
+	s.RunAll()
+	assert.Len(t, ran, 0, "Expected no jobs to be run once the scheduler is stopped")
+}
+
+func TestScheduler_Stop(t *testing.T) {
+	s := New(hclog.NewNullLogger())
+
+	ran := false
+	run := s.withJitter(time.Hour, func() {
+		ran = true
+	})
+
+	done := make(chan struct{})
+	go func() {
+		run()
+		close(done)
+	}()
+
+	<-s.Stop().Done()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected job waiting on jitter to return when the scheduler is stopped")
+	}
+	assert.False(t, ran)
+}
@@ -0,0 +1,127 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Redactor replaces secrets in text with Redacted. Secrets are added as they are resolved, so anything
+// logged or published afterwards is redacted. It is safe for concurrent use.
+//
+// A nil *Redactor is valid, and redacts nothing.
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  map[string]struct{}
+	replacer *strings.Replacer
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{
+		secrets:  map[string]struct{}{},
+		replacer: strings.NewReplacer(),
+	}
+}
+
+// Add adds secrets to be redacted. Empty secrets are ignored. Secrets are also redacted where they have
+// been escaped, such as in JSON messages and quoted log values.
+func (r *Redactor) Add(secrets ...string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	added := false
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		for _, variant := range escaped(secret) {
+			if _, ok := r.secrets[variant]; ok {
+				continue
+			}
+			r.secrets[variant] = struct{}{}
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// Longer secrets are replaced first, so a secret containing another is redacted completely.
+	all := make([]string, 0, len(r.secrets))
+	for secret := range r.secrets {
+		all = append(all, secret)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return len(all[i]) > len(all[j])
+	})
+	pairs := make([]string, 0, 2*len(all))
+	for _, secret := range all {
+		pairs = append(pairs, secret, Redacted)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// escaped returns secret, and the ways it may be escaped when it's logged or published.
+func escaped(secret string) []string {
+	variants := []string{secret}
+	if quoted := strconv.Quote(secret); quoted[1:len(quoted)-1] != secret {
+		variants = append(variants, quoted[1:len(quoted)-1])
+	}
+	if encoded, err := json.Marshal(secret); err == nil && string(encoded[1:len(encoded)-1]) != secret {
+		variants = append(variants, string(encoded[1:len(encoded)-1]))
+	}
+	return variants
+}
+
+// Redact returns s with every known secret replaced.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.replacer.Replace(s)
+}
+
+// RedactError returns err with every known secret replaced in its message. If nothing was replaced,
+// err is returned as it is, so it can still be inspected with errors.Is and errors.As.
+func (r *Redactor) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	if redacted := r.Redact(message); redacted != message {
+		return errors.New(redacted)
+	}
+	return err
+}
+
+// Writer returns a writer which redacts everything written before passing it to w. Each write is redacted
+// separately, which suits loggers writing a line at a time.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return &redactingWriter{redactor: r, w: w}
+}
+
+type redactingWriter struct {
+	redactor *Redactor
+	w        io.Writer
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
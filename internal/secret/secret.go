@@ -0,0 +1,131 @@
+// Package secret resolves references to secrets in configuration values, such as ${env:GITHUB_TOKEN}, and
+// redacts the resolved values wherever they might otherwise be logged or published.
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of secret reference.
+const (
+	// KindEnv reads an environment variable: ${env:NAME}
+	KindEnv = "env"
+	// KindFile reads a file, without its trailing newline: ${file:/run/secrets/token}
+	KindFile = "file"
+	// KindExec runs a command, using its output without the trailing newline: ${exec:/usr/local/bin/get-secret name}
+	KindExec = "exec"
+)
+
+// ExecTimeout is how long an exec reference may take to produce its secret.
+const ExecTimeout = 30 * time.Second
+
+// Redacted replaces secrets in logs and published messages.
+const Redacted = "(redacted)"
+
+var referencePattern = regexp.MustCompile(`\$\{(env|file|exec):([^}]*)\}`)
+
+// Reference is a reference to a secret in a configuration value.
+type Reference struct {
+	Kind string
+	// Target is the variable name, file path, or command line of the reference.
+	Target string
+}
+
+func (r Reference) String() string {
+	return fmt.Sprintf("${%s:%s}", r.Kind, r.Target)
+}
+
+// References returns the secret references in value, or an error if any of them is incomplete.
+func References(value string) ([]Reference, error) {
+	refs := []Reference{}
+	for _, match := range referencePattern.FindAllStringSubmatch(value, -1) {
+		ref := Reference{Kind: match[1], Target: strings.TrimSpace(match[2])}
+		if ref.Target == "" {
+			return nil, fmt.Errorf("secret reference %s is missing its %s", match[0], ref.targetName())
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+func (r Reference) targetName() string {
+	switch r.Kind {
+	case KindEnv:
+		return "variable name"
+	case KindFile:
+		return "path"
+	}
+	return "command"
+}
+
+// Resolve replaces every secret reference in value with the secret it refers to, returning the resolved value
+// and the secrets it contains, so they can be redacted. Values without references are returned unchanged.
+//
+// Errors describe the reference which couldn't be resolved, but never include a secret.
+func Resolve(ctx context.Context, value string) (string, []string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil, nil
+	}
+
+	secrets := []string{}
+	errs := []error{}
+	resolved := referencePattern.ReplaceAllStringFunc(value, func(match string) string {
+		refs, err := References(match)
+		if err != nil {
+			errs = append(errs, err)
+			return match
+		}
+		secret, err := refs[0].resolve(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolving secret %s: %w", refs[0], err))
+			return match
+		}
+		secrets = append(secrets, secret)
+		return secret
+	})
+	if len(errs) > 0 {
+		return "", nil, errors.Join(errs...)
+	}
+	return resolved, secrets, nil
+}
+
+func (r Reference) resolve(ctx context.Context) (string, error) {
+	switch r.Kind {
+	case KindEnv:
+		secret, ok := os.LookupEnv(r.Target)
+		if !ok {
+			return "", errors.New("environment variable is not set")
+		}
+		return secret, nil
+
+	case KindFile:
+		content, err := os.ReadFile(r.Target)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+
+	case KindExec:
+		args := strings.Fields(r.Target)
+		ctx, cancel := context.WithTimeout(ctx, ExecTimeout)
+		defer cancel()
+
+		stdout := bytes.Buffer{}
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdout = &stdout
+		// The command's error output isn't included in errors, as it may contain the secret.
+		if err := cmd.Run(); err != nil {
+			return "", err
+		}
+		return strings.TrimRight(stdout.String(), "\r\n"), nil
+	}
+	return "", fmt.Errorf("unsupported secret kind %q", r.Kind)
+}
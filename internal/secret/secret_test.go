@@ -0,0 +1,94 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferences(t *testing.T) {
+	refs, err := References("Bearer ${env:GITHUB_TOKEN} from ${file:/run/secrets/token} and ${exec:get-secret name}")
+	assert.NoError(t, err)
+	assert.Equal(t, []Reference{
+		{Kind: KindEnv, Target: "GITHUB_TOKEN"},
+		{Kind: KindFile, Target: "/run/secrets/token"},
+		{Kind: KindExec, Target: "get-secret name"},
+	}, refs)
+
+	refs, err = References("${vault:secret} and $HOME")
+	assert.NoError(t, err)
+	assert.Empty(t, refs, "Unsupported kinds are not references")
+
+	_, err = References("${env:}")
+	assert.ErrorContains(t, err, "variable name")
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("CF_TEST_TOKEN", "s3cr3t")
+
+	secretFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("from-file\n"), 0600))
+
+	t.Run("Values without references are unchanged", func(t *testing.T) {
+		value, secrets, err := Resolve(ctx, "localhost:22")
+		assert.NoError(t, err)
+		assert.Equal(t, "localhost:22", value)
+		assert.Empty(t, secrets)
+	})
+
+	t.Run("Environment variables", func(t *testing.T) {
+		value, secrets, err := Resolve(ctx, "Bearer ${env:CF_TEST_TOKEN}")
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer s3cr3t", value)
+		assert.Equal(t, []string{"s3cr3t"}, secrets)
+	})
+
+	t.Run("Files", func(t *testing.T) {
+		value, secrets, err := Resolve(ctx, "${file:"+secretFile+"}")
+		assert.NoError(t, err)
+		assert.Equal(t, "from-file", value)
+		assert.Equal(t, []string{"from-file"}, secrets)
+	})
+
+	t.Run("Commands", func(t *testing.T) {
+		value, secrets, err := Resolve(ctx, "${exec:echo from-exec}")
+		assert.NoError(t, err)
+		assert.Equal(t, "from-exec", value)
+		assert.Equal(t, []string{"from-exec"}, secrets)
+	})
+
+	t.Run("Errors describe the reference", func(t *testing.T) {
+		_, _, err := Resolve(ctx, "${env:CF_TEST_MISSING} ${exec:false}")
+		assert.ErrorContains(t, err, "${env:CF_TEST_MISSING}")
+		assert.ErrorContains(t, err, "${exec:false}")
+	})
+}
+
+func TestRedactor(t *testing.T) {
+	var nilRedactor *Redactor
+	assert.Equal(t, "s3cr3t", nilRedactor.Redact("s3cr3t"))
+
+	r := NewRedactor()
+	r.Add("s3cr3t", "", "s3cr3t-longer")
+
+	assert.Equal(t, "token=(redacted) other=(redacted)", r.Redact("token=s3cr3t other=s3cr3t-longer"))
+
+	r.Add(`pa"ss<word>`)
+	assert.Equal(t, `{"token":"(redacted)"} token="(redacted)"`, r.Redact(`{"token":"pa\"ss\u003cword\u003e"} token="pa\"ss<word>"`))
+
+	original := errors.New("no secrets here")
+	assert.Same(t, original, r.RedactError(original))
+	assert.EqualError(t, r.RedactError(errors.New("invalid token s3cr3t")), "invalid token (redacted)")
+
+	out := bytes.Buffer{}
+	n, err := r.Writer(&out).Write([]byte("logged s3cr3t\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, len("logged s3cr3t\n"), n)
+	assert.Equal(t, "logged (redacted)\n", out.String())
+}
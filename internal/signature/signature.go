@@ -0,0 +1,281 @@
+// Package signature signs and verifies plugins and policy bundles using ed25519 keys.
+//
+// Signatures are detached, and stored next to the artifact they sign with a `.sig` extension. They are made
+// over the artifact's digest, so an artifact can be verified from its digest alone, such as an HTTP(S) artifact
+// whose checksum is already known.
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Ext is the extension of signature files.
+const Ext = ".sig"
+
+const algorithm = "ed25519"
+
+// Signature is a detached signature of an artifact.
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	// KeyID identifies the key which made the signature.
+	KeyID string `json:"key_id"`
+	// Digest is the digest of the signed artifact, such as `sha256:<hex>`.
+	Digest    string `json:"digest"`
+	Signature string `json:"signature"`
+}
+
+// KeyID returns a short identifier for a public key, so signatures can refer to the key that made them.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateKey creates a new key pair, returned PEM encoded.
+func GenerateKey() (publicKey []byte, privateKey []byte, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicDer, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateDer, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer}),
+		nil
+}
+
+// LoadPublicKey reads a PEM encoded ed25519 public key.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPem(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key %s: %w", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an ed25519 key", path)
+	}
+	return public, nil
+}
+
+// LoadPrivateKey reads a PEM encoded ed25519 private key.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPem(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key %s: %w", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not an ed25519 key", path)
+	}
+	return private, nil
+}
+
+func readPem(path string, blockType string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded %s", path, strings.ToLower(blockType))
+	}
+	return block.Bytes, nil
+}
+
+// Digest returns the digest of the file or directory at path.
+//
+// For a file, this is the SHA256 of its content. For a directory, such as an extracted policy bundle, it is the
+// SHA256 of a manifest listing the relative path and SHA256 of every regular file within it, sorted by path.
+func Digest(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsDir() {
+		sum, err := fileSum(path)
+		if err != nil {
+			return "", err
+		}
+		return "sha256:" + sum, nil
+	}
+
+	type manifestEntry struct{ path, sum string }
+	entries := []manifestEntry{}
+	err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		sum, err := fileSum(file)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, manifestEntry{path: filepath.ToSlash(rel), sum: sum})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	slices.SortFunc(entries, func(a, b manifestEntry) int {
+		return strings.Compare(a.path, b.path)
+	})
+
+	manifest := strings.Builder{}
+	for _, e := range entries {
+		fmt.Fprintf(&manifest, "%s  %s\n", e.sum, e.path)
+	}
+
+	sum := sha256.Sum256([]byte(manifest.String()))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func fileSum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Sign signs digest with key.
+func Sign(key ed25519.PrivateKey, digest string) *Signature {
+	return &Signature{
+		Algorithm: algorithm,
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		Digest:    digest,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(digest))),
+	}
+}
+
+// SignPath signs the file or directory at path, and writes the signature alongside it.
+func SignPath(key ed25519.PrivateKey, path string) (*Signature, error) {
+	digest, err := Digest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := Sign(key, digest)
+	content, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Clean(path)+Ext, content, 0644); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Parse decodes a signature file.
+func Parse(content []byte) (*Signature, error) {
+	sig := &Signature{}
+	if err := json.Unmarshal(content, sig); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	return sig, nil
+}
+
+// Verifier checks signatures were made by one of a set of trusted keys.
+type Verifier struct {
+	keys map[string]ed25519.PublicKey
+}
+
+func NewVerifier(keys ...ed25519.PublicKey) *Verifier {
+	v := &Verifier{keys: map[string]ed25519.PublicKey{}}
+	for _, key := range keys {
+		v.keys[KeyID(key)] = key
+	}
+	return v
+}
+
+// Verify checks sig is a valid signature of digest, made by a trusted key. It returns the ID of the key
+// which made the signature.
+func (v *Verifier) Verify(digest string, sig *Signature) (string, error) {
+	if sig.Algorithm != algorithm {
+		return "", fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	if sig.Digest != digest {
+		return "", fmt.Errorf("signature is for digest %s, but artifact has digest %s", sig.Digest, digest)
+	}
+
+	key, ok := v.keys[sig.KeyID]
+	if !ok {
+		return "", fmt.Errorf("signed by untrusted key %s", sig.KeyID)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return "", fmt.Errorf("invalid signature: %w", err)
+	}
+	if !ed25519.Verify(key, []byte(digest), signature) {
+		return "", errors.New("signature does not match")
+	}
+
+	return sig.KeyID, nil
+}
+
+// VerifyPath checks the file or directory at path has a valid signature alongside it, made by a trusted key.
+func (v *Verifier) VerifyPath(path string) (string, error) {
+	content, err := os.ReadFile(filepath.Clean(path) + Ext)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%s is not signed", path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := Parse(content)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := Digest(path)
+	if err != nil {
+		return "", err
+	}
+
+	return v.Verify(digest, sig)
+}
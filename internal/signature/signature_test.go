@@ -0,0 +1,127 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	return key
+}
+
+func TestGenerateKey(t *testing.T) {
+	publicKey, privateKey, err := GenerateKey()
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "key.pub"), publicKey, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "key"), privateKey, 0600))
+
+	public, err := LoadPublicKey(filepath.Join(dir, "key.pub"))
+	assert.NoError(t, err)
+	private, err := LoadPrivateKey(filepath.Join(dir, "key"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, public, private.Public())
+
+	_, err = LoadPublicKey(filepath.Join(dir, "key"))
+	assert.Error(t, err, "a private key should not load as a public key")
+}
+
+func TestDigest(t *testing.T) {
+	t.Run("Directory digests change with their content", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "policies"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "policies", "ssh.rego"), []byte("package ssh"), 0644))
+
+		before, err := Digest(dir)
+		assert.NoError(t, err)
+
+		again, err := Digest(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, before, again)
+
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "policies", "ssh.rego"), []byte("package ssh2"), 0644))
+		after, err := Digest(dir)
+		assert.NoError(t, err)
+		assert.NotEqual(t, before, after)
+	})
+
+	t.Run("File digests are their sha256", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "plugin")
+		assert.NoError(t, os.WriteFile(file, []byte("test"), 0644))
+
+		digest, err := Digest(file)
+		assert.NoError(t, err)
+		assert.Equal(t, "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", digest)
+	})
+}
+
+func TestVerifier_VerifyPath(t *testing.T) {
+	trusted := newKey(t)
+	untrusted := newKey(t)
+	verifier := NewVerifier(trusted.Public().(ed25519.PublicKey))
+
+	write := func(t *testing.T, content string) string {
+		file := filepath.Join(t.TempDir(), "plugin")
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0755))
+		return file
+	}
+
+	t.Run("Accepts artifacts signed by a trusted key", func(t *testing.T) {
+		file := write(t, "plugin")
+		sig, err := SignPath(trusted, file)
+		assert.NoError(t, err)
+
+		keyID, err := verifier.VerifyPath(file)
+		assert.NoError(t, err)
+		assert.Equal(t, sig.KeyID, keyID)
+	})
+
+	t.Run("Refuses unsigned artifacts", func(t *testing.T) {
+		file := write(t, "plugin")
+
+		_, err := verifier.VerifyPath(file)
+		assert.ErrorContains(t, err, "not signed")
+	})
+
+	t.Run("Refuses artifacts signed by an untrusted key", func(t *testing.T) {
+		file := write(t, "plugin")
+		_, err := SignPath(untrusted, file)
+		assert.NoError(t, err)
+
+		_, err = verifier.VerifyPath(file)
+		assert.ErrorContains(t, err, "untrusted key")
+	})
+
+	t.Run("Refuses artifacts modified after signing", func(t *testing.T) {
+		file := write(t, "plugin")
+		_, err := SignPath(trusted, file)
+		assert.NoError(t, err)
+
+		assert.NoError(t, os.WriteFile(file, []byte("tampered"), 0755))
+
+		_, err = verifier.VerifyPath(file)
+		assert.Error(t, err)
+	})
+
+	t.Run("Refuses forged signatures", func(t *testing.T) {
+		file := write(t, "plugin")
+		digest, err := Digest(file)
+		assert.NoError(t, err)
+
+		// A signature made by an untrusted key, claiming to be from the trusted one.
+		sig := Sign(untrusted, digest)
+		sig.KeyID = KeyID(trusted.Public().(ed25519.PublicKey))
+
+		_, err = verifier.Verify(digest, sig)
+		assert.ErrorContains(t, err, "does not match")
+	})
+}
@@ -0,0 +1,213 @@
+// Package telemetry sets up OpenTelemetry tracing for the agent and the API, and propagates trace context
+// between them through NATS message headers and gRPC metadata.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// Exporters which spans can be sent to.
+const (
+	// ExporterNone disables tracing. Trace context is still propagated, so traces aren't broken.
+	ExporterNone = "none"
+	// ExporterOTLP sends spans to an OpenTelemetry collector over gRPC.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans to stdout as JSON, for local testing.
+	ExporterStdout = "stdout"
+	// ExporterFile writes spans to a file as JSON, for local testing.
+	ExporterFile = "file"
+)
+
+// Config configures tracing.
+type Config struct {
+	// Exporter is one of the Exporter constants. It defaults to ExporterNone.
+	Exporter string
+	// Endpoint is the host and port of the OTLP collector. It defaults to the standard OTEL_EXPORTER_OTLP_*
+	// environment variables, and then localhost:4317.
+	Endpoint string
+	// Insecure connects to the OTLP collector without TLS.
+	Insecure bool
+	// File is where spans are written by ExporterFile.
+	File string
+	// SampleRatio is the fraction of traces which are sampled, from 0 to 1. It defaults to sampling every trace.
+	// Traces started elsewhere, such as by an agent, follow the sampling decision of their parent.
+	SampleRatio *float64
+}
+
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case "", ExporterNone, ExporterOTLP, ExporterStdout:
+	case ExporterFile:
+		if c.File == "" {
+			return errors.New("the file exporter requires a file")
+		}
+	default:
+		return fmt.Errorf("unsupported exporter %q, expected none, otlp, stdout or file", c.Exporter)
+	}
+	if c.SampleRatio != nil && (*c.SampleRatio < 0 || *c.SampleRatio > 1) {
+		return fmt.Errorf("sample ratio must be between 0 and 1: %g", *c.SampleRatio)
+	}
+	return nil
+}
+
+// Setup installs a global tracer provider for the service, exporting spans as configured, and the W3C trace
+// context propagator. It returns a function which flushes any pending spans and stops the exporter.
+func Setup(ctx context.Context, serviceName string, config Config) (func(context.Context) error, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	otel.SetTextMapPropagator(propagator)
+
+	exporter, closeExporter, err := newExporter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if config.SampleRatio != nil {
+		sampler = sdktrace.TraceIDRatioBased(*config.SampleRatio)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		return errors.Join(err, closeExporter())
+	}, nil
+}
+
+// newExporter returns the configured exporter, or nil if spans aren't exported, and a function which closes
+// anything the exporter writes to.
+func newExporter(ctx context.Context, config Config) (sdktrace.SpanExporter, func() error, error) {
+	noClose := func() error { return nil }
+
+	switch config.Exporter {
+	case ExporterOTLP:
+		options := []otlptracegrpc.Option{}
+		if config.Endpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, options...)
+		return exporter, noClose, err
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exporter, noClose, err
+	case ExporterFile:
+		f, err := os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return exporter, f.Close, nil
+	}
+	return nil, noClose, nil
+}
+
+// propagator propagates W3C trace context and baggage. Inject and Extract always use it, rather than the global
+// propagator, so trace context is passed on by processes which don't export spans themselves.
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Tracer returns a tracer from the global tracer provider, for the instrumented package name.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Inject adds the trace context of ctx to carrier, such as the headers of a message.
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagator.Inject(ctx, carrier)
+}
+
+// Extract returns ctx with the trace context from carrier, such as the headers of a received message.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
+
+// EndSpan records err on span, if there was one, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// HeaderCarrier carries trace context in the headers of a NATS message.
+type HeaderCarrier nats.Header
+
+func (c HeaderCarrier) Get(key string) string {
+	return nats.Header(c).Get(key)
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	nats.Header(c).Set(key, value)
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// MetadataCarrier carries trace context in gRPC metadata.
+type MetadataCarrier metadata.MD
+
+func (c MetadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c MetadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	ratio := 0.5
+	tooHigh := 1.5
+
+	assert.NoError(t, Config{}.Validate())
+	assert.NoError(t, Config{Exporter: ExporterOTLP, Endpoint: "collector:4317", SampleRatio: &ratio}.Validate())
+	assert.ErrorContains(t, Config{Exporter: ExporterFile}.Validate(), "requires a file")
+	assert.ErrorContains(t, Config{Exporter: "jaeger"}.Validate(), "unsupported exporter")
+	assert.ErrorContains(t, Config{SampleRatio: &tooHigh}.Validate(), "sample ratio")
+}
+
+func TestSetup_File(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(context.Background(), "test", Config{Exporter: ExporterFile, File: file})
+	assert.NoError(t, err)
+
+	ctx, parent := Tracer("test").Start(context.Background(), "parent")
+	_, child := Tracer("test").Start(ctx, "child")
+	EndSpan(child, errors.New("failed"))
+	EndSpan(parent, nil)
+
+	assert.NoError(t, shutdown(context.Background()))
+
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"Name":"parent"`)
+	assert.Contains(t, string(content), `"Name":"child"`)
+	assert.Contains(t, string(content), `"Description":"failed"`)
+	assert.Contains(t, string(content), parent.SpanContext().TraceID().String())
+}
+
+func TestPropagation(t *testing.T) {
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+	header := nats.Header{}
+	Inject(ctx, HeaderCarrier(header))
+	assert.NotEmpty(t, header.Get("traceparent"))
+
+	extracted := trace.SpanContextFromContext(Extract(context.Background(), HeaderCarrier(header)))
+	assert.Equal(t, spanContext.TraceID(), extracted.TraceID())
+	assert.Equal(t, spanContext.SpanID(), extracted.SpanID())
+	assert.True(t, extracted.IsRemote())
+}
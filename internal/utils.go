@@ -2,6 +2,7 @@ package internal
 
 import (
 	"archive/tar"
+	"fmt"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/uuid"
 	"hash/crc64"
@@ -68,6 +69,12 @@ func Untar(destination string, tarReader io.Reader) error {
 		// the target location where the dir/file should be created
 		target := filepath.Join(destination, header.Name)
 
+		// don't allow entries to be written outside the destination, such as with `../` in their name.
+		// archives created from a directory, such as with `tar -C dir .`, have an entry for the destination itself.
+		if target != filepath.Clean(destination) && !strings.HasPrefix(target, filepath.Clean(destination)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+
 		// the following switch could also be done using fi.Mode(), not sure if there
 		// a benefit of using one vs. the other.
 		// fi := header.FileInfo()
@@ -85,6 +92,11 @@ func Untar(destination string, tarReader io.Reader) error {
 
 		// if it's a file create it
 		case tar.TypeReg:
+			// archives don't always contain entries for each directory
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
 			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
 			if err != nil {
 				return err
@@ -92,6 +104,7 @@ func Untar(destination string, tarReader io.Reader) error {
 
 			// copy over contents
 			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
 				return err
 			}
 
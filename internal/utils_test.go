@@ -1,7 +1,11 @@
 package internal
 
 import (
+	"archive/tar"
+	"bytes"
 	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -159,3 +163,96 @@ func TestSeededUUID(t *testing.T) {
 		}
 	})
 }
+
+func tarball(t *testing.T, files map[string]string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write tar content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close tar: %v", err)
+	}
+	return buf
+}
+
+func TestUntar(t *testing.T) {
+	t.Run("Extracts files into nested directories", func(t *testing.T) {
+		destination := t.TempDir()
+
+		err := Untar(destination, tarball(t, map[string]string{
+			"policies/ssh.rego": "package ssh",
+		}))
+		if err != nil {
+			t.Fatalf("Untar() returned an error: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(destination, "policies", "ssh.rego"))
+		if err != nil {
+			t.Fatalf("Failed to read extracted file: %v", err)
+		}
+		if string(content) != "package ssh" {
+			t.Errorf("Untar() extracted %q, expected %q", content, "package ssh")
+		}
+	})
+
+	t.Run("Extracts archives rooted at ./", func(t *testing.T) {
+		destination := t.TempDir()
+
+		// Archives created with `tar -C dir .` start with an entry for the directory itself.
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, header := range []*tar.Header{
+			{Name: "./", Mode: 0755, Typeflag: tar.TypeDir},
+			{Name: "./policies/", Mode: 0755, Typeflag: tar.TypeDir},
+			{Name: "./policies/ssh.rego", Mode: 0644, Size: int64(len("package ssh")), Typeflag: tar.TypeReg},
+		} {
+			if err := tw.WriteHeader(header); err != nil {
+				t.Fatalf("Failed to write tar header: %v", err)
+			}
+		}
+		if _, err := tw.Write([]byte("package ssh")); err != nil {
+			t.Fatalf("Failed to write tar content: %v", err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("Failed to close tar: %v", err)
+		}
+
+		if err := Untar(destination, buf); err != nil {
+			t.Fatalf("Untar() returned an error: %v", err)
+		}
+		content, err := os.ReadFile(filepath.Join(destination, "policies", "ssh.rego"))
+		if err != nil {
+			t.Fatalf("Failed to read extracted file: %v", err)
+		}
+		if string(content) != "package ssh" {
+			t.Errorf("Untar() extracted %q, expected %q", content, "package ssh")
+		}
+	})
+
+	t.Run("Rejects files outside the destination", func(t *testing.T) {
+		parent := t.TempDir()
+		destination := filepath.Join(parent, "destination")
+
+		err := Untar(destination, tarball(t, map[string]string{
+			"../escaped": "oops",
+		}))
+		if err == nil {
+			t.Errorf("Untar() expected an error for a path outside the destination")
+		}
+		if _, err := os.Stat(filepath.Join(parent, "escaped")); !os.IsNotExist(err) {
+			t.Errorf("Untar() wrote a file outside the destination")
+		}
+	})
+}
@@ -2,37 +2,135 @@ package runner
 
 import (
 	"context"
+	"fmt"
+	"sync"
+
+	"github.com/compliance-framework/framework/internal/telemetry"
 	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-// GRPCClient is an implementation of KV that talks over RPC.
-type GRPCClient struct{ client proto2.RunnerClient }
+// GRPCClient is an implementation of ContextRunner that talks over RPC.
+// Cancellation and deadlines on the context passed to each call are propagated to the plugin, as is the trace
+// context, in the call's metadata.
+//
+// Methods added in later protocol versions return an Unimplemented error without calling the plugin, if the
+// plugin speaks an earlier version.
+type GRPCClient struct {
+	client proto2.RunnerClient
+	// protocolVersion is the protocol version negotiated with the plugin.
+	protocolVersion int
+	// hostService is the broker ID the agent's Host is served on, or 0 if it isn't.
+	hostService uint32
+}
 
-func (m *GRPCClient) Configure(req *proto2.ConfigureRequest) (*proto2.ConfigureResponse, error) {
-	return m.client.Configure(context.Background(), req)
+// ProtocolVersion returns the protocol version negotiated with the plugin.
+func (m *GRPCClient) ProtocolVersion() int {
+	return m.protocolVersion
 }
 
-func (m *GRPCClient) PrepareForEval(req *proto2.PrepareForEvalRequest) (*proto2.PrepareForEvalResponse, error) {
-	return m.client.PrepareForEval(context.Background(), req)
+// requireVersion returns an Unimplemented error for methods added in version, if the plugin speaks an earlier
+// version, as the plugin may not serve them.
+func (m *GRPCClient) requireVersion(method string, version int) error {
+	if m.protocolVersion < version {
+		return status.Errorf(codes.Unimplemented, "%s requires protocol version %d, but the plugin speaks version %d", method, version, m.protocolVersion)
+	}
+	return nil
 }
 
-func (m *GRPCClient) Eval(req *proto2.EvalRequest) (*proto2.EvalResponse, error) {
-	resp, err := m.client.Eval(context.Background(), req)
+// Configure tells the plugin where the agent's Host is served, if it is.
+func (m *GRPCClient) Configure(ctx context.Context, req *proto2.ConfigureRequest) (*proto2.ConfigureResponse, error) {
+	if m.hostService != 0 {
+		req = &proto2.ConfigureRequest{Config: req.Config, HostService: m.hostService}
+	}
+	return m.client.Configure(outgoingContext(ctx), req)
+}
+
+func (m *GRPCClient) PrepareForEval(ctx context.Context, req *proto2.PrepareForEvalRequest) (*proto2.PrepareForEvalResponse, error) {
+	return m.client.PrepareForEval(outgoingContext(ctx), req)
+}
+
+func (m *GRPCClient) Eval(ctx context.Context, req *proto2.EvalRequest) (*proto2.EvalResponse, error) {
+	resp, err := m.client.Eval(outgoingContext(ctx), req)
 	return resp, err
 }
 
+// Info returns an Unimplemented error for plugins which don't implement Informer. Use the package Info
+// function to treat them as not describing themselves.
+func (m *GRPCClient) Info(ctx context.Context, req *proto2.InfoRequest) (*proto2.InfoResponse, error) {
+	if err := m.requireVersion("Info", ProtocolVersion2); err != nil {
+		return nil, err
+	}
+	return m.client.Info(outgoingContext(ctx), req)
+}
+
+// outgoingContext adds the trace context of ctx to the metadata sent to the plugin.
+func outgoingContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	telemetry.Inject(ctx, telemetry.MetadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// incomingContext returns ctx with the trace context sent by the agent, so spans created by the plugin are part
+// of the agent's trace.
+func incomingContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return telemetry.Extract(ctx, telemetry.MetadataCarrier(md))
+}
+
 type GRPCServer struct {
-	Impl Runner
+	Impl ContextRunner
+
+	broker *plugin.GRPCBroker
+	hostMu sync.Mutex
+	// host is the agent's Host, once the agent has said where it is served.
+	host *hostGRPCClient
 }
 
+// Configure connects to the agent's Host, if it provides one, before configuring the plugin.
 func (m *GRPCServer) Configure(ctx context.Context, req *proto2.ConfigureRequest) (*proto2.ConfigureResponse, error) {
-	return m.Impl.Configure(req)
+	if req.HostService != 0 && m.broker != nil {
+		conn, err := m.broker.Dial(req.HostService)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to host services: %w", err)
+		}
+		m.hostMu.Lock()
+		if m.host != nil {
+			m.host.conn.Close()
+		}
+		m.host = &hostGRPCClient{conn: conn, client: proto2.NewHostClient(conn)}
+		m.hostMu.Unlock()
+	}
+	return m.Impl.Configure(m.context(ctx), req)
 }
 
 func (m *GRPCServer) PrepareForEval(ctx context.Context, req *proto2.PrepareForEvalRequest) (*proto2.PrepareForEvalResponse, error) {
-	return m.Impl.PrepareForEval(req)
+	return m.Impl.PrepareForEval(m.context(ctx), req)
 }
 
 func (m *GRPCServer) Eval(ctx context.Context, req *proto2.EvalRequest) (*proto2.EvalResponse, error) {
-	return m.Impl.Eval(req)
+	return m.Impl.Eval(m.context(ctx), req)
+}
+
+// context returns the context the plugin is called with, carrying the trace context sent by the agent and the
+// agent's Host.
+func (m *GRPCServer) context(ctx context.Context) context.Context {
+	m.hostMu.Lock()
+	defer m.hostMu.Unlock()
+	if m.host == nil {
+		return incomingContext(ctx)
+	}
+	return withHost(incomingContext(ctx), m.host)
+}
+
+func (m *GRPCServer) Info(ctx context.Context, req *proto2.InfoRequest) (*proto2.InfoResponse, error) {
+	informer, ok := m.Impl.(Informer)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "plugin does not implement Info")
+	}
+	return informer.Info(m.context(ctx), req)
 }
@@ -0,0 +1,254 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-plugin"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// contextRunner records the contexts it receives, and blocks in Eval until its context is done.
+type contextRunner struct {
+	configureDeadline time.Time
+	configureSpan     trace.SpanContext
+	evalErr           chan error
+}
+
+func (r *contextRunner) Configure(ctx context.Context, req *proto.ConfigureRequest) (*proto.ConfigureResponse, error) {
+	r.configureDeadline, _ = ctx.Deadline()
+	r.configureSpan = trace.SpanContextFromContext(ctx)
+	return &proto.ConfigureResponse{}, nil
+}
+
+func (r *contextRunner) PrepareForEval(ctx context.Context, req *proto.PrepareForEvalRequest) (*proto.PrepareForEvalResponse, error) {
+	return &proto.PrepareForEvalResponse{}, nil
+}
+
+func (r *contextRunner) Eval(ctx context.Context, req *proto.EvalRequest) (*proto.EvalResponse, error) {
+	<-ctx.Done()
+	r.evalErr <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+type legacyTestRunner struct{}
+
+func (r *legacyTestRunner) Configure(req *proto.ConfigureRequest) (*proto.ConfigureResponse, error) {
+	return &proto.ConfigureResponse{Value: []byte(req.Config["name"])}, nil
+}
+
+func (r *legacyTestRunner) PrepareForEval(req *proto.PrepareForEvalRequest) (*proto.PrepareForEvalResponse, error) {
+	return &proto.PrepareForEvalResponse{}, nil
+}
+
+func (r *legacyTestRunner) Eval(req *proto.EvalRequest) (*proto.EvalResponse, error) {
+	return &proto.EvalResponse{Title: req.BundlePath}, nil
+}
+
+// dispenseRunner serves impl over a real gRPC connection, and returns the client side.
+func dispenseRunner(t *testing.T, impl ContextRunner) ContextRunner {
+	return dispenseRunnerVersion(t, impl, ProtocolVersion2)
+}
+
+// dispenseRunnerVersion is dispenseRunner, with the client negotiated to protocolVersion.
+func dispenseRunnerVersion(t *testing.T, impl ContextRunner, protocolVersion int) ContextRunner {
+	conn, server := plugin.TestGRPCConn(t, func(s *grpc.Server) {
+		proto.RegisterRunnerServer(s, &GRPCServer{Impl: impl})
+	})
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+
+	return &GRPCClient{client: proto.NewRunnerClient(conn), protocolVersion: protocolVersion}
+}
+
+func TestGRPC_ContextPropagation(t *testing.T) {
+	t.Run("Deadlines reach the plugin", func(t *testing.T) {
+		impl := &contextRunner{}
+		r := dispenseRunner(t, impl)
+
+		deadline := time.Now().Add(time.Minute)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+
+		_, err := r.Configure(ctx, &proto.ConfigureRequest{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if impl.configureDeadline.IsZero() {
+			t.Fatalf("Expected plugin to receive a deadline")
+		}
+		// gRPC sends the deadline as a relative timeout, so allow for some drift.
+		if drift := impl.configureDeadline.Sub(deadline).Abs(); drift > time.Second {
+			t.Errorf("Expected plugin deadline %v to be close to %v", impl.configureDeadline, deadline)
+		}
+	})
+
+	t.Run("Trace context reaches the plugin", func(t *testing.T) {
+		impl := &contextRunner{}
+		r := dispenseRunner(t, impl)
+
+		spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x01, 0x02, 0x03},
+			SpanID:     trace.SpanID{0x04, 0x05, 0x06},
+			TraceFlags: trace.FlagsSampled,
+		})
+		ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+		_, err := r.Configure(ctx, &proto.ConfigureRequest{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if impl.configureSpan.TraceID() != spanContext.TraceID() || impl.configureSpan.SpanID() != spanContext.SpanID() {
+			t.Errorf("Expected plugin to receive span %v, got %v", spanContext, impl.configureSpan)
+		}
+		if !impl.configureSpan.IsRemote() {
+			t.Errorf("Expected plugin span context to be remote")
+		}
+	})
+
+	t.Run("Cancellation reaches the plugin", func(t *testing.T) {
+		impl := &contextRunner{evalErr: make(chan error, 1)}
+		r := dispenseRunner(t, impl)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := r.Eval(ctx, &proto.EvalRequest{})
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("Expected deadline exceeded from host call, got %v", err)
+		}
+
+		select {
+		case pluginErr := <-impl.evalErr:
+			if !errors.Is(pluginErr, context.DeadlineExceeded) && !errors.Is(pluginErr, context.Canceled) {
+				t.Errorf("Expected plugin context to be done, got %v", pluginErr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Expected plugin context to be cancelled")
+		}
+	})
+}
+
+func TestGRPC_FromLegacy(t *testing.T) {
+	r := dispenseRunner(t, FromLegacy(&legacyTestRunner{}))
+
+	configured, err := r.Configure(context.Background(), &proto.ConfigureRequest{
+		Config: map[string]string{"name": "legacy"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(configured.Value) != "legacy" {
+		t.Errorf("configured.Value: got %s, want %s", configured.Value, "legacy")
+	}
+
+	res, err := r.Eval(context.Background(), &proto.EvalRequest{BundlePath: "bundle"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Title != "bundle" {
+		t.Errorf("res.Title: got %s, want %s", res.Title, "bundle")
+	}
+}
+
+func TestRunnerGRPCPlugin_Impl(t *testing.T) {
+	// Plugins built against earlier versions serve a Runner as Impl.
+	client, _ := plugin.TestPluginGRPCConn(t, false, map[string]plugin.Plugin{
+		"runner": &RunnerGRPCPlugin{Impl: &legacyTestRunner{}},
+	})
+	t.Cleanup(func() { client.Close() })
+
+	raw, err := client.Dispense("runner")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res, err := raw.(ContextRunner).Eval(context.Background(), &proto.EvalRequest{BundlePath: "bundle"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Title != "bundle" {
+		t.Errorf("res.Title: got %s, want %s", res.Title, "bundle")
+	}
+}
+
+// infoRunner describes itself.
+type infoRunner struct {
+	contextRunner
+}
+
+func (r *infoRunner) Info(ctx context.Context, req *proto.InfoRequest) (*proto.InfoResponse, error) {
+	return &proto.InfoResponse{
+		Name:         "info",
+		Version:      "1.0.0",
+		ConfigSchema: `{"type": "object"}`,
+		Capabilities: []string{CapabilityCancellation},
+	}, nil
+}
+
+func TestGRPC_Info(t *testing.T) {
+	t.Run("Plugins describe themselves", func(t *testing.T) {
+		r := dispenseRunner(t, &infoRunner{})
+
+		info, err := Info(context.Background(), r)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info == nil || info.Name != "info" || info.Version != "1.0.0" {
+			t.Fatalf("Expected plugin info, got %v", info)
+		}
+		if len(info.Capabilities) != 1 || info.Capabilities[0] != CapabilityCancellation {
+			t.Errorf("info.Capabilities: got %v, want %v", info.Capabilities, []string{CapabilityCancellation})
+		}
+	})
+
+	t.Run("Plugins without Info are described as nil", func(t *testing.T) {
+		r := dispenseRunner(t, &contextRunner{})
+
+		info, err := Info(context.Background(), r)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info != nil {
+			t.Errorf("Expected no plugin info, got %v", info)
+		}
+	})
+}
+
+func TestGRPC_ProtocolVersion1(t *testing.T) {
+	t.Run("Plugins are not described", func(t *testing.T) {
+		r := dispenseRunnerVersion(t, &infoRunner{}, ProtocolVersion1)
+
+		info, err := Info(context.Background(), r)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info != nil {
+			t.Errorf("Expected no plugin info over version 1, got %v", info)
+		}
+	})
+
+	t.Run("Plugins are evaluated without streaming", func(t *testing.T) {
+		r := dispenseRunnerVersion(t, FromLegacy(&legacyTestRunner{}), ProtocolVersion1)
+
+		if err := r.(*GRPCClient).EvalStream(context.Background(), &proto.EvalRequest{}, NewStreamingEvalResponse(nil)); status.Code(err) != codes.Unimplemented {
+			t.Errorf("Expected EvalStream to be unimplemented over version 1, got %v", err)
+		}
+		res, err := Eval(context.Background(), r, &proto.EvalRequest{BundlePath: "bundle"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if res.Title != "bundle" {
+			t.Errorf("Expected version 1 plugins to be evaluated with Eval, got %v", res)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	policy_manager "github.com/compliance-framework/framework/policy-manager"
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+)
+
+// Host is the set of services the agent provides to plugins, so plugins don't each need their own policy
+// evaluation, logging and caching. Plugins get it from the context passed to each call with HostFromContext.
+type Host interface {
+	// EvalPolicy evaluates the policies in a bundle, under the compliance_framework.<namespace> package, with the
+	// agent's policy manager. Only the bundle of the evaluation in progress can be evaluated.
+	EvalPolicy(ctx context.Context, bundlePath string, namespace string, input map[string]interface{}) ([]policy_manager.Result, error)
+	// Log adds a log entry to the result of the evaluation in progress. Outside an evaluation, it is written to
+	// the agent's log.
+	Log(ctx context.Context, entry *proto2.LogEntry) error
+	// CacheGet returns the value of key in the plugin's persistent cache, and whether it was found.
+	CacheGet(ctx context.Context, key string) ([]byte, bool, error)
+	// CacheSet stores value as key in the plugin's persistent cache for ttl. A ttl of zero keeps the value until
+	// it is deleted.
+	CacheSet(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// CacheDelete removes key from the plugin's persistent cache.
+	CacheDelete(ctx context.Context, key string) error
+	// Progress reports that completed of total items have been processed by the current call.
+	Progress(ctx context.Context, completed int64, total int64, message string) error
+}
+
+type hostContextKey struct{}
+
+// HostFromContext returns the agent's host services, or nil if the plugin was started by an agent which
+// doesn't provide them.
+func HostFromContext(ctx context.Context) Host {
+	host, _ := ctx.Value(hostContextKey{}).(Host)
+	return host
+}
+
+// withHost returns ctx carrying host, if there is one.
+func withHost(ctx context.Context, host Host) context.Context {
+	if host == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, hostContextKey{}, host)
+}
+
+// serveHost serves host to the plugin through the broker, returning the broker ID the plugin dials.
+func serveHost(broker *plugin.GRPCBroker, host Host) uint32 {
+	id := broker.NextId()
+	go broker.AcceptAndServe(id, func(opts []grpc.ServerOption) *grpc.Server {
+		s := grpc.NewServer(opts...)
+		proto2.RegisterHostServer(s, &hostGRPCServer{impl: host})
+		return s
+	})
+	return id
+}
+
+// hostGRPCServer serves the agent's Host to a plugin.
+type hostGRPCServer struct {
+	impl Host
+}
+
+func (h *hostGRPCServer) EvalPolicy(ctx context.Context, req *proto2.HostEvalPolicyRequest) (*proto2.HostEvalPolicyResponse, error) {
+	input := map[string]interface{}{}
+	if len(req.Input) > 0 {
+		if err := json.Unmarshal(req.Input, &input); err != nil {
+			return nil, err
+		}
+	}
+	results, err := h.impl.EvalPolicy(incomingContext(ctx), req.BundlePath, req.Namespace, input)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	return &proto2.HostEvalPolicyResponse{Results: encoded}, nil
+}
+
+func (h *hostGRPCServer) Log(ctx context.Context, req *proto2.HostLogRequest) (*proto2.Empty, error) {
+	return &proto2.Empty{}, h.impl.Log(incomingContext(ctx), req.Entry)
+}
+
+func (h *hostGRPCServer) CacheGet(ctx context.Context, req *proto2.HostCacheGetRequest) (*proto2.HostCacheGetResponse, error) {
+	value, found, err := h.impl.CacheGet(incomingContext(ctx), req.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &proto2.HostCacheGetResponse{Value: value, Found: found}, nil
+}
+
+func (h *hostGRPCServer) CacheSet(ctx context.Context, req *proto2.HostCacheSetRequest) (*proto2.Empty, error) {
+	return &proto2.Empty{}, h.impl.CacheSet(incomingContext(ctx), req.Key, req.Value, time.Duration(req.TtlSeconds)*time.Second)
+}
+
+func (h *hostGRPCServer) CacheDelete(ctx context.Context, req *proto2.HostCacheDeleteRequest) (*proto2.Empty, error) {
+	return &proto2.Empty{}, h.impl.CacheDelete(incomingContext(ctx), req.Key)
+}
+
+func (h *hostGRPCServer) Progress(ctx context.Context, req *proto2.HostProgressRequest) (*proto2.Empty, error) {
+	return &proto2.Empty{}, h.impl.Progress(incomingContext(ctx), req.Completed, req.Total, req.Message)
+}
+
+// hostGRPCClient is the agent's Host, as seen by a plugin.
+type hostGRPCClient struct {
+	conn   *grpc.ClientConn
+	client proto2.HostClient
+}
+
+func (h *hostGRPCClient) EvalPolicy(ctx context.Context, bundlePath string, namespace string, input map[string]interface{}) ([]policy_manager.Result, error) {
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.client.EvalPolicy(outgoingContext(ctx), &proto2.HostEvalPolicyRequest{
+		BundlePath: bundlePath,
+		Namespace:  namespace,
+		Input:      encoded,
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := []policy_manager.Result{}
+	if err := json.Unmarshal(res.Results, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (h *hostGRPCClient) Log(ctx context.Context, entry *proto2.LogEntry) error {
+	_, err := h.client.Log(outgoingContext(ctx), &proto2.HostLogRequest{Entry: entry})
+	return err
+}
+
+func (h *hostGRPCClient) CacheGet(ctx context.Context, key string) ([]byte, bool, error) {
+	res, err := h.client.CacheGet(outgoingContext(ctx), &proto2.HostCacheGetRequest{Key: key})
+	if err != nil {
+		return nil, false, err
+	}
+	return res.Value, res.Found, nil
+}
+
+func (h *hostGRPCClient) CacheSet(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := h.client.CacheSet(outgoingContext(ctx), &proto2.HostCacheSetRequest{
+		Key:   key,
+		Value: value,
+		// Rounded up, so short TTLs don't become zero, which would keep the value forever.
+		TtlSeconds: int64((ttl + time.Second - 1) / time.Second),
+	})
+	return err
+}
+
+func (h *hostGRPCClient) CacheDelete(ctx context.Context, key string) error {
+	_, err := h.client.CacheDelete(outgoingContext(ctx), &proto2.HostCacheDeleteRequest{Key: key})
+	return err
+}
+
+func (h *hostGRPCClient) Progress(ctx context.Context, completed int64, total int64, message string) error {
+	_, err := h.client.Progress(outgoingContext(ctx), &proto2.HostProgressRequest{
+		Completed: completed,
+		Total:     total,
+		Message:   message,
+	})
+	return err
+}
@@ -0,0 +1,34 @@
+package runner
+
+import (
+	"context"
+
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Capabilities a plugin can declare in its InfoResponse.
+const (
+	// CapabilityCancellation declares the plugin stops work when the context of a call is done.
+	CapabilityCancellation = "cancellation"
+)
+
+// Informer is implemented by plugins which describe themselves, so the agent can check their configuration
+// before configuring them. It is optional, so plugins built before it was added can still be served.
+type Informer interface {
+	Info(ctx context.Context, request *proto2.InfoRequest) (*proto2.InfoResponse, error)
+}
+
+// Info returns the description of the plugin r, or nil if it doesn't describe itself.
+func Info(ctx context.Context, r ContextRunner) (*proto2.InfoResponse, error) {
+	informer, ok := r.(Informer)
+	if !ok {
+		return nil, nil
+	}
+	info, err := informer.Info(ctx, &proto2.InfoRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil, nil
+	}
+	return info, err
+}
@@ -0,0 +1,33 @@
+package runner
+
+import (
+	"context"
+
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+)
+
+// FromLegacy wraps a Runner so it can be used as a ContextRunner, such as to serve it with Serve.
+//
+//	runner.Serve(runner.FromLegacy(myPlugin))
+//
+// The wrapped implementation does not receive the context, so it cannot observe cancellation.
+// The host still stops waiting for a response once the context is done.
+func FromLegacy(impl Runner) ContextRunner {
+	return &legacyRunner{impl: impl}
+}
+
+type legacyRunner struct {
+	impl Runner
+}
+
+func (l *legacyRunner) Configure(ctx context.Context, req *proto2.ConfigureRequest) (*proto2.ConfigureResponse, error) {
+	return l.impl.Configure(req)
+}
+
+func (l *legacyRunner) PrepareForEval(ctx context.Context, req *proto2.PrepareForEvalRequest) (*proto2.PrepareForEvalResponse, error) {
+	return l.impl.PrepareForEval(req)
+}
+
+func (l *legacyRunner) Eval(ctx context.Context, req *proto2.EvalRequest) (*proto2.EvalResponse, error) {
+	return l.impl.Eval(req)
+}
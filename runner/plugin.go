@@ -2,39 +2,125 @@ package runner
 
 import (
 	"context"
+	"errors"
+
 	proto2 "github.com/compliance-framework/framework/runner/proto"
 	"github.com/hashicorp/go-plugin"
 	"google.golang.org/grpc"
 )
 
+// Runner is the interface implemented by plugins which don't observe cancellation. Plugins which should stop
+// work when the agent cancels a call implement ContextRunner instead.
 type Runner interface {
 	Configure(request *proto2.ConfigureRequest) (*proto2.ConfigureResponse, error)
 	PrepareForEval(request *proto2.PrepareForEvalRequest) (*proto2.PrepareForEvalResponse, error)
 	Eval(request *proto2.EvalRequest) (*proto2.EvalResponse, error)
 }
 
+// ContextRunner is the interface implemented by plugins which observe cancellation, and dispensed to the agent.
+//
+// The context passed to each method is cancelled when the agent cancels the call, or when its deadline
+// is exceeded, and implementations should stop work and return when it is done.
+// Runner implementations can be used as a ContextRunner with FromLegacy.
+type ContextRunner interface {
+	Configure(ctx context.Context, request *proto2.ConfigureRequest) (*proto2.ConfigureResponse, error)
+	PrepareForEval(ctx context.Context, request *proto2.PrepareForEvalRequest) (*proto2.PrepareForEvalResponse, error)
+	Eval(ctx context.Context, request *proto2.EvalRequest) (*proto2.EvalResponse, error)
+}
+
+// Protocol versions spoken between the agent and plugins. The agent and each plugin negotiate the highest
+// version they both support when the plugin starts.
+const (
+	// ProtocolVersion1 is the original protocol, of Configure, PrepareForEval and Eval.
+	ProtocolVersion1 = 1
+	// ProtocolVersion2 adds Info, EvalStream and host services. Plugins speaking it must serve every Runner
+	// method, though they may still leave Info and EvalStream unimplemented.
+	ProtocolVersion2 = 2
+)
+
+// ErrUnsupportedProtocol is returned by the agent when a plugin speaks none of the protocol versions it supports.
+var ErrUnsupportedProtocol = errors.New("plugin speaks no protocol version supported by this agent")
+
 type RunnerGRPCPlugin struct {
 	plugin.Plugin
 
 	// Impl Injection
 	Impl Runner
+
+	// ContextImpl is served instead of Impl, if it is set, so the plugin receives each call's context.
+	ContextImpl ContextRunner
+
+	// Host is served to the plugin through the broker when the agent dispenses it, if it is set and the plugin
+	// speaks ProtocolVersion2 or later.
+	Host Host
+
+	// Version is the protocol version the plugin is dispensed with. If it is zero, it is ProtocolVersion1.
+	Version int
 }
 
 func (p *RunnerGRPCPlugin) GRPCServer(broker *plugin.GRPCBroker, s *grpc.Server) error {
-	proto2.RegisterRunnerServer(s, &GRPCServer{Impl: p.Impl})
+	impl := p.ContextImpl
+	if impl == nil {
+		if p.Impl == nil {
+			return errors.New("runner plugin has no implementation")
+		}
+		impl = FromLegacy(p.Impl)
+	}
+	proto2.RegisterRunnerServer(s, &GRPCServer{Impl: impl, broker: broker})
 	return nil
 }
 
 func (p *RunnerGRPCPlugin) GRPCClient(ctx context.Context, broker *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
-	return &GRPCClient{client: proto2.NewRunnerClient(c)}, nil
+	client := &GRPCClient{client: proto2.NewRunnerClient(c), protocolVersion: max(p.Version, ProtocolVersion1)}
+	if p.Host != nil && client.protocolVersion >= ProtocolVersion2 {
+		client.hostService = serveHost(broker, p.Host)
+	}
+	return client, nil
 }
 
+// HandshakeConfig is shared by every protocol version. Its ProtocolVersion is the version spoken by plugins
+// served with PluginMap.
 var HandshakeConfig = plugin.HandshakeConfig{
 	ProtocolVersion:  1,
 	MagicCookieKey:   "RUNNER_PLUGIN",
 	MagicCookieValue: "AC755DCE-C118-481A-8EFA-18D8675D8122",
 }
 
+// PluginMap serves a plugin speaking only ProtocolVersion1.
+//
+// Deprecated: Serve plugins with Serve, or ServeConfig, so they can speak later protocol versions.
 var PluginMap = map[string]plugin.Plugin{
 	"runner": &RunnerGRPCPlugin{},
 }
+
+// VersionedPlugins returns the plugin sets the agent dispenses plugins with, for each protocol version it
+// supports. host is served to plugins speaking ProtocolVersion2 or later, if it isn't nil.
+func VersionedPlugins(host Host) map[int]plugin.PluginSet {
+	return map[int]plugin.PluginSet{
+		ProtocolVersion1: {"runner": &RunnerGRPCPlugin{Version: ProtocolVersion1}},
+		ProtocolVersion2: {"runner": &RunnerGRPCPlugin{Version: ProtocolVersion2, Host: host}},
+	}
+}
+
+// ServeConfig returns the configuration to serve impl as a plugin with, speaking every protocol version, so the
+// plugin can be run by agents which support any of them.
+// Runner implementations can be served with FromLegacy.
+func ServeConfig(impl ContextRunner) *plugin.ServeConfig {
+	return &plugin.ServeConfig{
+		HandshakeConfig: HandshakeConfig,
+		VersionedPlugins: map[int]plugin.PluginSet{
+			ProtocolVersion1: {"runner": &RunnerGRPCPlugin{ContextImpl: impl}},
+			ProtocolVersion2: {"runner": &RunnerGRPCPlugin{ContextImpl: impl}},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
+	}
+}
+
+// Serve serves impl as a plugin, from the plugin's main function. It returns once the agent stops the plugin.
+//
+//	func main() {
+//		runner.Serve(&MyPlugin{})
+//	}
+func Serve(impl ContextRunner) {
+	plugin.Serve(ServeConfig(impl))
+}
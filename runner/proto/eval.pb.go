@@ -77,6 +77,10 @@ type ExecutionStatus int32
 const (
 	ExecutionStatus_SUCCESS ExecutionStatus = 0
 	ExecutionStatus_FAILURE ExecutionStatus = 1
+	// UNAVAILABLE is reported by the agent, rather than plugins, when a plugin is paused after failing repeatedly.
+	ExecutionStatus_UNAVAILABLE ExecutionStatus = 2
+	// PARTIAL is reported by the agent on each chunk of a chunked result but the last, which has the result's status.
+	ExecutionStatus_PARTIAL ExecutionStatus = 3
 )
 
 // Enum value maps for ExecutionStatus.
@@ -84,10 +88,14 @@ var (
 	ExecutionStatus_name = map[int32]string{
 		0: "SUCCESS",
 		1: "FAILURE",
+		2: "UNAVAILABLE",
+		3: "PARTIAL",
 	}
 	ExecutionStatus_value = map[string]int32{
-		"SUCCESS": 0,
-		"FAILURE": 1,
+		"SUCCESS":     0,
+		"FAILURE":     1,
+		"UNAVAILABLE": 2,
+		"PARTIAL":     3,
 	}
 )
 
@@ -1085,6 +1093,192 @@ func (x *EvalResponse) GetLogs() []*LogEntry {
 	return nil
 }
 
+// *
+// EvalStreamResponse is one part of the response to EvalStream. Observations, findings, risks and logs are sent
+// one at a time as the plugin produces them, and Done is sent last. A stream which ends without Done is incomplete.
+type EvalStreamResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Item:
+	//
+	//	*EvalStreamResponse_Observation
+	//	*EvalStreamResponse_Finding
+	//	*EvalStreamResponse_Risk
+	//	*EvalStreamResponse_Log
+	//	*EvalStreamResponse_Done
+	Item          isEvalStreamResponse_Item `protobuf_oneof:"Item"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EvalStreamResponse) Reset() {
+	*x = EvalStreamResponse{}
+	mi := &file_runner_proto_eval_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EvalStreamResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EvalStreamResponse) ProtoMessage() {}
+
+func (x *EvalStreamResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_runner_proto_eval_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EvalStreamResponse.ProtoReflect.Descriptor instead.
+func (*EvalStreamResponse) Descriptor() ([]byte, []int) {
+	return file_runner_proto_eval_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *EvalStreamResponse) GetItem() isEvalStreamResponse_Item {
+	if x != nil {
+		return x.Item
+	}
+	return nil
+}
+
+func (x *EvalStreamResponse) GetObservation() *Observation {
+	if x != nil {
+		if x, ok := x.Item.(*EvalStreamResponse_Observation); ok {
+			return x.Observation
+		}
+	}
+	return nil
+}
+
+func (x *EvalStreamResponse) GetFinding() *Finding {
+	if x != nil {
+		if x, ok := x.Item.(*EvalStreamResponse_Finding); ok {
+			return x.Finding
+		}
+	}
+	return nil
+}
+
+func (x *EvalStreamResponse) GetRisk() *Risk {
+	if x != nil {
+		if x, ok := x.Item.(*EvalStreamResponse_Risk); ok {
+			return x.Risk
+		}
+	}
+	return nil
+}
+
+func (x *EvalStreamResponse) GetLog() *LogEntry {
+	if x != nil {
+		if x, ok := x.Item.(*EvalStreamResponse_Log); ok {
+			return x.Log
+		}
+	}
+	return nil
+}
+
+func (x *EvalStreamResponse) GetDone() *EvalStreamDone {
+	if x != nil {
+		if x, ok := x.Item.(*EvalStreamResponse_Done); ok {
+			return x.Done
+		}
+	}
+	return nil
+}
+
+type isEvalStreamResponse_Item interface {
+	isEvalStreamResponse_Item()
+}
+
+type EvalStreamResponse_Observation struct {
+	Observation *Observation `protobuf:"bytes,1,opt,name=Observation,proto3,oneof"`
+}
+
+type EvalStreamResponse_Finding struct {
+	Finding *Finding `protobuf:"bytes,2,opt,name=Finding,proto3,oneof"`
+}
+
+type EvalStreamResponse_Risk struct {
+	Risk *Risk `protobuf:"bytes,3,opt,name=Risk,proto3,oneof"`
+}
+
+type EvalStreamResponse_Log struct {
+	Log *LogEntry `protobuf:"bytes,4,opt,name=Log,proto3,oneof"`
+}
+
+type EvalStreamResponse_Done struct {
+	Done *EvalStreamDone `protobuf:"bytes,5,opt,name=Done,proto3,oneof"`
+}
+
+func (*EvalStreamResponse_Observation) isEvalStreamResponse_Item() {}
+
+func (*EvalStreamResponse_Finding) isEvalStreamResponse_Item() {}
+
+func (*EvalStreamResponse_Risk) isEvalStreamResponse_Item() {}
+
+func (*EvalStreamResponse_Log) isEvalStreamResponse_Item() {}
+
+func (*EvalStreamResponse_Done) isEvalStreamResponse_Item() {}
+
+// EvalStreamDone ends a response to EvalStream, with the status and title of the EvalResponse it assembles into.
+type EvalStreamDone struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        ExecutionStatus        `protobuf:"varint,1,opt,name=Status,proto3,enum=proto.ExecutionStatus" json:"Status,omitempty"`
+	Title         string                 `protobuf:"bytes,2,opt,name=Title,proto3" json:"Title,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EvalStreamDone) Reset() {
+	*x = EvalStreamDone{}
+	mi := &file_runner_proto_eval_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EvalStreamDone) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EvalStreamDone) ProtoMessage() {}
+
+func (x *EvalStreamDone) ProtoReflect() protoreflect.Message {
+	mi := &file_runner_proto_eval_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EvalStreamDone.ProtoReflect.Descriptor instead.
+func (*EvalStreamDone) Descriptor() ([]byte, []int) {
+	return file_runner_proto_eval_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *EvalStreamDone) GetStatus() ExecutionStatus {
+	if x != nil {
+		return x.Status
+	}
+	return ExecutionStatus_SUCCESS
+}
+
+func (x *EvalStreamDone) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
 var File_runner_proto_eval_proto protoreflect.FileDescriptor
 
 var file_runner_proto_eval_proto_rawDesc = []byte{
@@ -1226,15 +1420,38 @@ var file_runner_proto_eval_proto_rawDesc = []byte{
 	0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x52, 0x69, 0x73, 0x6b, 0x52, 0x05,
 	0x52, 0x69, 0x73, 0x6b, 0x73, 0x12, 0x23, 0x0a, 0x04, 0x4c, 0x6f, 0x67, 0x73, 0x18, 0x06, 0x20,
 	0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4c, 0x6f, 0x67, 0x45,
-	0x6e, 0x74, 0x72, 0x79, 0x52, 0x04, 0x4c, 0x6f, 0x67, 0x73, 0x2a, 0x43, 0x0a, 0x0d, 0x46, 0x69,
+	0x6e, 0x74, 0x72, 0x79, 0x52, 0x04, 0x4c, 0x6f, 0x67, 0x73, 0x22, 0xf5, 0x01, 0x0a, 0x12, 0x45,
+	0x76, 0x61, 0x6c, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x36, 0x0a, 0x0b, 0x4f, 0x62, 0x73, 0x65, 0x72, 0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4f,
+	0x62, 0x73, 0x65, 0x72, 0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x00, 0x52, 0x0b, 0x4f, 0x62,
+	0x73, 0x65, 0x72, 0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x2a, 0x0a, 0x07, 0x46, 0x69, 0x6e,
+	0x64, 0x69, 0x6e, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x2e, 0x46, 0x69, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x48, 0x00, 0x52, 0x07, 0x46, 0x69,
+	0x6e, 0x64, 0x69, 0x6e, 0x67, 0x12, 0x21, 0x0a, 0x04, 0x52, 0x69, 0x73, 0x6b, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x52, 0x69, 0x73, 0x6b,
+	0x48, 0x00, 0x52, 0x04, 0x52, 0x69, 0x73, 0x6b, 0x12, 0x23, 0x0a, 0x03, 0x4c, 0x6f, 0x67, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4c, 0x6f,
+	0x67, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x48, 0x00, 0x52, 0x03, 0x4c, 0x6f, 0x67, 0x12, 0x2b, 0x0a,
+	0x04, 0x44, 0x6f, 0x6e, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x76, 0x61, 0x6c, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x44, 0x6f,
+	0x6e, 0x65, 0x48, 0x00, 0x52, 0x04, 0x44, 0x6f, 0x6e, 0x65, 0x42, 0x06, 0x0a, 0x04, 0x49, 0x74,
+	0x65, 0x6d, 0x22, 0x56, 0x0a, 0x0e, 0x45, 0x76, 0x61, 0x6c, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d,
+	0x44, 0x6f, 0x6e, 0x65, 0x12, 0x2e, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x16, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x78, 0x65,
+	0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x06, 0x53, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x54, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x54, 0x69, 0x74, 0x6c, 0x65, 0x2a, 0x43, 0x0a, 0x0d, 0x46, 0x69,
 	0x6e, 0x64, 0x69, 0x6e, 0x67, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0b, 0x0a, 0x07, 0x55,
 	0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x4f, 0x50, 0x45, 0x4e,
 	0x10, 0x01, 0x12, 0x0d, 0x0a, 0x09, 0x4d, 0x49, 0x54, 0x49, 0x47, 0x41, 0x54, 0x45, 0x44, 0x10,
 	0x02, 0x12, 0x0c, 0x0a, 0x08, 0x52, 0x45, 0x53, 0x4f, 0x4c, 0x56, 0x45, 0x44, 0x10, 0x03, 0x2a,
-	0x2b, 0x0a, 0x0f, 0x45, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74,
+	0x49, 0x0a, 0x0f, 0x45, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74,
 	0x75, 0x73, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x55, 0x43, 0x43, 0x45, 0x53, 0x53, 0x10, 0x00, 0x12,
-	0x0b, 0x0a, 0x07, 0x46, 0x41, 0x49, 0x4c, 0x55, 0x52, 0x45, 0x10, 0x01, 0x42, 0x09, 0x5a, 0x07,
-	0x2e, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x0b, 0x0a, 0x07, 0x46, 0x41, 0x49, 0x4c, 0x55, 0x52, 0x45, 0x10, 0x01, 0x12, 0x0f, 0x0a, 0x0b,
+	0x55, 0x4e, 0x41, 0x56, 0x41, 0x49, 0x4c, 0x41, 0x42, 0x4c, 0x45, 0x10, 0x02, 0x12, 0x0b, 0x0a,
+	0x07, 0x50, 0x41, 0x52, 0x54, 0x49, 0x41, 0x4c, 0x10, 0x03, 0x42, 0x09, 0x5a, 0x07, 0x2e, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -1250,22 +1467,24 @@ func file_runner_proto_eval_proto_rawDescGZIP() []byte {
 }
 
 var file_runner_proto_eval_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_runner_proto_eval_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_runner_proto_eval_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
 var file_runner_proto_eval_proto_goTypes = []any{
-	(FindingStatus)(0),   // 0: proto.FindingStatus
-	(ExecutionStatus)(0), // 1: proto.ExecutionStatus
-	(*Property)(nil),     // 2: proto.Property
-	(*Link)(nil),         // 3: proto.Link
-	(*LogEntry)(nil),     // 4: proto.LogEntry
-	(*Evidence)(nil),     // 5: proto.Evidence
-	(*Finding)(nil),      // 6: proto.Finding
-	(*Observation)(nil),  // 7: proto.Observation
-	(*Step)(nil),         // 8: proto.Step
-	(*Task)(nil),         // 9: proto.Task
-	(*Activity)(nil),     // 10: proto.Activity
-	(*Risk)(nil),         // 11: proto.Risk
-	(*EvalRequest)(nil),  // 12: proto.EvalRequest
-	(*EvalResponse)(nil), // 13: proto.EvalResponse
+	(FindingStatus)(0),         // 0: proto.FindingStatus
+	(ExecutionStatus)(0),       // 1: proto.ExecutionStatus
+	(*Property)(nil),           // 2: proto.Property
+	(*Link)(nil),               // 3: proto.Link
+	(*LogEntry)(nil),           // 4: proto.LogEntry
+	(*Evidence)(nil),           // 5: proto.Evidence
+	(*Finding)(nil),            // 6: proto.Finding
+	(*Observation)(nil),        // 7: proto.Observation
+	(*Step)(nil),               // 8: proto.Step
+	(*Task)(nil),               // 9: proto.Task
+	(*Activity)(nil),           // 10: proto.Activity
+	(*Risk)(nil),               // 11: proto.Risk
+	(*EvalRequest)(nil),        // 12: proto.EvalRequest
+	(*EvalResponse)(nil),       // 13: proto.EvalResponse
+	(*EvalStreamResponse)(nil), // 14: proto.EvalStreamResponse
+	(*EvalStreamDone)(nil),     // 15: proto.EvalStreamDone
 }
 var file_runner_proto_eval_proto_depIdxs = []int32{
 	2,  // 0: proto.LogEntry.Props:type_name -> proto.Property
@@ -1287,11 +1506,17 @@ var file_runner_proto_eval_proto_depIdxs = []int32{
 	6,  // 16: proto.EvalResponse.Findings:type_name -> proto.Finding
 	11, // 17: proto.EvalResponse.Risks:type_name -> proto.Risk
 	4,  // 18: proto.EvalResponse.Logs:type_name -> proto.LogEntry
-	19, // [19:19] is the sub-list for method output_type
-	19, // [19:19] is the sub-list for method input_type
-	19, // [19:19] is the sub-list for extension type_name
-	19, // [19:19] is the sub-list for extension extendee
-	0,  // [0:19] is the sub-list for field type_name
+	7,  // 19: proto.EvalStreamResponse.Observation:type_name -> proto.Observation
+	6,  // 20: proto.EvalStreamResponse.Finding:type_name -> proto.Finding
+	11, // 21: proto.EvalStreamResponse.Risk:type_name -> proto.Risk
+	4,  // 22: proto.EvalStreamResponse.Log:type_name -> proto.LogEntry
+	15, // 23: proto.EvalStreamResponse.Done:type_name -> proto.EvalStreamDone
+	1,  // 24: proto.EvalStreamDone.Status:type_name -> proto.ExecutionStatus
+	25, // [25:25] is the sub-list for method output_type
+	25, // [25:25] is the sub-list for method input_type
+	25, // [25:25] is the sub-list for extension type_name
+	25, // [25:25] is the sub-list for extension extendee
+	0,  // [0:25] is the sub-list for field type_name
 }
 
 func init() { file_runner_proto_eval_proto_init() }
@@ -1299,13 +1524,20 @@ func file_runner_proto_eval_proto_init() {
 	if File_runner_proto_eval_proto != nil {
 		return
 	}
+	file_runner_proto_eval_proto_msgTypes[12].OneofWrappers = []any{
+		(*EvalStreamResponse_Observation)(nil),
+		(*EvalStreamResponse_Finding)(nil),
+		(*EvalStreamResponse_Risk)(nil),
+		(*EvalStreamResponse_Log)(nil),
+		(*EvalStreamResponse_Done)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_runner_proto_eval_proto_rawDesc,
 			NumEnums:      2,
-			NumMessages:   12,
+			NumMessages:   14,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -22,6 +22,8 @@ const (
 	Runner_Configure_FullMethodName      = "/proto.Runner/Configure"
 	Runner_PrepareForEval_FullMethodName = "/proto.Runner/PrepareForEval"
 	Runner_Eval_FullMethodName           = "/proto.Runner/Eval"
+	Runner_EvalStream_FullMethodName     = "/proto.Runner/EvalStream"
+	Runner_Info_FullMethodName           = "/proto.Runner/Info"
 )
 
 // RunnerClient is the client API for Runner service.
@@ -31,6 +33,9 @@ type RunnerClient interface {
 	Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error)
 	PrepareForEval(ctx context.Context, in *PrepareForEvalRequest, opts ...grpc.CallOption) (*PrepareForEvalResponse, error)
 	Eval(ctx context.Context, in *EvalRequest, opts ...grpc.CallOption) (*EvalResponse, error)
+	// EvalStream is Eval with the response streamed, so it isn't limited by the maximum message size.
+	EvalStream(ctx context.Context, in *EvalRequest, opts ...grpc.CallOption) (Runner_EvalStreamClient, error)
+	Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error)
 }
 
 type runnerClient struct {
@@ -68,6 +73,47 @@ func (c *runnerClient) Eval(ctx context.Context, in *EvalRequest, opts ...grpc.C
 	return out, nil
 }
 
+func (c *runnerClient) EvalStream(ctx context.Context, in *EvalRequest, opts ...grpc.CallOption) (Runner_EvalStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Runner_ServiceDesc.Streams[0], Runner_EvalStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &runnerEvalStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Runner_EvalStreamClient interface {
+	Recv() (*EvalStreamResponse, error)
+	grpc.ClientStream
+}
+
+type runnerEvalStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *runnerEvalStreamClient) Recv() (*EvalStreamResponse, error) {
+	m := new(EvalStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *runnerClient) Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error) {
+	out := new(InfoResponse)
+	err := c.cc.Invoke(ctx, Runner_Info_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // RunnerServer is the server API for Runner service.
 // All implementations should embed UnimplementedRunnerServer
 // for forward compatibility
@@ -75,6 +121,9 @@ type RunnerServer interface {
 	Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error)
 	PrepareForEval(context.Context, *PrepareForEvalRequest) (*PrepareForEvalResponse, error)
 	Eval(context.Context, *EvalRequest) (*EvalResponse, error)
+	// EvalStream is Eval with the response streamed, so it isn't limited by the maximum message size.
+	EvalStream(*EvalRequest, Runner_EvalStreamServer) error
+	Info(context.Context, *InfoRequest) (*InfoResponse, error)
 }
 
 // UnimplementedRunnerServer should be embedded to have forward compatible implementations.
@@ -90,6 +139,12 @@ func (UnimplementedRunnerServer) PrepareForEval(context.Context, *PrepareForEval
 func (UnimplementedRunnerServer) Eval(context.Context, *EvalRequest) (*EvalResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Eval not implemented")
 }
+func (UnimplementedRunnerServer) EvalStream(*EvalRequest, Runner_EvalStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method EvalStream not implemented")
+}
+func (UnimplementedRunnerServer) Info(context.Context, *InfoRequest) (*InfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Info not implemented")
+}
 
 // UnsafeRunnerServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to RunnerServer will
@@ -156,6 +211,45 @@ func _Runner_Eval_Handler(srv interface{}, ctx context.Context, dec func(interfa
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Runner_EvalStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EvalRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RunnerServer).EvalStream(m, &runnerEvalStreamServer{stream})
+}
+
+type Runner_EvalStreamServer interface {
+	Send(*EvalStreamResponse) error
+	grpc.ServerStream
+}
+
+type runnerEvalStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *runnerEvalStreamServer) Send(m *EvalStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Runner_Info_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunnerServer).Info(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Runner_Info_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunnerServer).Info(ctx, req.(*InfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Runner_ServiceDesc is the grpc.ServiceDesc for Runner service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -175,6 +269,297 @@ var Runner_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Eval",
 			Handler:    _Runner_Eval_Handler,
 		},
+		{
+			MethodName: "Info",
+			Handler:    _Runner_Info_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "EvalStream",
+			Handler:       _Runner_EvalStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "runner/proto/runner.proto",
+}
+
+const (
+	Host_EvalPolicy_FullMethodName  = "/proto.Host/EvalPolicy"
+	Host_Log_FullMethodName         = "/proto.Host/Log"
+	Host_CacheGet_FullMethodName    = "/proto.Host/CacheGet"
+	Host_CacheSet_FullMethodName    = "/proto.Host/CacheSet"
+	Host_CacheDelete_FullMethodName = "/proto.Host/CacheDelete"
+	Host_Progress_FullMethodName    = "/proto.Host/Progress"
+)
+
+// HostClient is the client API for Host service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type HostClient interface {
+	// EvalPolicy evaluates a policy bundle with the agent's policy manager.
+	EvalPolicy(ctx context.Context, in *HostEvalPolicyRequest, opts ...grpc.CallOption) (*HostEvalPolicyResponse, error)
+	// Log adds a log entry to the result of the evaluation in progress.
+	Log(ctx context.Context, in *HostLogRequest, opts ...grpc.CallOption) (*Empty, error)
+	// CacheGet, CacheSet and CacheDelete use a persistent key-value cache, scoped to the plugin.
+	CacheGet(ctx context.Context, in *HostCacheGetRequest, opts ...grpc.CallOption) (*HostCacheGetResponse, error)
+	CacheSet(ctx context.Context, in *HostCacheSetRequest, opts ...grpc.CallOption) (*Empty, error)
+	CacheDelete(ctx context.Context, in *HostCacheDeleteRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Progress reports how far the plugin is through its current call.
+	Progress(ctx context.Context, in *HostProgressRequest, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type hostClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewHostClient(cc grpc.ClientConnInterface) HostClient {
+	return &hostClient{cc}
+}
+
+func (c *hostClient) EvalPolicy(ctx context.Context, in *HostEvalPolicyRequest, opts ...grpc.CallOption) (*HostEvalPolicyResponse, error) {
+	out := new(HostEvalPolicyResponse)
+	err := c.cc.Invoke(ctx, Host_EvalPolicy_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) Log(ctx context.Context, in *HostLogRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, Host_Log_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) CacheGet(ctx context.Context, in *HostCacheGetRequest, opts ...grpc.CallOption) (*HostCacheGetResponse, error) {
+	out := new(HostCacheGetResponse)
+	err := c.cc.Invoke(ctx, Host_CacheGet_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) CacheSet(ctx context.Context, in *HostCacheSetRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, Host_CacheSet_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) CacheDelete(ctx context.Context, in *HostCacheDeleteRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, Host_CacheDelete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) Progress(ctx context.Context, in *HostProgressRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, Host_Progress_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// HostServer is the server API for Host service.
+// All implementations should embed UnimplementedHostServer
+// for forward compatibility
+type HostServer interface {
+	// EvalPolicy evaluates a policy bundle with the agent's policy manager.
+	EvalPolicy(context.Context, *HostEvalPolicyRequest) (*HostEvalPolicyResponse, error)
+	// Log adds a log entry to the result of the evaluation in progress.
+	Log(context.Context, *HostLogRequest) (*Empty, error)
+	// CacheGet, CacheSet and CacheDelete use a persistent key-value cache, scoped to the plugin.
+	CacheGet(context.Context, *HostCacheGetRequest) (*HostCacheGetResponse, error)
+	CacheSet(context.Context, *HostCacheSetRequest) (*Empty, error)
+	CacheDelete(context.Context, *HostCacheDeleteRequest) (*Empty, error)
+	// Progress reports how far the plugin is through its current call.
+	Progress(context.Context, *HostProgressRequest) (*Empty, error)
+}
+
+// UnimplementedHostServer should be embedded to have forward compatible implementations.
+type UnimplementedHostServer struct {
+}
+
+func (UnimplementedHostServer) EvalPolicy(context.Context, *HostEvalPolicyRequest) (*HostEvalPolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EvalPolicy not implemented")
+}
+func (UnimplementedHostServer) Log(context.Context, *HostLogRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Log not implemented")
+}
+func (UnimplementedHostServer) CacheGet(context.Context, *HostCacheGetRequest) (*HostCacheGetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheGet not implemented")
+}
+func (UnimplementedHostServer) CacheSet(context.Context, *HostCacheSetRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheSet not implemented")
+}
+func (UnimplementedHostServer) CacheDelete(context.Context, *HostCacheDeleteRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheDelete not implemented")
+}
+func (UnimplementedHostServer) Progress(context.Context, *HostProgressRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Progress not implemented")
+}
+
+// UnsafeHostServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to HostServer will
+// result in compilation errors.
+type UnsafeHostServer interface {
+	mustEmbedUnimplementedHostServer()
+}
+
+func RegisterHostServer(s grpc.ServiceRegistrar, srv HostServer) {
+	s.RegisterService(&Host_ServiceDesc, srv)
+}
+
+func _Host_EvalPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HostEvalPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).EvalPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Host_EvalPolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).EvalPolicy(ctx, req.(*HostEvalPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_Log_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HostLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).Log(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Host_Log_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).Log(ctx, req.(*HostLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_CacheGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HostCacheGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).CacheGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Host_CacheGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).CacheGet(ctx, req.(*HostCacheGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_CacheSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HostCacheSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).CacheSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Host_CacheSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).CacheSet(ctx, req.(*HostCacheSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_CacheDelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HostCacheDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).CacheDelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Host_CacheDelete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).CacheDelete(ctx, req.(*HostCacheDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_Progress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HostProgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).Progress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Host_Progress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).Progress(ctx, req.(*HostProgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Host_ServiceDesc is the grpc.ServiceDesc for Host service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Host_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Host",
+	HandlerType: (*HostServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "EvalPolicy",
+			Handler:    _Host_EvalPolicy_Handler,
+		},
+		{
+			MethodName: "Log",
+			Handler:    _Host_Log_Handler,
+		},
+		{
+			MethodName: "CacheGet",
+			Handler:    _Host_CacheGet_Handler,
+		},
+		{
+			MethodName: "CacheSet",
+			Handler:    _Host_CacheSet_Handler,
+		},
+		{
+			MethodName: "CacheDelete",
+			Handler:    _Host_CacheDelete_Handler,
+		},
+		{
+			MethodName: "Progress",
+			Handler:    _Host_Progress_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "runner/proto/runner.proto",
@@ -4,6 +4,16 @@ import (
 	"github.com/compliance-framework/framework/runner/proto"
 )
 
+// Labels of each chunk of a result the agent publishes in chunks, which the API assembles back into one result.
+const (
+	// LabelChunk is the number of the chunk, starting from 1.
+	LabelChunk = "_chunk"
+	// LabelChunkRun identifies the evaluation the chunk is part of.
+	LabelChunkRun = "_chunk_run"
+	// LabelChunks is the number of chunks in the result, and is only set on the last.
+	LabelChunks = "_chunks"
+)
+
 type Result struct {
 	Title        string                `json:"title"`
 	Status       proto.ExecutionStatus `json:"status"`
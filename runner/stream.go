@@ -0,0 +1,255 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	proto2 "github.com/compliance-framework/framework/runner/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StreamEvaluator is implemented by plugins which emit the observations, findings, risks and logs of an
+// evaluation as they go, rather than returning them all at once from Eval. Responses are then neither limited by
+// the maximum gRPC message size, nor held in the plugin's memory.
+//
+// It is optional. The response of plugins which only implement Eval is streamed to the agent once Eval returns.
+type StreamEvaluator interface {
+	EvalStream(ctx context.Context, request *proto2.EvalRequest, response *StreamingEvalResponse) error
+}
+
+// StreamingEvalResponse is the streaming counterpart of CallableEvalResponse. Each item is sent as it is added,
+// and the Status and Title are sent once EvalStream returns.
+type StreamingEvalResponse struct {
+	Status proto2.ExecutionStatus
+	Title  string
+
+	send func(*proto2.EvalStreamResponse) error
+}
+
+// NewStreamingEvalResponse returns a response which passes each part to send. It is created by the framework
+// when serving EvalStream, and can be used to test a StreamEvaluator directly.
+func NewStreamingEvalResponse(send func(*proto2.EvalStreamResponse) error) *StreamingEvalResponse {
+	return &StreamingEvalResponse{
+		Status: proto2.ExecutionStatus_SUCCESS,
+		send:   send,
+	}
+}
+
+func (eval *StreamingEvalResponse) AddObservation(observation *proto2.Observation) error {
+	return eval.send(&proto2.EvalStreamResponse{Item: &proto2.EvalStreamResponse_Observation{Observation: observation}})
+}
+
+func (eval *StreamingEvalResponse) AddFinding(finding *proto2.Finding) error {
+	return eval.send(&proto2.EvalStreamResponse{Item: &proto2.EvalStreamResponse_Finding{Finding: finding}})
+}
+
+func (eval *StreamingEvalResponse) AddLogEntry(logEntry *proto2.LogEntry) error {
+	return eval.send(&proto2.EvalStreamResponse{Item: &proto2.EvalStreamResponse_Log{Log: logEntry}})
+}
+
+func (eval *StreamingEvalResponse) AddRiskEntry(risk *proto2.Risk) error {
+	return eval.send(&proto2.EvalStreamResponse{Item: &proto2.EvalStreamResponse_Risk{Risk: risk}})
+}
+
+// addAll sends every item of a complete response, and takes its status and title.
+func (eval *StreamingEvalResponse) addAll(res *proto2.EvalResponse) error {
+	eval.Status = res.Status
+	eval.Title = res.Title
+	for _, observation := range res.Observations {
+		if err := eval.AddObservation(observation); err != nil {
+			return err
+		}
+	}
+	for _, finding := range res.Findings {
+		if err := eval.AddFinding(finding); err != nil {
+			return err
+		}
+	}
+	for _, risk := range res.Risks {
+		if err := eval.AddRiskEntry(risk); err != nil {
+			return err
+		}
+	}
+	for _, logEntry := range res.Logs {
+		if err := eval.AddLogEntry(logEntry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// done ends the response with its status and title.
+func (eval *StreamingEvalResponse) done() error {
+	return eval.send(&proto2.EvalStreamResponse{Item: &proto2.EvalStreamResponse_Done{Done: &proto2.EvalStreamDone{
+		Status: eval.Status,
+		Title:  eval.Title,
+	}}})
+}
+
+// Eval evaluates a policy with the plugin r, streaming the response if the plugin supports it, and assembles
+// it into a single response. Plugins built before EvalStream was added are evaluated with Eval.
+func Eval(ctx context.Context, r ContextRunner, request *proto2.EvalRequest) (*proto2.EvalResponse, error) {
+	evaluator, ok := r.(StreamEvaluator)
+	if !ok {
+		return r.Eval(ctx, request)
+	}
+
+	assembled := NewCallableEvalResponse()
+	received := false
+	response := NewStreamingEvalResponse(func(part *proto2.EvalStreamResponse) error {
+		received = true
+		addPart(assembled, part)
+		return nil
+	})
+
+	err := evaluator.EvalStream(ctx, request, response)
+	if !received && status.Code(err) == codes.Unimplemented {
+		return r.Eval(ctx, request)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	assembled.Status = response.Status
+	assembled.Title = response.Title
+	return assembled.Result(), nil
+}
+
+// EvalChunked evaluates a policy with the plugin r as Eval does, but splits the response into chunks of at most
+// chunkSize observations, findings, risks and log entries. Each chunk but the last is passed to publish as soon
+// as it is full, so a large response is neither held in memory nor published as a single message. The last chunk
+// is returned, with the response's status and title. Earlier chunks have no title, and the PARTIAL status, as the
+// response's status isn't known until it is complete.
+//
+// If chunkSize is zero, the response isn't split, and is returned whole as by Eval.
+func EvalChunked(ctx context.Context, r ContextRunner, request *proto2.EvalRequest, chunkSize int, publish func(chunk *proto2.EvalResponse) error) (*proto2.EvalResponse, error) {
+	if chunkSize <= 0 {
+		return Eval(ctx, r, request)
+	}
+
+	chunk := NewCallableEvalResponse()
+	items := 0
+	add := func(part *proto2.EvalStreamResponse) error {
+		// Full chunks are only published once another item arrives, so the last chunk is never empty.
+		if items == chunkSize {
+			chunk.Status = proto2.ExecutionStatus_PARTIAL
+			if err := publish(chunk.Result()); err != nil {
+				return err
+			}
+			chunk = NewCallableEvalResponse()
+			items = 0
+		}
+		if addPart(chunk, part) {
+			items++
+		}
+		return nil
+	}
+
+	response, err := evalParts(ctx, r, request, add)
+	if err != nil {
+		return nil, err
+	}
+	chunk.Status = response.Status
+	chunk.Title = response.Title
+	return chunk.Result(), nil
+}
+
+// addPart adds the item in part to res, returning false if it has none.
+func addPart(res *CallableEvalResponse, part *proto2.EvalStreamResponse) bool {
+	switch item := part.Item.(type) {
+	case *proto2.EvalStreamResponse_Observation:
+		res.AddObservation(item.Observation)
+	case *proto2.EvalStreamResponse_Finding:
+		res.AddFinding(item.Finding)
+	case *proto2.EvalStreamResponse_Risk:
+		res.AddRiskEntry(item.Risk)
+	case *proto2.EvalStreamResponse_Log:
+		res.AddLogEntry(item.Log)
+	default:
+		return false
+	}
+	return true
+}
+
+// evalParts evaluates a policy with the plugin r, passing each item of the response to send as it is received.
+// The response of plugins which don't implement EvalStream is passed item by item once Eval returns.
+func evalParts(ctx context.Context, r ContextRunner, request *proto2.EvalRequest, send func(*proto2.EvalStreamResponse) error) (*StreamingEvalResponse, error) {
+	received := false
+	response := NewStreamingEvalResponse(func(part *proto2.EvalStreamResponse) error {
+		received = true
+		return send(part)
+	})
+
+	if evaluator, ok := r.(StreamEvaluator); ok {
+		err := evaluator.EvalStream(ctx, request, response)
+		if received || status.Code(err) != codes.Unimplemented {
+			return response, err
+		}
+	}
+
+	res, err := r.Eval(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response, response.addAll(res)
+}
+
+// errIncompleteStream is returned when a plugin's response to EvalStream ends before it is done.
+var errIncompleteStream = errors.New("plugin ended the response stream before it was done")
+
+// EvalStream receives each part of the plugin's streamed response and adds it to response. Use the package Eval
+// function to assemble the response, and to evaluate plugins which don't implement EvalStream.
+func (m *GRPCClient) EvalStream(ctx context.Context, req *proto2.EvalRequest, response *StreamingEvalResponse) error {
+	if err := m.requireVersion("EvalStream", ProtocolVersion2); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := m.client.EvalStream(outgoingContext(ctx), req)
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return errIncompleteStream
+		}
+		if err != nil {
+			return err
+		}
+		if done, ok := part.Item.(*proto2.EvalStreamResponse_Done); ok {
+			response.Status = done.Done.Status
+			response.Title = done.Done.Title
+			return nil
+		}
+		if err := response.send(part); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *GRPCServer) EvalStream(req *proto2.EvalRequest, stream proto2.Runner_EvalStreamServer) error {
+	ctx := m.context(stream.Context())
+	response := NewStreamingEvalResponse(stream.Send)
+
+	if evaluator, ok := m.Impl.(StreamEvaluator); ok {
+		if err := evaluator.EvalStream(ctx, req, response); err != nil {
+			return err
+		}
+		return response.done()
+	}
+
+	// The response of plugins which only implement Eval is still streamed, so it isn't limited by the maximum
+	// message size on its way to the agent.
+	res, err := m.Impl.Eval(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := response.addAll(res); err != nil {
+		return err
+	}
+	return response.done()
+}
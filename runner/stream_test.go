@@ -0,0 +1,198 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamRunner streams observations, and fails after sending them if err is set.
+type streamRunner struct {
+	contextRunner
+	observations int
+	description  string
+	err          error
+}
+
+func (r *streamRunner) EvalStream(ctx context.Context, req *proto.EvalRequest, response *StreamingEvalResponse) error {
+	for i := 0; i < r.observations; i++ {
+		if err := response.AddObservation(&proto.Observation{Id: fmt.Sprint(i), Description: r.description}); err != nil {
+			return err
+		}
+	}
+	if err := response.AddFinding(&proto.Finding{Title: "finding"}); err != nil {
+		return err
+	}
+	response.Title = req.BundlePath
+	response.Status = proto.ExecutionStatus_FAILURE
+	return r.err
+}
+
+// evalRunner returns observations from Eval, without implementing EvalStream.
+type evalRunner struct {
+	contextRunner
+	observations int
+}
+
+func (r *evalRunner) Eval(ctx context.Context, req *proto.EvalRequest) (*proto.EvalResponse, error) {
+	res := NewCallableEvalResponse()
+	res.Title = req.BundlePath
+	for i := 0; i < r.observations; i++ {
+		res.AddObservation(&proto.Observation{Id: fmt.Sprint(i)})
+	}
+	return res.Result(), nil
+}
+
+// unstreamedServer serves a plugin built before EvalStream was added.
+type unstreamedServer struct {
+	*GRPCServer
+}
+
+func (s *unstreamedServer) EvalStream(req *proto.EvalRequest, stream proto.Runner_EvalStreamServer) error {
+	return status.Error(codes.Unimplemented, "method EvalStream not implemented")
+}
+
+func TestGRPC_EvalStream(t *testing.T) {
+	t.Run("Responses larger than the maximum message size are streamed", func(t *testing.T) {
+		// Together, the observations are larger than gRPC's default 4MB limit.
+		r := dispenseRunner(t, &streamRunner{observations: 5000, description: strings.Repeat("x", 1024)})
+
+		res, err := Eval(context.Background(), r, &proto.EvalRequest{BundlePath: "bundle"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(res.Observations) != 5000 || res.Observations[4999].Id != "4999" {
+			t.Errorf("Expected every observation in order, got %d", len(res.Observations))
+		}
+		if len(res.Findings) != 1 {
+			t.Errorf("Expected one finding, got %d", len(res.Findings))
+		}
+		if res.Title != "bundle" || res.Status != proto.ExecutionStatus_FAILURE {
+			t.Errorf("Expected the title and status set by the plugin, got %q and %s", res.Title, res.Status)
+		}
+	})
+
+	t.Run("Errors after streaming items are returned", func(t *testing.T) {
+		r := dispenseRunner(t, &streamRunner{observations: 10, err: errors.New("scan failed")})
+
+		_, err := Eval(context.Background(), r, &proto.EvalRequest{})
+		if err == nil || !strings.Contains(err.Error(), "scan failed") {
+			t.Errorf("Expected the plugin's error, got %v", err)
+		}
+	})
+
+	t.Run("Responses of plugins which only implement Eval are streamed", func(t *testing.T) {
+		r := dispenseRunner(t, FromLegacy(&legacyTestRunner{}))
+
+		res, err := Eval(context.Background(), r, &proto.EvalRequest{BundlePath: "bundle"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if res.Title != "bundle" {
+			t.Errorf("res.Title: got %s, want %s", res.Title, "bundle")
+		}
+	})
+
+	t.Run("Plugins without EvalStream are evaluated with Eval", func(t *testing.T) {
+		conn, server := plugin.TestGRPCConn(t, func(s *grpc.Server) {
+			proto.RegisterRunnerServer(s, &unstreamedServer{&GRPCServer{Impl: FromLegacy(&legacyTestRunner{})}})
+		})
+		t.Cleanup(func() {
+			conn.Close()
+			server.Stop()
+		})
+		r := &GRPCClient{client: proto.NewRunnerClient(conn), protocolVersion: ProtocolVersion2}
+
+		res, err := Eval(context.Background(), r, &proto.EvalRequest{BundlePath: "bundle"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if res.Title != "bundle" {
+			t.Errorf("res.Title: got %s, want %s", res.Title, "bundle")
+		}
+	})
+}
+
+func TestEvalChunked(t *testing.T) {
+	t.Run("Large responses are split into chunks as they are received", func(t *testing.T) {
+		r := dispenseRunner(t, &streamRunner{observations: 2500})
+
+		chunks := []*proto.EvalResponse{}
+		last, err := EvalChunked(context.Background(), r, &proto.EvalRequest{BundlePath: "bundle"}, 1000, func(chunk *proto.EvalResponse) error {
+			chunks = append(chunks, chunk)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(chunks) != 2 || len(chunks[0].Observations) != 1000 || len(chunks[1].Observations) != 1000 {
+			t.Fatalf("Expected two full chunks to be published, got %d", len(chunks))
+		}
+		if chunks[1].Observations[0].Id != "1000" {
+			t.Errorf("Expected chunks in order, got %+v", chunks[1].Observations[0])
+		}
+		if chunks[0].Status != proto.ExecutionStatus_PARTIAL || chunks[1].Status != proto.ExecutionStatus_PARTIAL {
+			t.Errorf("Expected chunks before the last to be partial, got %s and %s", chunks[0].Status, chunks[1].Status)
+		}
+		if len(last.Observations) != 500 || len(last.Findings) != 1 {
+			t.Errorf("Expected the remaining items in the last chunk, got %d observations and %d findings", len(last.Observations), len(last.Findings))
+		}
+		if last.Title != "bundle" || last.Status != proto.ExecutionStatus_FAILURE {
+			t.Errorf("Expected the title and status set by the plugin on the last chunk, got %q and %s", last.Title, last.Status)
+		}
+	})
+
+	t.Run("The last chunk is never empty", func(t *testing.T) {
+		r := dispenseRunner(t, &streamRunner{observations: 9})
+
+		published := 0
+		last, err := EvalChunked(context.Background(), r, &proto.EvalRequest{}, 5, func(chunk *proto.EvalResponse) error {
+			published++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if published != 1 || len(last.Observations) != 4 || len(last.Findings) != 1 {
+			t.Errorf("Expected a full chunk and the remaining items, got %d chunks and %d observations", published, len(last.Observations))
+		}
+	})
+
+	t.Run("Responses of plugins which only implement Eval are split", func(t *testing.T) {
+		r := dispenseRunner(t, &evalRunner{observations: 3})
+
+		published := 0
+		last, err := EvalChunked(context.Background(), r, &proto.EvalRequest{BundlePath: "bundle"}, 1, func(chunk *proto.EvalResponse) error {
+			published++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if published != 2 || len(last.Observations) != 1 {
+			t.Errorf("Expected a chunk for each observation, got %d published and %d in the last", published, len(last.Observations))
+		}
+		if last.Title != "bundle" {
+			t.Errorf("res.Title: got %s, want %s", last.Title, "bundle")
+		}
+	})
+
+	t.Run("Errors publishing chunks stop the evaluation", func(t *testing.T) {
+		r := dispenseRunner(t, &streamRunner{observations: 10})
+
+		_, err := EvalChunked(context.Background(), r, &proto.EvalRequest{}, 2, func(chunk *proto.EvalResponse) error {
+			return errors.New("publish failed")
+		})
+		if err == nil || !strings.Contains(err.Error(), "publish failed") {
+			t.Errorf("Expected the publishing error, got %v", err)
+		}
+	})
+}
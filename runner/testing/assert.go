@@ -0,0 +1,158 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	gotesting "testing"
+
+	"github.com/compliance-framework/framework/runner/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// AssertStatus fails the test unless res has status.
+func AssertStatus(t gotesting.TB, res *proto.EvalResponse, status proto.ExecutionStatus) {
+	t.Helper()
+	if res.GetStatus() != status {
+		t.Errorf("Expected status %s, got %s: %q", status, res.GetStatus(), res.GetTitle())
+	}
+}
+
+// AssertSuccess fails the test unless res succeeded.
+func AssertSuccess(t gotesting.TB, res *proto.EvalResponse) {
+	t.Helper()
+	AssertStatus(t, res, proto.ExecutionStatus_SUCCESS)
+}
+
+// AssertObservation returns the observation in res with title, failing the test if there isn't one.
+func AssertObservation(t gotesting.TB, res *proto.EvalResponse, title string) *proto.Observation {
+	t.Helper()
+	titles := []string{}
+	for _, observation := range res.GetObservations() {
+		if observation.GetTitle() == title {
+			return observation
+		}
+		titles = append(titles, observation.GetTitle())
+	}
+	t.Fatalf("Expected an observation titled %q, got %q", title, titles)
+	return nil
+}
+
+// AssertFinding returns the finding in res with title, failing the test if there isn't one.
+func AssertFinding(t gotesting.TB, res *proto.EvalResponse, title string) *proto.Finding {
+	t.Helper()
+	titles := []string{}
+	for _, finding := range res.GetFindings() {
+		if finding.GetTitle() == title {
+			return finding
+		}
+		titles = append(titles, finding.GetTitle())
+	}
+	t.Fatalf("Expected a finding titled %q, got %q", title, titles)
+	return nil
+}
+
+// AssertRisk returns the risk in res with title, failing the test if there isn't one.
+func AssertRisk(t gotesting.TB, res *proto.EvalResponse, title string) *proto.Risk {
+	t.Helper()
+	titles := []string{}
+	for _, risk := range res.GetRisks() {
+		if risk.GetTitle() == title {
+			return risk
+		}
+		titles = append(titles, risk.GetTitle())
+	}
+	t.Fatalf("Expected a risk titled %q, got %q", title, titles)
+	return nil
+}
+
+// AssertLog returns the log entry in res with title, failing the test if there isn't one.
+func AssertLog(t gotesting.TB, res *proto.EvalResponse, title string) *proto.LogEntry {
+	t.Helper()
+	titles := []string{}
+	for _, entry := range res.GetLogs() {
+		if entry.GetTitle() == title {
+			return entry
+		}
+		titles = append(titles, entry.GetTitle())
+	}
+	t.Fatalf("Expected a log entry titled %q, got %q", title, titles)
+	return nil
+}
+
+// AssertCounts fails the test unless res has the given numbers of observations, findings and risks.
+func AssertCounts(t gotesting.TB, res *proto.EvalResponse, observations, findings, risks int) {
+	t.Helper()
+	if len(res.GetObservations()) != observations {
+		t.Errorf("Expected %d observations, got %d", observations, len(res.GetObservations()))
+	}
+	if len(res.GetFindings()) != findings {
+		t.Errorf("Expected %d findings, got %d", findings, len(res.GetFindings()))
+	}
+	if len(res.GetRisks()) != risks {
+		t.Errorf("Expected %d risks, got %d", risks, len(res.GetRisks()))
+	}
+}
+
+// UpdateGoldenEnv is the environment variable which, when set to true, makes AssertGolden write golden files
+// instead of comparing against them:
+//
+//	CF_UPDATE_GOLDEN=true go test ./...
+const UpdateGoldenEnv = "CF_UPDATE_GOLDEN"
+
+var (
+	uuidPattern      = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	timestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`)
+)
+
+// Snapshot returns res as indented JSON, with the UUIDs and RFC 3339 timestamps plugins generate for each run
+// replaced by <uuid> and <timestamp>, so it is the same every run.
+func Snapshot(res *proto.EvalResponse) ([]byte, error) {
+	content, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	// protojson's output deliberately isn't stable, so it is indented again.
+	out := bytes.Buffer{}
+	if err := json.Indent(&out, content, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	snapshot := uuidPattern.ReplaceAll(out.Bytes(), []byte("<uuid>"))
+	return timestampPattern.ReplaceAll(snapshot, []byte("<timestamp>")), nil
+}
+
+// AssertGolden fails the test unless the Snapshot of res matches the golden file at path. The golden file is
+// written instead if UpdateGoldenEnv is set.
+func AssertGolden(t gotesting.TB, res *proto.EvalResponse, path string) {
+	t.Helper()
+	snapshot, err := Snapshot(res)
+	if err != nil {
+		t.Fatalf("Error snapshotting result: %v", err)
+	}
+
+	if os.Getenv(UpdateGoldenEnv) == "true" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Error writing golden file: %v", err)
+		}
+		if err := os.WriteFile(path, snapshot, 0644); err != nil {
+			t.Fatalf("Error writing golden file: %v", err)
+		}
+		t.Logf("Wrote golden file %s", path)
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Golden file %s doesn't exist. Run the tests with %s=true to write it.", path, UpdateGoldenEnv)
+	}
+	if err != nil {
+		t.Fatalf("Error reading golden file: %v", err)
+	}
+	if !bytes.Equal(golden, snapshot) {
+		t.Errorf("Result doesn't match golden file %s. Run the tests with %s=true to update it.\nwant:\n%s\ngot:\n%s", path, UpdateGoldenEnv, golden, snapshot)
+	}
+}
@@ -0,0 +1,136 @@
+// Package testing runs plugins in tests, without building them or running the agent. A Harness serves a Runner
+// in-process over the same gRPC path the agent uses, with a fake of the agent's host services, so plugins can be
+// tested with ordinary go test suites. As the package shares its name with the standard library's testing, it
+// is usually imported as runnertesting:
+//
+//	func TestPlugin(t *testing.T) {
+//		h := runnertesting.New(t, &MyPlugin{})
+//		results := h.Run(runnertesting.LoadFixture(t, "testdata/fixture.json"))
+//
+//		runnertesting.AssertSuccess(t, results[0])
+//		runnertesting.AssertFinding(t, results[0], "SSH root login is disabled")
+//		runnertesting.AssertGolden(t, results[0], "testdata/results.golden.json")
+//	}
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	gotesting "testing"
+
+	"github.com/compliance-framework/framework/runner"
+	"github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-plugin"
+)
+
+// Harness runs a plugin for a test. Each call fails the test if the plugin returns an error. To test errors,
+// call the plugin through Runner instead.
+type Harness struct {
+	t gotesting.TB
+	// Runner is the client side of the plugin, as the agent sees it.
+	Runner runner.ContextRunner
+	// Host is the fake host services served to the plugin.
+	Host *FakeHost
+}
+
+// New serves impl for the duration of the test, speaking the latest protocol version, and returns a harness
+// calling it.
+func New(t gotesting.TB, impl runner.ContextRunner) *Harness {
+	t.Helper()
+	host := NewFakeHost()
+	client, _ := plugin.TestPluginGRPCConn(t, false, map[string]plugin.Plugin{
+		"runner": &runner.RunnerGRPCPlugin{ContextImpl: impl, Host: host, Version: runner.ProtocolVersion2},
+	})
+	// Closing the client stops the server too, as the agent stops plugins.
+	t.Cleanup(func() { client.Close() })
+
+	raw, err := client.Dispense("runner")
+	if err != nil {
+		t.Fatalf("Error dispensing plugin: %v", err)
+	}
+	return &Harness{t: t, Runner: raw.(runner.ContextRunner), Host: host}
+}
+
+// Info returns how the plugin describes itself, or nil if it doesn't implement Info.
+func (h *Harness) Info() *proto.InfoResponse {
+	h.t.Helper()
+	info, err := runner.Info(context.Background(), h.Runner)
+	if err != nil {
+		h.t.Fatalf("Error describing plugin: %v", err)
+	}
+	return info
+}
+
+// Configure configures the plugin with config.
+func (h *Harness) Configure(config map[string]string) *proto.ConfigureResponse {
+	h.t.Helper()
+	res, err := h.Runner.Configure(context.Background(), &proto.ConfigureRequest{Config: config})
+	if err != nil {
+		h.t.Fatalf("Error configuring plugin: %v", err)
+	}
+	return res
+}
+
+// PrepareForEval prepares the plugin to be evaluated.
+func (h *Harness) PrepareForEval() *proto.PrepareForEvalResponse {
+	h.t.Helper()
+	res, err := h.Runner.PrepareForEval(context.Background(), &proto.PrepareForEvalRequest{})
+	if err != nil {
+		h.t.Fatalf("Error preparing plugin: %v", err)
+	}
+	return res
+}
+
+// Eval evaluates the plugin against the policy bundle at bundlePath, streaming the response if the plugin
+// supports it, as the agent does. Entries the plugin logs with the host's Log are included in the response.
+func (h *Harness) Eval(bundlePath string) *proto.EvalResponse {
+	h.t.Helper()
+	h.Host.beginEval(bundlePath)
+	res, err := runner.Eval(context.Background(), h.Runner, &proto.EvalRequest{BundlePath: bundlePath})
+	logs := h.Host.endEval()
+	if err != nil {
+		h.t.Fatalf("Error evaluating plugin against %s: %v", bundlePath, err)
+	}
+	res.Logs = append(res.Logs, logs...)
+	return res
+}
+
+// Fixture is a run of a plugin: the config it is configured with, and the policy bundles it is evaluated against.
+type Fixture struct {
+	Config   map[string]string `json:"config"`
+	Policies []string          `json:"policies"`
+}
+
+// LoadFixture reads a Fixture from a JSON file. Policy bundle paths are relative to the test's package, like
+// the fixture's path.
+//
+//	{
+//		"config": {"region": "eu-west-1"},
+//		"policies": ["testdata/policies"]
+//	}
+func LoadFixture(t gotesting.TB, path string) Fixture {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading fixture: %v", err)
+	}
+	fixture := Fixture{}
+	if err := json.Unmarshal(content, &fixture); err != nil {
+		t.Fatalf("Error reading fixture %s: %v", path, err)
+	}
+	return fixture
+}
+
+// Run configures and prepares the plugin as the agent does for a run, then evaluates it against each of the
+// fixture's policy bundles, returning a response for each of them in order.
+func (h *Harness) Run(fixture Fixture) []*proto.EvalResponse {
+	h.t.Helper()
+	h.Configure(fixture.Config)
+	h.PrepareForEval()
+	results := []*proto.EvalResponse{}
+	for _, bundlePath := range fixture.Policies {
+		results = append(results, h.Eval(bundlePath))
+	}
+	return results
+}
@@ -0,0 +1,183 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	gotesting "testing"
+	"time"
+
+	"github.com/compliance-framework/framework/runner"
+	"github.com/compliance-framework/framework/runner/proto"
+	"github.com/google/uuid"
+)
+
+// sshPlugin is an example plugin, which evaluates the policies in its bundle with the host, and reports a
+// finding for each violation and a risk for each risk. The test policies are violated when it is configured
+// with violated set to yes.
+type sshPlugin struct {
+	violated string
+}
+
+func (p *sshPlugin) Configure(ctx context.Context, req *proto.ConfigureRequest) (*proto.ConfigureResponse, error) {
+	p.violated = req.Config["violated"]
+	return &proto.ConfigureResponse{}, nil
+}
+
+func (p *sshPlugin) PrepareForEval(ctx context.Context, req *proto.PrepareForEvalRequest) (*proto.PrepareForEvalResponse, error) {
+	return &proto.PrepareForEvalResponse{}, nil
+}
+
+func (p *sshPlugin) Eval(ctx context.Context, req *proto.EvalRequest) (*proto.EvalResponse, error) {
+	host := runner.HostFromContext(ctx)
+	if host == nil {
+		return nil, errors.New("no host services")
+	}
+	results, err := host.EvalPolicy(ctx, req.BundlePath, "local_ssh", map[string]interface{}{"violated": []string{p.violated}})
+	if err != nil {
+		return nil, err
+	}
+	previous, _, err := host.CacheGet(ctx, "runs")
+	if err != nil {
+		return nil, err
+	}
+	if err := host.CacheSet(ctx, "runs", append(previous, 'x'), time.Hour); err != nil {
+		return nil, err
+	}
+
+	res := runner.NewCallableEvalResponse()
+	res.Title = fmt.Sprintf("SSH checked, %d previous runs", len(previous))
+	res.Status = proto.ExecutionStatus_SUCCESS
+	for i, result := range results {
+		res.AddObservation(&proto.Observation{
+			Id:        uuid.New().String(),
+			Title:     result.Policy.Package.PurePackage(),
+			Collected: time.Now().Format(time.RFC3339),
+		})
+		for _, violation := range result.Violations {
+			res.AddFinding(&proto.Finding{Id: uuid.New().String(), Title: violation.Title})
+		}
+		for _, risk := range result.Risks {
+			res.AddRiskEntry(&proto.Risk{Title: risk.Title, Statement: risk.Statement})
+		}
+		if err := host.Progress(ctx, int64(i+1), int64(len(results)), "evaluated policy"); err != nil {
+			return nil, err
+		}
+	}
+	if err := host.Log(ctx, &proto.LogEntry{Title: "Evaluated policies"}); err != nil {
+		return nil, err
+	}
+	return res.Result(), nil
+}
+
+func TestHarness(t *gotesting.T) {
+	h := New(t, &sshPlugin{})
+	if info := h.Info(); info != nil {
+		t.Errorf("Expected no info from a plugin without Info, got %v", info)
+	}
+
+	fixture := LoadFixture(t, "testdata/fixture.json")
+	results := h.Run(fixture)
+	if len(results) != 1 {
+		t.Fatalf("Expected a result for each policy bundle, got %d", len(results))
+	}
+	res := results[0]
+	AssertSuccess(t, res)
+	AssertCounts(t, res, 1, 1, 2)
+	AssertFinding(t, res, "Violation 1")
+	if risk := AssertRisk(t, res, "Risk 2"); risk.Statement != "You should be worried" {
+		t.Errorf("Unexpected risk statement %q", risk.Statement)
+	}
+	AssertLog(t, res, "Evaluated policies")
+	AssertGolden(t, res, "testdata/ssh.golden.json")
+
+	if progress := h.Host.ProgressReports(); len(progress) != 1 || progress[0].Completed != 1 {
+		t.Errorf("Expected progress to be reported to the host, got %v", progress)
+	}
+
+	again := h.Eval(fixture.Policies[0])
+	if again.Title != "SSH checked, 1 previous runs" {
+		t.Errorf("Expected the cache to be kept between evaluations, got %q", again.Title)
+	}
+	if len(again.Logs) != 1 {
+		t.Errorf("Expected only the evaluation's own log entries, got %v", again.Logs)
+	}
+}
+
+func TestHarness_Errors(t *gotesting.T) {
+	h := New(t, &sshPlugin{})
+	h.Configure(map[string]string{"violated": "yes"})
+
+	// Like the agent, the host only evaluates the bundle being evaluated.
+	_, err := h.Runner.Eval(context.Background(), &proto.EvalRequest{BundlePath: "../../policy-manager/testdata"})
+	if err == nil || !strings.Contains(err.Error(), errNotEvaluating.Error()) {
+		t.Errorf("Expected the host to refuse to evaluate policies outside an evaluation, got %v", err)
+	}
+}
+
+func TestHarness_Legacy(t *gotesting.T) {
+	h := New(t, runner.FromLegacy(&legacyPlugin{}))
+	AssertStatus(t, h.Eval("bundle"), proto.ExecutionStatus_FAILURE)
+}
+
+type legacyPlugin struct{}
+
+func (p *legacyPlugin) Configure(req *proto.ConfigureRequest) (*proto.ConfigureResponse, error) {
+	return &proto.ConfigureResponse{}, nil
+}
+
+func (p *legacyPlugin) PrepareForEval(req *proto.PrepareForEvalRequest) (*proto.PrepareForEvalResponse, error) {
+	return &proto.PrepareForEvalResponse{}, nil
+}
+
+func (p *legacyPlugin) Eval(req *proto.EvalRequest) (*proto.EvalResponse, error) {
+	return &proto.EvalResponse{Status: proto.ExecutionStatus_FAILURE, Title: req.BundlePath}, nil
+}
+
+func TestSnapshot(t *gotesting.T) {
+	snapshot, err := Snapshot(&proto.EvalResponse{
+		Title: "result",
+		Observations: []*proto.Observation{{
+			Id:        "1f0b6c1e-3a5d-4a8e-9a57-3c1f2f4e8b90",
+			Collected: "2024-05-01T12:30:00.123+01:00",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `{
+  "Title": "result",
+  "Observations": [
+    {
+      "Id": "<uuid>",
+      "Collected": "<timestamp>"
+    }
+  ]
+}
+`
+	if string(snapshot) != want {
+		t.Errorf("Unexpected snapshot:\n%s", snapshot)
+	}
+}
+
+func TestFakeHost_Cache(t *gotesting.T) {
+	h := NewFakeHost()
+	now := time.Now()
+	h.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := h.CacheSet(ctx, "key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value, found, _ := h.CacheGet(ctx, "key"); !found || string(value) != "value" {
+		t.Errorf("Expected the cached value, got %q", value)
+	}
+	now = now.Add(time.Minute)
+	if _, found, _ := h.CacheGet(ctx, "key"); found {
+		t.Errorf("Expected the value to expire after its TTL")
+	}
+	if err := h.CacheSet(ctx, "key", nil, -time.Second); err == nil {
+		t.Errorf("Expected an error for a negative TTL")
+	}
+}
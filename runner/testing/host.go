@@ -0,0 +1,151 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	policy_manager "github.com/compliance-framework/framework/policy-manager"
+	"github.com/compliance-framework/framework/runner/proto"
+	"github.com/hashicorp/go-hclog"
+)
+
+// errNotEvaluating is returned when a plugin asks to evaluate a policy bundle outside an evaluation of it, as
+// the agent refuses to.
+var errNotEvaluating = errors.New("only the policy bundle being evaluated can be evaluated by the host")
+
+// ProgressReport is a report of progress by a plugin, through the host's Progress.
+type ProgressReport struct {
+	Completed int64
+	Total     int64
+	Message   string
+}
+
+// FakeHost is an in-memory fake of the agent's host services. Policies are evaluated with the agent's policy
+// manager, and, like the agent, only the bundle being evaluated can be. The cache only lasts as long as the
+// FakeHost, and can be seeded with CacheSet before running the plugin.
+//
+// It is safe for concurrent use.
+type FakeHost struct {
+	now func() time.Time
+
+	mu sync.Mutex
+	// bundlePath is the policy bundle being evaluated, if there is one.
+	bundlePath string
+	evalLogs   []*proto.LogEntry
+	logs       []*proto.LogEntry
+	progress   []ProgressReport
+	cache      map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewFakeHost returns a FakeHost with an empty cache.
+func NewFakeHost() *FakeHost {
+	return &FakeHost{now: time.Now, cache: map[string]cacheEntry{}}
+}
+
+// beginEval starts the evaluation of a policy bundle, which the plugin's logs are part of until endEval.
+func (h *FakeHost) beginEval(bundlePath string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.bundlePath = bundlePath
+	h.evalLogs = nil
+}
+
+// endEval ends the evaluation in progress, returning the entries the plugin logged during it.
+func (h *FakeHost) endEval() []*proto.LogEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	logs := h.evalLogs
+	h.bundlePath = ""
+	h.evalLogs = nil
+	return logs
+}
+
+// Logs returns every entry the plugin has logged, including those outside an evaluation.
+func (h *FakeHost) Logs() []*proto.LogEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*proto.LogEntry{}, h.logs...)
+}
+
+// ProgressReports returns each report of progress by the plugin, in order.
+func (h *FakeHost) ProgressReports() []ProgressReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]ProgressReport{}, h.progress...)
+}
+
+func (h *FakeHost) EvalPolicy(ctx context.Context, bundlePath string, namespace string, input map[string]interface{}) ([]policy_manager.Result, error) {
+	h.mu.Lock()
+	evaluating := h.bundlePath != "" && h.bundlePath == bundlePath
+	h.mu.Unlock()
+	if !evaluating {
+		return nil, errNotEvaluating
+	}
+	return policy_manager.New(ctx, hclog.NewNullLogger(), bundlePath).Execute(ctx, namespace, input)
+}
+
+func (h *FakeHost) Log(ctx context.Context, entry *proto.LogEntry) error {
+	if entry == nil {
+		return errors.New("no log entry")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logs = append(h.logs, entry)
+	if h.bundlePath != "" {
+		h.evalLogs = append(h.evalLogs, entry)
+	}
+	return nil
+}
+
+func (h *FakeHost) CacheGet(ctx context.Context, key string) ([]byte, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry, ok := h.cache[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && !h.now().Before(entry.expires) {
+		delete(h.cache, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (h *FakeHost) CacheSet(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("ttl cannot be negative: %s", ttl)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry := cacheEntry{value: append([]byte{}, value...)}
+	if ttl > 0 {
+		entry.expires = h.now().Add(ttl)
+	}
+	h.cache[key] = entry
+	return nil
+}
+
+func (h *FakeHost) CacheDelete(ctx context.Context, key string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.cache, key)
+	return nil
+}
+
+func (h *FakeHost) Progress(ctx context.Context, completed int64, total int64, message string) error {
+	if completed < 0 || total < 0 {
+		return fmt.Errorf("progress cannot be negative: %d of %d", completed, total)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.progress = append(h.progress, ProgressReport{Completed: completed, Total: total, Message: message})
+	return nil
+}
@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/compliance-framework/framework/domain"
+	"github.com/compliance-framework/framework/event"
+	"github.com/compliance-framework/framework/service"
+)
+
+// AgentProcessor stores the registrations and heartbeats published by agents.
+type AgentProcessor struct {
+	agentService *service.AgentService
+	sub          event.Subscriber[event.AgentEvent]
+}
+
+func NewAgentProcessor(s event.Subscriber[event.AgentEvent], agentService *service.AgentService) *AgentProcessor {
+	return &AgentProcessor{
+		sub:          s,
+		agentService: agentService,
+	}
+}
+
+func (p *AgentProcessor) Listen() {
+	ch, err := p.sub(event.TopicTypeAgent)
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		for msg := range ch {
+			agent := msg.Agent
+			if agent.Id == "" {
+				log.Printf("Ignoring agent %s event without an id", msg.Type)
+				continue
+			}
+
+			// Heartbeats are timed by the API rather than the agent, so clock skew doesn't make agents stale.
+			agent.LastHeartbeat = time.Now()
+			agent.RegisteredAt = time.Time{}
+			if msg.Type == event.AgentEventStopped {
+				agent.Status = domain.AgentStatusStopped
+			} else {
+				agent.Status = domain.AgentStatusRunning
+			}
+
+			if err := p.agentService.Save(context.Background(), &agent); err != nil {
+				log.Printf("Error saving agent %s: %v", agent.Id, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,106 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/compliance-framework/framework/runner"
+	"github.com/google/uuid"
+)
+
+// resultChunkTimeout is how long the chunks of a result are held waiting for the rest, before they are dropped.
+const resultChunkTimeout = time.Hour
+
+// pendingResult is a result whose chunks are still being received.
+type pendingResult struct {
+	run      string
+	chunks   int
+	result   ExecutionResult
+	received time.Time
+}
+
+// resultChunks assembles the results agents publish in chunks back into a single result, so only complete
+// results are stored, and the latest result of a stream is the whole of it.
+//
+// The chunks of a result are published in order on the result's stream. Chunks are dropped if any before them
+// are missing, and when a different result is received on the stream, such as the failure of the evaluation
+// they are part of.
+type resultChunks struct {
+	pending map[uuid.UUID]*pendingResult
+	now     func() time.Time
+}
+
+func newResultChunks() *resultChunks {
+	return &resultChunks{
+		pending: map[uuid.UUID]*pendingResult{},
+		now:     time.Now,
+	}
+}
+
+// add receives msg, returning the complete result and true if it completes one. Results which weren't
+// published in chunks are complete.
+func (c *resultChunks) add(msg ExecutionResult) (ExecutionResult, bool) {
+	now := c.now()
+	for streamId, pending := range c.pending {
+		if now.Sub(pending.received) > resultChunkTimeout {
+			fmt.Printf("Dropping incomplete result on stream %s, after %d chunks\n", streamId, pending.chunks)
+			delete(c.pending, streamId)
+		}
+	}
+
+	chunk, chunked := msg.Labels[runner.LabelChunk]
+	if !chunked {
+		c.drop(msg.StreamId)
+		return msg, true
+	}
+
+	number, _ := strconv.Atoi(chunk)
+	pending := c.pending[msg.StreamId]
+	if pending == nil || pending.run != msg.Labels[runner.LabelChunkRun] {
+		c.drop(msg.StreamId)
+		if number != 1 {
+			fmt.Printf("Dropping chunk %d of result on stream %s, as earlier chunks are missing\n", number, msg.StreamId)
+			return ExecutionResult{}, false
+		}
+		pending = &pendingResult{run: msg.Labels[runner.LabelChunkRun], result: msg}
+		c.pending[msg.StreamId] = pending
+	} else if number != pending.chunks+1 {
+		fmt.Printf("Dropping result on stream %s, as chunk %d was received after chunk %d\n", msg.StreamId, number, pending.chunks)
+		delete(c.pending, msg.StreamId)
+		return ExecutionResult{}, false
+	} else {
+		pending.result.Observations = append(pending.result.Observations, msg.Observations...)
+		pending.result.Findings = append(pending.result.Findings, msg.Findings...)
+		pending.result.Risks = append(pending.result.Risks, msg.Risks...)
+		pending.result.Logs = append(pending.result.Logs, msg.Logs...)
+	}
+	pending.chunks = number
+	pending.received = now
+
+	if _, last := msg.Labels[runner.LabelChunks]; !last {
+		return ExecutionResult{}, false
+	}
+	delete(c.pending, msg.StreamId)
+
+	// The last chunk has the result's title, status and labels.
+	result := pending.result
+	result.Title = msg.Title
+	result.Status = msg.Status
+	result.Error = msg.Error
+	result.Labels = map[string]string{}
+	for key, value := range msg.Labels {
+		if key != runner.LabelChunk && key != runner.LabelChunkRun {
+			result.Labels[key] = value
+		}
+	}
+	return result, true
+}
+
+// drop drops any incomplete result on a stream.
+func (c *resultChunks) drop(streamId uuid.UUID) {
+	if pending, ok := c.pending[streamId]; ok {
+		fmt.Printf("Dropping incomplete result on stream %s, after %d chunks\n", streamId, pending.chunks)
+		delete(c.pending, streamId)
+	}
+}
@@ -0,0 +1,106 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// chunk returns a chunk of a result on stream, with an observation titled title.
+func chunk(stream uuid.UUID, run string, number string, last bool, title string) ExecutionResult {
+	labels := map[string]string{"_policy": "policy", "_chunk": number, "_chunk_run": run}
+	if last {
+		labels["_chunks"] = number
+	}
+	return ExecutionResult{
+		StreamId:     stream,
+		Status:       ExecutionStatusPartial,
+		Labels:       labels,
+		Observations: []Observation{{Title: title}},
+	}
+}
+
+func TestResultChunks(t *testing.T) {
+	stream := uuid.New()
+
+	t.Run("Chunks are assembled into a single result", func(t *testing.T) {
+		c := newResultChunks()
+		if _, complete := c.add(chunk(stream, "run", "1", false, "first")); complete {
+			t.Fatalf("Expected the first chunk to be held")
+		}
+		if _, complete := c.add(chunk(stream, "run", "2", false, "second")); complete {
+			t.Fatalf("Expected the second chunk to be held")
+		}
+		last := chunk(stream, "run", "3", true, "third")
+		last.Title = "result"
+		last.Status = ExecutionStatusFailure
+		result, complete := c.add(last)
+		if !complete {
+			t.Fatalf("Expected the last chunk to complete the result")
+		}
+
+		if len(result.Observations) != 3 || result.Observations[0].Title != "first" || result.Observations[2].Title != "third" {
+			t.Errorf("Expected the observations of every chunk in order, got %v", result.Observations)
+		}
+		if result.Title != "result" || result.Status != ExecutionStatusFailure {
+			t.Errorf("Expected the title and status of the last chunk, got %q and %d", result.Title, result.Status)
+		}
+		if _, ok := result.Labels["_chunk"]; ok || result.Labels["_chunks"] != "3" || result.Labels["_policy"] != "policy" {
+			t.Errorf("Expected the labels of the result, got %v", result.Labels)
+		}
+		if len(c.pending) != 0 {
+			t.Errorf("Expected no chunks to be held once the result is complete")
+		}
+	})
+
+	t.Run("Results which weren't chunked are complete", func(t *testing.T) {
+		c := newResultChunks()
+		c.add(chunk(stream, "run", "1", false, "first"))
+
+		// Such as the failure of the evaluation the chunks are part of.
+		failure := ExecutionResult{StreamId: stream, Status: ExecutionStatusFailure}
+		result, complete := c.add(failure)
+		if !complete || len(result.Observations) != 0 {
+			t.Errorf("Expected the result as it is, got %v", result)
+		}
+		if len(c.pending) != 0 {
+			t.Errorf("Expected the incomplete result on the stream to be dropped")
+		}
+	})
+
+	t.Run("Incomplete results are dropped", func(t *testing.T) {
+		c := newResultChunks()
+		c.add(chunk(stream, "failed", "1", false, "failed"))
+		c.add(chunk(stream, "retry", "1", false, "first"))
+		result, complete := c.add(chunk(stream, "retry", "2", true, "second"))
+		if !complete || len(result.Observations) != 2 || result.Observations[0].Title != "first" {
+			t.Errorf("Expected only the chunks of the latest run, got %v", result.Observations)
+		}
+
+		if _, complete := c.add(chunk(stream, "missing", "2", true, "second")); complete {
+			t.Errorf("Expected a result missing its first chunk to be dropped")
+		}
+
+		c.add(chunk(stream, "skipped", "1", false, "first"))
+		if _, complete := c.add(chunk(stream, "skipped", "3", true, "third")); complete {
+			t.Errorf("Expected a result missing a chunk to be dropped")
+		}
+		if len(c.pending) != 0 {
+			t.Errorf("Expected no chunks to be held, got %d", len(c.pending))
+		}
+	})
+
+	t.Run("Chunks expire", func(t *testing.T) {
+		c := newResultChunks()
+		now := time.Now()
+		c.now = func() time.Time { return now }
+		c.add(chunk(stream, "run", "1", false, "first"))
+
+		now = now.Add(resultChunkTimeout + time.Minute)
+		c.add(ExecutionResult{StreamId: uuid.New()})
+		if len(c.pending) != 0 {
+			t.Errorf("Expected chunks held longer than %s to be dropped", resultChunkTimeout)
+		}
+	})
+}
@@ -1,23 +1,27 @@
 package runtime
 
 import (
-	"context"
 	"fmt"
 	"time"
 
 	"github.com/compliance-framework/framework/domain"
 	"github.com/compliance-framework/framework/event"
+	"github.com/compliance-framework/framework/internal/telemetry"
 	"github.com/compliance-framework/framework/service"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = telemetry.Tracer("github.com/compliance-framework/framework/runtime")
+
 type Processor struct {
 	planService   *service.PlanService
 	resultService *service.ResultsService
-	sub           event.Subscriber[ExecutionResult]
+	sub           event.ContextSubscriber[ExecutionResult]
 }
 
-func NewProcessor(s event.Subscriber[ExecutionResult], planService *service.PlanService, resultService *service.ResultsService) *Processor {
+func NewProcessor(s event.ContextSubscriber[ExecutionResult], planService *service.PlanService, resultService *service.ResultsService) *Processor {
 	return &Processor{
 		sub:           s,
 		planService:   planService,
@@ -33,9 +37,22 @@ func (r *Processor) Listen() {
 	}
 
 	go func() {
-		for msg := range ch {
+		chunks := newResultChunks()
+		for received := range ch {
+			msg := received.Data
 			fmt.Printf("Received message: %v\n", msg)
 
+			// Results published in chunks are only stored once they are complete.
+			msg, complete := chunks.add(msg)
+			if !complete {
+				continue
+			}
+
+			// The result is processed as part of the trace it was published in by the agent.
+			ctx, span := tracer.Start(received.Context, "process result", trace.WithAttributes(
+				attribute.String("cf.stream_id", msg.StreamId.String()),
+			))
+
 			// TODO: Create an actor for the runtime that publishes the events to store it as the origin
 			// TODO: Handle execution status
 
@@ -52,6 +69,7 @@ func (r *Processor) Listen() {
 
 			err := r.planService.SaveSubject(subject)
 			if err != nil {
+				telemetry.EndSpan(span, err)
 				return
 			}
 
@@ -92,10 +110,10 @@ func (r *Processor) Listen() {
 					Statement:   r.Statement,
 					Props:       r.Props,
 					Links:       r.Links,
-					// TODO. Seems we're only relating the first observation here.
-					RelatedObservations: []primitive.ObjectID{
-						observations[0].Id,
-					},
+				}
+				// TODO. Seems we're only relating the first observation here.
+				if len(observations) > 0 {
+					risks[i].RelatedObservations = []primitive.ObjectID{observations[0].Id}
 				}
 			}
 
@@ -143,7 +161,8 @@ func (r *Processor) Listen() {
 
 			fmt.Printf("Plumbed message: %v\n", msg)
 
-			err = r.resultService.Create(context.TODO(), &result)
+			err = r.resultService.Create(ctx, &result)
+			telemetry.EndSpan(span, err)
 			if err != nil {
 				return
 			}
@@ -13,6 +13,10 @@ type LogType int
 const (
 	ExecutionStatusSuccess ExecutionStatus = iota
 	ExecutionStatusFailure
+	// ExecutionStatusUnavailable is reported when an agent has paused a plugin after it failed repeatedly.
+	ExecutionStatusUnavailable
+	// ExecutionStatusPartial is reported on each chunk of a chunked result but the last, which has the result's status.
+	ExecutionStatusPartial
 )
 
 // ExecutionResult holds the result of an compliance check execution for each subject.
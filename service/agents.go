@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/compliance-framework/framework/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrAgentNotFound = errors.New("agent not found")
+
+type AgentService struct {
+	agentsCollection *mongo.Collection
+}
+
+func NewAgentService(db *mongo.Database) *AgentService {
+	return &AgentService{
+		agentsCollection: db.Collection("agents"),
+	}
+}
+
+// Save stores the latest state of an agent, registering it if it hasn't been seen before.
+// RegisteredAt is only set when the agent is first stored.
+func (s *AgentService) Save(ctx context.Context, agent *domain.Agent) error {
+	data, err := bson.Marshal(agent)
+	if err != nil {
+		return err
+	}
+	fields := bson.M{}
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	delete(fields, "_id")
+	delete(fields, "registeredAt")
+
+	registeredAt := agent.RegisteredAt
+	if registeredAt.IsZero() {
+		registeredAt = agent.LastHeartbeat
+	}
+
+	_, err = s.agentsCollection.UpdateOne(ctx, bson.M{"_id": agent.Id}, bson.M{
+		"$set":         fields,
+		"$setOnInsert": bson.M{"registeredAt": registeredAt},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+// Get returns the agent with the given id, flagged as stale if its heartbeats have stopped.
+func (s *AgentService) Get(ctx context.Context, id string) (*domain.Agent, error) {
+	var agent domain.Agent
+	err := s.agentsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&agent)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAgentNotFound
+		}
+		return nil, err
+	}
+
+	agent.Stale = agent.IsStale(time.Now())
+	return &agent, nil
+}
+
+// List returns every agent which has registered, sorted by id, flagged as stale if their heartbeats have stopped.
+func (s *AgentService) List(ctx context.Context) ([]*domain.Agent, error) {
+	cursor, err := s.agentsCollection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	agents := []*domain.Agent{}
+	if err := cursor.All(ctx, &agents); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, agent := range agents {
+		agent.Stale = agent.IsStale(now)
+	}
+	return agents, nil
+}
@@ -0,0 +1,87 @@
+//go:build integration
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/compliance-framework/framework/domain"
+	"github.com/compliance-framework/framework/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAgents(t *testing.T) {
+	suite.Run(t, new(AgentIntegrationSuite))
+}
+
+type AgentIntegrationSuite struct {
+	tests.IntegrationTestSuite
+}
+
+func (suite *AgentIntegrationSuite) TestSaveAgent() {
+	ctx := context.Background()
+	agentService := NewAgentService(suite.MongoDatabase)
+
+	suite.Run("An agent keeps its registration time across heartbeats", func() {
+		_, err := suite.MongoDatabase.Collection("agents").DeleteMany(ctx, bson.M{})
+		assert.NoError(suite.T(), err)
+
+		registered := time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+		agent := &domain.Agent{
+			Id:            "web-01",
+			Version:       "v1.0.0",
+			Status:        domain.AgentStatusRunning,
+			LastHeartbeat: registered,
+			Plugins: []domain.AgentPlugin{
+				{Name: "local-ssh", Source: "ghcr.io/compliance-framework/plugin-local-ssh:v1"},
+			},
+		}
+		assert.NoError(suite.T(), agentService.Save(ctx, agent))
+
+		agent.Version = "v1.1.0"
+		agent.LastHeartbeat = time.Now().UTC()
+		assert.NoError(suite.T(), agentService.Save(ctx, agent))
+
+		saved, err := agentService.Get(ctx, "web-01")
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "v1.1.0", saved.Version)
+		assert.Equal(suite.T(), registered, saved.RegisteredAt.UTC())
+		assert.Len(suite.T(), saved.Plugins, 1)
+		assert.False(suite.T(), saved.Stale)
+	})
+
+	suite.Run("An agent is stale once its heartbeats stop", func() {
+		_, err := suite.MongoDatabase.Collection("agents").DeleteMany(ctx, bson.M{})
+		assert.NoError(suite.T(), err)
+
+		last := time.Now().Add(-time.Hour)
+		assert.NoError(suite.T(), agentService.Save(ctx, &domain.Agent{
+			Id:                "running",
+			Status:            domain.AgentStatusRunning,
+			HeartbeatInterval: time.Minute,
+			LastHeartbeat:     last,
+		}))
+		assert.NoError(suite.T(), agentService.Save(ctx, &domain.Agent{
+			Id:                "stopped",
+			Status:            domain.AgentStatusStopped,
+			HeartbeatInterval: time.Minute,
+			LastHeartbeat:     last,
+		}))
+
+		agents, err := agentService.List(ctx)
+		assert.NoError(suite.T(), err)
+		assert.Len(suite.T(), agents, 2)
+		assert.Equal(suite.T(), "running", agents[0].Id)
+		assert.True(suite.T(), agents[0].Stale)
+		assert.False(suite.T(), agents[1].Stale, "A stopped agent should not be stale")
+	})
+
+	suite.Run("An unknown agent is not found", func() {
+		_, err := agentService.Get(ctx, "unknown")
+		assert.ErrorIs(suite.T(), err, ErrAgentNotFound)
+	})
+}
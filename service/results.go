@@ -5,6 +5,7 @@ import (
 	"errors"
 	"github.com/compliance-framework/framework/converters/labelfilter"
 	"github.com/compliance-framework/framework/domain"
+	"github.com/compliance-framework/framework/internal/telemetry"
 	"github.com/google/uuid"
 	bson "go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -64,6 +65,8 @@ func (sr *StreamRecords) FillGaps(ctx context.Context, duration time.Duration) {
 	}
 }
 
+var tracer = telemetry.Tracer("github.com/compliance-framework/framework/service")
+
 type ResultsService struct {
 	resultsCollection *mongo.Collection
 }
@@ -74,7 +77,10 @@ func NewResultsService(db *mongo.Database) *ResultsService {
 	}
 }
 
-func (s *ResultsService) Create(ctx context.Context, result *domain.Result) error {
+func (s *ResultsService) Create(ctx context.Context, result *domain.Result) (err error) {
+	ctx, span := tracer.Start(ctx, "create result")
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	output, err := s.resultsCollection.InsertOne(ctx, result)
 	if err != nil {
 		return err